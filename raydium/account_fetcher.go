@@ -0,0 +1,111 @@
+package raydium
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+var ErrAccountNotFound = errors.New("account not found")
+
+// AccountFetcher is the part of the Solana RPC API the package reads chain
+// state through. GetMultipleAccounts returns nil for missing accounts, in the
+// order of the keys; GetAccountInfo returns ErrAccountNotFound instead.
+// GetTokenAccountsByOwner returns the accounts of token program programId
+// held by owner.
+type AccountFetcher interface {
+	GetAccountInfo(ctx context.Context, account solana.PublicKey) (*rpc.Account, error)
+	GetMultipleAccounts(ctx context.Context, accounts []solana.PublicKey) ([]*rpc.Account, error)
+	GetProgramAccounts(ctx context.Context, programId solana.PublicKey, filters []rpc.RPCFilter) (rpc.GetProgramAccountsResult, error)
+	GetTokenAccountsByOwner(ctx context.Context, owner, programId solana.PublicKey) (rpc.GetProgramAccountsResult, error)
+	SimulateTransaction(ctx context.Context, tx *solana.Transaction) (*rpc.SimulateTransactionResult, error)
+}
+
+// RpcAccountFetcher is an AccountFetcher backed by a JSON-RPC node.
+type RpcAccountFetcher struct {
+	client *rpc.Client
+	slot   atomic.Uint64
+}
+
+func NewRpcAccountFetcher(client *rpc.Client) *RpcAccountFetcher {
+	return &RpcAccountFetcher{client: client}
+}
+
+func (f *RpcAccountFetcher) GetAccountInfo(ctx context.Context, account solana.PublicKey) (*rpc.Account, error) {
+	result, err := f.client.GetAccountInfoWithOpts(ctx, account, &rpc.GetAccountInfoOpts{
+		Encoding: solana.EncodingBase64,
+	})
+	if errors.Is(err, rpc.ErrNotFound) {
+		return nil, ErrAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.observeSlot(result.Context.Slot)
+	return result.Value, nil
+}
+
+func (f *RpcAccountFetcher) GetMultipleAccounts(ctx context.Context, accounts []solana.PublicKey) ([]*rpc.Account, error) {
+	result, err := f.client.GetMultipleAccountsWithOpts(ctx, accounts, &rpc.GetMultipleAccountsOpts{
+		Encoding: solana.EncodingBase64,
+	})
+	if err != nil {
+		return nil, err
+	}
+	f.observeSlot(result.Context.Slot)
+	return result.Value, nil
+}
+
+func (f *RpcAccountFetcher) GetProgramAccounts(ctx context.Context, programId solana.PublicKey, filters []rpc.RPCFilter) (rpc.GetProgramAccountsResult, error) {
+	return f.client.GetProgramAccountsWithOpts(ctx, programId, &rpc.GetProgramAccountsOpts{
+		Encoding: solana.EncodingBase64,
+		Filters:  filters,
+	})
+}
+
+func (f *RpcAccountFetcher) GetTokenAccountsByOwner(ctx context.Context, owner, programId solana.PublicKey) (rpc.GetProgramAccountsResult, error) {
+	result, err := f.client.GetTokenAccountsByOwner(ctx, owner, &rpc.GetTokenAccountsConfig{ProgramId: &programId}, &rpc.GetTokenAccountsOpts{
+		Encoding: solana.EncodingBase64,
+	})
+	if err != nil {
+		return nil, err
+	}
+	f.observeSlot(result.Context.Slot)
+	accounts := make(rpc.GetProgramAccountsResult, 0, len(result.Value))
+	for _, tokenAccount := range result.Value {
+		account := tokenAccount.Account
+		accounts = append(accounts, &rpc.KeyedAccount{Pubkey: tokenAccount.Pubkey, Account: &account})
+	}
+	return accounts, nil
+}
+
+// SimulateTransaction lets the node replace the blockhash and skips signature
+// verification, so tx may carry placeholder signatures.
+func (f *RpcAccountFetcher) SimulateTransaction(ctx context.Context, tx *solana.Transaction) (*rpc.SimulateTransactionResult, error) {
+	result, err := f.client.SimulateTransactionWithOpts(ctx, tx, &rpc.SimulateTransactionOpts{
+		ReplaceRecentBlockhash: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	f.observeSlot(result.Context.Slot)
+	return result.Value, nil
+}
+
+// Slot is the highest context slot among the responses received so far.
+// getProgramAccounts responses carry none.
+func (f *RpcAccountFetcher) Slot() uint64 {
+	return f.slot.Load()
+}
+
+func (f *RpcAccountFetcher) observeSlot(slot uint64) {
+	for {
+		current := f.slot.Load()
+		if slot <= current || f.slot.CompareAndSwap(current, slot) {
+			return
+		}
+	}
+}
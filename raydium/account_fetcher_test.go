@@ -0,0 +1,319 @@
+package raydium
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+func testPublicKey(name string) solana.PublicKey {
+	hash := sha256.Sum256([]byte(name))
+	return solana.PublicKeyFromBytes(hash[:])
+}
+
+// mustMarshal encodes a layout as account data.
+func mustMarshal(tb testing.TB, layout interface{ MarshalBinary() ([]byte, error) }) []byte {
+	tb.Helper()
+	data, err := layout.MarshalBinary()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return data
+}
+
+// stubBlockTime is the block time newStubRpcServer reports for slot.
+func stubBlockTime(slot int64) int64 {
+	return 1_600_000_000 + slot
+}
+
+type stubAccount struct {
+	owner solana.PublicKey
+	data  []byte
+}
+
+// newTestFetcher serves accounts and answers simulations with logs, or with
+// an instruction error when logs is nil.
+func newTestFetcher(accounts map[solana.PublicKey]stubAccount, logs []string) *FakeAccountFetcher {
+	fetcher := NewFakeAccountFetcher()
+	for key, account := range accounts {
+		fetcher.SetAccount(key, account.owner, account.data)
+	}
+	fetcher.Simulate = func(tx *solana.Transaction) (*rpc.SimulateTransactionResult, error) {
+		if logs == nil {
+			return &rpc.SimulateTransactionResult{Err: "InstructionError"}, nil
+		}
+		return &rpc.SimulateTransactionResult{Logs: logs}, nil
+	}
+	return fetcher
+}
+
+// newStubRpcServer exposes fetcher over JSON-RPC, with getBlockTime answered
+// by stubBlockTime, so code can run against a real rpc.Client.
+func newStubRpcServer(t *testing.T, fetcher *FakeAccountFetcher) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Id     json.RawMessage   `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Error(err)
+			return
+		}
+		withContext := func(value any) any {
+			return map[string]any{"context": map[string]any{"slot": 1}, "value": value}
+		}
+
+		var result any
+		var err error
+		switch request.Method {
+		case "getAccountInfo":
+			var key solana.PublicKey
+			if err = json.Unmarshal(request.Params[0], &key); err != nil {
+				break
+			}
+			var account *rpc.Account
+			if account, err = fetcher.GetAccountInfo(r.Context(), key); errors.Is(err, ErrAccountNotFound) {
+				err = nil
+			}
+			result = withContext(account)
+		case "getMultipleAccounts":
+			var keys []solana.PublicKey
+			if err = json.Unmarshal(request.Params[0], &keys); err != nil {
+				break
+			}
+			var accounts []*rpc.Account
+			accounts, err = fetcher.GetMultipleAccounts(r.Context(), keys)
+			result = withContext(accounts)
+		case "getProgramAccounts":
+			var programId solana.PublicKey
+			var opts struct {
+				Filters []rpc.RPCFilter `json:"filters"`
+			}
+			if err = json.Unmarshal(request.Params[0], &programId); err != nil {
+				break
+			}
+			if err = json.Unmarshal(request.Params[1], &opts); err != nil {
+				break
+			}
+			result, err = fetcher.GetProgramAccounts(r.Context(), programId, opts.Filters)
+		case "getTokenAccountsByOwner":
+			var owner solana.PublicKey
+			var conf struct {
+				ProgramId solana.PublicKey `json:"programId"`
+			}
+			if err = json.Unmarshal(request.Params[0], &owner); err != nil {
+				break
+			}
+			if err = json.Unmarshal(request.Params[1], &conf); err != nil {
+				break
+			}
+			var accounts rpc.GetProgramAccountsResult
+			accounts, err = fetcher.GetTokenAccountsByOwner(r.Context(), owner, conf.ProgramId)
+			result = withContext(accounts)
+		case "getBlockTime":
+			var slot int64
+			err = json.Unmarshal(request.Params[0], &slot)
+			result = stubBlockTime(slot)
+		case "simulateTransaction":
+			var encoded string
+			if err = json.Unmarshal(request.Params[0], &encoded); err != nil {
+				break
+			}
+			var data []byte
+			if data, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+				break
+			}
+			var tx *solana.Transaction
+			if tx, err = solana.TransactionFromDecoder(bin.NewBinDecoder(data)); err != nil {
+				break
+			}
+			var simulation *rpc.SimulateTransactionResult
+			simulation, err = fetcher.SimulateTransaction(r.Context(), tx)
+			result = withContext(simulation)
+		default:
+			t.Errorf("unexpected method %s", request.Method)
+			return
+		}
+		if err != nil {
+			t.Errorf("%s: %v", request.Method, err)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": request.Id, "result": result})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFakeAccountFetcherFilters(t *testing.T) {
+	programId := testPublicKey("program")
+	fetcher := NewFakeAccountFetcher()
+	fetcher.SetAccount(testPublicKey("a"), programId, []byte{1, 2, 3, 4})
+	fetcher.SetAccount(testPublicKey("b"), programId, []byte{1, 2, 9, 9})
+	fetcher.SetAccount(testPublicKey("c"), programId, []byte{1, 2, 3})
+	fetcher.SetAccount(testPublicKey("d"), testPublicKey("other program"), []byte{1, 2, 3, 4})
+
+	cases := []struct {
+		name    string
+		filters []rpc.RPCFilter
+		want    []solana.PublicKey
+	}{
+		{"no filter", nil, []solana.PublicKey{testPublicKey("a"), testPublicKey("b"), testPublicKey("c")}},
+		{"data size", []rpc.RPCFilter{{DataSize: 4}}, []solana.PublicKey{testPublicKey("a"), testPublicKey("b")}},
+		{"memcmp", []rpc.RPCFilter{{Memcmp: &rpc.RPCFilterMemcmp{Offset: 2, Bytes: []byte{3}}}}, []solana.PublicKey{testPublicKey("a"), testPublicKey("c")}},
+		{"memcmp past the end", []rpc.RPCFilter{{Memcmp: &rpc.RPCFilterMemcmp{Offset: 3, Bytes: []byte{4}}}}, []solana.PublicKey{testPublicKey("a")}},
+		{"both", []rpc.RPCFilter{{DataSize: 4}, {Memcmp: &rpc.RPCFilterMemcmp{Offset: 2, Bytes: []byte{3}}}}, []solana.PublicKey{testPublicKey("a")}},
+	}
+	for _, c := range cases {
+		result, err := fetcher.GetProgramAccounts(context.Background(), programId, c.filters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[solana.PublicKey]bool)
+		for _, keyedAccount := range result {
+			got[keyedAccount.Pubkey] = true
+		}
+		if len(got) != len(c.want) {
+			t.Errorf("%s: got %d accounts, want %d", c.name, len(got), len(c.want))
+		}
+		for _, key := range c.want {
+			if !got[key] {
+				t.Errorf("%s: missing %v", c.name, key)
+			}
+		}
+	}
+
+	// Callers may not alter the stored data.
+	account, err := fetcher.GetAccountInfo(context.Background(), testPublicKey("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	account.Data.GetBinary()[0] = 7
+	if account, _ = fetcher.GetAccountInfo(context.Background(), testPublicKey("a")); account.Data.GetBinary()[0] != 1 {
+		t.Error("stored account was modified through a returned copy")
+	}
+}
+
+func TestRpcAccountFetcherMatchesFake(t *testing.T) {
+	programId := testPublicKey("program")
+	fake := newTestFetcher(map[solana.PublicKey]stubAccount{
+		testPublicKey("a"): {programId, []byte{1, 2, 3, 4}},
+		testPublicKey("b"): {programId, []byte{5, 6}},
+	}, []string{"Program log: hello"})
+	fetcher := NewRpcAccountFetcher(rpc.New(newStubRpcServer(t, fake).URL))
+	ctx := context.Background()
+
+	account, err := fetcher.GetAccountInfo(ctx, testPublicKey("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !account.Owner.Equals(programId) || string(account.Data.GetBinary()) != string([]byte{1, 2, 3, 4}) {
+		t.Errorf("got %+v", account)
+	}
+	if _, err := fetcher.GetAccountInfo(ctx, testPublicKey("missing")); !errors.Is(err, ErrAccountNotFound) {
+		t.Errorf("missing account: got %v, want ErrAccountNotFound", err)
+	}
+
+	accounts, err := fetcher.GetMultipleAccounts(ctx, []solana.PublicKey{testPublicKey("b"), testPublicKey("missing")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 2 || accounts[0] == nil || accounts[1] != nil {
+		t.Errorf("got %v", accounts)
+	}
+
+	programAccounts, err := fetcher.GetProgramAccounts(ctx, programId, []rpc.RPCFilter{{DataSize: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(programAccounts) != 1 || !programAccounts[0].Pubkey.Equals(testPublicKey("b")) {
+		t.Errorf("got %v", programAccounts)
+	}
+
+	tx, err := solana.NewTransaction([]solana.Instruction{solana.NewInstruction(programId, solana.AccountMetaSlice{solana.Meta(testPublicKey("a"))}, []byte{AMM_INSTRUCTION_SIMULATE_INFO, 0})}, solana.Hash{}, solana.TransactionPayer(AMM_SIMULATE_PAYER))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Signatures = append(tx.Signatures, solana.Signature{})
+	simulation, err := fetcher.SimulateTransaction(ctx, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if simulation.Err != nil || len(simulation.Logs) != 1 {
+		t.Errorf("got %+v", simulation)
+	}
+}
+
+func TestFetchTokenAccounts(t *testing.T) {
+	wallet := testPublicKey("wallet")
+	// A Token-2022 mint whose bytes at the owner offset match the wallet.
+	mint := mustMarshal(t, &SplMint{IsInitialized: 1, Extensions: MintExtensions{NonTransferable: true}})
+	copy(mint[32:], wallet[:])
+	fake := newTestFetcher(map[solana.PublicKey]stubAccount{
+		testPublicKey("token account"):      {TOKEN_PROGRAM_ID, mustMarshal(t, &SplAccount{Mint: testPublicKey("usdc"), Owner: wallet, Amount: 5})},
+		testPublicKey("token 2022 account"): {TOKEN_2022_PROGRAM_ID, mustMarshal(t, &SplAccount{Mint: testPublicKey("nft"), Owner: wallet, Amount: 1, Extensions: AccountExtensions{NonTransferable: true}})},
+		testPublicKey("other account"):      {TOKEN_PROGRAM_ID, mustMarshal(t, &SplAccount{Mint: testPublicKey("usdc"), Owner: testPublicKey("other")})},
+		testPublicKey("mint"):               {TOKEN_2022_PROGRAM_ID, mint},
+	}, nil)
+	server := newStubRpcServer(t, fake)
+	var methods sync.Map
+	counting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var request struct {
+			Method string `json:"method"`
+		}
+		json.Unmarshal(body, &request)
+		count, _ := methods.LoadOrStore(request.Method, new(atomic.Int32))
+		count.(*atomic.Int32).Add(1)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		server.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(counting.Close)
+
+	tokenAccounts, err := FetchTokenAccounts(context.Background(), NewRpcAccountFetcher(rpc.New(counting.URL)), wallet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokenAccounts) != 2 ||
+		!tokenAccounts[0].PublicKey.Equals(testPublicKey("token account")) || !tokenAccounts[0].ProgramId.Equals(TOKEN_PROGRAM_ID) ||
+		!tokenAccounts[1].PublicKey.Equals(testPublicKey("token 2022 account")) || !tokenAccounts[1].ProgramId.Equals(TOKEN_2022_PROGRAM_ID) {
+		t.Fatalf("got %+v", tokenAccounts)
+	}
+	methods.Range(func(method, count any) bool {
+		if n := count.(*atomic.Int32).Load(); method != "getTokenAccountsByOwner" || n != 2 {
+			t.Errorf("%d %s requests", n, method)
+		}
+		return true
+	})
+}
+
+func TestLoadFakeAccountFetcher(t *testing.T) {
+	fetcher, err := LoadFakeAccountFetcher("testdata/clmm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pools, err := fetcher.GetProgramAccounts(context.Background(), CLMM_PROGRAM_ID, []rpc.RPCFilter{{DataSize: POOL_STATE_SIZE}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pools) != 1 {
+		t.Fatalf("got %d pools, want 1", len(pools))
+	}
+	if _, err := NewPoolInfoLayoutFromBytes(pools[0].Account.Data.GetBinary()); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,14 +1,18 @@
 package raydium
 
 import (
+	"bytes"
 	"context"
 	"fmt"
-	"unsafe"
 
 	"github.com/gagliardetto/solana-go"
 	"github.com/gagliardetto/solana-go/rpc"
 )
 
+var (
+	AMM_V4_PROGRAM_ID = solana.MustPublicKeyFromBase58("675kPX9MHTjS2zt1qfr1NYHuzeLXfQM9H24wFSUt1Mp8")
+)
+
 type AmmInfo struct {
 	Id                 solana.PublicKey
 	BaseMint           solana.PublicKey
@@ -38,38 +42,86 @@ type AmmInfo struct {
 	LookupTableAccount solana.PublicKey
 }
 
+// ApiPoolInfoV4 is an AMM v4 pool as listed by the Raydium API.
+type ApiPoolInfoV4 struct {
+	Id                 string `json:"id"`
+	BaseMint           string `json:"baseMint"`
+	QuoteMint          string `json:"quoteMint"`
+	LpMint             string `json:"lpMint"`
+	BaseDecimals       uint64 `json:"baseDecimals"`
+	QuoteDecimals      uint64 `json:"quoteDecimals"`
+	LpDecimals         uint64 `json:"lpDecimals"`
+	Version            uint64 `json:"version"`
+	ProgramId          string `json:"programId"`
+	Authority          string `json:"authority"`
+	OpenOrders         string `json:"openOrders"`
+	TargetOrders       string `json:"targetOrders"`
+	BaseVault          string `json:"baseVault"`
+	QuoteVault         string `json:"quoteVault"`
+	WithdrawQueue      string `json:"withdrawQueue"`
+	LpVault            string `json:"lpVault"`
+	MarketVersion      uint64 `json:"marketVersion"`
+	MarketId           string `json:"marketId"`
+	MarketProgramId    string `json:"marketProgramId"`
+	MarketAuthority    string `json:"marketAuthority"`
+	MarketBaseVault    string `json:"marketBaseVault"`
+	MarketQuoteVault   string `json:"marketQuoteVault"`
+	MarketBids         string `json:"marketBids"`
+	MarketAsks         string `json:"marketAsks"`
+	MarketEventQueue   string `json:"marketEventQueue"`
+	LookupTableAccount string `json:"lookupTableAccount"`
+}
+
 func (amm AmmInfo) Display() string {
 	return fmt.Sprintf("Id: %v\n BaseMint: %v\n QuoteMint: %v\n LpMint: %v\n BaseDecimals: %v\n QuoteDecimals: %v\n LpDecimals: %v\n Version: %v\n ProgramId: %v\n Authority: %v\n OpenOrders: %v\n TargetOrders: %v\n BaseVault: %v\n QuoteVault: %v\n WithdrawQueue: %v\n LpVault: %v\n MarketVersion: %v\n MarketProgramId: %v\n MarketId: %v\n MarketAuthority: %v\n MarketBaseVault: %v\n MarketQuoteVault: %v\n MarketBids: %v\n MarketAsks: %v\n MarketEventQueue: %v\n LookupTableAccount: %v\n", amm.Id.String(), amm.BaseMint.String(), amm.QuoteMint.String(), amm.LpMint.String(), amm.BaseDecimals, amm.QuoteDecimals, amm.LpDecimals, amm.Version, amm.ProgramId.String(), amm.Authority.String(), amm.OpenOrders.String(), amm.TargetOrders.String(), amm.BaseVault.String(), amm.QuoteVault.String(), amm.WithdrawQueue.String(), amm.LpVault.String(), amm.MarketVersion, amm.MarketProgramId.String(), amm.MarketId.String(), amm.MarketAuthority.String(), amm.MarketBaseVault.String(), amm.MarketQuoteVault.String(), amm.MarketBids.String(), amm.MarketAsks.String(), amm.MarketEventQueue.String(), amm.LookupTableAccount.String())
 }
 
-func GetAmmInfo(client *rpc.Client, id string, userAccount solana.PublicKey) (*AmmInfo, error) {
-	pubKey := solana.MustPublicKeyFromBase58(id)
-	account, err := client.GetAccountInfo(context.TODO(), pubKey)
+// GetAmmInfo loads the AMM v4 pool id with its market accounts. Its
+// LookupTableAccount is the table of lookupTables holding most of the pool id
+// and vaults; it is left unset when lookupTables is nil or has none.
+func GetAmmInfo(ctx context.Context, fetcher AccountFetcher, id string, lookupTables *LookupTableIndex) (*AmmInfo, error) {
+	pubKey, err := solana.PublicKeyFromBase58(id)
+	if err != nil {
+		return nil, fmt.Errorf("amm id %q: %w", id, err)
+	}
+	account, err := fetcher.GetAccountInfo(ctx, pubKey)
+	if err != nil {
+		return nil, err
+	}
+	owner := account.Owner
+	if err := checkOwner(owner, AMM_V4_PROGRAM_ID); err != nil {
+		return nil, err
+	}
+	liquidityState, err := NewLiquidityStateV4FromBytes(account.Data.GetBinary())
 	if err != nil {
 		return nil, err
 	}
-	owner := account.Value.Owner
-	fmt.Println("size of liquidity state:", unsafe.Sizeof(LiquidityStateV4{}), ", size of data:", len(account.Value.Data.GetBinary()))
-	liquidityState := (*(*LiquidityStateV4)(unsafe.Pointer(&account.Value.Data.GetBinary()[0])))
 
-	fmt.Println("market id", solana.PublicKeyFromBytes(liquidityState.MarketId[:]).String())
-	marketAccount, err := client.GetAccountInfo(context.TODO(), solana.PublicKeyFromBytes(liquidityState.MarketId[:]))
+	marketAccount, err := fetcher.GetAccountInfo(ctx, solana.PublicKeyFromBytes(liquidityState.MarketId[:]))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOwner(marketAccount.Owner, solana.PublicKeyFromBytes(liquidityState.MarketProgramId[:])); err != nil {
+		return nil, err
+	}
+	marketState, err := NewMarketStateV3FromBytes(marketAccount.Data.GetBinary())
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println("size of market state", unsafe.Sizeof(MarketStateV3{}), ", size of data:", len(marketAccount.Value.Data.GetBinary()[13:]))
-	marketState := (*(*MarketStateV3)(unsafe.Pointer(&marketAccount.Value.Data.GetBinary()[13])))
 
-	fmt.Println("market event queue", solana.PublicKeyFromBytes(marketState.EventQueue[:]).String())
-	lpMintAccount, err := client.GetAccountInfo(context.TODO(), solana.PublicKeyFromBytes(liquidityState.LpMint[:]))
+	lpMintAccount, err := fetcher.GetAccountInfo(ctx, solana.PublicKeyFromBytes(liquidityState.LpMint[:]))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOwner(lpMintAccount.Owner, TOKEN_PROGRAM_ID); err != nil {
+		return nil, err
+	}
+	splMint, err := NewSplMintFromBytes(lpMintAccount.Data.GetBinary())
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println("size of spl mint", unsafe.Sizeof(SplMint{}), ", size of data:", len(lpMintAccount.Value.Data.GetBinary()[4:]))
-	splMint := (*(*SplMint)(unsafe.Pointer(&lpMintAccount.Value.Data.GetBinary()[4])))
 
-	// "amm authority"
-	authority, _, err := solana.FindProgramAddress([][]byte{{97, 109, 109, 32, 97, 117, 116, 104, 111, 114, 105, 116, 121}}, owner)
+	authority, err := getAmmAuthority(owner)
 	if err != nil {
 		return nil, err
 	}
@@ -79,7 +131,7 @@ func GetAmmInfo(client *rpc.Client, id string, userAccount solana.PublicKey) (*A
 		return nil, err
 	}
 
-	return &AmmInfo{
+	ammInfo := &AmmInfo{
 		Id:               pubKey,
 		BaseMint:         solana.PublicKeyFromBytes(liquidityState.BaseMint[:]),
 		QuoteMint:        solana.PublicKeyFromBytes(liquidityState.QuoteMint[:]),
@@ -106,6 +158,168 @@ func GetAmmInfo(client *rpc.Client, id string, userAccount solana.PublicKey) (*A
 		MarketAsks:       solana.PublicKeyFromBytes(marketState.Asks[:]),
 		MarketEventQueue: solana.PublicKeyFromBytes(marketState.EventQueue[:]),
 		// MarketEventQueue:   solana.MustPublicKeyFromBase58("2CoBP2rr5HmjMdPC4nMwnYg1cdH9JPUuqbq2QGSMGfms"),
-		LookupTableAccount: userAccount,
-	}, nil
+	}
+	if lookupTables != nil {
+		lookupTables.SetAmmLookupTable(ammInfo)
+	}
+	return ammInfo, nil
+}
+
+// FormatAmmKeys loads every AMM v4 pool trading through an OpenBook market,
+// with the market accounts its instructions need and the Raydium lookup table
+// holding most of its id and vaults, if any. Pools whose market or LP mint no
+// longer exists are left out.
+func FormatAmmKeys(ctx context.Context, fetcher AccountFetcher) (map[string]*ApiPoolInfoV4, error) {
+	allAmmAccount, err := fetcher.GetProgramAccounts(ctx, AMM_V4_PROGRAM_ID, []rpc.RPCFilter{
+		{
+			DataSize: LIQUIDITY_STATE_V4_SIZE,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	filterDefKey := solana.MustPublicKeyFromBase58("11111111111111111111111111111111")
+	amAccountData := make([]*AmmAccount, 0, len(allAmmAccount))
+	allMarketProgram := make(map[solana.PublicKey]struct{})
+	allLpMint := make(map[solana.PublicKey]struct{})
+	for _, acc := range allAmmAccount {
+		liquidityState, err := NewLiquidityStateV4FromBytes(acc.Account.Data.GetBinary())
+		if err != nil {
+			return nil, fmt.Errorf("decode pool %v: %w", acc.Pubkey, err)
+		}
+		if bytes.Equal(liquidityState.MarketProgramId[:], filterDefKey[:]) {
+			continue
+		}
+
+		amAccountData = append(amAccountData, &AmmAccount{
+			Id:             acc.Pubkey,
+			ProgramId:      acc.Account.Owner,
+			LiquidityState: liquidityState,
+		})
+		allMarketProgram[solana.PublicKeyFromBytes(liquidityState.MarketProgramId[:])] = struct{}{}
+		allLpMint[solana.PublicKeyFromBytes(liquidityState.LpMint[:])] = struct{}{}
+	}
+
+	marketInfo := make(map[string]*MarketInfo)
+	for marketProgram := range allMarketProgram {
+		allMarketInfo, err := fetcher.GetProgramAccounts(ctx, marketProgram, []rpc.RPCFilter{
+			{
+				DataSize: MARKET_STATE_V3_SIZE,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, market := range allMarketInfo {
+			itemMarketInfo, err := NewMarketStateV3FromBytes(market.Account.Data.GetBinary())
+			if err != nil {
+				return nil, fmt.Errorf("decode market %v: %w", market.Pubkey, err)
+			}
+			marketAuthority, err := GetAssociatedAuthority(market.Account.Owner.Bytes(), market.Pubkey.Bytes())
+			if err != nil {
+				return nil, err
+			}
+
+			marketInfo[market.Pubkey.String()] = &MarketInfo{
+				MarketProgramId:  market.Account.Owner.String(),
+				MarketAuthority:  marketAuthority.String(),
+				MarketBaseVault:  solana.PublicKeyFromBytes(itemMarketInfo.BaseVault[:]).String(),
+				MarketQuoteVault: solana.PublicKeyFromBytes(itemMarketInfo.QuoteVault[:]).String(),
+				MarketBids:       solana.PublicKeyFromBytes(itemMarketInfo.Bids[:]).String(),
+				MarketAsks:       solana.PublicKeyFromBytes(itemMarketInfo.Asks[:]).String(),
+				MarketEventQueue: solana.PublicKeyFromBytes(itemMarketInfo.EventQueue[:]).String(),
+			}
+		}
+	}
+
+	lpMints := make([]solana.PublicKey, 0, len(allLpMint))
+	for lpMint := range allLpMint {
+		lpMints = append(lpMints, lpMint)
+	}
+	lpMintAccounts, err := fetchAccounts(ctx, fetcher, lpMints)
+	if err != nil {
+		return nil, err
+	}
+	lpDecimals := make(map[solana.PublicKey]uint8, len(lpMints))
+	for i, lpMint := range lpMints {
+		if lpMintAccounts.Missing(i) {
+			continue
+		}
+		splMint, err := NewSplMintFromBytes(lpMintAccounts.Accounts[i].Data.GetBinary())
+		if err != nil {
+			return nil, fmt.Errorf("decode lp mint %v: %w", lpMint, err)
+		}
+		lpDecimals[lpMint] = splMint.Decimals
+	}
+
+	ammFormatData := make(map[string]*ApiPoolInfoV4)
+	for _, itemAmm := range amAccountData {
+		itemMarket, ok := marketInfo[solana.PublicKeyFromBytes(itemAmm.LiquidityState.MarketId[:]).String()]
+		if !ok {
+			continue
+		}
+		itemLpDecimals, ok := lpDecimals[solana.PublicKeyFromBytes(itemAmm.LiquidityState.LpMint[:])]
+		if !ok {
+			continue
+		}
+
+		authority, err := getAmmAuthority(itemAmm.ProgramId)
+		if err != nil {
+			return nil, err
+		}
+		ammFormatData[itemAmm.Id.String()] = &ApiPoolInfoV4{
+			Id:                 itemAmm.Id.String(),
+			BaseMint:           solana.PublicKeyFromBytes(itemAmm.LiquidityState.BaseMint[:]).String(),
+			QuoteMint:          solana.PublicKeyFromBytes(itemAmm.LiquidityState.QuoteMint[:]).String(),
+			LpMint:             solana.PublicKeyFromBytes(itemAmm.LiquidityState.LpMint[:]).String(),
+			BaseDecimals:       itemAmm.LiquidityState.BaseDecimal,
+			QuoteDecimals:      itemAmm.LiquidityState.QuoteDecimal,
+			LpDecimals:         uint64(itemLpDecimals),
+			Version:            4,
+			ProgramId:          itemAmm.ProgramId.String(),
+			Authority:          authority.String(),
+			OpenOrders:         solana.PublicKeyFromBytes(itemAmm.LiquidityState.OpenOrders[:]).String(),
+			TargetOrders:       solana.PublicKeyFromBytes(itemAmm.LiquidityState.TargetOrders[:]).String(),
+			BaseVault:          solana.PublicKeyFromBytes(itemAmm.LiquidityState.BaseVault[:]).String(),
+			QuoteVault:         solana.PublicKeyFromBytes(itemAmm.LiquidityState.QuoteVault[:]).String(),
+			WithdrawQueue:      solana.PublicKeyFromBytes(itemAmm.LiquidityState.WithdrawQueue[:]).String(),
+			LpVault:            solana.PublicKeyFromBytes(itemAmm.LiquidityState.LpVault[:]).String(),
+			MarketVersion:      3,
+			MarketId:           solana.PublicKeyFromBytes(itemAmm.LiquidityState.MarketId[:]).String(),
+			MarketProgramId:    itemMarket.MarketProgramId,
+			MarketAuthority:    itemMarket.MarketAuthority,
+			MarketBaseVault:    itemMarket.MarketBaseVault,
+			MarketQuoteVault:   itemMarket.MarketQuoteVault,
+			MarketBids:         itemMarket.MarketBids,
+			MarketAsks:         itemMarket.MarketAsks,
+			MarketEventQueue:   itemMarket.MarketEventQueue,
+			LookupTableAccount: filterDefKey.String(),
+		}
+	}
+
+	lookupTables, err := GetLookupTablesByAuthority(ctx, fetcher, RAYDIUM_LOOKUP_TABLE_AUTHORITY)
+	if err != nil {
+		return nil, err
+	}
+	index := NewLookupTableIndex(lookupTables...)
+	for _, itemAmm := range amAccountData {
+		pool, ok := ammFormatData[itemAmm.Id.String()]
+		if !ok {
+			continue
+		}
+		keys := []solana.PublicKey{itemAmm.Id, solana.PublicKeyFromBytes(itemAmm.LiquidityState.BaseVault[:]), solana.PublicKeyFromBytes(itemAmm.LiquidityState.QuoteVault[:])}
+		if key, ok := index.BestTable(keys...); ok {
+			pool.LookupTableAccount = key.String()
+		}
+	}
+
+	return ammFormatData, nil
+}
+
+func getAmmAuthority(programId solana.PublicKey) (solana.PublicKey, error) {
+	// "amm authority"
+	authority, _, err := solana.FindProgramAddress([][]byte{{97, 109, 109, 32, 97, 117, 116, 104, 111, 114, 105, 116, 121}}, programId)
+	return authority, err
 }
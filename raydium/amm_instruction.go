@@ -0,0 +1,313 @@
+package raydium
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// AMM v4 instruction tags.
+const (
+	AMM_INSTRUCTION_INITIALIZE2   = 1
+	AMM_INSTRUCTION_DEPOSIT       = 3
+	AMM_INSTRUCTION_WITHDRAW      = 4
+	AMM_INSTRUCTION_SWAP_BASE_IN  = 9
+	AMM_INSTRUCTION_SWAP_BASE_OUT = 11
+	AMM_INSTRUCTION_SIMULATE_INFO = 12
+)
+
+// Sides of a deposit whose amount is kept exactly; the other side is
+// adjusted to the pool ratio.
+type AmmFixedSide uint64
+
+const (
+	AMM_FIXED_SIDE_BASE AmmFixedSide = iota
+	AMM_FIXED_SIDE_QUOTE
+)
+
+var (
+	// AMM_V4_CREATE_POOL_FEE_ADDRESS receives the mainnet pool creation fee.
+	AMM_V4_CREATE_POOL_FEE_ADDRESS = solana.MustPublicKeyFromBase58("7YttLkHDoNj9wyDur5pM1ejNaAvT9X4eqaYcHQqtj2G5")
+)
+
+var (
+	ErrMissingAccount = errors.New("instruction account not set")
+	ErrInvalidAmount  = errors.New("instruction amount must be positive")
+)
+
+// GetAssociatedAmmInfo derives the accounts of the pool Initialize2 creates
+// for marketId. The market accounts, decimals and LP decimals are left for the
+// caller to fill from the market.
+func GetAssociatedAmmInfo(programId, marketProgramId, marketId, baseMint, quoteMint solana.PublicKey) (*AmmInfo, error) {
+	associated := func(seed string) (solana.PublicKey, error) {
+		key, _, err := solana.FindProgramAddress([][]byte{programId.Bytes(), marketId.Bytes(), []byte(seed)}, programId)
+		return key, err
+	}
+	ammInfo := &AmmInfo{
+		BaseMint:        baseMint,
+		QuoteMint:       quoteMint,
+		Version:         4,
+		ProgramId:       programId,
+		MarketVersion:   3,
+		MarketProgramId: marketProgramId,
+		MarketId:        marketId,
+	}
+	for _, key := range []struct {
+		dst  *solana.PublicKey
+		seed string
+	}{
+		{&ammInfo.Id, "amm_associated_seed"},
+		{&ammInfo.LpMint, "lp_mint_associated_seed"},
+		{&ammInfo.OpenOrders, "open_order_associated_seed"},
+		{&ammInfo.TargetOrders, "target_associated_seed"},
+		{&ammInfo.BaseVault, "coin_vault_associated_seed"},
+		{&ammInfo.QuoteVault, "pc_vault_associated_seed"},
+	} {
+		var err error
+		if *key.dst, err = associated(key.seed); err != nil {
+			return nil, err
+		}
+	}
+	var err error
+	if ammInfo.Authority, err = getAmmAuthority(programId); err != nil {
+		return nil, err
+	}
+	if ammInfo.MarketAuthority, err = GetAssociatedAuthority(marketProgramId.Bytes(), marketId.Bytes()); err != nil {
+		return nil, err
+	}
+	return ammInfo, nil
+}
+
+// NewAmmSwapBaseInInstruction swaps exactly amountIn from userSource, failing
+// unless at least minAmountOut reaches userDestination.
+func NewAmmSwapBaseInInstruction(ammInfo *AmmInfo, userSource, userDestination, owner solana.PublicKey, amountIn, minAmountOut *big.Int) (solana.Instruction, error) {
+	return newAmmSwapInstruction(AMM_INSTRUCTION_SWAP_BASE_IN, ammInfo, userSource, userDestination, owner, amountIn, minAmountOut)
+}
+
+// NewAmmSwapBaseOutInstruction swaps for exactly amountOut into
+// userDestination, spending at most maxAmountIn from userSource.
+func NewAmmSwapBaseOutInstruction(ammInfo *AmmInfo, userSource, userDestination, owner solana.PublicKey, maxAmountIn, amountOut *big.Int) (solana.Instruction, error) {
+	return newAmmSwapInstruction(AMM_INSTRUCTION_SWAP_BASE_OUT, ammInfo, userSource, userDestination, owner, maxAmountIn, amountOut)
+}
+
+// newAmmSwapInstruction builds either swap: the first amount is the one spent,
+// the second the one received, and only the exact side must be positive.
+func newAmmSwapInstruction(tag uint8, ammInfo *AmmInfo, userSource, userDestination, owner solana.PublicKey, amountIn, amountOut *big.Int) (solana.Instruction, error) {
+	exact, limit := amountIn, amountOut
+	if tag == AMM_INSTRUCTION_SWAP_BASE_OUT {
+		exact, limit = amountOut, amountIn
+	}
+	if err := checkInstructionAmount(exact, true); err != nil {
+		return nil, err
+	}
+	if err := checkInstructionAmount(limit, false); err != nil {
+		return nil, err
+	}
+
+	w := newLayoutWriter(17, 0)
+	w.bytes([]byte{tag})
+	w.u64(amountIn.Uint64())
+	w.u64(amountOut.Uint64())
+	return newAmmInstruction(ammInfo, 1, solana.AccountMetaSlice{
+		solana.Meta(TOKEN_PROGRAM_ID),
+		solana.Meta(ammInfo.Id).WRITE(),
+		solana.Meta(ammInfo.Authority),
+		solana.Meta(ammInfo.OpenOrders).WRITE(),
+		solana.Meta(ammInfo.TargetOrders).WRITE(),
+		solana.Meta(ammInfo.BaseVault).WRITE(),
+		solana.Meta(ammInfo.QuoteVault).WRITE(),
+		solana.Meta(ammInfo.MarketProgramId),
+		solana.Meta(ammInfo.MarketId).WRITE(),
+		solana.Meta(ammInfo.MarketBids).WRITE(),
+		solana.Meta(ammInfo.MarketAsks).WRITE(),
+		solana.Meta(ammInfo.MarketEventQueue).WRITE(),
+		solana.Meta(ammInfo.MarketBaseVault).WRITE(),
+		solana.Meta(ammInfo.MarketQuoteVault).WRITE(),
+		solana.Meta(ammInfo.MarketAuthority),
+		solana.Meta(userSource).WRITE(),
+		solana.Meta(userDestination).WRITE(),
+		solana.Meta(owner).SIGNER(),
+	}, w.data)
+}
+
+// NewAmmDepositInstruction adds liquidity of up to maxBaseAmount and
+// maxQuoteAmount, keeping fixedSide exact, and mints the LP tokens to userLp.
+func NewAmmDepositInstruction(ammInfo *AmmInfo, userBase, userQuote, userLp, owner solana.PublicKey, maxBaseAmount, maxQuoteAmount *big.Int, fixedSide AmmFixedSide) (solana.Instruction, error) {
+	if fixedSide != AMM_FIXED_SIDE_BASE && fixedSide != AMM_FIXED_SIDE_QUOTE {
+		return nil, fmt.Errorf("invalid fixed side %d", fixedSide)
+	}
+	for _, amount := range []*big.Int{maxBaseAmount, maxQuoteAmount} {
+		if err := checkInstructionAmount(amount, true); err != nil {
+			return nil, err
+		}
+	}
+
+	w := newLayoutWriter(25, 0)
+	w.bytes([]byte{AMM_INSTRUCTION_DEPOSIT})
+	w.u64(maxBaseAmount.Uint64())
+	w.u64(maxQuoteAmount.Uint64())
+	w.u64(uint64(fixedSide))
+	return newAmmInstruction(ammInfo, 1, solana.AccountMetaSlice{
+		solana.Meta(TOKEN_PROGRAM_ID),
+		solana.Meta(ammInfo.Id).WRITE(),
+		solana.Meta(ammInfo.Authority),
+		solana.Meta(ammInfo.OpenOrders),
+		solana.Meta(ammInfo.TargetOrders).WRITE(),
+		solana.Meta(ammInfo.LpMint).WRITE(),
+		solana.Meta(ammInfo.BaseVault).WRITE(),
+		solana.Meta(ammInfo.QuoteVault).WRITE(),
+		solana.Meta(ammInfo.MarketId),
+		solana.Meta(userBase).WRITE(),
+		solana.Meta(userQuote).WRITE(),
+		solana.Meta(userLp).WRITE(),
+		solana.Meta(owner).SIGNER(),
+		solana.Meta(ammInfo.MarketEventQueue),
+	}, w.data)
+}
+
+// NewAmmWithdrawInstruction burns lpAmount from userLp and returns the
+// pool tokens to userBase and userQuote.
+func NewAmmWithdrawInstruction(ammInfo *AmmInfo, userLp, userBase, userQuote, owner solana.PublicKey, lpAmount *big.Int) (solana.Instruction, error) {
+	if err := checkInstructionAmount(lpAmount, true); err != nil {
+		return nil, err
+	}
+
+	w := newLayoutWriter(9, 0)
+	w.bytes([]byte{AMM_INSTRUCTION_WITHDRAW})
+	w.u64(lpAmount.Uint64())
+	return newAmmInstruction(ammInfo, 1, solana.AccountMetaSlice{
+		solana.Meta(TOKEN_PROGRAM_ID),
+		solana.Meta(ammInfo.Id).WRITE(),
+		solana.Meta(ammInfo.Authority),
+		solana.Meta(ammInfo.OpenOrders).WRITE(),
+		solana.Meta(ammInfo.TargetOrders).WRITE(),
+		solana.Meta(ammInfo.LpMint).WRITE(),
+		solana.Meta(ammInfo.BaseVault).WRITE(),
+		solana.Meta(ammInfo.QuoteVault).WRITE(),
+		solana.Meta(ammInfo.MarketProgramId),
+		solana.Meta(ammInfo.MarketId).WRITE(),
+		solana.Meta(ammInfo.MarketBaseVault).WRITE(),
+		solana.Meta(ammInfo.MarketQuoteVault).WRITE(),
+		solana.Meta(ammInfo.MarketAuthority),
+		solana.Meta(userLp).WRITE(),
+		solana.Meta(userBase).WRITE(),
+		solana.Meta(userQuote).WRITE(),
+		solana.Meta(owner).SIGNER(),
+		solana.Meta(ammInfo.MarketEventQueue).WRITE(),
+		solana.Meta(ammInfo.MarketBids).WRITE(),
+		solana.Meta(ammInfo.MarketAsks).WRITE(),
+	}, w.data)
+}
+
+// NewAmmGetPoolDataInstruction logs the pool state as GetPoolData when
+// simulated; see SimulatePoolInfoFetcher.
+func NewAmmGetPoolDataInstruction(ammInfo *AmmInfo) (solana.Instruction, error) {
+	return newAmmInstruction(ammInfo, 0, solana.AccountMetaSlice{
+		solana.Meta(ammInfo.Id),
+		solana.Meta(ammInfo.Authority),
+		solana.Meta(ammInfo.OpenOrders),
+		solana.Meta(ammInfo.BaseVault),
+		solana.Meta(ammInfo.QuoteVault),
+		solana.Meta(ammInfo.LpMint),
+		solana.Meta(ammInfo.MarketId),
+		solana.Meta(ammInfo.MarketEventQueue),
+	}, []byte{AMM_INSTRUCTION_SIMULATE_INFO, 0})
+}
+
+// NewAmmInitialize2Instruction creates the pool of ammInfo, as derived by
+// GetAssociatedAmmInfo, seeding it from userBase and userQuote and opening
+// swaps at openTime, a unix timestamp. The LP tokens go to userLp, the
+// owner's associated account, which the program creates if needed.
+func NewAmmInitialize2Instruction(ammInfo *AmmInfo, userBase, userQuote, userLp, owner solana.PublicKey, openTime uint64, initBaseAmount, initQuoteAmount *big.Int) (solana.Instruction, error) {
+	for _, amount := range []*big.Int{initBaseAmount, initQuoteAmount} {
+		if err := checkInstructionAmount(amount, true); err != nil {
+			return nil, err
+		}
+	}
+	authority, nonce, err := solana.FindProgramAddress([][]byte{[]byte("amm authority")}, ammInfo.ProgramId)
+	if err != nil {
+		return nil, err
+	}
+	if !authority.Equals(ammInfo.Authority) {
+		return nil, fmt.Errorf("pool authority %v is not the program authority %v", ammInfo.Authority, authority)
+	}
+	config, _, err := solana.FindProgramAddress([][]byte{[]byte("amm_config_account_seed")}, ammInfo.ProgramId)
+	if err != nil {
+		return nil, err
+	}
+
+	w := newLayoutWriter(26, 0)
+	w.bytes([]byte{AMM_INSTRUCTION_INITIALIZE2, nonce})
+	w.u64(openTime)
+	w.u64(initQuoteAmount.Uint64())
+	w.u64(initBaseAmount.Uint64())
+	return newAmmInstruction(ammInfo, 4, solana.AccountMetaSlice{
+		solana.Meta(TOKEN_PROGRAM_ID),
+		solana.Meta(ASSOCIATED_TOKEN_PROGRAM_ID),
+		solana.Meta(solana.SystemProgramID),
+		solana.Meta(SYSVAR_RENT_PUBKEY),
+		solana.Meta(ammInfo.Id).WRITE(),
+		solana.Meta(ammInfo.Authority),
+		solana.Meta(ammInfo.OpenOrders).WRITE(),
+		solana.Meta(ammInfo.LpMint).WRITE(),
+		solana.Meta(ammInfo.BaseMint),
+		solana.Meta(ammInfo.QuoteMint),
+		solana.Meta(ammInfo.BaseVault).WRITE(),
+		solana.Meta(ammInfo.QuoteVault).WRITE(),
+		solana.Meta(ammInfo.TargetOrders).WRITE(),
+		solana.Meta(config),
+		solana.Meta(AMM_V4_CREATE_POOL_FEE_ADDRESS).WRITE(),
+		solana.Meta(ammInfo.MarketProgramId),
+		solana.Meta(ammInfo.MarketId),
+		solana.Meta(owner).WRITE().SIGNER(),
+		solana.Meta(userBase).WRITE(),
+		solana.Meta(userQuote).WRITE(),
+		solana.Meta(userLp).WRITE(),
+	}, w.data)
+}
+
+// newAmmInstruction checks that every account after the first programs, which
+// may be the all-zero system program, is set before building an instruction
+// for ammInfo's program.
+func newAmmInstruction(ammInfo *AmmInfo, programs int, accounts solana.AccountMetaSlice, data []byte) (solana.Instruction, error) {
+	if ammInfo.ProgramId.IsZero() {
+		return nil, fmt.Errorf("%w: program id", ErrMissingAccount)
+	}
+	for i, account := range accounts {
+		if i >= programs && account.PublicKey.IsZero() {
+			return nil, fmt.Errorf("%w: account %d of instruction %d", ErrMissingAccount, i, data[0])
+		}
+	}
+	return solana.NewInstruction(ammInfo.ProgramId, accounts, data), nil
+}
+
+// checkInstructionAmount checks that amount fits a u64 and, if positive is
+// set, that it is not zero.
+func checkInstructionAmount(amount *big.Int, positive bool) error {
+	if amount == nil || amount.Sign() < 0 || positive && amount.Sign() == 0 {
+		return fmt.Errorf("%w: %v", ErrInvalidAmount, amount)
+	}
+	if !amount.IsUint64() {
+		return fmt.Errorf("%w: %v", ErrAmountOverflow, amount)
+	}
+	return nil
+}
+
+// checkInstructionAccounts reports the first of the named accounts, by
+// name, that is not set.
+func checkInstructionAccounts(accounts map[string]solana.PublicKey) error {
+	names := make([]string, 0, len(accounts))
+	for name := range accounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if accounts[name].IsZero() {
+			return fmt.Errorf("%w: %s", ErrMissingAccount, name)
+		}
+	}
+	return nil
+}
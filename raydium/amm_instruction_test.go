@@ -0,0 +1,274 @@
+package raydium
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// testAmmInfo is a pool with every account set to a distinct key.
+func testAmmInfo() *AmmInfo {
+	return &AmmInfo{
+		Id:               testPublicKey("amm"),
+		BaseMint:         testPublicKey("base mint"),
+		QuoteMint:        testPublicKey("quote mint"),
+		LpMint:           testPublicKey("lp mint"),
+		ProgramId:        AMM_V4_PROGRAM_ID,
+		Authority:        testPublicKey("authority"),
+		OpenOrders:       testPublicKey("open orders"),
+		TargetOrders:     testPublicKey("target orders"),
+		BaseVault:        testPublicKey("base vault"),
+		QuoteVault:       testPublicKey("quote vault"),
+		MarketProgramId:  OPENBOOK_PROGRAM_ID,
+		MarketId:         testPublicKey("market"),
+		MarketAuthority:  testPublicKey("market authority"),
+		MarketBaseVault:  testPublicKey("market base vault"),
+		MarketQuoteVault: testPublicKey("market quote vault"),
+		MarketBids:       testPublicKey("bids"),
+		MarketAsks:       testPublicKey("asks"),
+		MarketEventQueue: testPublicKey("event queue"),
+	}
+}
+
+// checkInstruction compares the data and account metas of instruction.
+func checkInstruction(t *testing.T, instruction solana.Instruction, data []byte, accounts solana.AccountMetaSlice) {
+	t.Helper()
+	got, err := instruction.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(data) {
+		t.Errorf("got data %v, want %v", got, data)
+	}
+	metas := instruction.Accounts()
+	if len(metas) != len(accounts) {
+		t.Fatalf("got %d accounts, want %d", len(metas), len(accounts))
+	}
+	for i, meta := range metas {
+		if *meta != *accounts[i] {
+			t.Errorf("account %d: got %+v, want %+v", i, *meta, *accounts[i])
+		}
+	}
+}
+
+func instructionData(tag uint8, values ...uint64) []byte {
+	data := []byte{tag}
+	for _, value := range values {
+		data = binary.LittleEndian.AppendUint64(data, value)
+	}
+	return data
+}
+
+func TestAmmSwapInstructions(t *testing.T) {
+	ammInfo := testAmmInfo()
+	source, destination, owner := testPublicKey("source"), testPublicKey("destination"), testPublicKey("owner")
+	accounts := solana.AccountMetaSlice{
+		solana.Meta(TOKEN_PROGRAM_ID),
+		solana.Meta(ammInfo.Id).WRITE(),
+		solana.Meta(ammInfo.Authority),
+		solana.Meta(ammInfo.OpenOrders).WRITE(),
+		solana.Meta(ammInfo.TargetOrders).WRITE(),
+		solana.Meta(ammInfo.BaseVault).WRITE(),
+		solana.Meta(ammInfo.QuoteVault).WRITE(),
+		solana.Meta(OPENBOOK_PROGRAM_ID),
+		solana.Meta(ammInfo.MarketId).WRITE(),
+		solana.Meta(ammInfo.MarketBids).WRITE(),
+		solana.Meta(ammInfo.MarketAsks).WRITE(),
+		solana.Meta(ammInfo.MarketEventQueue).WRITE(),
+		solana.Meta(ammInfo.MarketBaseVault).WRITE(),
+		solana.Meta(ammInfo.MarketQuoteVault).WRITE(),
+		solana.Meta(ammInfo.MarketAuthority),
+		solana.Meta(source).WRITE(),
+		solana.Meta(destination).WRITE(),
+		solana.Meta(owner).SIGNER(),
+	}
+
+	instruction, err := NewAmmSwapBaseInInstruction(ammInfo, source, destination, owner, big.NewInt(1000), big.NewInt(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !instruction.ProgramID().Equals(AMM_V4_PROGRAM_ID) {
+		t.Errorf("got program %v", instruction.ProgramID())
+	}
+	checkInstruction(t, instruction, instructionData(AMM_INSTRUCTION_SWAP_BASE_IN, 1000, 0), accounts)
+
+	instruction, err = NewAmmSwapBaseOutInstruction(ammInfo, source, destination, owner, big.NewInt(1100), big.NewInt(900))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInstruction(t, instruction, instructionData(AMM_INSTRUCTION_SWAP_BASE_OUT, 1100, 900), accounts)
+
+	for _, c := range []struct {
+		name            string
+		amountIn, limit *big.Int
+		baseOut         bool
+		want            error
+		ammInfo         *AmmInfo
+		sourceOverride  *solana.PublicKey
+	}{
+		{name: "zero amount in", amountIn: big.NewInt(0), limit: big.NewInt(1), want: ErrInvalidAmount},
+		{name: "zero amount out", amountIn: big.NewInt(1), limit: big.NewInt(0), baseOut: true, want: ErrInvalidAmount},
+		{name: "nil min amount out", amountIn: big.NewInt(1), want: ErrInvalidAmount},
+		{name: "negative", amountIn: big.NewInt(-1), limit: big.NewInt(0), want: ErrInvalidAmount},
+		{name: "overflow", amountIn: new(big.Int).Lsh(big.NewInt(1), 64), limit: big.NewInt(0), want: ErrAmountOverflow},
+		{name: "missing market", amountIn: big.NewInt(1), limit: big.NewInt(0), want: ErrMissingAccount, ammInfo: &AmmInfo{Id: ammInfo.Id, ProgramId: AMM_V4_PROGRAM_ID}},
+		{name: "missing source", amountIn: big.NewInt(1), limit: big.NewInt(0), want: ErrMissingAccount, sourceOverride: &solana.PublicKey{}},
+	} {
+		pool, userSource := ammInfo, source
+		if c.ammInfo != nil {
+			pool = c.ammInfo
+		}
+		if c.sourceOverride != nil {
+			userSource = *c.sourceOverride
+		}
+		if c.baseOut {
+			_, err = NewAmmSwapBaseOutInstruction(pool, userSource, destination, owner, c.amountIn, c.limit)
+		} else {
+			_, err = NewAmmSwapBaseInInstruction(pool, userSource, destination, owner, c.amountIn, c.limit)
+		}
+		if !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+}
+
+func TestAmmLiquidityInstructions(t *testing.T) {
+	ammInfo := testAmmInfo()
+	userBase, userQuote, userLp, owner := testPublicKey("user base"), testPublicKey("user quote"), testPublicKey("user lp"), testPublicKey("owner")
+
+	instruction, err := NewAmmDepositInstruction(ammInfo, userBase, userQuote, userLp, owner, big.NewInt(500), big.NewInt(700), AMM_FIXED_SIDE_QUOTE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInstruction(t, instruction, instructionData(AMM_INSTRUCTION_DEPOSIT, 500, 700, 1), solana.AccountMetaSlice{
+		solana.Meta(TOKEN_PROGRAM_ID),
+		solana.Meta(ammInfo.Id).WRITE(),
+		solana.Meta(ammInfo.Authority),
+		solana.Meta(ammInfo.OpenOrders),
+		solana.Meta(ammInfo.TargetOrders).WRITE(),
+		solana.Meta(ammInfo.LpMint).WRITE(),
+		solana.Meta(ammInfo.BaseVault).WRITE(),
+		solana.Meta(ammInfo.QuoteVault).WRITE(),
+		solana.Meta(ammInfo.MarketId),
+		solana.Meta(userBase).WRITE(),
+		solana.Meta(userQuote).WRITE(),
+		solana.Meta(userLp).WRITE(),
+		solana.Meta(owner).SIGNER(),
+		solana.Meta(ammInfo.MarketEventQueue),
+	})
+	if _, err := NewAmmDepositInstruction(ammInfo, userBase, userQuote, userLp, owner, big.NewInt(500), big.NewInt(700), 2); err == nil {
+		t.Error("accepted fixed side 2")
+	}
+	if _, err := NewAmmDepositInstruction(ammInfo, userBase, userQuote, userLp, owner, big.NewInt(500), big.NewInt(0), AMM_FIXED_SIDE_BASE); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("got %v, want ErrInvalidAmount", err)
+	}
+
+	instruction, err = NewAmmWithdrawInstruction(ammInfo, userLp, userBase, userQuote, owner, big.NewInt(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInstruction(t, instruction, instructionData(AMM_INSTRUCTION_WITHDRAW, 42), solana.AccountMetaSlice{
+		solana.Meta(TOKEN_PROGRAM_ID),
+		solana.Meta(ammInfo.Id).WRITE(),
+		solana.Meta(ammInfo.Authority),
+		solana.Meta(ammInfo.OpenOrders).WRITE(),
+		solana.Meta(ammInfo.TargetOrders).WRITE(),
+		solana.Meta(ammInfo.LpMint).WRITE(),
+		solana.Meta(ammInfo.BaseVault).WRITE(),
+		solana.Meta(ammInfo.QuoteVault).WRITE(),
+		solana.Meta(OPENBOOK_PROGRAM_ID),
+		solana.Meta(ammInfo.MarketId).WRITE(),
+		solana.Meta(ammInfo.MarketBaseVault).WRITE(),
+		solana.Meta(ammInfo.MarketQuoteVault).WRITE(),
+		solana.Meta(ammInfo.MarketAuthority),
+		solana.Meta(userLp).WRITE(),
+		solana.Meta(userBase).WRITE(),
+		solana.Meta(userQuote).WRITE(),
+		solana.Meta(owner).SIGNER(),
+		solana.Meta(ammInfo.MarketEventQueue).WRITE(),
+		solana.Meta(ammInfo.MarketBids).WRITE(),
+		solana.Meta(ammInfo.MarketAsks).WRITE(),
+	})
+	if _, err := NewAmmWithdrawInstruction(ammInfo, userLp, userBase, userQuote, owner, nil); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("got %v, want ErrInvalidAmount", err)
+	}
+
+	instruction, err = NewAmmGetPoolDataInstruction(ammInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInstruction(t, instruction, []byte{AMM_INSTRUCTION_SIMULATE_INFO, 0}, solana.AccountMetaSlice{
+		solana.Meta(ammInfo.Id),
+		solana.Meta(ammInfo.Authority),
+		solana.Meta(ammInfo.OpenOrders),
+		solana.Meta(ammInfo.BaseVault),
+		solana.Meta(ammInfo.QuoteVault),
+		solana.Meta(ammInfo.LpMint),
+		solana.Meta(ammInfo.MarketId),
+		solana.Meta(ammInfo.MarketEventQueue),
+	})
+}
+
+func TestAmmInitialize2Instruction(t *testing.T) {
+	marketId := testPublicKey("market")
+	ammInfo, err := GetAssociatedAmmInfo(AMM_V4_PROGRAM_ID, OPENBOOK_PROGRAM_ID, marketId, testPublicKey("base mint"), testPublicKey("quote mint"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := solana.MustPublicKeyFromBase58("5Q544fKrFoe6tsEbD7S8EmxGTJYAKtTVhAW5Q5pge4j1"); !ammInfo.Authority.Equals(want) {
+		t.Errorf("got authority %v, want %v", ammInfo.Authority, want)
+	}
+	wantId, _, err := solana.FindProgramAddress([][]byte{AMM_V4_PROGRAM_ID.Bytes(), marketId.Bytes(), []byte("amm_associated_seed")}, AMM_V4_PROGRAM_ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ammInfo.Id.Equals(wantId) {
+		t.Errorf("got id %v, want %v", ammInfo.Id, wantId)
+	}
+
+	userBase, userQuote, userLp, owner := testPublicKey("user base"), testPublicKey("user quote"), testPublicKey("user lp"), testPublicKey("owner")
+	instruction, err := NewAmmInitialize2Instruction(ammInfo, userBase, userQuote, userLp, owner, 1_700_000_000, big.NewInt(5_000), big.NewInt(7_000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, nonce, err := solana.FindProgramAddress([][]byte{[]byte("amm authority")}, AMM_V4_PROGRAM_ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, _, err := solana.FindProgramAddress([][]byte{[]byte("amm_config_account_seed")}, AMM_V4_PROGRAM_ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := append([]byte{AMM_INSTRUCTION_INITIALIZE2, nonce}, instructionData(0, 1_700_000_000, 7_000, 5_000)[1:]...)
+	checkInstruction(t, instruction, data, solana.AccountMetaSlice{
+		solana.Meta(TOKEN_PROGRAM_ID),
+		solana.Meta(ASSOCIATED_TOKEN_PROGRAM_ID),
+		solana.Meta(solana.SystemProgramID),
+		solana.Meta(SYSVAR_RENT_PUBKEY),
+		solana.Meta(ammInfo.Id).WRITE(),
+		solana.Meta(ammInfo.Authority),
+		solana.Meta(ammInfo.OpenOrders).WRITE(),
+		solana.Meta(ammInfo.LpMint).WRITE(),
+		solana.Meta(ammInfo.BaseMint),
+		solana.Meta(ammInfo.QuoteMint),
+		solana.Meta(ammInfo.BaseVault).WRITE(),
+		solana.Meta(ammInfo.QuoteVault).WRITE(),
+		solana.Meta(ammInfo.TargetOrders).WRITE(),
+		solana.Meta(config),
+		solana.Meta(AMM_V4_CREATE_POOL_FEE_ADDRESS).WRITE(),
+		solana.Meta(OPENBOOK_PROGRAM_ID),
+		solana.Meta(marketId),
+		solana.Meta(owner).WRITE().SIGNER(),
+		solana.Meta(userBase).WRITE(),
+		solana.Meta(userQuote).WRITE(),
+		solana.Meta(userLp).WRITE(),
+	})
+
+	ammInfo.Authority = testPublicKey("other authority")
+	if _, err := NewAmmInitialize2Instruction(ammInfo, userBase, userQuote, userLp, owner, 0, big.NewInt(1), big.NewInt(1)); err == nil {
+		t.Error("accepted a pool authority the program does not own")
+	}
+}
@@ -0,0 +1,237 @@
+package raydium
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Default AMM v4 swap fee, used when only GetPoolData reserves are available.
+const (
+	LIQUIDITY_FEES_NUMERATOR   = 25
+	LIQUIDITY_FEES_DENOMINATOR = 10000
+)
+
+// AMM v4 pool statuses. Initialized, SwapOnly and WaitingTrade accept swaps;
+// Initialized and OrderBookOnly also keep liquidity on the order book.
+const (
+	AMM_STATUS_INITIALIZED     = 1
+	AMM_STATUS_ORDER_BOOK_ONLY = 5
+	AMM_STATUS_SWAP_ONLY       = 6
+	AMM_STATUS_WAITING_TRADE   = 7
+)
+
+var (
+	ErrTokenNotInPool = errors.New("token not match with pool")
+	ErrZeroReserves   = errors.New("pool has zero reserves")
+	ErrPoolNotOpen    = errors.New("pool not open for swaps")
+	ErrAmountOverflow = errors.New("amount overflows u64")
+)
+
+type AmmQuote struct {
+	AmountIn       *big.Int
+	AmountOut      *big.Int
+	MinAmountOut   *big.Int
+	MaxAmountIn    *big.Int
+	Fee            *big.Int
+	PriceImpact    decimal.Decimal
+	ExecutionPrice decimal.Decimal
+}
+
+// ReservesWithoutTakePnl returns the reserves the program prices swaps against:
+// the vault balances minus the pnl it still owes to the protocol.
+func (state *LiquidityStateV4) ReservesWithoutTakePnl(baseAmount, quoteAmount uint64) (*big.Int, *big.Int, error) {
+	if baseAmount < state.BaseNeedTakePnl || quoteAmount < state.QuoteNeedTakePnl {
+		return nil, nil, errors.New("vault balance below need take pnl")
+	}
+	base := new(big.Int).SetUint64(baseAmount - state.BaseNeedTakePnl)
+	quote := new(big.Int).SetUint64(quoteAmount - state.QuoteNeedTakePnl)
+	return base, quote, nil
+}
+
+// QuoteAmountOut quotes a swap_base_in against the pool's own swap fee.
+// baseAmount and quoteAmount are the pool token balances as seen by the
+// program, i.e. the vault balances plus any funds held in OpenOrders.
+func QuoteAmountOut(ctx context.Context, ammInfo *AmmInfo, state *LiquidityStateV4, baseAmount, quoteAmount uint64, inputToken *Token, outputToken *Token, amountIn *big.Int, slippage Slippage, clock Clock) (*AmmQuote, error) {
+	reserveIn, reserveOut, numerator, denominator, err := ammQuoteParams(ctx, ammInfo, state, baseAmount, quoteAmount, inputToken, outputToken, amountIn, clock)
+	if err != nil {
+		return nil, err
+	}
+
+	fee := ammSwapFee(amountIn, numerator, denominator)
+	amountInWithFee := new(big.Int).Sub(amountIn, fee)
+	amountOut := swapTokenAmountBaseIn(amountInWithFee, reserveIn, reserveOut)
+
+	return &AmmQuote{
+		AmountIn:       new(big.Int).Set(amountIn),
+		AmountOut:      amountOut,
+		MinAmountOut:   slippage.MinAmountOut(amountOut),
+		Fee:            fee,
+		PriceImpact:    ammPriceImpact(amountInWithFee, amountOut, reserveIn, reserveOut),
+		ExecutionPrice: ammExecutionPrice(amountIn, amountOut, inputToken, outputToken),
+	}, nil
+}
+
+// QuoteAmountIn quotes a swap_base_out: the input needed to receive exactly
+// amountOut, with the fee added on top the way the program does.
+func QuoteAmountIn(ctx context.Context, ammInfo *AmmInfo, state *LiquidityStateV4, baseAmount, quoteAmount uint64, inputToken *Token, outputToken *Token, amountOut *big.Int, slippage Slippage, clock Clock) (*AmmQuote, error) {
+	reserveIn, reserveOut, numerator, denominator, err := ammQuoteParams(ctx, ammInfo, state, baseAmount, quoteAmount, inputToken, outputToken, amountOut, clock)
+	if err != nil {
+		return nil, err
+	}
+
+	amountInWithoutFee, err := swapTokenAmountBaseOut(amountOut, reserveIn, reserveOut)
+	if err != nil {
+		return nil, err
+	}
+	amountIn := ammAddFee(amountInWithoutFee, numerator, denominator)
+	maxAmountIn := slippage.MaxAmountIn(amountIn)
+	if !maxAmountIn.IsUint64() {
+		return nil, fmt.Errorf("%w: max amount in %v", ErrAmountOverflow, maxAmountIn)
+	}
+
+	return &AmmQuote{
+		AmountIn:       amountIn,
+		AmountOut:      new(big.Int).Set(amountOut),
+		MaxAmountIn:    maxAmountIn,
+		Fee:            new(big.Int).Sub(amountIn, amountInWithoutFee),
+		PriceImpact:    ammPriceImpact(amountInWithoutFee, amountOut, reserveIn, reserveOut),
+		ExecutionPrice: ammExecutionPrice(amountIn, amountOut, inputToken, outputToken),
+	}, nil
+}
+
+func ammQuoteParams(ctx context.Context, ammInfo *AmmInfo, state *LiquidityStateV4, baseAmount, quoteAmount uint64, inputToken *Token, outputToken *Token, amount *big.Int, clock Clock) (reserveIn, reserveOut, numerator, denominator *big.Int, err error) {
+	now, err := chainTimestamp(ctx, clock)
+	if err != nil {
+		return
+	}
+	if err = checkAmmSwapOpen(state.Status, state.PoolOpenTime, now); err != nil {
+		return
+	}
+	if state.SwapFeeDenominator == 0 || state.SwapFeeNumerator >= state.SwapFeeDenominator {
+		err = fmt.Errorf("invalid swap fee %d/%d", state.SwapFeeNumerator, state.SwapFeeDenominator)
+		return
+	}
+	baseReserve, quoteReserve, err := state.ReservesWithoutTakePnl(baseAmount, quoteAmount)
+	if err != nil {
+		return
+	}
+	reserveIn, reserveOut, err = ammOrientReserves(ammInfo, baseReserve, quoteReserve, inputToken, outputToken, amount)
+	if err != nil {
+		return
+	}
+	numerator = new(big.Int).SetUint64(state.SwapFeeNumerator)
+	denominator = new(big.Int).SetUint64(state.SwapFeeDenominator)
+	return
+}
+
+// ammOrientReserves validates a swap request and returns the reserves in
+// input/output order.
+func ammOrientReserves(ammInfo *AmmInfo, baseReserve, quoteReserve *big.Int, inputToken *Token, outputToken *Token, amount *big.Int) (*big.Int, *big.Int, error) {
+	if !includesToken(ammInfo, inputToken) || !includesToken(ammInfo, outputToken) || inputToken.Mint.Equals(outputToken.Mint) {
+		return nil, nil, fmt.Errorf("%w: %v -> %v in pool %v", ErrTokenNotInPool, inputToken.Mint, outputToken.Mint, ammInfo.Id)
+	}
+	if amount == nil || amount.Sign() <= 0 {
+		return nil, nil, fmt.Errorf("invalid amount %v", amount)
+	}
+	if !amount.IsUint64() {
+		return nil, nil, fmt.Errorf("%w: %v", ErrAmountOverflow, amount)
+	}
+	if baseReserve == nil || quoteReserve == nil || baseReserve.Sign() <= 0 || quoteReserve.Sign() <= 0 {
+		return nil, nil, fmt.Errorf("%w: %v/%v", ErrZeroReserves, baseReserve, quoteReserve)
+	}
+
+	if inputToken.Mint.Equals(ammInfo.QuoteMint) {
+		return quoteReserve, baseReserve, nil
+	}
+	return baseReserve, quoteReserve, nil
+}
+
+// checkAmmSwapOpen mirrors the status check at the top of the program's swap
+// instructions: WaitingTrade pools only trade once pool_open_time has passed.
+func checkAmmSwapOpen(status uint64, openTime uint64, now uint64) error {
+	switch status {
+	case AMM_STATUS_INITIALIZED, AMM_STATUS_SWAP_ONLY:
+		return nil
+	case AMM_STATUS_WAITING_TRADE:
+		if now < openTime {
+			return fmt.Errorf("%w: opens at %v", ErrPoolNotOpen, time.Unix(int64(openTime), 0).UTC())
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: status %d", ErrPoolNotOpen, status)
+	}
+}
+
+// ammSwapFee is amountIn * numerator / denominator rounded the way the
+// program's CheckedCeilDiv does.
+func ammSwapFee(amountIn, numerator, denominator *big.Int) *big.Int {
+	return ammCeilDiv(new(big.Int).Mul(amountIn, numerator), denominator)
+}
+
+// ammCeilDiv mirrors CheckedCeilDiv in the AMM program: a quotient below one is
+// rounded half up instead of always up.
+func ammCeilDiv(dividend, divisor *big.Int) *big.Int {
+	quotient, remainder := new(big.Int).QuoRem(dividend, divisor, new(big.Int))
+	if quotient.Sign() == 0 {
+		if new(big.Int).Lsh(dividend, 1).Cmp(divisor) >= 0 {
+			return big.NewInt(1)
+		}
+		return big.NewInt(0)
+	}
+	if remainder.Sign() > 0 {
+		quotient.Add(quotient, big.NewInt(1))
+	}
+	return quotient
+}
+
+// swapTokenAmountBaseIn solves (in + amountIn) * (out - amountOut) = in * out
+// for amountOut, rounding down.
+func swapTokenAmountBaseIn(amountIn, reserveIn, reserveOut *big.Int) *big.Int {
+	denominator := new(big.Int).Add(reserveIn, amountIn)
+	return new(big.Int).Div(new(big.Int).Mul(reserveOut, amountIn), denominator)
+}
+
+// swapTokenAmountBaseOut solves the same invariant for amountIn, rounding
+// with CheckedCeilDiv like the program.
+func swapTokenAmountBaseOut(amountOut, reserveIn, reserveOut *big.Int) (*big.Int, error) {
+	if amountOut.Cmp(reserveOut) >= 0 {
+		return nil, fmt.Errorf("amount out %v exceeds pool reserve %v", amountOut, reserveOut)
+	}
+	denominator := new(big.Int).Sub(reserveOut, amountOut)
+	amountIn := ammCeilDiv(new(big.Int).Mul(reserveIn, amountOut), denominator)
+	if !amountIn.IsUint64() {
+		return nil, fmt.Errorf("%w: amount in %v", ErrAmountOverflow, amountIn)
+	}
+	return amountIn, nil
+}
+
+// ammAddFee grosses amountIn up so that the fee taken by swap_base_out
+// leaves amountIn for the curve.
+func ammAddFee(amountIn, numerator, denominator *big.Int) *big.Int {
+	return ammCeilDiv(new(big.Int).Mul(amountIn, denominator), new(big.Int).Sub(denominator, numerator))
+}
+
+func ammPriceImpact(amountInWithFee, amountOut, reserveIn, reserveOut *big.Int) decimal.Decimal {
+	if reserveIn.Sign() == 0 {
+		return decimal.Zero
+	}
+	exactQuote := decimal.NewFromBigInt(amountInWithFee, 0).Mul(decimal.NewFromBigInt(reserveOut, 0)).Div(decimal.NewFromBigInt(reserveIn, 0))
+	if exactQuote.IsZero() {
+		return decimal.Zero
+	}
+	return exactQuote.Sub(decimal.NewFromBigInt(amountOut, 0)).Abs().Div(exactQuote)
+}
+
+func ammExecutionPrice(amountIn, amountOut *big.Int, inputToken *Token, outputToken *Token) decimal.Decimal {
+	if amountIn.Sign() == 0 {
+		return decimal.Zero
+	}
+	in := decimal.NewFromBigInt(amountIn, -int32(inputToken.Decimals))
+	out := decimal.NewFromBigInt(amountOut, -int32(outputToken.Decimals))
+	return out.Div(in)
+}
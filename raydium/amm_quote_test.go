@@ -0,0 +1,223 @@
+package raydium
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+var (
+	RAY_MINT = solana.MustPublicKeyFromBase58("4k3Dyjzvzp8eMZWUXbBCjEvwSkkk59S5iCNLY3QrkX6R")
+
+	onePercent = Slippage{rate: big.NewRat(1, 100)}
+
+	testTime  = time.Unix(1_700_000_000, 0)
+	testClock = NewFixedClock(testTime)
+
+	rayToken  = &Token{ProgramId: TOKEN_PROGRAM_ID, Mint: RAY_MINT, Decimals: 6, Symbol: "RAY", Name: "RAY"}
+	wsolToken = &Token{ProgramId: TOKEN_PROGRAM_ID, Mint: WSOL_MINT, Decimals: 9, Symbol: "WSOL", Name: "WSOL"}
+)
+
+// Reserves and result of the swap logged in amm_test.go:
+// ray_log: A+gDAAAAAAAAUgAAAAAAAAABAAAAAAAAAOgDAAAAAAAAHodcPlgDAAC9rZJn7ycAAFMAAAAAAAAA
+// amount_in=1000 minimum_out=82 direction=PC2Coin pool_coin=3677538256670 pool_pc=43909188332989 out_amount=83
+const (
+	rayLogPoolCoin  = 3677538256670
+	rayLogPoolPc    = 43909188332989
+	rayLogAmountIn  = 1000
+	rayLogAmountOut = 83
+)
+
+func rayWsolFixture() (*AmmInfo, *LiquidityStateV4) {
+	ammInfo := &AmmInfo{
+		Id:        solana.MustPublicKeyFromBase58("AVs9TA4nWDzfPJE9gGVNJMVhcQy3V9PGazuz33BfG2RA"),
+		BaseMint:  RAY_MINT,
+		QuoteMint: WSOL_MINT,
+	}
+	state := &LiquidityStateV4{
+		Status:              6,
+		BaseDecimal:         6,
+		QuoteDecimal:        9,
+		TradeFeeNumerator:   25,
+		TradeFeeDenominator: 10000,
+		SwapFeeNumerator:    25,
+		SwapFeeDenominator:  10000,
+		BaseNeedTakePnl:     1_234_567,
+		QuoteNeedTakePnl:    89_000,
+	}
+	return ammInfo, state
+}
+
+func TestQuoteAmountOutMatchesRayLog(t *testing.T) {
+	ammInfo, state := rayWsolFixture()
+	quote, err := QuoteAmountOut(
+		context.Background(),
+		ammInfo,
+		state,
+		rayLogPoolCoin+state.BaseNeedTakePnl,
+		rayLogPoolPc+state.QuoteNeedTakePnl,
+		wsolToken,
+		rayToken,
+		big.NewInt(rayLogAmountIn),
+		onePercent,
+		testClock,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quote.AmountOut.Int64() != rayLogAmountOut {
+		t.Errorf("amount out: got %v, want %v", quote.AmountOut, rayLogAmountOut)
+	}
+	if quote.Fee.Int64() != 3 {
+		t.Errorf("fee: got %v, want 3", quote.Fee)
+	}
+	if quote.MinAmountOut.Int64() != 82 {
+		t.Errorf("min amount out: got %v, want 82", quote.MinAmountOut)
+	}
+	if quote.PriceImpact.IsNegative() || quote.ExecutionPrice.Sign() <= 0 {
+		t.Errorf("unexpected impact %v / price %v", quote.PriceImpact, quote.ExecutionPrice)
+	}
+}
+
+func TestQuoteAmountOutUsesPoolFee(t *testing.T) {
+	ammInfo, state := rayWsolFixture()
+	amountIn := big.NewInt(1_000_000_000)
+
+	standard, err := QuoteAmountOut(context.Background(), ammInfo, state, rayLogPoolCoin+state.BaseNeedTakePnl, rayLogPoolPc+state.QuoteNeedTakePnl, wsolToken, rayToken, amountIn, onePercent, testClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.SwapFeeNumerator = 100
+	expensive, err := QuoteAmountOut(context.Background(), ammInfo, state, rayLogPoolCoin+state.BaseNeedTakePnl, rayLogPoolPc+state.QuoteNeedTakePnl, wsolToken, rayToken, amountIn, onePercent, testClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if standard.Fee.Int64() != 2_500_000 || expensive.Fee.Int64() != 10_000_000 {
+		t.Errorf("fees: got %v and %v", standard.Fee, expensive.Fee)
+	}
+	if expensive.AmountOut.Cmp(standard.AmountOut) >= 0 {
+		t.Errorf("higher fee should quote less: %v >= %v", expensive.AmountOut, standard.AmountOut)
+	}
+}
+
+func TestReservesWithoutTakePnl(t *testing.T) {
+	_, state := rayWsolFixture()
+	base, quote, err := state.ReservesWithoutTakePnl(rayLogPoolCoin+state.BaseNeedTakePnl, rayLogPoolPc+state.QuoteNeedTakePnl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base.Int64() != rayLogPoolCoin || quote.Int64() != rayLogPoolPc {
+		t.Errorf("got %v/%v", base, quote)
+	}
+	if _, _, err := state.ReservesWithoutTakePnl(0, 0); err == nil {
+		t.Error("expected error for vaults below need take pnl")
+	}
+}
+
+func TestAmmCeilDiv(t *testing.T) {
+	cases := []struct{ dividend, divisor, want int64 }{
+		{25000, 10000, 3},
+		{20000, 10000, 2},
+		{5000, 10000, 1},
+		{4999, 10000, 0},
+		{0, 10000, 0},
+	}
+	for _, c := range cases {
+		if got := ammCeilDiv(big.NewInt(c.dividend), big.NewInt(c.divisor)); got.Int64() != c.want {
+			t.Errorf("ceil(%d/%d): got %v, want %d", c.dividend, c.divisor, got, c.want)
+		}
+	}
+}
+
+func TestQuoteAmountIn(t *testing.T) {
+	ammInfo, state := rayWsolFixture()
+	baseAmount, quoteAmount := uint64(rayLogPoolCoin)+state.BaseNeedTakePnl, uint64(rayLogPoolPc)+state.QuoteNeedTakePnl
+
+	cases := []struct{ amountOut, amountIn, maxAmountIn int64 }{
+		{rayLogAmountOut, 995, 1004},
+		{1_000_000, 11_969_761, 12_089_458},
+	}
+	for _, c := range cases {
+		quote, err := QuoteAmountIn(context.Background(), ammInfo, state, baseAmount, quoteAmount, wsolToken, rayToken, big.NewInt(c.amountOut), onePercent, testClock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if quote.AmountIn.Int64() != c.amountIn || quote.MaxAmountIn.Int64() != c.maxAmountIn {
+			t.Errorf("out %d: got in %v max %v, want %d max %d", c.amountOut, quote.AmountIn, quote.MaxAmountIn, c.amountIn, c.maxAmountIn)
+		}
+
+		// Spending the quoted input with swap_base_in must yield at least the requested output.
+		back, err := QuoteAmountOut(context.Background(), ammInfo, state, baseAmount, quoteAmount, wsolToken, rayToken, quote.AmountIn, onePercent, testClock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if back.AmountOut.Int64() < c.amountOut {
+			t.Errorf("out %d: swapping %v in only yields %v", c.amountOut, quote.AmountIn, back.AmountOut)
+		}
+	}
+
+	if _, err := QuoteAmountIn(context.Background(), ammInfo, state, baseAmount, quoteAmount, wsolToken, rayToken, big.NewInt(rayLogPoolCoin), onePercent, testClock); err == nil {
+		t.Error("expected error when asking for the whole reserve")
+	}
+}
+
+func TestQuoteErrors(t *testing.T) {
+	ammInfo, state := rayWsolFixture()
+	baseAmount, quoteAmount := uint64(rayLogPoolCoin)+state.BaseNeedTakePnl, uint64(rayLogPoolPc)+state.QuoteNeedTakePnl
+	usdc := &Token{ProgramId: TOKEN_PROGRAM_ID, Mint: TOKEN_PROGRAM_ID, Decimals: 6}
+
+	if _, err := QuoteAmountOut(context.Background(), ammInfo, state, baseAmount, quoteAmount, usdc, rayToken, big.NewInt(1000), onePercent, testClock); !errors.Is(err, ErrTokenNotInPool) {
+		t.Errorf("foreign token: got %v", err)
+	}
+	if _, err := QuoteAmountOut(context.Background(), ammInfo, state, baseAmount, quoteAmount, rayToken, rayToken, big.NewInt(1000), onePercent, testClock); !errors.Is(err, ErrTokenNotInPool) {
+		t.Errorf("same token: got %v", err)
+	}
+	if _, err := QuoteAmountOut(context.Background(), ammInfo, state, state.BaseNeedTakePnl, quoteAmount, wsolToken, rayToken, big.NewInt(1000), onePercent, testClock); !errors.Is(err, ErrZeroReserves) {
+		t.Errorf("zero reserves: got %v", err)
+	}
+	if _, err := QuoteAmountOut(context.Background(), ammInfo, state, baseAmount, quoteAmount, wsolToken, rayToken, new(big.Int).Lsh(big.NewInt(1), 64), onePercent, testClock); !errors.Is(err, ErrAmountOverflow) {
+		t.Errorf("overflow: got %v", err)
+	}
+
+	state.Status = AMM_STATUS_WAITING_TRADE
+	state.PoolOpenTime = uint64(testTime.Unix()) + 1
+	if _, err := QuoteAmountIn(context.Background(), ammInfo, state, baseAmount, quoteAmount, wsolToken, rayToken, big.NewInt(1000), onePercent, testClock); !errors.Is(err, ErrPoolNotOpen) {
+		t.Errorf("waiting trade: got %v", err)
+	}
+	state.PoolOpenTime = uint64(testTime.Unix())
+	if _, err := QuoteAmountIn(context.Background(), ammInfo, state, baseAmount, quoteAmount, wsolToken, rayToken, big.NewInt(1000), onePercent, testClock); err != nil {
+		t.Errorf("waiting trade at open time: got %v", err)
+	}
+	state.Status = 4
+	state.PoolOpenTime = 0
+	if _, err := QuoteAmountIn(context.Background(), ammInfo, state, baseAmount, quoteAmount, wsolToken, rayToken, big.NewInt(1000), onePercent, testClock); !errors.Is(err, ErrPoolNotOpen) {
+		t.Errorf("disabled pool: got %v", err)
+	}
+}
+
+func TestComputeAmountOutFromPoolInfo(t *testing.T) {
+	ammInfo, _ := rayWsolFixture()
+	poolInfo := &PoolInfo{
+		Status:       big.NewInt(AMM_STATUS_SWAP_ONLY),
+		BaseReserve:  big.NewInt(rayLogPoolCoin),
+		QuoteReserve: big.NewInt(rayLogPoolPc),
+	}
+	amountOut, minAmountOut, err := ComputeAmountOut(context.Background(), ammInfo, poolInfo, wsolToken, rayToken, big.NewInt(rayLogAmountIn), onePercent, testClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if amountOut.Int64() != rayLogAmountOut || minAmountOut.Int64() != 82 {
+		t.Errorf("got %v/%v", amountOut, minAmountOut)
+	}
+
+	poolInfo.StartTime = int(testTime.Unix()) + 1
+	poolInfo.Status = big.NewInt(AMM_STATUS_WAITING_TRADE)
+	if _, _, err := ComputeAmountOut(context.Background(), ammInfo, poolInfo, wsolToken, rayToken, big.NewInt(rayLogAmountIn), onePercent, testClock); !errors.Is(err, ErrPoolNotOpen) {
+		t.Errorf("got %v, want ErrPoolNotOpen", err)
+	}
+}
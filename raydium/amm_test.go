@@ -4,11 +4,8 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/base64"
-	"encoding/binary"
-	"encoding/json"
-	"fmt"
 	"math/big"
-	"strings"
+	"os"
 	"testing"
 	"time"
 
@@ -16,23 +13,29 @@ import (
 	"github.com/gagliardetto/solana-go"
 	addresslookuptable "github.com/gagliardetto/solana-go/programs/address-lookup-table"
 	computebudget "github.com/gagliardetto/solana-go/programs/compute-budget"
-	"github.com/gagliardetto/solana-go/programs/system"
 	"github.com/gagliardetto/solana-go/rpc"
 )
 
 var (
-	WSOL_MINT                   = solana.MustPublicKeyFromBase58("So11111111111111111111111111111111111111112")
-	SYSVAR_RENT_PUBKEY          = solana.MustPublicKeyFromBase58("SysvarRent111111111111111111111111111111111")
-	ASSOCIATED_TOKEN_PROGRAM_ID = solana.MustPublicKeyFromBase58("ATokenGPvbdGVxr1b2hvZbsiqW5xWH25efTNsLJA8knL")
-	SYSTEM_PROGRAM_ID           = solana.MustPublicKeyFromBase58("11111111111111111111111111111111")
+	SYSTEM_PROGRAM_ID = solana.MustPublicKeyFromBase58("11111111111111111111111111111111")
 )
 
+// liveRpcClient connects to RAYDIUM_RPC_URL. Tests that need mainnet state
+// skip without it.
+func liveRpcClient(tb testing.TB) *rpc.Client {
+	endpoint := os.Getenv("RAYDIUM_RPC_URL")
+	if endpoint == "" {
+		tb.Skip("RAYDIUM_RPC_URL not set")
+	}
+	return rpc.New(endpoint)
+}
+
 func TestGetAmmInfo(t *testing.T) {
 
 	key := solana.MustPublicKeyFromBase58("2immgwYNHBbyVQKVGCEkgWpi53bLwWNRMB5G2nbgYV17")
 	t.Log(key)
 
-	data, err := base64.StdEncoding.DecodeString("AQAAAP//////////d49+DAAAAAAAAQZMWvw7GUNJdaccNBVnb57OKakxL2BHLYvhRwVILRsgAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAMGRm/lIRcy/+ytunLDm+e8jOW7xfcSayxDmzpAAAAABt324ddloZPZy+FGzut5rBy0he1fWzeROoz1hX7/AKkG3fbh7nWP3hhCXbzkbM3athr8TYO5DSf+vfko2KGL/AVKU1D4XciC1hSlVnJ4iilt3x6rq9CmBniISTL07vagBqfVFxksXFEhjMlMPUrxf1ja7gibof1E49vZigAAAAAGp9UXGMd0yShWY5hpHV62i164o5tLbVxzVVshAAAAAIyXJY9OJInxuz0QKRSODYMLWhOZ2v8QhASOe9jb6fhZC3BlsePRfEU4nVJ/awTDzVi4bHMaoP21SbbRvAP4KUbIScv+6Yw2LHF/6K0ZjUPibbSWXCirYPGuuVl7zT789IUPLW4CpHr4JNCatp3ELXDLKMv6JJ+37le50lbBJ2LvDQdRqCgtphMF/imcN7mY5YRx2xE1A3MQ+L4QRaYK9u4GRfZP3LsAd00a+IkCpA22UNQMKdq5BFbJuwuOLqc8zxCTDlqxBG8J0HcxtfogQHDK06ukzfaXiNDKAob1MqBHS9lJxDYCwz8gd5DtFqNSTKG5l1zxIaKpDP/sffi2is1H9aKveyXSu5StXElYRl9SD5As0DHE4N0GLnf84/siiKXVyp4Ez121kLcUui/jLLFZEz/BwZK3Ilf9B9OcsEAeDMKAy2vjGSxQODgBz0QwGA+eP4ZjIjrIAQaXENv31QfLlOdXSRCkaybRniDHF4C8YcwhcvsqrOVuTP4B2Na+9wLdtrB31uz2rtlFI5kahdsnp/d1SrASDInYCtTYtdoke4kX+hoKWcEWM4Tle8pTUkUVv4BxS6fje/EzKBE4Qu9N9LMnrw/JNO0hqMVB4rk/2ou4AB1loQ7FZoPwut2o4KZB+0p9xnbrQKw038qjpHar+PyDwvxBRcu5hpHw3dguezeWv+IwvgW5icu8EGkhGa9AkFPPJT7VMSFb8xowveU=")
+	data, err := base64.StdEncoding.DecodeString(lookupTableFixture)
 	if err != nil {
 		t.Error(err)
 	}
@@ -42,10 +45,11 @@ func TestGetAmmInfo(t *testing.T) {
 		t.Error(err)
 	}
 
-	client := rpc.New("https://aged-morning-glade.solana-mainnet.quiknode.pro/b57bbb1a4c8bdd409e1ac53aaedead26da057f59/")
+	client := liveRpcClient(t)
+	fetcher := NewRpcAccountFetcher(client)
 
-	// ammInfo, err := GetAmmInfo(client, "EVzLJhqMtdC1nPmz8rNd6xGfVjDPxpLZgq7XJuNfMZ6", solana.PublicKey{})
-	ammInfo, err := GetAmmInfo(client, "AVs9TA4nWDzfPJE9gGVNJMVhcQy3V9PGazuz33BfG2RA", solana.PublicKey{})
+	// ammInfo, err := GetAmmInfo(context.Background(), fetcher, "EVzLJhqMtdC1nPmz8rNd6xGfVjDPxpLZgq7XJuNfMZ6", nil)
+	ammInfo, err := GetAmmInfo(context.Background(), fetcher, "AVs9TA4nWDzfPJE9gGVNJMVhcQy3V9PGazuz33BfG2RA", nil)
 	if err != nil {
 		t.Error(err)
 	}
@@ -58,53 +62,11 @@ func TestGetAmmInfo(t *testing.T) {
 		t.Error(err)
 	}
 
-	tx, err := solana.NewTransaction(
-		[]solana.Instruction{
-			solana.NewInstruction(ammInfo.ProgramId, []*solana.AccountMeta{
-				{PublicKey: ammInfo.Id},
-				{PublicKey: ammInfo.Authority},
-				{PublicKey: ammInfo.OpenOrders},
-				{PublicKey: ammInfo.BaseVault},
-				{PublicKey: ammInfo.QuoteVault},
-				{PublicKey: ammInfo.LpMint},
-				{PublicKey: ammInfo.MarketId},
-				{PublicKey: ammInfo.MarketEventQueue},
-			}, []byte{12, 0}),
-		},
-		recentBlockhashResult.Value.Blockhash,
-		solana.TransactionPayer(solana.MustPublicKeyFromBase58("RaydiumSimuLateTransaction11111111111111111")),
-	)
-	tx.Signatures = append(tx.Signatures, solana.Signature{})
-	if err != nil {
-		t.Error(err)
-	}
-
-	simulateTransactionResponse, err := client.SimulateTransactionWithOpts(context.TODO(), tx, &rpc.SimulateTransactionOpts{ReplaceRecentBlockhash: true})
+	poolInfos, err := NewSimulatePoolInfoFetcher(fetcher).FetchPoolInfos(context.Background(), []*AmmInfo{ammInfo})
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
-
-	var logs []string
-	for _, log := range simulateTransactionResponse.Value.Logs {
-		if !strings.Contains(log, "GetPoolData") {
-			continue
-		}
-		logs = append(logs, log)
-	}
-	t.Log(logs)
-
 	t.Log("Fetch info: ", time.Since(start))
-
-	var poolInfos []*PoolInfo
-	for _, log := range logs {
-		jsonStr := log[strings.Index(log, "{") : strings.LastIndex(log, "}")+1]
-		var poolInfo PoolInfo
-		if err := json.Unmarshal([]byte(jsonStr), &poolInfo); err != nil {
-			t.Error(err)
-		}
-		t.Log(poolInfo)
-		poolInfos = append(poolInfos, &poolInfo)
-	}
 	t.Log(poolInfos)
 
 	inputTokenMint := WSOL_MINT
@@ -112,7 +74,12 @@ func TestGetAmmInfo(t *testing.T) {
 	userAccount := solana.MustPublicKeyFromBase58("4d6MQwQC21eXMWToBiTL3UbknXwN3xzZ5Af8EyED4554")
 	amountIn := big.NewInt(1000)
 
-	amountOut, minAmountOut := ComputeAmountOut(
+	slippage, err := NewSlippageFromBps(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	amountOut, minAmountOut, err := ComputeAmountOut(
+		context.Background(),
 		ammInfo,
 		poolInfos[0],
 		&Token{
@@ -130,57 +97,55 @@ func TestGetAmmInfo(t *testing.T) {
 			Name:      "RAY",
 		},
 		amountIn,
-		1,
+		slippage,
+		NewSysvarClock(fetcher),
 	)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	t.Log(amountOut, minAmountOut)
 
-	tokenAccountsResult, err := client.GetTokenAccountsByOwner(
-		context.TODO(),
-		userAccount,
-		&rpc.GetTokenAccountsConfig{
-			ProgramId: &TOKEN_PROGRAM_ID,
-		},
-		nil,
-	)
+	tokenAccounts, err := FetchTokenAccounts(context.Background(), fetcher, userAccount)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
-	t.Log(tokenAccountsResult)
-
-	var tokenAccounts []*TokenAccount
-	for _, account := range tokenAccountsResult.Value {
-		tokenAccounts = append(tokenAccounts, &TokenAccount{
-			PublicKey:   account.Pubkey,
-			ProgramId:   account.Account.Owner,
-			AccountInfo: NewSplAccountFromBytes(account.Account.Data.GetBinary()),
-		})
-	}
-	t.Log(tokenAccounts)
-
-	tokenAccountIn := selectTokenAccount(tokenAccounts, inputTokenMint, userAccount, false)
-	if tokenAccountIn != nil {
-		t.Log(tokenAccountIn)
-	}
-
-	tokenAccountOut := selectTokenAccount(tokenAccounts, outputTokenMint, userAccount, true)
-	if tokenAccountOut != nil {
-		t.Log(tokenAccountOut)
-	}
-
-	tokenInPubKey, frontInstructionsIn, endInstructionsIn := handleTokenAccount(client, tokenAccountIn, "in", amountIn, inputTokenMint, userAccount, TOKEN_PROGRAM_ID)
-	tokenOutPubKey, frontInstructionsOut, endInstructionsOut := handleTokenAccount(client, tokenAccountOut, "out", big.NewInt(0), outputTokenMint, userAccount, TOKEN_PROGRAM_ID)
-	swapInstruction := makeSwapInstruction(ammInfo, tokenInPubKey, tokenOutPubKey, userAccount, amountIn, minAmountOut, "in")
-	t.Log("tokenInPubKey", tokenInPubKey, "tokenOutPubKey", tokenOutPubKey)
-	var instructions []solana.Instruction
-	instructions = append(instructions, computebudget.NewSetComputeUnitLimitInstruction(10000000).Build())
-	instructions = append(instructions, computebudget.NewSetComputeUnitPriceInstruction(10).Build())
-	instructions = append(instructions, frontInstructionsIn...)
-	instructions = append(instructions, frontInstructionsOut...)
-	instructions = append(instructions, swapInstruction)
-	instructions = append(instructions, endInstructionsIn...)
-	instructions = append(instructions, endInstructionsOut...)
-	tx, err = solana.NewTransaction(
+	rent, err := client.GetMinimumBalanceForRentExemption(context.Background(), uint64(SPL_ACCOUNT_SIZE), rpc.CommitmentConfirmed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	planIn, err := PlanTokenAccount(tokenAccounts, &TokenAccountRequest{
+		Owner:              userAccount,
+		Mint:               inputTokenMint,
+		TokenProgramId:     TOKEN_PROGRAM_ID,
+		Amount:             amountIn.Uint64(),
+		WrapSol:            WRAP_SOL_SEEDED,
+		Seed:               solana.NewWallet().PublicKey().String()[:32],
+		RentExemptLamports: rent,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	planOut, err := PlanTokenAccount(tokenAccounts, &TokenAccountRequest{
+		Owner:          userAccount,
+		Mint:           outputTokenMint,
+		TokenProgramId: TOKEN_PROGRAM_ID,
+		AssociatedOnly: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	swapInstruction, err := NewAmmSwapBaseInInstruction(ammInfo, planIn.Account, planOut.Account, userAccount, amountIn, minAmountOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("tokenInPubKey", planIn.Account, "tokenOutPubKey", planOut.Account)
+	instructions := WithTokenAccounts([]solana.Instruction{
+		computebudget.NewSetComputeUnitLimitInstruction(10000000).Build(),
+		computebudget.NewSetComputeUnitPriceInstruction(10).Build(),
+		swapInstruction,
+	}, planIn, planOut)
+	tx, err := solana.NewTransaction(
 		instructions,
 		recentBlockhashResult.Value.Blockhash,
 		solana.TransactionPayer(userAccount),
@@ -193,174 +158,13 @@ func TestGetAmmInfo(t *testing.T) {
 	}
 	tx.Signatures = append(tx.Signatures, solana.Signature{})
 	// "Create: address CwQcFzbLDdo2GLPDq1KVs6pFBdRv2wN8Bbxsn64mUwGP does not match derived address HiB5NeyoFbcvwsqyYiiQsdT5ZvdnwXdcwYfeQXH7Nxwp"
-	simulateTransactionResponse, err = client.SimulateTransactionWithOpts(context.TODO(), tx, &rpc.SimulateTransactionOpts{ReplaceRecentBlockhash: true})
+	simulateTransactionResponse, err := client.SimulateTransactionWithOpts(context.TODO(), tx, &rpc.SimulateTransactionOpts{ReplaceRecentBlockhash: true})
 	if err != nil {
 		t.Error(err)
 	}
 	t.Log(simulateTransactionResponse.Value.Logs)
 }
 
-func makeSwapInstruction(ammInfo *AmmInfo, tokenInPubKey, tokenOutPubKey, owner solana.PublicKey, amountIn, amountOut *big.Int, fixedSide string) solana.Instruction {
-	data := make([]byte, 1+8+8)
-	data[0] = 9
-	binary.LittleEndian.PutUint64(data[1:], amountIn.Uint64())
-	binary.LittleEndian.PutUint64(data[9:], amountOut.Uint64())
-
-	return solana.NewInstruction(
-		ammInfo.ProgramId,
-		[]*solana.AccountMeta{
-			{PublicKey: TOKEN_PROGRAM_ID},
-			{PublicKey: ammInfo.Id, IsWritable: true},
-			{PublicKey: ammInfo.Authority},
-			{PublicKey: ammInfo.OpenOrders, IsWritable: true},
-			{PublicKey: ammInfo.TargetOrders, IsWritable: true},
-			{PublicKey: ammInfo.BaseVault, IsWritable: true},
-			{PublicKey: ammInfo.QuoteVault, IsWritable: true},
-			{PublicKey: ammInfo.MarketProgramId},
-			{PublicKey: ammInfo.MarketId, IsWritable: true},
-			{PublicKey: ammInfo.MarketBids, IsWritable: true},
-			{PublicKey: ammInfo.MarketAsks, IsWritable: true},
-			{PublicKey: ammInfo.MarketEventQueue, IsWritable: true},
-			{PublicKey: ammInfo.MarketBaseVault, IsWritable: true},
-			{PublicKey: ammInfo.MarketQuoteVault, IsWritable: true},
-			{PublicKey: ammInfo.MarketAuthority},
-			{PublicKey: tokenInPubKey, IsWritable: true},
-			{PublicKey: tokenOutPubKey, IsWritable: true},
-			{PublicKey: owner, IsSigner: true, IsWritable: true},
-		},
-		data,
-	)
-}
-
-func selectTokenAccount(tokenAccounts []*TokenAccount, mint solana.PublicKey, owner solana.PublicKey, associatedOnly bool) *TokenAccount {
-	var nonEmptyAccounts []*TokenAccount
-	for _, account := range tokenAccounts {
-		if account.AccountInfo.Amount > 0 {
-			nonEmptyAccounts = append(nonEmptyAccounts, account)
-			fmt.Println(account)
-		}
-	}
-
-	ata, _, err := solana.FindProgramAddress([][]byte{owner.Bytes(), TOKEN_PROGRAM_ID[:], mint.Bytes()}, solana.MustPublicKeyFromBase58("ATokenGPvbdGVxr1b2hvZbsiqW5xWH25efTNsLJA8knL"))
-	if err != nil {
-		panic(err)
-	}
-
-	for _, account := range nonEmptyAccounts {
-		if solana.PublicKeyFromBytes(account.AccountInfo.Mint[:]).Equals(mint) {
-			if associatedOnly {
-				if ata.Equals(account.PublicKey) {
-					return account
-				}
-			} else {
-				return account
-			}
-		}
-	}
-	return nil
-}
-
-func handleTokenAccount(client *rpc.Client, tokenAccount *TokenAccount, side string, amount *big.Int, mint solana.PublicKey, owner solana.PublicKey, programId solana.PublicKey) (solana.PublicKey, []solana.Instruction, []solana.Instruction) {
-	ata, _, err := solana.FindProgramAddress([][]byte{owner.Bytes(), TOKEN_PROGRAM_ID[:], mint.Bytes()}, solana.MustPublicKeyFromBase58("ATokenGPvbdGVxr1b2hvZbsiqW5xWH25efTNsLJA8knL"))
-	if err != nil {
-		panic(err)
-	}
-
-	if WSOL_MINT.Equals(mint) {
-		newTokenAccount, frontInstructions := insertCreateWrappedNativeAccount(client, amount, owner, mint, programId)
-		endInstructions := []solana.Instruction{createCloseAccountInstruction(newTokenAccount, owner, owner, programId)}
-		return newTokenAccount, frontInstructions, endInstructions
-	} else if tokenAccount == nil || (side == "out" && !ata.Equals(tokenAccount.PublicKey)) {
-		instruction := makeCreateAssociatedTokenAccountInstruction(owner, ata, mint, programId)
-		return ata, []solana.Instruction{instruction}, nil
-	}
-
-	return tokenAccount.PublicKey, nil, nil
-}
-
-func makeCreateAssociatedTokenAccountInstruction(owner, associatedTokenAccount, mint, programId solana.PublicKey) solana.Instruction {
-	return solana.NewInstruction(
-		ASSOCIATED_TOKEN_PROGRAM_ID,
-		[]*solana.AccountMeta{
-			{PublicKey: owner, IsSigner: true, IsWritable: true},
-			{PublicKey: associatedTokenAccount, IsWritable: true},
-			{PublicKey: owner},
-			{PublicKey: mint},
-			{PublicKey: SYSTEM_PROGRAM_ID},
-			{PublicKey: programId},
-		},
-		[]byte{},
-	)
-}
-
-func createCloseAccountInstruction(account, destination, authrity, programId solana.PublicKey) solana.Instruction {
-	return solana.NewInstruction(
-		programId,
-		[]*solana.AccountMeta{
-			{PublicKey: account, IsWritable: true},
-			{PublicKey: destination, IsWritable: true},
-			{PublicKey: authrity, IsSigner: true, IsWritable: true},
-		},
-		[]byte{9},
-	)
-}
-
-func insertCreateWrappedNativeAccount(client *rpc.Client, amount *big.Int, owner, mint, programId solana.PublicKey) (solana.PublicKey, []solana.Instruction) {
-	return makeCreateWrappedNativeAccountInstructions(client, amount, owner, mint, programId)
-}
-
-func makeCreateWrappedNativeAccountInstructions(client *rpc.Client, amount *big.Int, owner, mint, programId solana.PublicKey) (solana.PublicKey, []solana.Instruction) {
-	balanceNeeded, err := getMinimumBalanceForRentExemption(client)
-	if err != nil {
-		panic(err)
-	}
-
-	var instructions []solana.Instruction
-	lamports := new(big.Int).Add(amount, big.NewInt(int64(balanceNeeded)))
-	fmt.Println(owner, TOKEN_PROGRAM_ID)
-	newAccount, seed := generatePubKey(owner, TOKEN_PROGRAM_ID)
-	instructions = append(instructions, system.NewCreateAccountWithSeedInstruction(
-		owner, // TODO
-		seed,
-		lamports.Uint64(),
-		uint64(SPL_ACCOUNT_SIZE),
-		TOKEN_PROGRAM_ID,
-		owner,
-		newAccount,
-		owner, // TODO
-	).Build())
-	instructions = append(instructions, createInitializeAccountInstruction(newAccount, mint, owner, programId))
-
-	return newAccount, instructions
-}
-
-func createInitializeAccountInstruction(account, mint, owner, programId solana.PublicKey) solana.Instruction {
-	return solana.NewInstruction(
-		TOKEN_PROGRAM_ID,
-		[]*solana.AccountMeta{
-			{PublicKey: account, IsWritable: true},
-			{PublicKey: mint},
-			{PublicKey: owner},
-			{PublicKey: SYSVAR_RENT_PUBKEY},
-		},
-		[]byte{1},
-	)
-}
-
-func generatePubKey(fromPublicKey solana.PublicKey, programId solana.PublicKey) (solana.PublicKey, string) {
-	seed := solana.NewWallet().PublicKey().String()[0:32]
-	var buffer []byte
-	buffer = append(buffer, fromPublicKey.Bytes()...)
-	buffer = append(buffer, []byte(seed)...)
-	buffer = append(buffer, programId.Bytes()...)
-	publicKeyBytes := sha256.Sum256(buffer)
-	return solana.PublicKeyFromBytes(publicKeyBytes[:]), seed
-}
-
-func getMinimumBalanceForRentExemption(client *rpc.Client) (uint64, error) {
-	return client.GetMinimumBalanceForRentExemption(context.TODO(), uint64(SPL_ACCOUNT_SIZE), rpc.CommitmentConfirmed)
-}
-
 // market id 56ZNe9c73XrizrXXqzPd9xdjNPGpxsWbiV4RszFKfBL8
 // market event queue 7Yb9UPpS6ykpFrWjrNRi37JUzynCbs4BtqHQTw8g4gfk
 // 2CoBP2rr5HmjMdPC4nMwnYg1cdH9JPUuqbq2QGSMGfms
@@ -377,7 +181,7 @@ func TestDecodeTransaction(t *testing.T) {
 		t.Error(err)
 	}
 
-	client := rpc.New("https://aged-morning-glade.solana-mainnet.quiknode.pro/b57bbb1a4c8bdd409e1ac53aaedead26da057f59/")
+	client := liveRpcClient(t)
 	recentBlockhashResult, err := client.GetRecentBlockhash(context.TODO(), rpc.CommitmentConfirmed)
 	if err != nil {
 		t.Error(err)
@@ -410,7 +214,7 @@ func TestDecodeTransaction2(t *testing.T) {
 		t.Error(err)
 	}
 
-	client := rpc.New("https://aged-morning-glade.solana-mainnet.quiknode.pro/b57bbb1a4c8bdd409e1ac53aaedead26da057f59/")
+	client := liveRpcClient(t)
 	recentBlockhashResult, err := client.GetRecentBlockhash(context.TODO(), rpc.CommitmentConfirmed)
 	if err != nil {
 		t.Error(err)
@@ -444,7 +248,7 @@ func TestLookupTableCache(t *testing.T) {
 	key := solana.MustPublicKeyFromBase58("2immgwYNHBbyVQKVGCEkgWpi53bLwWNRMB5G2nbgYV17")
 	t.Log(key)
 
-	data, err := base64.StdEncoding.DecodeString("AQAAAP//////////d49+DAAAAAAAAQZMWvw7GUNJdaccNBVnb57OKakxL2BHLYvhRwVILRsgAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAMGRm/lIRcy/+ytunLDm+e8jOW7xfcSayxDmzpAAAAABt324ddloZPZy+FGzut5rBy0he1fWzeROoz1hX7/AKkG3fbh7nWP3hhCXbzkbM3athr8TYO5DSf+vfko2KGL/AVKU1D4XciC1hSlVnJ4iilt3x6rq9CmBniISTL07vagBqfVFxksXFEhjMlMPUrxf1ja7gibof1E49vZigAAAAAGp9UXGMd0yShWY5hpHV62i164o5tLbVxzVVshAAAAAIyXJY9OJInxuz0QKRSODYMLWhOZ2v8QhASOe9jb6fhZC3BlsePRfEU4nVJ/awTDzVi4bHMaoP21SbbRvAP4KUbIScv+6Yw2LHF/6K0ZjUPibbSWXCirYPGuuVl7zT789IUPLW4CpHr4JNCatp3ELXDLKMv6JJ+37le50lbBJ2LvDQdRqCgtphMF/imcN7mY5YRx2xE1A3MQ+L4QRaYK9u4GRfZP3LsAd00a+IkCpA22UNQMKdq5BFbJuwuOLqc8zxCTDlqxBG8J0HcxtfogQHDK06ukzfaXiNDKAob1MqBHS9lJxDYCwz8gd5DtFqNSTKG5l1zxIaKpDP/sffi2is1H9aKveyXSu5StXElYRl9SD5As0DHE4N0GLnf84/siiKXVyp4Ez121kLcUui/jLLFZEz/BwZK3Ilf9B9OcsEAeDMKAy2vjGSxQODgBz0QwGA+eP4ZjIjrIAQaXENv31QfLlOdXSRCkaybRniDHF4C8YcwhcvsqrOVuTP4B2Na+9wLdtrB31uz2rtlFI5kahdsnp/d1SrASDInYCtTYtdoke4kX+hoKWcEWM4Tle8pTUkUVv4BxS6fje/EzKBE4Qu9N9LMnrw/JNO0hqMVB4rk/2ou4AB1loQ7FZoPwut2o4KZB+0p9xnbrQKw038qjpHar+PyDwvxBRcu5hpHw3dguezeWv+IwvgW5icu8EGkhGa9AkFPPJT7VMSFb8xowveU=")
+	data, err := base64.StdEncoding.DecodeString(lookupTableFixture)
 	if err != nil {
 		t.Error(err)
 	}
@@ -494,7 +298,7 @@ func TestGeneratePubKey(t *testing.T) {
 // Program TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA success
 
 func BenchmarkGetProgramAccounts(b *testing.B) {
-	client := rpc.New("https://aged-morning-glade.solana-mainnet.quiknode.pro/b57bbb1a4c8bdd409e1ac53aaedead26da057f59/")
+	client := liveRpcClient(b)
 
 	start := time.Now()
 	// offset := uint64(0)
@@ -519,3 +323,94 @@ func BenchmarkGetProgramAccounts(b *testing.B) {
 	}
 	b.Log(time.Since(start), len(programAccountsResult))
 }
+
+func TestFormatAmmKeysFromFixtures(t *testing.T) {
+	fetcher := NewFakeAccountFetcher()
+	poolId, marketId, lpMint := testPublicKey("pool"), testPublicKey("market"), testPublicKey("lp mint")
+	pool := &LiquidityStateV4{BaseDecimal: 9, QuoteDecimal: 6, MarketId: marketId, MarketProgramId: OPENBOOK_PROGRAM_ID, LpMint: lpMint}
+	fetcher.SetAccount(poolId, AMM_V4_PROGRAM_ID, mustMarshal(t, pool))
+	fetcher.SetAccount(lpMint, TOKEN_PROGRAM_ID, mustMarshal(t, &SplMint{Decimals: 6, IsInitialized: 1}))
+	market := &MarketStateV3{BaseVault: testPublicKey("market base vault"), Bids: testPublicKey("bids")}
+	fetcher.SetAccount(marketId, OPENBOOK_PROGRAM_ID, mustMarshal(t, market))
+	// Neither a pool without a market program nor one whose market is gone
+	// is listed.
+	fetcher.SetAccount(testPublicKey("no market program"), AMM_V4_PROGRAM_ID, mustMarshal(t, &LiquidityStateV4{LpMint: lpMint}))
+	fetcher.SetAccount(testPublicKey("missing market"), AMM_V4_PROGRAM_ID, mustMarshal(t, &LiquidityStateV4{MarketId: testPublicKey("gone"), MarketProgramId: OPENBOOK_PROGRAM_ID, LpMint: lpMint}))
+	lookupTable := testPublicKey("lookup table")
+	fetcher.SetAccount(lookupTable, ADDRESS_LOOKUP_TABLE_PROGRAM_ID, mustMarshal(t, &AddressLookupTableState{
+		Authority: RAYDIUM_LOOKUP_TABLE_AUTHORITY,
+		Addresses: []solana.PublicKey{testPublicKey("other pool"), poolId},
+	}))
+	fetcher.SetAccount(testPublicKey("foreign lookup table"), ADDRESS_LOOKUP_TABLE_PROGRAM_ID, mustMarshal(t, &AddressLookupTableState{
+		Authority: testPublicKey("someone else"),
+		Addresses: []solana.PublicKey{poolId},
+	}))
+
+	pools, err := FormatAmmKeys(context.Background(), fetcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pools) != 1 {
+		t.Fatalf("got %d pools, want 1", len(pools))
+	}
+	got := pools[poolId.String()]
+	if got == nil {
+		t.Fatalf("pool %v not listed", poolId)
+	}
+	marketAuthority, err := GetAssociatedAuthority(OPENBOOK_PROGRAM_ID.Bytes(), marketId.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	authority, err := getAmmAuthority(AMM_V4_PROGRAM_ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.LpDecimals != 6 || got.BaseDecimals != 9 || got.QuoteDecimals != 6 {
+		t.Errorf("got decimals base %d quote %d lp %d", got.BaseDecimals, got.QuoteDecimals, got.LpDecimals)
+	}
+	if got.Authority != authority.String() || got.MarketAuthority != marketAuthority.String() {
+		t.Errorf("got authority %v market authority %v", got.Authority, got.MarketAuthority)
+	}
+	if got.MarketBaseVault != testPublicKey("market base vault").String() || got.MarketBids != testPublicKey("bids").String() {
+		t.Errorf("got market base vault %v bids %v", got.MarketBaseVault, got.MarketBids)
+	}
+	if got.LookupTableAccount != lookupTable.String() {
+		t.Errorf("got lookup table %v, want %v", got.LookupTableAccount, lookupTable)
+	}
+}
+
+func TestGetAmmInfoFromFixtures(t *testing.T) {
+	fetcher := NewFakeAccountFetcher()
+	poolId, marketId, lpMint := testPublicKey("pool"), testPublicKey("market"), testPublicKey("lp mint")
+	baseVault := testPublicKey("base vault")
+	pool := &LiquidityStateV4{BaseDecimal: 9, QuoteDecimal: 6, BaseVault: baseVault, MarketId: marketId, MarketProgramId: OPENBOOK_PROGRAM_ID, LpMint: lpMint}
+	fetcher.SetAccount(poolId, AMM_V4_PROGRAM_ID, mustMarshal(t, pool))
+	fetcher.SetAccount(lpMint, TOKEN_PROGRAM_ID, mustMarshal(t, &SplMint{Decimals: 6, IsInitialized: 1}))
+	fetcher.SetAccount(marketId, OPENBOOK_PROGRAM_ID, mustMarshal(t, &MarketStateV3{Bids: testPublicKey("bids")}))
+
+	ammInfo, err := GetAmmInfo(context.Background(), fetcher, poolId.String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ammInfo.LpDecimals != 6 || !ammInfo.MarketBids.Equals(testPublicKey("bids")) {
+		t.Errorf("got lp decimals %d bids %v", ammInfo.LpDecimals, ammInfo.MarketBids)
+	}
+	if !ammInfo.LookupTableAccount.IsZero() {
+		t.Errorf("got lookup table %v without an index", ammInfo.LookupTableAccount)
+	}
+	if _, err := GetAmmInfo(context.Background(), fetcher, "not a key", nil); err == nil {
+		t.Error("accepted an invalid pool id")
+	}
+
+	index := NewLookupTableIndex(
+		testLookupTable("id only", poolId),
+		testLookupTable("id and vault", poolId, baseVault),
+	)
+	ammInfo, err = GetAmmInfo(context.Background(), fetcher, poolId.String(), index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := testPublicKey("id and vault"); !ammInfo.LookupTableAccount.Equals(want) {
+		t.Errorf("got lookup table %v, want %v", ammInfo.LookupTableAccount, want)
+	}
+}
@@ -0,0 +1,303 @@
+package raydium
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+)
+
+// MAX_MULTIPLE_ACCOUNTS is the most keys a getMultipleAccounts call accepts.
+const MAX_MULTIPLE_ACCOUNTS = 100
+
+// BatchOptions tunes a BatchAccountFetcher. Zero values mean chunks of
+// MAX_MULTIPLE_ACCOUNTS, one request at a time, no rate limit and no retries.
+type BatchOptions struct {
+	ChunkSize   int
+	Concurrency int
+	// RequestsPerSecond caps every request made, retries included.
+	RequestsPerSecond float64
+	// MaxRetries is how many times a request failing with a transient
+	// error is retried, waiting MinBackoff and doubling up to MaxBackoff.
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+func DefaultBatchOptions() BatchOptions {
+	return BatchOptions{
+		ChunkSize:         MAX_MULTIPLE_ACCOUNTS,
+		Concurrency:       4,
+		RequestsPerSecond: 10,
+		MaxRetries:        3,
+		MinBackoff:        250 * time.Millisecond,
+		MaxBackoff:        4 * time.Second,
+	}
+}
+
+// AccountsResult holds accounts in the order of their keys, with nil for the
+// ones that do not exist.
+type AccountsResult struct {
+	Keys     []solana.PublicKey
+	Accounts []*rpc.Account
+}
+
+func (r *AccountsResult) Missing(i int) bool {
+	return r.Accounts[i] == nil
+}
+
+func (r *AccountsResult) MissingKeys() []solana.PublicKey {
+	var keys []solana.PublicKey
+	for i, key := range r.Keys {
+		if r.Missing(i) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Err reports missing accounts as ErrAccountNotFound, for callers that need
+// every one of them.
+func (r *AccountsResult) Err() error {
+	missing := r.MissingKeys()
+	switch len(missing) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("%w: %v", ErrAccountNotFound, missing[0])
+	default:
+		return fmt.Errorf("%w: %v and %d more", ErrAccountNotFound, missing[0], len(missing)-1)
+	}
+}
+
+// BatchAccountFetcher wraps an AccountFetcher to split getMultipleAccounts
+// calls into chunks run concurrently, under a request rate budget, retrying
+// transient RPC errors.
+type BatchAccountFetcher struct {
+	fetcher AccountFetcher
+	options BatchOptions
+	limiter *rateLimiter
+}
+
+func NewBatchAccountFetcher(fetcher AccountFetcher, options BatchOptions) *BatchAccountFetcher {
+	if options.ChunkSize <= 0 || options.ChunkSize > MAX_MULTIPLE_ACCOUNTS {
+		options.ChunkSize = MAX_MULTIPLE_ACCOUNTS
+	}
+	options.Concurrency = max(options.Concurrency, 1)
+	options.MaxBackoff = max(options.MaxBackoff, options.MinBackoff)
+	return &BatchAccountFetcher{
+		fetcher: fetcher,
+		options: options,
+		limiter: newRateLimiter(options.RequestsPerSecond),
+	}
+}
+
+func (b *BatchAccountFetcher) GetAccountInfo(ctx context.Context, account solana.PublicKey) (*rpc.Account, error) {
+	var result *rpc.Account
+	err := b.retry(ctx, func() (err error) {
+		result, err = b.fetcher.GetAccountInfo(ctx, account)
+		return err
+	})
+	return result, err
+}
+
+func (b *BatchAccountFetcher) GetMultipleAccounts(ctx context.Context, accounts []solana.PublicKey) ([]*rpc.Account, error) {
+	result, err := b.FetchAccounts(ctx, accounts)
+	if err != nil {
+		return nil, err
+	}
+	return result.Accounts, nil
+}
+
+func (b *BatchAccountFetcher) GetProgramAccounts(ctx context.Context, programId solana.PublicKey, filters []rpc.RPCFilter) (rpc.GetProgramAccountsResult, error) {
+	var result rpc.GetProgramAccountsResult
+	err := b.retry(ctx, func() (err error) {
+		result, err = b.fetcher.GetProgramAccounts(ctx, programId, filters)
+		return err
+	})
+	return result, err
+}
+
+func (b *BatchAccountFetcher) GetTokenAccountsByOwner(ctx context.Context, owner, programId solana.PublicKey) (rpc.GetProgramAccountsResult, error) {
+	var result rpc.GetProgramAccountsResult
+	err := b.retry(ctx, func() (err error) {
+		result, err = b.fetcher.GetTokenAccountsByOwner(ctx, owner, programId)
+		return err
+	})
+	return result, err
+}
+
+// Slot is the slot reported by the wrapped fetcher, or 0 when it reports none.
+func (b *BatchAccountFetcher) Slot() uint64 {
+	return fetcherSlot(b.fetcher)
+}
+
+func (b *BatchAccountFetcher) SimulateTransaction(ctx context.Context, tx *solana.Transaction) (*rpc.SimulateTransactionResult, error) {
+	var result *rpc.SimulateTransactionResult
+	err := b.retry(ctx, func() (err error) {
+		result, err = b.fetcher.SimulateTransaction(ctx, tx)
+		return err
+	})
+	return result, err
+}
+
+// FetchAccounts fetches any number of keys. The first chunk to fail cancels
+// the others and its error is returned.
+func (b *BatchAccountFetcher) FetchAccounts(ctx context.Context, keys []solana.PublicKey) (*AccountsResult, error) {
+	result := &AccountsResult{Keys: keys, Accounts: make([]*rpc.Account, len(keys))}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	semaphore := make(chan struct{}, b.options.Concurrency)
+	for start := 0; start < len(keys); start += b.options.ChunkSize {
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(start int) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			chunk := keys[start:min(start+b.options.ChunkSize, len(keys))]
+			var accounts []*rpc.Account
+			err := b.retry(ctx, func() (err error) {
+				accounts, err = b.fetcher.GetMultipleAccounts(ctx, chunk)
+				return err
+			})
+			if err == nil && len(accounts) != len(chunk) {
+				err = fmt.Errorf("getMultipleAccounts returned %d accounts for %d keys", len(accounts), len(chunk))
+			}
+			if err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			copy(result.Accounts[start:], accounts)
+		}(start)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	// Canceled by the caller before every chunk was sent.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (b *BatchAccountFetcher) retry(ctx context.Context, call func() error) error {
+	backoff := b.options.MinBackoff
+	for attempt := 0; ; attempt++ {
+		if err := b.limiter.wait(ctx); err != nil {
+			return err
+		}
+		err := call()
+		if err == nil || attempt >= b.options.MaxRetries || !isTransientRpcError(err) {
+			return err
+		}
+		if err := sleepContext(ctx, backoff); err != nil {
+			return err
+		}
+		backoff = min(2*backoff, b.options.MaxBackoff)
+	}
+}
+
+// isTransientRpcError tells whether a request may succeed if sent again:
+// rate limiting, server errors, unhealthy nodes and transport failures. Any
+// other error is returned as is.
+func isTransientRpcError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrAccountNotFound) {
+		return false
+	}
+	var httpErr *jsonrpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code == 429 || httpErr.Code >= 500
+	}
+	var rpcErr *jsonrpc.RPCError
+	if errors.As(err, &rpcErr) {
+		// -32004 block not available, -32005 node unhealthy, -32014 block
+		// status not yet available; some providers report 429 here too.
+		switch rpcErr.Code {
+		case -32004, -32005, -32014, 429:
+			return true
+		}
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rateLimiter spaces requests evenly; a nil limiter never waits.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newRateLimiter(requestsPerSecond float64) *rateLimiter {
+	if requestsPerSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / requestsPerSecond)}
+}
+
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+	return sleepContext(ctx, time.Until(at))
+}
+
+// batchFetcher is an AccountFetcher that fetches any number of keys itself,
+// as BatchAccountFetcher does.
+type batchFetcher interface {
+	FetchAccounts(ctx context.Context, keys []solana.PublicKey) (*AccountsResult, error)
+}
+
+// fetchAccounts fetches keys through fetcher's batching, or in sequential
+// chunks when it has none.
+func fetchAccounts(ctx context.Context, fetcher AccountFetcher, keys []solana.PublicKey) (*AccountsResult, error) {
+	if batch, ok := fetcher.(batchFetcher); ok {
+		return batch.FetchAccounts(ctx, keys)
+	}
+	return NewBatchAccountFetcher(fetcher, BatchOptions{}).FetchAccounts(ctx, keys)
+}
@@ -0,0 +1,187 @@
+package raydium
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+)
+
+// scriptedFetcher serves a fake, failing its first getMultipleAccounts calls
+// with err and tracking how many run at once.
+type scriptedFetcher struct {
+	*FakeAccountFetcher
+	delay time.Duration
+
+	mu          sync.Mutex
+	failures    int
+	err         error
+	calls       int
+	inFlight    int
+	maxInFlight int
+}
+
+func (f *scriptedFetcher) GetMultipleAccounts(ctx context.Context, accounts []solana.PublicKey) ([]*rpc.Account, error) {
+	f.mu.Lock()
+	f.calls++
+	f.inFlight++
+	f.maxInFlight = max(f.maxInFlight, f.inFlight)
+	fail := f.failures > 0
+	if fail {
+		f.failures--
+	}
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.inFlight--
+		f.mu.Unlock()
+	}()
+
+	time.Sleep(f.delay)
+	if fail {
+		return nil, f.err
+	}
+	return f.FakeAccountFetcher.GetMultipleAccounts(ctx, accounts)
+}
+
+func batchFixture(n int) (*FakeAccountFetcher, []solana.PublicKey) {
+	fake := NewFakeAccountFetcher()
+	keys := make([]solana.PublicKey, 0, n)
+	for i := 0; i < n; i++ {
+		key := testPublicKey(fmt.Sprint("account ", i))
+		keys = append(keys, key)
+		// Every tenth account is missing.
+		if i%10 != 3 {
+			fake.SetAccount(key, SYSTEM_PROGRAM_ID, []byte{byte(i)})
+		}
+	}
+	return fake, keys
+}
+
+func TestBatchAccountFetcherChunks(t *testing.T) {
+	fake, keys := batchFixture(250)
+	scripted := &scriptedFetcher{FakeAccountFetcher: fake, delay: 10 * time.Millisecond}
+	fetcher := NewBatchAccountFetcher(scripted, BatchOptions{ChunkSize: 20, Concurrency: 3})
+
+	result, err := fetcher.FetchAccounts(context.Background(), keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scripted.calls != 13 {
+		t.Errorf("got %d requests, want 13", scripted.calls)
+	}
+	if scripted.maxInFlight < 2 || scripted.maxInFlight > 3 {
+		t.Errorf("got %d requests in flight, want 2 to 3", scripted.maxInFlight)
+	}
+	for i, account := range result.Accounts {
+		if i%10 == 3 {
+			if !result.Missing(i) {
+				t.Errorf("account %d: expected missing", i)
+			}
+			continue
+		}
+		if result.Missing(i) || account.Data.GetBinary()[0] != byte(i) {
+			t.Errorf("account %d: got %v", i, account)
+		}
+	}
+	if missing := result.MissingKeys(); len(missing) != 25 || !missing[0].Equals(keys[3]) {
+		t.Errorf("got %d missing keys", len(missing))
+	}
+	if err := result.Err(); !errors.Is(err, ErrAccountNotFound) {
+		t.Errorf("got %v, want ErrAccountNotFound", err)
+	}
+}
+
+func TestBatchAccountFetcherRetries(t *testing.T) {
+	fake, keys := batchFixture(5)
+	transient := &jsonrpc.RPCError{Code: -32005, Message: "Node is unhealthy"}
+	invalid := &jsonrpc.RPCError{Code: -32602, Message: "Invalid params"}
+	options := BatchOptions{MaxRetries: 2, MinBackoff: time.Millisecond}
+
+	cases := []struct {
+		name     string
+		failures int
+		err      error
+		calls    int
+		ok       bool
+	}{
+		{"recovers", 2, transient, 3, true},
+		{"gives up", 3, transient, 3, false},
+		{"not transient", 1, invalid, 1, false},
+		{"http 429", 1, jsonrpc.NewHTTPError(429, errors.New("too many requests")), 2, true},
+		{"http 400", 1, jsonrpc.NewHTTPError(400, errors.New("bad request")), 1, false},
+		{"transport", 1, &url.Error{Op: "Post", URL: "http://rpc", Err: syscall.ECONNRESET}, 2, true},
+		{"unknown", 1, errors.New("decode response"), 1, false},
+	}
+	for _, c := range cases {
+		scripted := &scriptedFetcher{FakeAccountFetcher: fake, failures: c.failures, err: c.err}
+		_, err := NewBatchAccountFetcher(scripted, options).FetchAccounts(context.Background(), keys)
+		if (err == nil) != c.ok {
+			t.Errorf("%s: got %v", c.name, err)
+		}
+		if scripted.calls != c.calls {
+			t.Errorf("%s: got %d requests, want %d", c.name, scripted.calls, c.calls)
+		}
+	}
+}
+
+func TestBatchAccountFetcherRateLimit(t *testing.T) {
+	fake, keys := batchFixture(60)
+	fetcher := NewBatchAccountFetcher(fake, BatchOptions{ChunkSize: 10, Concurrency: 6, RequestsPerSecond: 50})
+
+	start := time.Now()
+	if _, err := fetcher.FetchAccounts(context.Background(), keys); err != nil {
+		t.Fatal(err)
+	}
+	// Six requests 20ms apart.
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("took %v, want at least 100ms", elapsed)
+	}
+}
+
+func TestBatchAccountFetcherCancel(t *testing.T) {
+	fake, keys := batchFixture(50)
+	scripted := &scriptedFetcher{FakeAccountFetcher: fake, failures: 100, err: &url.Error{Op: "Post", URL: "http://rpc", Err: syscall.ECONNRESET}}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	fetcher := NewBatchAccountFetcher(scripted, BatchOptions{ChunkSize: 10, MaxRetries: 100, MinBackoff: 20 * time.Millisecond})
+	if _, err := fetcher.FetchAccounts(ctx, keys); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestFetchAccountsUsesBatching(t *testing.T) {
+	fake, keys := batchFixture(50)
+	scripted := &scriptedFetcher{FakeAccountFetcher: fake, delay: 10 * time.Millisecond}
+	// A fetcher wrapping the batch fetcher keeps its batching.
+	wrapped := struct{ *BatchAccountFetcher }{NewBatchAccountFetcher(scripted, BatchOptions{ChunkSize: 10, Concurrency: 5})}
+	if _, err := fetchAccounts(context.Background(), wrapped, keys); err != nil {
+		t.Fatal(err)
+	}
+	if scripted.calls != 5 || scripted.maxInFlight < 2 {
+		t.Errorf("got %d requests, at most %d at once", scripted.calls, scripted.maxInFlight)
+	}
+}
+
+func TestBatchAccountFetcherSlot(t *testing.T) {
+	fake, keys := batchFixture(5)
+	fetcher := NewBatchAccountFetcher(NewRpcAccountFetcher(rpc.New(newStubRpcServer(t, fake).URL)), BatchOptions{})
+	if fetcher.Slot() != 0 {
+		t.Errorf("slot before any request: got %d", fetcher.Slot())
+	}
+	if _, err := fetcher.GetMultipleAccounts(context.Background(), keys); err != nil {
+		t.Fatal(err)
+	}
+	if fetcher.Slot() != 1 {
+		t.Errorf("slot: got %d, want 1", fetcher.Slot())
+	}
+}
@@ -2,18 +2,21 @@ package raydium
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"math/big"
 	"strconv"
-	"time"
-	"unsafe"
 
 	"github.com/gagliardetto/solana-go"
 	"github.com/gagliardetto/solana-go/rpc"
 	"github.com/shopspring/decimal"
 )
 
+var (
+	CLMM_PROGRAM_ID = solana.MustPublicKeyFromBase58("CAMMCzo5YL8w4VFF8KVHrK22GGUsp5VTaW7grrKgrWqK")
+)
+
 type ApiClmmConfigItem struct {
 	Id              string           `json:"id"`
 	Index           uint16           `json:"index"`
@@ -82,6 +85,9 @@ type Mint struct {
 	Mint      solana.PublicKey `json:"mint"`
 	Vault     solana.PublicKey `json:"vault"`
 	Decimals  uint8            `json:"decimals"`
+	// Extensions are the Token-2022 extensions of the mint, empty for
+	// TOKEN_PROGRAM_ID mints.
+	Extensions MintExtensions `json:"extensions"`
 }
 
 type ClmmPoolInfo struct {
@@ -125,260 +131,241 @@ type TickArrayBitmapEx struct {
 	NegativeTickArrayBitmap [][]string       `json:"negativeTickArrayBitmap"`
 }
 
-func FormatClmmKeys(client *rpc.Client) (map[string]*ClmmPoolInfo, error) {
-	filterDefKey := solana.MustPublicKeyFromBase58("11111111111111111111111111111111")
-
-	poolAccountInfo, err := client.GetProgramAccountsWithOpts(
-		context.TODO(),
-		solana.MustPublicKeyFromBase58("CAMMCzo5YL8w4VFF8KVHrK22GGUsp5VTaW7grrKgrWqK"),
-		&rpc.GetProgramAccountsOpts{
-			Filters: []rpc.RPCFilter{
-				{
-					DataSize: 1544,
-				},
-			},
-		},
-	)
+// FormatClmmKeys loads every CLMM pool with rewards accrued up to the time
+// of clock. A pool that cannot be assembled, for instance because one of its
+// mints is gone, is left out and its error joined into the one returned with
+// the other pools. If it stops early, for instance because ctx expired, the
+// map returned with the error holds the pools completed so far.
+func FormatClmmKeys(ctx context.Context, fetcher AccountFetcher, clock Clock) (map[string]*ClmmPoolInfo, error) {
+	chainTime, err := chainTimestamp(ctx, clock)
 	if err != nil {
 		return nil, err
 	}
-
-	poolAccountFormat := make(map[string]*PoolInfoLayout)
-	for _, acc := range poolAccountInfo {
-		poolAccountFormat[acc.Pubkey.String()] = NewPoolInfoLayoutFromBytes(acc.Account.Data.GetBinary())
+	state, err := fetchClmmAccounts(ctx, fetcher)
+	if err != nil {
+		return nil, err
 	}
 
-	allMint := make(map[solana.PublicKey]struct{})
-	for _, pool := range poolAccountFormat {
-		if !pool.MintA.Equals(filterDefKey) {
-			allMint[pool.MintA] = struct{}{}
-		}
-		if !pool.MintB.Equals(filterDefKey) {
-			allMint[pool.MintB] = struct{}{}
+	poolsInfo := make(map[string]*ClmmPoolInfo)
+	var poolErrs []error
+	for _, pool := range state.pools {
+		if err := ctx.Err(); err != nil {
+			return poolsInfo, errors.Join(append(poolErrs, err)...)
 		}
-		for _, rewardInfo := range pool.RewardInfos {
-			if !rewardInfo.TokenMint.Equals(filterDefKey) {
-				allMint[rewardInfo.TokenMint] = struct{}{}
-			}
+		poolInfo, err := newClmmPoolInfo(pool.id, pool.programId, pool.layout, state.configs[pool.layout.AmmConfig.String()], state.accounts, chainTime)
+		if err != nil {
+			poolErrs = append(poolErrs, fmt.Errorf("pool %v: %w", pool.id, err))
+			continue
 		}
+		state.lookupTables.SetClmmLookupTable(poolInfo)
+		poolsInfo[pool.id.String()] = poolInfo
 	}
-	var allMintAccount []solana.PublicKey
-	for mint := range allMint {
-		allMintAccount = append(allMintAccount, mint)
-	}
 
-	mintInfoDict := make(map[solana.PublicKey]*rpc.Account)
-	accounts, err := getMultipleAccountsInfo(client, allMintAccount)
+	return poolsInfo, errors.Join(poolErrs...)
+}
+
+// clmmPoolAccount is a decoded pool and the program that owns it.
+type clmmPoolAccount struct {
+	id        solana.PublicKey
+	programId solana.PublicKey
+	layout    *PoolInfoLayout
+}
+
+// clmmAccounts holds what newClmmPoolInfo reads for a set of pools, with nil
+// accounts for those that do not exist, and the Raydium lookup tables.
+type clmmAccounts struct {
+	pools        []*clmmPoolAccount
+	configs      map[string]*ApiClmmConfigItem
+	accounts     map[solana.PublicKey]*rpc.Account
+	lookupTables *LookupTableIndex
+}
+
+// fetchClmmAccounts loads every CLMM pool, config and Raydium lookup table
+// with getProgramAccounts, then the mints, reward vaults and bitmap
+// extensions of all pools in one batch, each account once.
+func fetchClmmAccounts(ctx context.Context, fetcher AccountFetcher) (*clmmAccounts, error) {
+	poolAccountInfo, err := fetcher.GetProgramAccounts(ctx, CLMM_PROGRAM_ID, []rpc.RPCFilter{
+		{
+			DataSize: POOL_STATE_SIZE,
+		},
+	})
 	if err != nil {
 		return nil, err
 	}
-	for i, acc := range accounts {
-		mintInfoDict[allMintAccount[i]] = acc
+
+	pools := make([]*clmmPoolAccount, 0, len(poolAccountInfo))
+	for _, acc := range poolAccountInfo {
+		pool, err := NewPoolInfoLayoutFromBytes(acc.Account.Data.GetBinary())
+		if err != nil {
+			return nil, fmt.Errorf("decode pool %v: %w", acc.Pubkey, err)
+		}
+		pools = append(pools, &clmmPoolAccount{id: acc.Pubkey, programId: acc.Account.Owner, layout: pool})
 	}
 
-	configAccountInfo, err := client.GetProgramAccountsWithOpts(
-		context.TODO(),
-		solana.MustPublicKeyFromBase58("CAMMCzo5YL8w4VFF8KVHrK22GGUsp5VTaW7grrKgrWqK"),
-		&rpc.GetProgramAccountsOpts{
-			Filters: []rpc.RPCFilter{
-				{
-					DataSize: 117,
-				},
-			},
+	configAccountInfo, err := fetcher.GetProgramAccounts(ctx, CLMM_PROGRAM_ID, []rpc.RPCFilter{
+		{
+			DataSize: AMM_CONFIG_SIZE,
 		},
-	)
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	configIdToData := make(map[string]*ApiClmmConfigItem)
 	for _, acc := range configAccountInfo {
-		data := acc.Account.Data.GetBinary()
-		configIdToData[acc.Pubkey.String()] = &ApiClmmConfigItem{
-			Id:              acc.Pubkey.String(),
-			Index:           *(*uint16)(unsafe.Pointer(&data[9])),
-			ProtocolFeeRate: *(*uint32)(unsafe.Pointer(&data[43])),
-			TradeFeeRate:    *(*uint32)(unsafe.Pointer(&data[47])),
-			TickSpacing:     *(*uint16)(unsafe.Pointer(&data[51])),
-			FundFeeRate:     *(*uint32)(unsafe.Pointer(&data[53])),
-			FundOwner:       solana.PublicKeyFromBytes(data[61:93]),
-			Description:     "",
+		config, err := NewApiClmmConfigItemFromBytes(acc.Pubkey, acc.Account.Data.GetBinary())
+		if err != nil {
+			return nil, fmt.Errorf("decode amm config %v: %w", acc.Pubkey, err)
 		}
+		configIdToData[acc.Pubkey.String()] = config
 	}
 
-	poolInfoDict := map[string]*ApiClmmPoolsItem{}
-	for id, pool := range poolAccountFormat {
-		mintProgramIdA := mintInfoDict[pool.MintA].Owner
-		mintProgramIdB := mintInfoDict[pool.MintB].Owner
-		rewardInfos := make(map[solana.PublicKey]solana.PublicKey)
-		for _, rewardInfo := range pool.RewardInfos {
-			if rewardInfo.TokenMint.Equals(filterDefKey) {
-				continue
-			}
-			rewardInfos[rewardInfo.TokenMint] = mintInfoDict[rewardInfo.TokenMint].Owner
-		}
-
-		poolInfoDict[id] = &ApiClmmPoolsItem{
-			Id:                 solana.MustPublicKeyFromBase58(id),
-			MintProgramIdA:     mintProgramIdA,
-			MintProgramIdB:     mintProgramIdB,
-			MintA:              pool.MintA,
-			MintB:              pool.MintB,
-			VaultA:             pool.VaultA,
-			VaultB:             pool.VaultB,
-			MintDecimalsA:      pool.MintDecimalsA,
-			MintDecimalsB:      pool.MintDicimalsB,
-			AmmConfig:          configIdToData[pool.AmmConfig.String()],
-			RewardInfos:        rewardInfos,
-			Tvl:                0,
-			Day:                &ApiClmmPoolsItemStatistics{},
-			Week:               &ApiClmmPoolsItemStatistics{},
-			Month:              &ApiClmmPoolsItemStatistics{},
-			LookupTableAccount: filterDefKey,
+	// Mints and reward vaults are shared between pools; fetch each once.
+	accountKeys := make(map[solana.PublicKey]struct{})
+	for _, pool := range pools {
+		for _, key := range clmmPoolDependencies(pool.programId, pool.id, pool.layout) {
+			accountKeys[key] = struct{}{}
 		}
 	}
-
-	poolKeys := make([]*ApiClmmPoolsItem, 0, len(poolInfoDict))
-	for _, pool := range poolInfoDict {
-		poolKeys = append(poolKeys, pool)
+	allAccountKeys := make([]solana.PublicKey, 0, len(accountKeys))
+	for key := range accountKeys {
+		allAccountKeys = append(allAccountKeys, key)
 	}
-
-	publicKeys := make([]solana.PublicKey, 0, len(poolKeys))
-	for _, pool := range poolKeys {
-		publicKeys = append(publicKeys, pool.Id)
+	fetched, err := fetchAccounts(ctx, fetcher, allAccountKeys)
+	if err != nil {
+		return nil, err
 	}
-	poolAccountInfos, err := getMultipleAccountsInfo(client, publicKeys)
+	accountInfos := make(map[solana.PublicKey]*rpc.Account, len(allAccountKeys))
+	for i, key := range allAccountKeys {
+		accountInfos[key] = fetched.Accounts[i]
+	}
+
+	lookupTables, err := GetLookupTablesByAuthority(ctx, fetcher, RAYDIUM_LOOKUP_TABLE_AUTHORITY)
 	if err != nil {
 		return nil, err
 	}
 
-	exBitmapAddress := make(map[solana.PublicKey]solana.PublicKey)
-	for i, apiPoolInfo := range poolKeys {
-		accountInfo := poolAccountInfos[i]
-		if accountInfo == nil {
+	return &clmmAccounts{pools: pools, configs: configIdToData, accounts: accountInfos, lookupTables: NewLookupTableIndex(lookupTables...)}, nil
+}
+
+// clmmPoolDependencies lists the accounts newClmmPoolInfo reads besides the
+// pool itself: the mints, the reward mints and vaults and the bitmap extension.
+func clmmPoolDependencies(programId, id solana.PublicKey, pool *PoolInfoLayout) []solana.PublicKey {
+	keys := []solana.PublicKey{pool.MintA, pool.MintB, getPdaExBitmapAccount(programId, id)}
+	for _, rewardInfo := range pool.RewardInfos {
+		if rewardInfo.TokenMint.Equals(solana.SystemProgramID) {
 			continue
 		}
-
-		exBitmapAddress[apiPoolInfo.Id] = getPdaExBitmapAccount(accountInfo.Owner, apiPoolInfo.Id)
+		keys = append(keys, rewardInfo.TokenMint, rewardInfo.TokenVault)
 	}
+	return keys
+}
 
-	exBitmapAddressValues := make([]solana.PublicKey, 0, len(exBitmapAddress))
-	for _, value := range exBitmapAddress {
-		exBitmapAddressValues = append(exBitmapAddressValues, value)
+// newClmmPoolInfo assembles a pool from its state and the accounts of
+// clmmPoolDependencies, nil for those that do not exist.
+func newClmmPoolInfo(id, programId solana.PublicKey, pool *PoolInfoLayout, config *ApiClmmConfigItem, accounts map[solana.PublicKey]*rpc.Account, chainTime uint64) (*ClmmPoolInfo, error) {
+	mintAccountA, mintAccountB := accounts[pool.MintA], accounts[pool.MintB]
+	if mintAccountA == nil || mintAccountB == nil {
+		return nil, fmt.Errorf("mints: %w", ErrAccountNotFound)
 	}
 
-	fetchedBitmapAccount, err := getMultipleAccountsInfo(client, exBitmapAddressValues)
+	mintInfoA, err := NewSplMintFromBytes(mintAccountA.Data.GetBinary())
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("decode mint %v: %w", pool.MintA, err)
 	}
-
-	exBitmapAccountInfos := make(map[solana.PublicKey]*TickArrayBitmap)
-	for i, acc := range fetchedBitmapAccount {
-		if acc == nil {
-			continue
-		}
-		exBitmapAccountInfos[exBitmapAddressValues[i]] = NewTickArrayBitmapFromBytes(acc.Data.GetBinary())
+	mintInfoB, err := NewSplMintFromBytes(mintAccountB.Data.GetBinary())
+	if err != nil {
+		return nil, fmt.Errorf("decode mint %v: %w", pool.MintB, err)
 	}
 
-	// var programIds []solana.PublicKey
-	poolsInfo := make(map[string]*ClmmPoolInfo)
-	// var updateRewardInfos []ClmmPoolRewardInfo
-	for i, apiPoolInfo := range poolKeys {
-		accountInfo := poolAccountInfos[i]
-		exBitmapInfo := exBitmapAccountInfos[exBitmapAddress[apiPoolInfo.Id]]
-		if accountInfo == nil {
-			continue
-		}
-
-		layoutAccountInfo := NewPoolInfoLayoutFromBytes(accountInfo.Data.GetBinary())
-		poolsInfo[apiPoolInfo.Id.String()] = &ClmmPoolInfo{
-			Id: apiPoolInfo.Id,
-			MintA: Mint{
-				ProgramId: apiPoolInfo.MintProgramIdA,
-				Mint:      layoutAccountInfo.MintA,
-				Vault:     layoutAccountInfo.VaultA,
-				Decimals:  layoutAccountInfo.MintDecimalsA,
-			},
-			MintB: Mint{
-				ProgramId: apiPoolInfo.MintProgramIdB,
-				Mint:      layoutAccountInfo.MintB,
-				Vault:     layoutAccountInfo.VaultB,
-				Decimals:  layoutAccountInfo.MintDicimalsB,
-			},
-			ObservationId: layoutAccountInfo.ObservationId,
-			AmmConfig:     apiPoolInfo.AmmConfig,
-			Creator:       layoutAccountInfo.Creator,
-			ProgramId:     accountInfo.Owner,
-			Version:       6,
-			TickSpacing:   layoutAccountInfo.TickSpacing,
-			Liquidity:     layoutAccountInfo.Liquidity.String(),
-			SqrtPriceX64:  layoutAccountInfo.SqrtPriceX64.String(),
-			CurrentPrice: sqrtPriceX64ToPrice(
-				layoutAccountInfo.SqrtPriceX64,
-				int64(layoutAccountInfo.MintDecimalsA),
-				int64(layoutAccountInfo.MintDicimalsB),
-			),
-			TickCurrent:               layoutAccountInfo.TickCurrent,
-			ObservationIndex:          layoutAccountInfo.ObservationIndex,
-			ObservationUpdateDuration: layoutAccountInfo.ObservationUpdateDuration,
-			FeeGrowthGlobalX64A:       layoutAccountInfo.FeeGrowthGlobalX64A.String(),
-			FeeGrowthGlobalX64B:       layoutAccountInfo.FeeGrowthGlobalX64B.String(),
-			ProtocolFeesTokenA:        layoutAccountInfo.ProtocolFeesTokenA,
-			ProtocolFeesTokenB:        layoutAccountInfo.ProtocolFeesTokenB,
-			SwapInAmountTokenA:        layoutAccountInfo.SwapInAmountTokenA.String(),
-			SwapOutAmountTokenB:       layoutAccountInfo.SwapOutAmountTokenB.String(),
-			SwapInAmountTokenB:        layoutAccountInfo.SwapInAmountTokenB.String(),
-			SwapOutAmountTokenA:       layoutAccountInfo.SwapOutAmountTokenA.String(),
-			TickArrayBitmap:           toStringArray(layoutAccountInfo.TickArrayBitmap),
-			RewardInfos: updatePoolRewardInfos(
-				client,
-				apiPoolInfo,
-				uint64(time.Now().Unix()),
-				layoutAccountInfo.Liquidity,
-				layoutAccountInfo.RewardInfos,
-				filterDefKey,
-			),
-			Day:                apiPoolInfo.Day,
-			Week:               apiPoolInfo.Week,
-			Month:              apiPoolInfo.Month,
-			Tvl:                apiPoolInfo.Tvl,
-			LookupTableAccount: apiPoolInfo.LookupTableAccount,
-			StartTime:          layoutAccountInfo.StartTime,
-			ExBitmapInfo:       toStringMatrix(exBitmapInfo),
+	// Pools whose ticks stay inside the pool bitmap may have no extension.
+	var exBitmapInfo *TickArrayBitmap
+	exBitmapAddress := getPdaExBitmapAccount(programId, id)
+	if bitmapAccount := accounts[exBitmapAddress]; bitmapAccount != nil {
+		if exBitmapInfo, err = NewTickArrayBitmapFromBytes(bitmapAccount.Data.GetBinary()); err != nil {
+			return nil, fmt.Errorf("decode tick array bitmap extension %v: %w", exBitmapAddress, err)
 		}
 	}
+	rewardInfos, err := updatePoolRewardInfos(chainTime, pool, accounts)
+	if err != nil {
+		return nil, fmt.Errorf("rewards: %w", err)
+	}
 
-	return poolsInfo, nil
+	currentPrice := SqrtPriceX64ToPrice(pool.SqrtPriceX64, int64(pool.MintDecimalsA), int64(pool.MintDicimalsB))
+	return &ClmmPoolInfo{
+		Id: id,
+		MintA: Mint{
+			ProgramId:  mintAccountA.Owner,
+			Mint:       pool.MintA,
+			Vault:      pool.VaultA,
+			Decimals:   pool.MintDecimalsA,
+			Extensions: mintInfoA.Extensions,
+		},
+		MintB: Mint{
+			ProgramId:  mintAccountB.Owner,
+			Mint:       pool.MintB,
+			Vault:      pool.VaultB,
+			Decimals:   pool.MintDicimalsB,
+			Extensions: mintInfoB.Extensions,
+		},
+		ObservationId:             pool.ObservationId,
+		AmmConfig:                 config,
+		Creator:                   pool.Creator,
+		ProgramId:                 programId,
+		Version:                   6,
+		TickSpacing:               pool.TickSpacing,
+		Liquidity:                 pool.Liquidity.String(),
+		SqrtPriceX64:              pool.SqrtPriceX64.String(),
+		CurrentPrice:              &currentPrice,
+		TickCurrent:               pool.TickCurrent,
+		ObservationIndex:          pool.ObservationIndex,
+		ObservationUpdateDuration: pool.ObservationUpdateDuration,
+		FeeGrowthGlobalX64A:       pool.FeeGrowthGlobalX64A.String(),
+		FeeGrowthGlobalX64B:       pool.FeeGrowthGlobalX64B.String(),
+		ProtocolFeesTokenA:        pool.ProtocolFeesTokenA,
+		ProtocolFeesTokenB:        pool.ProtocolFeesTokenB,
+		SwapInAmountTokenA:        pool.SwapInAmountTokenA.String(),
+		SwapOutAmountTokenB:       pool.SwapOutAmountTokenB.String(),
+		SwapInAmountTokenB:        pool.SwapInAmountTokenB.String(),
+		SwapOutAmountTokenA:       pool.SwapOutAmountTokenA.String(),
+		TickArrayBitmap:           toStringArray(pool.TickArrayBitmap),
+		RewardInfos:               rewardInfos,
+		Day:                       &ApiClmmPoolsItemStatistics{},
+		Week:                      &ApiClmmPoolsItemStatistics{},
+		Month:                     &ApiClmmPoolsItemStatistics{},
+		LookupTableAccount:        solana.SystemProgramID,
+		StartTime:                 pool.StartTime,
+		ExBitmapInfo:              toStringMatrix(exBitmapInfo),
+	}, nil
 }
 
-func getMultipleAccountsInfo(client *rpc.Client, publicKeys []solana.PublicKey) ([]*rpc.Account, error) {
-	chunkedKeys := make([][]solana.PublicKey, 0)
-	chunkSize := 100
-	for i := 0; i < len(publicKeys); i += chunkSize {
-		end := i + chunkSize
-		if end > len(publicKeys) {
-			end = len(publicKeys)
-		}
-		chunkedKeys = append(chunkedKeys, publicKeys[i:end])
+func NewApiClmmConfigItemFromBytes(id solana.PublicKey, data []byte) (*ApiClmmConfigItem, error) {
+	if err := checkAnchorAccount(data, AMM_CONFIG_DISCRIMINATOR, AMM_CONFIG_SIZE); err != nil {
+		return nil, err
 	}
 
-	accounts := make([]*rpc.Account, 0, len(publicKeys))
-	for _, chunk := range chunkedKeys {
-		result, err := client.GetMultipleAccountsWithOpts(context.TODO(), chunk, &rpc.GetMultipleAccountsOpts{
-			Encoding: solana.EncodingBase64,
-		})
-		if err != nil {
-			return nil, err
-		}
+	return &ApiClmmConfigItem{
+		Id:              id.String(),
+		Index:           binary.LittleEndian.Uint16(data[9:]),
+		ProtocolFeeRate: binary.LittleEndian.Uint32(data[43:]),
+		TradeFeeRate:    binary.LittleEndian.Uint32(data[47:]),
+		TickSpacing:     binary.LittleEndian.Uint16(data[51:]),
+		FundFeeRate:     binary.LittleEndian.Uint32(data[53:]),
+		FundOwner:       solana.PublicKeyFromBytes(data[61:93]),
+		Description:     "",
+	}, nil
+}
 
-		for _, acc := range result.Value {
-			if acc == nil {
-				return nil, errors.New("account not found")
-			}
-			accounts = append(accounts, acc)
-		}
+// getMultipleAccountsInfo fetches keys and fails unless every account exists.
+func getMultipleAccountsInfo(ctx context.Context, fetcher AccountFetcher, publicKeys []solana.PublicKey) ([]*rpc.Account, error) {
+	result, err := fetchAccounts(ctx, fetcher, publicKeys)
+	if err != nil {
+		return nil, err
+	}
+	if err := result.Err(); err != nil {
+		return nil, err
 	}
-	return accounts, nil
+	return result.Accounts, nil
 }
 
 func getPdaExBitmapAccount(programId, poolId solana.PublicKey) solana.PublicKey {
@@ -392,33 +379,32 @@ func getPdaExBitmapAccount(programId, poolId solana.PublicKey) solana.PublicKey
 	return publicKey
 }
 
-func sqrtPriceX64ToPrice(sqrtPriceX64 *big.Int, decimalsA int64, decimalsB int64) *decimal.Decimal {
-	d := decimal.NewFromBigInt(sqrtPriceX64, 0).Pow(decimal.NewFromInt(2)).Mul(decimal.NewFromInt(10).Pow(decimal.NewFromInt(decimalsA - decimalsB)))
-	return &d
-}
-
-func updatePoolRewardInfos(
-	client *rpc.Client,
-	apiPoolInfo *ApiClmmPoolsItem,
-	chainTime uint64,
-	poolLiquidity *big.Int,
-	rewardInfos []*RewardInfo,
-	filterDefKey solana.PublicKey,
-) []*ClmmPoolRewardInfo {
+// updatePoolRewardInfos advances the pool rewards to chainTime and fills in
+// what the pool account alone does not hold: the reward token program, the
+// per-second emissions in tokens and the rewards left in each vault.
+func updatePoolRewardInfos(chainTime uint64, pool *PoolInfoLayout, accounts map[solana.PublicKey]*rpc.Account) ([]*ClmmPoolRewardInfo, error) {
 	nRewardInfo := []*ClmmPoolRewardInfo{}
-	for _, rewardInfo := range rewardInfos {
-		if rewardInfo.TokenMint.Equals(filterDefKey) {
+	for _, rewardInfo := range UpdateRewardInfos(pool, chainTime) {
+		if !rewardInfo.initialized() {
 			continue
 		}
-
-		accInfo, err := client.GetAccountInfo(context.TODO(), rewardInfo.TokenMint)
+		mintAccount, vaultAccount := accounts[rewardInfo.TokenMint], accounts[rewardInfo.TokenVault]
+		if mintAccount == nil {
+			return nil, fmt.Errorf("reward mint: %w: %v", ErrAccountNotFound, rewardInfo.TokenMint)
+		}
+		if vaultAccount == nil {
+			return nil, fmt.Errorf("reward vault: %w: %v", ErrAccountNotFound, rewardInfo.TokenVault)
+		}
+		mint, err := NewSplMintFromBytes(mintAccount.Data.GetBinary())
 		if err != nil {
-			// TODO
-			continue
+			return nil, fmt.Errorf("decode reward mint %v: %w", rewardInfo.TokenMint, err)
+		}
+		vault, err := NewSplAccountFromBytes(vaultAccount.Data.GetBinary())
+		if err != nil {
+			return nil, fmt.Errorf("decode reward vault %v: %w", rewardInfo.TokenVault, err)
 		}
-		apiRewardProgram := accInfo.Value.Owner
 
-		itemReward := &ClmmPoolRewardInfo{
+		nRewardInfo = append(nRewardInfo, &ClmmPoolRewardInfo{
 			RewardState:           rewardInfo.RewardState,
 			OpenTime:              rewardInfo.OpenTime,
 			EndTime:               rewardInfo.EndTime,
@@ -426,33 +412,16 @@ func updatePoolRewardInfos(
 			EmissionsPerSecondX64: rewardInfo.EmissionsPerSecondX64,
 			RewardTotalEmissioned: rewardInfo.RewardTotalEmissioned,
 			RewardClaimed:         rewardInfo.RewardClaimed,
-			TokenProgramId:        apiRewardProgram,
+			TokenProgramId:        mintAccount.Owner,
 			TokenMint:             rewardInfo.TokenMint,
 			TokenVault:            rewardInfo.TokenVault,
 			Creator:               rewardInfo.Creator,
 			RewardGrowthGlobalX64: rewardInfo.RewardGrowthGlobalX64,
-			PerSecond:             decimal.NewFromBigInt(rewardInfo.EmissionsPerSecondX64, 0),
-			RemainingRewards:      nil,
-		}
-		if chainTime <= itemReward.OpenTime || poolLiquidity == nil || poolLiquidity.Int64() == 0 {
-			nRewardInfo = append(nRewardInfo, itemReward)
-			continue
-		}
-
-		latestUpdateTime := itemReward.EndTime
-		if chainTime < latestUpdateTime {
-			latestUpdateTime = chainTime
-		}
-		timeDelta := int64(latestUpdateTime) - int64(itemReward.LastUpdateTime)
-		rewardGrowthDeltaX64 := new(big.Int).Div(new(big.Int).Mul(big.NewInt(int64(timeDelta)), itemReward.EmissionsPerSecondX64), poolLiquidity)
-		rewardEmissionedDelta := new(big.Int).Div(new(big.Int).Mul(big.NewInt(int64(timeDelta)), itemReward.EmissionsPerSecondX64), new(big.Int).Lsh(big.NewInt(1), 64))
-		rewardTotalEmissioned := itemReward.RewardTotalEmissioned + rewardEmissionedDelta.Uint64()
-		itemReward.RewardGrowthGlobalX64 = rewardGrowthDeltaX64
-		itemReward.RewardTotalEmissioned = rewardTotalEmissioned
-		itemReward.LastUpdateTime = latestUpdateTime
-		nRewardInfo = append(nRewardInfo, itemReward)
+			PerSecond:             RewardPerSecond(rewardInfo, mint.Decimals),
+			RemainingRewards:      RemainingRewards(rewardInfo, vault.Amount),
+		})
 	}
-	return nRewardInfo
+	return nRewardInfo, nil
 }
 
 func toStringArray(array []uint64) []string {
@@ -0,0 +1,606 @@
+package raydium
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// Anchor instruction discriminators, sha256("global:<name>")[:8].
+var (
+	CLMM_SWAP_DISCRIMINATOR                      = [8]byte{248, 198, 158, 145, 225, 117, 135, 200}
+	CLMM_SWAP_V2_DISCRIMINATOR                   = [8]byte{43, 4, 237, 11, 26, 201, 30, 98}
+	CLMM_OPEN_POSITION_V2_DISCRIMINATOR          = [8]byte{77, 184, 74, 214, 112, 86, 241, 199}
+	CLMM_INCREASE_LIQUIDITY_V2_DISCRIMINATOR     = [8]byte{133, 29, 89, 223, 69, 238, 176, 10}
+	CLMM_DECREASE_LIQUIDITY_V2_DISCRIMINATOR     = [8]byte{58, 127, 188, 62, 79, 82, 196, 96}
+	CLMM_CLOSE_POSITION_DISCRIMINATOR            = [8]byte{123, 134, 81, 0, 49, 68, 98, 98}
+	CLMM_COLLECT_REMAINING_REWARDS_DISCRIMINATOR = [8]byte{18, 237, 166, 197, 34, 16, 213, 144}
+)
+
+var (
+	MEMO_PROGRAM_ID     = solana.MustPublicKeyFromBase58("MemoSq4gqABAXKb96qnH8TysNcWxMyWCqXgDLGmfcHr")
+	METADATA_PROGRAM_ID = solana.MustPublicKeyFromBase58("metaqbxxUerdq28cj1RbAWkYQm3ybzjb6a8bt518x1s")
+)
+
+// ClmmSwapParams describes a swap through a CLMM pool. TickArrays are the
+// tick arrays the swap crosses, in order, as in ClmmSwapResult.TickArrays.
+type ClmmSwapParams struct {
+	Payer              solana.PublicKey
+	InputMint          solana.PublicKey
+	InputTokenAccount  solana.PublicKey
+	OutputTokenAccount solana.PublicKey
+	// Amount is spent when IsBaseInput is set and received otherwise;
+	// OtherAmountThreshold bounds the other side.
+	Amount               *big.Int
+	OtherAmountThreshold *big.Int
+	// SqrtPriceLimitX64 stops the swap at this price; nil for no limit.
+	SqrtPriceLimitX64 *big.Int
+	IsBaseInput       bool
+	TickArrays        []solana.PublicKey
+}
+
+// ClmmOpenPositionParams describes a new position over [TickLower, TickUpper).
+// NftMint is a fresh keypair that must also sign the transaction.
+type ClmmOpenPositionParams struct {
+	Payer         solana.PublicKey
+	Owner         solana.PublicKey
+	NftMint       solana.PublicKey
+	TokenAccount0 solana.PublicKey
+	TokenAccount1 solana.PublicKey
+	TickLower     int32
+	TickUpper     int32
+	// Liquidity may be zero when BaseFlag is set, in which case the program
+	// derives it from Amount0Max (true) or Amount1Max (false).
+	Liquidity    *big.Int
+	Amount0Max   *big.Int
+	Amount1Max   *big.Int
+	WithMetadata bool
+	BaseFlag     *bool
+}
+
+// ClmmIncreaseLiquidityParams adds liquidity to an existing position; see
+// ClmmOpenPositionParams for Liquidity and BaseFlag. NftTokenProgramId is
+// the token program of the position NFT, Token when left zero.
+type ClmmIncreaseLiquidityParams struct {
+	Owner             solana.PublicKey
+	NftTokenProgramId solana.PublicKey
+	TokenAccount0     solana.PublicKey
+	TokenAccount1     solana.PublicKey
+	Liquidity         *big.Int
+	Amount0Max        *big.Int
+	Amount1Max        *big.Int
+	BaseFlag          *bool
+}
+
+// ClmmDecreaseLiquidityParams removes liquidity from a position and collects
+// its fees and rewards. A zero Liquidity only collects. RewardAccounts
+// receive the pool rewards, one per ClmmPoolInfo.RewardInfos entry.
+type ClmmDecreaseLiquidityParams struct {
+	Owner             solana.PublicKey
+	NftTokenProgramId solana.PublicKey
+	TokenAccount0     solana.PublicKey
+	TokenAccount1     solana.PublicKey
+	RewardAccounts    []solana.PublicKey
+	Liquidity         *big.Int
+	Amount0Min        *big.Int
+	Amount1Min        *big.Int
+}
+
+// NewClmmSwapInstruction builds the original swap instruction, which only
+// supports Token mints; prefer NewClmmSwapV2Instruction.
+func NewClmmSwapInstruction(pool *ClmmPoolInfo, params *ClmmSwapParams) (solana.Instruction, error) {
+	if !pool.MintA.ProgramId.Equals(TOKEN_PROGRAM_ID) || !pool.MintB.ProgramId.Equals(TOKEN_PROGRAM_ID) {
+		return nil, fmt.Errorf("pool %v has a Token-2022 mint, use swap_v2", pool.Id)
+	}
+	accounts, data, err := newClmmSwapAccounts(CLMM_SWAP_DISCRIMINATOR, pool, params)
+	if err != nil {
+		return nil, err
+	}
+	metas := append(accounts.fixed(),
+		solana.Meta(TOKEN_PROGRAM_ID),
+		solana.Meta(params.TickArrays[0]).WRITE(),
+	)
+	metas = append(metas, accounts.exBitmap...)
+	for _, tickArray := range params.TickArrays[1:] {
+		metas = append(metas, solana.Meta(tickArray).WRITE())
+	}
+	return solana.NewInstruction(pool.ProgramId, metas, data), nil
+}
+
+// NewClmmSwapV2Instruction builds a swap_v2, which supports both token
+// programs.
+func NewClmmSwapV2Instruction(pool *ClmmPoolInfo, params *ClmmSwapParams) (solana.Instruction, error) {
+	accounts, data, err := newClmmSwapAccounts(CLMM_SWAP_V2_DISCRIMINATOR, pool, params)
+	if err != nil {
+		return nil, err
+	}
+	metas := append(accounts.fixed(),
+		solana.Meta(TOKEN_PROGRAM_ID),
+		solana.Meta(TOKEN_2022_PROGRAM_ID),
+		solana.Meta(MEMO_PROGRAM_ID),
+		solana.Meta(accounts.inputMint),
+		solana.Meta(accounts.outputMint),
+	)
+	metas = append(metas, accounts.exBitmap...)
+	for _, tickArray := range params.TickArrays {
+		metas = append(metas, solana.Meta(tickArray).WRITE())
+	}
+	return solana.NewInstruction(pool.ProgramId, metas, data), nil
+}
+
+// clmmSwapAccounts are the accounts swap and swap_v2 share.
+type clmmSwapAccounts struct {
+	payer, ammConfig, poolId    solana.PublicKey
+	inputAccount, outputAccount solana.PublicKey
+	inputVault, outputVault     solana.PublicKey
+	inputMint, outputMint       solana.PublicKey
+	observation                 solana.PublicKey
+	exBitmap                    solana.AccountMetaSlice
+}
+
+func (accounts *clmmSwapAccounts) fixed() solana.AccountMetaSlice {
+	return solana.AccountMetaSlice{
+		solana.Meta(accounts.payer).SIGNER(),
+		solana.Meta(accounts.ammConfig),
+		solana.Meta(accounts.poolId).WRITE(),
+		solana.Meta(accounts.inputAccount).WRITE(),
+		solana.Meta(accounts.outputAccount).WRITE(),
+		solana.Meta(accounts.inputVault).WRITE(),
+		solana.Meta(accounts.outputVault).WRITE(),
+		solana.Meta(accounts.observation).WRITE(),
+	}
+}
+
+func newClmmSwapAccounts(discriminator [8]byte, pool *ClmmPoolInfo, params *ClmmSwapParams) (*clmmSwapAccounts, []byte, error) {
+	if err := checkInstructionAmount(params.Amount, true); err != nil {
+		return nil, nil, err
+	}
+	if err := checkInstructionAmount(params.OtherAmountThreshold, false); err != nil {
+		return nil, nil, err
+	}
+	if len(params.TickArrays) == 0 {
+		return nil, nil, fmt.Errorf("%w: tick array", ErrMissingAccount)
+	}
+	ammConfig, err := clmmAmmConfigId(pool)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkClmmMints(pool); err != nil {
+		return nil, nil, err
+	}
+	input, output := pool.MintA, pool.MintB
+	switch {
+	case params.InputMint.Equals(pool.MintA.Mint):
+	case params.InputMint.Equals(pool.MintB.Mint):
+		input, output = pool.MintB, pool.MintA
+	default:
+		return nil, nil, fmt.Errorf("mint %v is not in pool %v", params.InputMint, pool.Id)
+	}
+	accounts := &clmmSwapAccounts{
+		payer:         params.Payer,
+		ammConfig:     ammConfig,
+		poolId:        pool.Id,
+		inputAccount:  params.InputTokenAccount,
+		outputAccount: params.OutputTokenAccount,
+		inputVault:    input.Vault,
+		outputVault:   output.Vault,
+		inputMint:     input.Mint,
+		outputMint:    output.Mint,
+		observation:   pool.ObservationId,
+		exBitmap:      clmmExBitmapMetas(pool),
+	}
+	if err := checkInstructionAccounts(map[string]solana.PublicKey{
+		"payer":                params.Payer,
+		"input token account":  params.InputTokenAccount,
+		"output token account": params.OutputTokenAccount,
+		"input vault":          input.Vault,
+		"output vault":         output.Vault,
+		"observation":          pool.ObservationId,
+	}); err != nil {
+		return nil, nil, err
+	}
+
+	w := newLayoutWriter(41, 0)
+	w.bytes(discriminator[:])
+	w.u64(params.Amount.Uint64())
+	w.u64(params.OtherAmountThreshold.Uint64())
+	if err := w.u128(params.SqrtPriceLimitX64); err != nil {
+		return nil, nil, fmt.Errorf("sqrt price limit: %w", err)
+	}
+	w.bool(params.IsBaseInput)
+	return accounts, w.data, nil
+}
+
+// NewClmmOpenPositionV2Instruction opens a position, minting its NFT to the
+// owner's associated account.
+func NewClmmOpenPositionV2Instruction(pool *ClmmPoolInfo, params *ClmmOpenPositionParams) (solana.Instruction, error) {
+	if err := checkClmmTickRange(params.TickLower, params.TickUpper, pool.TickSpacing); err != nil {
+		return nil, err
+	}
+	if err := checkClmmLiquidity(params.Liquidity, params.BaseFlag != nil); err != nil {
+		return nil, err
+	}
+	for _, amount := range []*big.Int{params.Amount0Max, params.Amount1Max} {
+		if err := checkInstructionAmount(amount, false); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkInstructionAccounts(map[string]solana.PublicKey{
+		"payer":           params.Payer,
+		"owner":           params.Owner,
+		"nft mint":        params.NftMint,
+		"token account 0": params.TokenAccount0,
+		"token account 1": params.TokenAccount1,
+	}); err != nil {
+		return nil, err
+	}
+	positionAccounts, err := newClmmPositionAccounts(pool, params.TickLower, params.TickUpper)
+	if err != nil {
+		return nil, err
+	}
+	nftAccount, err := GetAssociatedTokenAddress(params.Owner, params.NftMint, TOKEN_PROGRAM_ID)
+	if err != nil {
+		return nil, err
+	}
+	metadata, _, err := solana.FindProgramAddress([][]byte{
+		[]byte("metadata"),
+		METADATA_PROGRAM_ID.Bytes(),
+		params.NftMint.Bytes(),
+	}, METADATA_PROGRAM_ID)
+	if err != nil {
+		return nil, err
+	}
+
+	w := newLayoutWriter(8+4*4+16+8+8+1+optionBoolSize(params.BaseFlag), 0)
+	w.bytes(CLMM_OPEN_POSITION_V2_DISCRIMINATOR[:])
+	w.u32(uint32(params.TickLower))
+	w.u32(uint32(params.TickUpper))
+	w.u32(uint32(positionAccounts.tickArrayLowerStart))
+	w.u32(uint32(positionAccounts.tickArrayUpperStart))
+	if err := w.u128(params.Liquidity); err != nil {
+		return nil, fmt.Errorf("liquidity: %w", err)
+	}
+	w.u64(params.Amount0Max.Uint64())
+	w.u64(params.Amount1Max.Uint64())
+	w.bool(params.WithMetadata)
+	w.optionBool(params.BaseFlag)
+
+	metas := solana.AccountMetaSlice{
+		solana.Meta(params.Payer).WRITE().SIGNER(),
+		solana.Meta(params.Owner),
+		solana.Meta(params.NftMint).WRITE().SIGNER(),
+		solana.Meta(nftAccount).WRITE(),
+		solana.Meta(metadata).WRITE(),
+		solana.Meta(pool.Id).WRITE(),
+		solana.Meta(positionAccounts.protocolPosition).WRITE(),
+		solana.Meta(positionAccounts.tickArrayLower).WRITE(),
+		solana.Meta(positionAccounts.tickArrayUpper).WRITE(),
+		solana.Meta(GetPdaPersonalPositionAddress(pool.ProgramId, params.NftMint)).WRITE(),
+		solana.Meta(params.TokenAccount0).WRITE(),
+		solana.Meta(params.TokenAccount1).WRITE(),
+		solana.Meta(pool.MintA.Vault).WRITE(),
+		solana.Meta(pool.MintB.Vault).WRITE(),
+		solana.Meta(SYSVAR_RENT_PUBKEY),
+		solana.Meta(solana.SystemProgramID),
+		solana.Meta(TOKEN_PROGRAM_ID),
+		solana.Meta(ASSOCIATED_TOKEN_PROGRAM_ID),
+		solana.Meta(METADATA_PROGRAM_ID),
+		solana.Meta(TOKEN_2022_PROGRAM_ID),
+		solana.Meta(pool.MintA.Mint),
+		solana.Meta(pool.MintB.Mint),
+	}
+	metas = append(metas, positionAccounts.exBitmap...)
+	return solana.NewInstruction(pool.ProgramId, metas, w.data), nil
+}
+
+// NewClmmIncreaseLiquidityV2Instruction adds liquidity to position.
+func NewClmmIncreaseLiquidityV2Instruction(pool *ClmmPoolInfo, position *PersonalPositionState, params *ClmmIncreaseLiquidityParams) (solana.Instruction, error) {
+	if err := checkClmmLiquidity(params.Liquidity, params.BaseFlag != nil); err != nil {
+		return nil, err
+	}
+	for _, amount := range []*big.Int{params.Amount0Max, params.Amount1Max} {
+		if err := checkInstructionAmount(amount, false); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkInstructionAccounts(map[string]solana.PublicKey{
+		"owner":           params.Owner,
+		"token account 0": params.TokenAccount0,
+		"token account 1": params.TokenAccount1,
+	}); err != nil {
+		return nil, err
+	}
+	positionAccounts, nftAccount, err := newClmmPersonalPositionAccounts(pool, position, params.Owner, params.NftTokenProgramId)
+	if err != nil {
+		return nil, err
+	}
+
+	w := newLayoutWriter(8+16+8+8+optionBoolSize(params.BaseFlag), 0)
+	w.bytes(CLMM_INCREASE_LIQUIDITY_V2_DISCRIMINATOR[:])
+	if err := w.u128(params.Liquidity); err != nil {
+		return nil, fmt.Errorf("liquidity: %w", err)
+	}
+	w.u64(params.Amount0Max.Uint64())
+	w.u64(params.Amount1Max.Uint64())
+	w.optionBool(params.BaseFlag)
+
+	metas := solana.AccountMetaSlice{
+		solana.Meta(params.Owner).SIGNER(),
+		solana.Meta(nftAccount),
+		solana.Meta(pool.Id).WRITE(),
+		solana.Meta(positionAccounts.protocolPosition).WRITE(),
+		solana.Meta(GetPdaPersonalPositionAddress(pool.ProgramId, position.NftMint)).WRITE(),
+		solana.Meta(positionAccounts.tickArrayLower).WRITE(),
+		solana.Meta(positionAccounts.tickArrayUpper).WRITE(),
+		solana.Meta(params.TokenAccount0).WRITE(),
+		solana.Meta(params.TokenAccount1).WRITE(),
+		solana.Meta(pool.MintA.Vault).WRITE(),
+		solana.Meta(pool.MintB.Vault).WRITE(),
+		solana.Meta(TOKEN_PROGRAM_ID),
+		solana.Meta(TOKEN_2022_PROGRAM_ID),
+		solana.Meta(pool.MintA.Mint),
+		solana.Meta(pool.MintB.Mint),
+	}
+	metas = append(metas, positionAccounts.exBitmap...)
+	return solana.NewInstruction(pool.ProgramId, metas, w.data), nil
+}
+
+// NewClmmDecreaseLiquidityV2Instruction removes liquidity from position and
+// pays out its fees and rewards.
+func NewClmmDecreaseLiquidityV2Instruction(pool *ClmmPoolInfo, position *PersonalPositionState, params *ClmmDecreaseLiquidityParams) (solana.Instruction, error) {
+	if err := checkClmmLiquidity(params.Liquidity, true); err != nil {
+		return nil, err
+	}
+	for _, amount := range []*big.Int{params.Amount0Min, params.Amount1Min} {
+		if err := checkInstructionAmount(amount, false); err != nil {
+			return nil, err
+		}
+	}
+	if len(params.RewardAccounts) != len(pool.RewardInfos) {
+		return nil, fmt.Errorf("%w: got %d reward accounts for %d rewards", ErrMissingAccount, len(params.RewardAccounts), len(pool.RewardInfos))
+	}
+	named := map[string]solana.PublicKey{
+		"owner":           params.Owner,
+		"token account 0": params.TokenAccount0,
+		"token account 1": params.TokenAccount1,
+	}
+	for i, account := range params.RewardAccounts {
+		named[fmt.Sprintf("reward account %d", i)] = account
+	}
+	if err := checkInstructionAccounts(named); err != nil {
+		return nil, err
+	}
+	positionAccounts, nftAccount, err := newClmmPersonalPositionAccounts(pool, position, params.Owner, params.NftTokenProgramId)
+	if err != nil {
+		return nil, err
+	}
+
+	w := newLayoutWriter(8+16+8+8, 0)
+	w.bytes(CLMM_DECREASE_LIQUIDITY_V2_DISCRIMINATOR[:])
+	if err := w.u128(params.Liquidity); err != nil {
+		return nil, fmt.Errorf("liquidity: %w", err)
+	}
+	w.u64(params.Amount0Min.Uint64())
+	w.u64(params.Amount1Min.Uint64())
+
+	metas := solana.AccountMetaSlice{
+		solana.Meta(params.Owner).SIGNER(),
+		solana.Meta(nftAccount),
+		solana.Meta(GetPdaPersonalPositionAddress(pool.ProgramId, position.NftMint)).WRITE(),
+		solana.Meta(pool.Id).WRITE(),
+		solana.Meta(positionAccounts.protocolPosition).WRITE(),
+		solana.Meta(pool.MintA.Vault).WRITE(),
+		solana.Meta(pool.MintB.Vault).WRITE(),
+		solana.Meta(positionAccounts.tickArrayLower).WRITE(),
+		solana.Meta(positionAccounts.tickArrayUpper).WRITE(),
+		solana.Meta(params.TokenAccount0).WRITE(),
+		solana.Meta(params.TokenAccount1).WRITE(),
+		solana.Meta(TOKEN_PROGRAM_ID),
+		solana.Meta(TOKEN_2022_PROGRAM_ID),
+		solana.Meta(MEMO_PROGRAM_ID),
+		solana.Meta(pool.MintA.Mint),
+		solana.Meta(pool.MintB.Mint),
+	}
+	metas = append(metas, positionAccounts.exBitmap...)
+	for i, rewardInfo := range pool.RewardInfos {
+		metas = append(metas,
+			solana.Meta(rewardInfo.TokenVault).WRITE(),
+			solana.Meta(params.RewardAccounts[i]).WRITE(),
+			solana.Meta(rewardInfo.TokenMint),
+		)
+	}
+	return solana.NewInstruction(pool.ProgramId, metas, w.data), nil
+}
+
+// NewClmmClosePositionInstruction burns the NFT of an emptied position and
+// closes its accounts. nftTokenProgramId is Token when left zero.
+func NewClmmClosePositionInstruction(programId, owner, nftMint, nftTokenProgramId solana.PublicKey) (solana.Instruction, error) {
+	if err := checkInstructionAccounts(map[string]solana.PublicKey{
+		"program id": programId,
+		"owner":      owner,
+		"nft mint":   nftMint,
+	}); err != nil {
+		return nil, err
+	}
+	if nftTokenProgramId.IsZero() {
+		nftTokenProgramId = TOKEN_PROGRAM_ID
+	}
+	nftAccount, err := GetAssociatedTokenAddress(owner, nftMint, nftTokenProgramId)
+	if err != nil {
+		return nil, err
+	}
+	w := newLayoutWriter(8, 0)
+	w.bytes(CLMM_CLOSE_POSITION_DISCRIMINATOR[:])
+	return solana.NewInstruction(programId, solana.AccountMetaSlice{
+		solana.Meta(owner).WRITE().SIGNER(),
+		solana.Meta(nftMint).WRITE(),
+		solana.Meta(nftAccount).WRITE(),
+		solana.Meta(GetPdaPersonalPositionAddress(programId, nftMint)).WRITE(),
+		solana.Meta(solana.SystemProgramID),
+		solana.Meta(nftTokenProgramId),
+	}, w.data), nil
+}
+
+// NewClmmCollectRewardInstruction lets the funder of reward rewardIndex, an
+// index into pool.RewardInfos, withdraw what remains undistributed after the
+// reward ends. Positions collect their own rewards through
+// NewClmmDecreaseLiquidityV2Instruction with zero liquidity.
+func NewClmmCollectRewardInstruction(pool *ClmmPoolInfo, funder, funderTokenAccount solana.PublicKey, rewardIndex int) (solana.Instruction, error) {
+	if rewardIndex < 0 || rewardIndex >= len(pool.RewardInfos) {
+		return nil, fmt.Errorf("reward index %d out of range for %d rewards", rewardIndex, len(pool.RewardInfos))
+	}
+	if err := checkInstructionAccounts(map[string]solana.PublicKey{
+		"funder":               funder,
+		"funder token account": funderTokenAccount,
+	}); err != nil {
+		return nil, err
+	}
+	rewardInfo := pool.RewardInfos[rewardIndex]
+	w := newLayoutWriter(9, 0)
+	w.bytes(CLMM_COLLECT_REMAINING_REWARDS_DISCRIMINATOR[:])
+	w.u8(uint8(rewardIndex))
+	return solana.NewInstruction(pool.ProgramId, solana.AccountMetaSlice{
+		solana.Meta(funder).SIGNER(),
+		solana.Meta(funderTokenAccount).WRITE(),
+		solana.Meta(pool.Id).WRITE(),
+		solana.Meta(rewardInfo.TokenVault).WRITE(),
+		solana.Meta(rewardInfo.TokenMint),
+		solana.Meta(TOKEN_PROGRAM_ID),
+		solana.Meta(TOKEN_2022_PROGRAM_ID),
+		solana.Meta(MEMO_PROGRAM_ID),
+	}, w.data), nil
+}
+
+// clmmPositionAccounts are the PDAs of a position's tick range.
+type clmmPositionAccounts struct {
+	tickArrayLowerStart int32
+	tickArrayUpperStart int32
+	tickArrayLower      solana.PublicKey
+	tickArrayUpper      solana.PublicKey
+	protocolPosition    solana.PublicKey
+	exBitmap            solana.AccountMetaSlice
+}
+
+func newClmmPositionAccounts(pool *ClmmPoolInfo, tickLower, tickUpper int32) (*clmmPositionAccounts, error) {
+	if err := checkInstructionAccounts(map[string]solana.PublicKey{
+		"program id": pool.ProgramId,
+		"pool id":    pool.Id,
+		"vault 0":    pool.MintA.Vault,
+		"vault 1":    pool.MintB.Vault,
+	}); err != nil {
+		return nil, err
+	}
+	if err := checkClmmMints(pool); err != nil {
+		return nil, err
+	}
+	lowerStart := getArrayStartIndex(tickLower, pool.TickSpacing)
+	upperStart := getArrayStartIndex(tickUpper, pool.TickSpacing)
+	if pool.ExBitmapInfo == nil && (isOverflowDefaultTickArrayBitmap(tickLower, pool.TickSpacing) || isOverflowDefaultTickArrayBitmap(tickUpper, pool.TickSpacing)) {
+		return nil, fmt.Errorf("%w: ticks [%d, %d) of pool %v", ErrMissingTickArrayBitmapExtension, tickLower, tickUpper, pool.Id)
+	}
+	return &clmmPositionAccounts{
+		tickArrayLowerStart: lowerStart,
+		tickArrayUpperStart: upperStart,
+		tickArrayLower:      GetPdaTickArrayAddress(pool.ProgramId, pool.Id, lowerStart),
+		tickArrayUpper:      GetPdaTickArrayAddress(pool.ProgramId, pool.Id, upperStart),
+		protocolPosition:    GetPdaProtocolPositionAddress(pool.ProgramId, pool.Id, tickLower, tickUpper),
+		exBitmap:            clmmExBitmapMetas(pool),
+	}, nil
+}
+
+// newClmmPersonalPositionAccounts also returns owner's account holding the
+// position NFT.
+func newClmmPersonalPositionAccounts(pool *ClmmPoolInfo, position *PersonalPositionState, owner, nftTokenProgramId solana.PublicKey) (*clmmPositionAccounts, solana.PublicKey, error) {
+	if !position.PoolId.Equals(pool.Id) {
+		return nil, solana.PublicKey{}, fmt.Errorf("position %v belongs to pool %v, not %v", position.NftMint, position.PoolId, pool.Id)
+	}
+	accounts, err := newClmmPositionAccounts(pool, position.TickLowerIndex, position.TickUpperIndex)
+	if err != nil {
+		return nil, solana.PublicKey{}, err
+	}
+	if nftTokenProgramId.IsZero() {
+		nftTokenProgramId = TOKEN_PROGRAM_ID
+	}
+	nftAccount, err := GetAssociatedTokenAddress(owner, position.NftMint, nftTokenProgramId)
+	if err != nil {
+		return nil, solana.PublicKey{}, err
+	}
+	return accounts, nftAccount, nil
+}
+
+// clmmExBitmapMetas passes the bitmap extension to the pools that have one,
+// which the program requires once ticks leave the pool's own bitmap.
+func clmmExBitmapMetas(pool *ClmmPoolInfo) solana.AccountMetaSlice {
+	if pool.ExBitmapInfo == nil {
+		return nil
+	}
+	return solana.AccountMetaSlice{solana.Meta(getPdaExBitmapAccount(pool.ProgramId, pool.Id)).WRITE()}
+}
+
+func clmmAmmConfigId(pool *ClmmPoolInfo) (solana.PublicKey, error) {
+	if pool.AmmConfig == nil {
+		return solana.PublicKey{}, fmt.Errorf("%w: amm config of pool %v", ErrMissingAccount, pool.Id)
+	}
+	ammConfig, err := solana.PublicKeyFromBase58(pool.AmmConfig.Id)
+	if err != nil {
+		return solana.PublicKey{}, fmt.Errorf("amm config of pool %v: %w", pool.Id, err)
+	}
+	return ammConfig, checkInstructionAccounts(map[string]solana.PublicKey{
+		"program id": pool.ProgramId,
+		"pool id":    pool.Id,
+	})
+}
+
+// checkClmmMints rejects pool mints the v2 instructions cannot move: the
+// program refuses transfer hook and non-transferable mints, and the token
+// program of each mint must be one the instructions pass.
+func checkClmmMints(pool *ClmmPoolInfo) error {
+	for _, mint := range []Mint{pool.MintA, pool.MintB} {
+		if err := checkTokenProgram(mint.ProgramId); err != nil {
+			return fmt.Errorf("mint %v: %w", mint.Mint, err)
+		}
+		switch {
+		case mint.Extensions.TransferHook != nil:
+			return fmt.Errorf("%w: %v has a transfer hook", ErrUnsupportedMint, mint.Mint)
+		case mint.Extensions.NonTransferable:
+			return fmt.Errorf("%w: %v is non-transferable", ErrUnsupportedMint, mint.Mint)
+		}
+	}
+	return nil
+}
+
+func checkClmmTickRange(tickLower, tickUpper int32, tickSpacing uint16) error {
+	for _, tick := range []int32{tickLower, tickUpper} {
+		if tick < MIN_TICK || tick > MAX_TICK {
+			return fmt.Errorf("%w: %d", ErrTickOutOfRange, tick)
+		}
+		if tickSpacing == 0 || tick%int32(tickSpacing) != 0 {
+			return fmt.Errorf("%w: tick %d is not a multiple of spacing %d", ErrInvalidTickRange, tick, tickSpacing)
+		}
+	}
+	if tickLower >= tickUpper {
+		return fmt.Errorf("%w: [%d, %d)", ErrInvalidTickRange, tickLower, tickUpper)
+	}
+	return nil
+}
+
+// checkClmmLiquidity checks that liquidity fits a u128 and, unless zero is
+// allowed, that it is positive.
+func checkClmmLiquidity(liquidity *big.Int, allowZero bool) error {
+	if liquidity == nil || liquidity.Sign() < 0 || !allowZero && liquidity.Sign() == 0 {
+		return fmt.Errorf("%w: liquidity %v", ErrInvalidAmount, liquidity)
+	}
+	if liquidity.Cmp(MAX_U128) > 0 {
+		return fmt.Errorf("liquidity %v: %w", liquidity, ErrU128Overflow)
+	}
+	return nil
+}
+
+// optionBoolSize is the Borsh size of an Option<bool>.
+func optionBoolSize(v *bool) int {
+	if v == nil {
+		return 1
+	}
+	return 2
+}
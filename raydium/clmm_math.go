@@ -0,0 +1,349 @@
+package raydium
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	MIN_TICK             = -443636
+	MAX_TICK             = 443636
+	FEE_RATE_DENOMINATOR = 1_000_000
+)
+
+var (
+	MIN_SQRT_PRICE_X64 = big.NewInt(4295048016)
+	MAX_SQRT_PRICE_X64 = mustBigInt("79226673521066979257578248091")
+
+	q64 = new(big.Int).Lsh(big.NewInt(1), 64)
+)
+
+var (
+	ErrTickOutOfRange      = errors.New("tick out of range")
+	ErrSqrtPriceOutOfRange = errors.New("sqrt price out of range")
+	ErrLiquidityUnderflow  = errors.New("liquidity underflow")
+	ErrInvalidTickRange    = errors.New("invalid tick range")
+)
+
+// Q64.64 values of 1/sqrt(1.0001)^(2^i) used by GetSqrtPriceAtTick.
+var sqrtPriceAtTickRatios = [19]uint64{
+	0xfffcb933bd6fb800, 0xfff97272373d4000, 0xfff2e50f5f657000, 0xffe5caca7e10f000,
+	0xffcb9843d60f7000, 0xff973b41fa98e800, 0xff2ea16466c9b000, 0xfe5dee046a9a3800,
+	0xfcbe86c7900bb000, 0xf987a7253ac65800, 0xf3392b0822bb6000, 0xe7159475a2caf000,
+	0xd097f3bdfd2f2000, 0xa9f746462d9f8000, 0x70d869a156f31c00, 0x31be135f97ed3200,
+	0x9aa508b5b85a500, 0x5d6af8dedc582c, 0x2216e584f5fa,
+}
+
+func mustBigInt(s string) *big.Int {
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		panic("invalid big integer " + s)
+	}
+	return v
+}
+
+// GetSqrtPriceAtTick returns sqrt(1.0001^tick) as a Q64.64 number, bit for
+// bit as tick_math::get_sqrt_price_at_tick.
+func GetSqrtPriceAtTick(tick int32) (*big.Int, error) {
+	if tick < MIN_TICK || tick > MAX_TICK {
+		return nil, fmt.Errorf("%w: %d", ErrTickOutOfRange, tick)
+	}
+	absTick := tick
+	if absTick < 0 {
+		absTick = -absTick
+	}
+
+	ratio := new(big.Int).Set(q64)
+	if absTick&1 != 0 {
+		ratio.SetUint64(sqrtPriceAtTickRatios[0])
+	}
+	for i := 1; i < len(sqrtPriceAtTickRatios); i++ {
+		if absTick&(1<<i) != 0 {
+			ratio.Mul(ratio, new(big.Int).SetUint64(sqrtPriceAtTickRatios[i]))
+			ratio.Rsh(ratio, 64)
+		}
+	}
+	if tick > 0 {
+		ratio.Quo(MAX_U128, ratio)
+	}
+	return ratio, nil
+}
+
+// GetTickAtSqrtPrice returns the greatest tick whose sqrt price is at most
+// sqrtPriceX64, using the program's 16-bit log2 approximation.
+func GetTickAtSqrtPrice(sqrtPriceX64 *big.Int) (int32, error) {
+	if sqrtPriceX64.Cmp(MIN_SQRT_PRICE_X64) < 0 || sqrtPriceX64.Cmp(MAX_SQRT_PRICE_X64) >= 0 {
+		return 0, fmt.Errorf("%w: %v", ErrSqrtPriceOutOfRange, sqrtPriceX64)
+	}
+
+	msb := sqrtPriceX64.BitLen() - 1
+	log2pIntegerX32 := big.NewInt(int64(msb - 64))
+	log2pIntegerX32.Lsh(log2pIntegerX32, 32)
+
+	r := new(big.Int)
+	if msb >= 64 {
+		r.Rsh(sqrtPriceX64, uint(msb-63))
+	} else {
+		r.Lsh(sqrtPriceX64, uint(63-msb))
+	}
+	// Fractional bits of log2, starting from 0.5 in Q64.64.
+	bit := new(big.Int).Lsh(big.NewInt(1), 63)
+	log2pFractionX64 := new(big.Int)
+	for precision := 0; precision < 16; precision++ {
+		r.Mul(r, r)
+		moreThanTwo := r.Bit(127)
+		r.Rsh(r, 63+moreThanTwo)
+		if moreThanTwo == 1 {
+			log2pFractionX64.Add(log2pFractionX64, bit)
+		}
+		bit.Rsh(bit, 1)
+	}
+
+	log2pX32 := log2pIntegerX32.Add(log2pIntegerX32, log2pFractionX64.Rsh(log2pFractionX64, 32))
+	logSqrt10001X64 := log2pX32.Mul(log2pX32, big.NewInt(59543866431248))
+
+	tickLow := new(big.Int).Sub(logSqrt10001X64, big.NewInt(184467440737095516))
+	tickLow.Rsh(tickLow, 64)
+	tickHigh := new(big.Int).Add(logSqrt10001X64, mustBigInt("15793534762490258745"))
+	tickHigh.Rsh(tickHigh, 64)
+
+	low, high := int32(tickLow.Int64()), int32(tickHigh.Int64())
+	if low == high {
+		return low, nil
+	}
+	highSqrtPrice, err := GetSqrtPriceAtTick(high)
+	if err == nil && highSqrtPrice.Cmp(sqrtPriceX64) <= 0 {
+		return high, nil
+	}
+	return low, nil
+}
+
+func mulDivFloor(a, b, denominator *big.Int) *big.Int {
+	return new(big.Int).Quo(new(big.Int).Mul(a, b), denominator)
+}
+
+func mulDivCeil(a, b, denominator *big.Int) *big.Int {
+	return divRoundingUp(new(big.Int).Mul(a, b), denominator)
+}
+
+func divRoundingUp(a, b *big.Int) *big.Int {
+	quotient, remainder := new(big.Int).QuoRem(a, b, new(big.Int))
+	if remainder.Sign() != 0 {
+		quotient.Add(quotient, big.NewInt(1))
+	}
+	return quotient
+}
+
+// getDeltaAmount0Unsigned is the amount of token 0 between two sqrt prices:
+// liquidity * (b - a) / (a * b). ok is false when it does not fit in a u64.
+func getDeltaAmount0Unsigned(sqrtPriceAX64, sqrtPriceBX64, liquidity *big.Int, roundUp bool) (*big.Int, bool) {
+	if sqrtPriceAX64.Cmp(sqrtPriceBX64) > 0 {
+		sqrtPriceAX64, sqrtPriceBX64 = sqrtPriceBX64, sqrtPriceAX64
+	}
+	numerator1 := new(big.Int).Lsh(liquidity, 64)
+	numerator2 := new(big.Int).Sub(sqrtPriceBX64, sqrtPriceAX64)
+
+	var result *big.Int
+	if roundUp {
+		result = divRoundingUp(mulDivCeil(numerator1, numerator2, sqrtPriceBX64), sqrtPriceAX64)
+	} else {
+		result = new(big.Int).Quo(mulDivFloor(numerator1, numerator2, sqrtPriceBX64), sqrtPriceAX64)
+	}
+	return result, result.IsUint64()
+}
+
+// getDeltaAmount1Unsigned is the amount of token 1 between two sqrt prices:
+// liquidity * (b - a). ok is false when it does not fit in a u64.
+func getDeltaAmount1Unsigned(sqrtPriceAX64, sqrtPriceBX64, liquidity *big.Int, roundUp bool) (*big.Int, bool) {
+	if sqrtPriceAX64.Cmp(sqrtPriceBX64) > 0 {
+		sqrtPriceAX64, sqrtPriceBX64 = sqrtPriceBX64, sqrtPriceAX64
+	}
+	difference := new(big.Int).Sub(sqrtPriceBX64, sqrtPriceAX64)
+
+	var result *big.Int
+	if roundUp {
+		result = mulDivCeil(liquidity, difference, q64)
+	} else {
+		result = mulDivFloor(liquidity, difference, q64)
+	}
+	return result, result.IsUint64()
+}
+
+func getNextSqrtPriceFromAmount0RoundingUp(sqrtPriceX64, liquidity, amount *big.Int, add bool) *big.Int {
+	if amount.Sign() == 0 {
+		return new(big.Int).Set(sqrtPriceX64)
+	}
+	numerator1 := new(big.Int).Lsh(liquidity, 64)
+	product := new(big.Int).Mul(amount, sqrtPriceX64)
+	if add {
+		return mulDivCeil(numerator1, sqrtPriceX64, new(big.Int).Add(numerator1, product))
+	}
+	return mulDivCeil(numerator1, sqrtPriceX64, new(big.Int).Sub(numerator1, product))
+}
+
+func getNextSqrtPriceFromAmount1RoundingDown(sqrtPriceX64, liquidity, amount *big.Int, add bool) *big.Int {
+	shifted := new(big.Int).Lsh(amount, 64)
+	if add {
+		return new(big.Int).Add(sqrtPriceX64, new(big.Int).Quo(shifted, liquidity))
+	}
+	return new(big.Int).Sub(sqrtPriceX64, divRoundingUp(shifted, liquidity))
+}
+
+func getNextSqrtPriceFromInput(sqrtPriceX64, liquidity, amountIn *big.Int, zeroForOne bool) *big.Int {
+	if zeroForOne {
+		return getNextSqrtPriceFromAmount0RoundingUp(sqrtPriceX64, liquidity, amountIn, true)
+	}
+	return getNextSqrtPriceFromAmount1RoundingDown(sqrtPriceX64, liquidity, amountIn, true)
+}
+
+func getNextSqrtPriceFromOutput(sqrtPriceX64, liquidity, amountOut *big.Int, zeroForOne bool) *big.Int {
+	if zeroForOne {
+		return getNextSqrtPriceFromAmount1RoundingDown(sqrtPriceX64, liquidity, amountOut, false)
+	}
+	return getNextSqrtPriceFromAmount0RoundingUp(sqrtPriceX64, liquidity, amountOut, false)
+}
+
+func addLiquidityDelta(liquidity, delta *big.Int) (*big.Int, error) {
+	result := new(big.Int).Add(liquidity, delta)
+	if result.Sign() < 0 {
+		return nil, fmt.Errorf("%w: %v + %v", ErrLiquidityUnderflow, liquidity, delta)
+	}
+	return result, nil
+}
+
+// SqrtPriceX64ToPrice converts a Q64.64 sqrt price to the price of token A in
+// token B. The result is exact: 2^-128 has a finite decimal expansion.
+func SqrtPriceX64ToPrice(sqrtPriceX64 *big.Int, decimalsA, decimalsB int64) decimal.Decimal {
+	priceX128 := new(big.Int).Mul(sqrtPriceX64, sqrtPriceX64)
+	// x / 2^128 == x * 5^128 / 10^128
+	priceX128.Mul(priceX128, new(big.Int).Exp(big.NewInt(5), big.NewInt(128), nil))
+	return decimal.NewFromBigInt(priceX128, -128).Shift(int32(decimalsA - decimalsB))
+}
+
+// PriceToSqrtPriceX64 is the inverse of SqrtPriceX64ToPrice, rounding down.
+func PriceToSqrtPriceX64(price decimal.Decimal, decimalsA, decimalsB int64) (*big.Int, error) {
+	if !price.IsPositive() {
+		return nil, fmt.Errorf("%w: price %v", ErrSqrtPriceOutOfRange, price)
+	}
+	raw := price.Shift(int32(decimalsB - decimalsA)).Rat()
+	priceX128 := new(big.Int).Lsh(raw.Num(), 128)
+	priceX128.Quo(priceX128, raw.Denom())
+	sqrtPriceX64 := priceX128.Sqrt(priceX128)
+	if sqrtPriceX64.Cmp(MIN_SQRT_PRICE_X64) < 0 || sqrtPriceX64.Cmp(MAX_SQRT_PRICE_X64) >= 0 {
+		return nil, fmt.Errorf("%w: price %v", ErrSqrtPriceOutOfRange, price)
+	}
+	return sqrtPriceX64, nil
+}
+
+// PriceToTick returns the tick of price, aligned to a multiple of tickSpacing.
+// It rounds down to the spacing unless roundUp is set; either way the result
+// stays within [MIN_TICK, MAX_TICK].
+func PriceToTick(price decimal.Decimal, decimalsA, decimalsB int64, tickSpacing uint16, roundUp bool) (int32, error) {
+	sqrtPriceX64, err := PriceToSqrtPriceX64(price, decimalsA, decimalsB)
+	if err != nil {
+		return 0, err
+	}
+	tick, err := GetTickAtSqrtPrice(sqrtPriceX64)
+	if err != nil {
+		return 0, err
+	}
+	return AlignTickToSpacing(tick, tickSpacing, roundUp), nil
+}
+
+// AlignTickToSpacing rounds tick to a multiple of tickSpacing, moving inwards
+// when the rounded tick would fall outside [MIN_TICK, MAX_TICK].
+func AlignTickToSpacing(tick int32, tickSpacing uint16, roundUp bool) int32 {
+	spacing := int32(tickSpacing)
+	aligned := tick / spacing * spacing
+	if aligned > tick {
+		aligned -= spacing
+	}
+	if roundUp && aligned < tick {
+		aligned += spacing
+	}
+	for aligned < MIN_TICK {
+		aligned += spacing
+	}
+	for aligned > MAX_TICK {
+		aligned -= spacing
+	}
+	return aligned
+}
+
+// getLiquidityFromAmount0 is liquidity_math::get_liquidity_from_amount_0.
+func getLiquidityFromAmount0(sqrtPriceAX64, sqrtPriceBX64 *big.Int, amount0 uint64) *big.Int {
+	if sqrtPriceAX64.Cmp(sqrtPriceBX64) > 0 {
+		sqrtPriceAX64, sqrtPriceBX64 = sqrtPriceBX64, sqrtPriceAX64
+	}
+	intermediate := mulDivFloor(sqrtPriceAX64, sqrtPriceBX64, q64)
+	return mulDivFloor(new(big.Int).SetUint64(amount0), intermediate, new(big.Int).Sub(sqrtPriceBX64, sqrtPriceAX64))
+}
+
+// getLiquidityFromAmount1 is liquidity_math::get_liquidity_from_amount_1.
+func getLiquidityFromAmount1(sqrtPriceAX64, sqrtPriceBX64 *big.Int, amount1 uint64) *big.Int {
+	if sqrtPriceAX64.Cmp(sqrtPriceBX64) > 0 {
+		sqrtPriceAX64, sqrtPriceBX64 = sqrtPriceBX64, sqrtPriceAX64
+	}
+	return mulDivFloor(new(big.Int).SetUint64(amount1), q64, new(big.Int).Sub(sqrtPriceBX64, sqrtPriceAX64))
+}
+
+// GetLiquidityFromAmounts returns the most liquidity amount0 and amount1 can
+// provide between sqrtPriceAX64 and sqrtPriceBX64 at the current price,
+// rounding down like liquidity_math::get_liquidity_from_amounts.
+func GetLiquidityFromAmounts(sqrtPriceCurrentX64, sqrtPriceAX64, sqrtPriceBX64 *big.Int, amount0, amount1 uint64) *big.Int {
+	if sqrtPriceAX64.Cmp(sqrtPriceBX64) > 0 {
+		sqrtPriceAX64, sqrtPriceBX64 = sqrtPriceBX64, sqrtPriceAX64
+	}
+	switch {
+	case sqrtPriceCurrentX64.Cmp(sqrtPriceAX64) <= 0:
+		return getLiquidityFromAmount0(sqrtPriceAX64, sqrtPriceBX64, amount0)
+	case sqrtPriceCurrentX64.Cmp(sqrtPriceBX64) < 0:
+		liquidity0 := getLiquidityFromAmount0(sqrtPriceCurrentX64, sqrtPriceBX64, amount0)
+		liquidity1 := getLiquidityFromAmount1(sqrtPriceAX64, sqrtPriceCurrentX64, amount1)
+		if liquidity0.Cmp(liquidity1) < 0 {
+			return liquidity0
+		}
+		return liquidity1
+	default:
+		return getLiquidityFromAmount1(sqrtPriceAX64, sqrtPriceBX64, amount1)
+	}
+}
+
+// GetAmountsFromLiquidity returns the token amounts that liquidityDelta adds
+// to (positive) or removes from (negative) the range [tickLower, tickUpper),
+// like liquidity_math::get_delta_amounts_signed: deposits round up and
+// withdrawals round down. Both amounts are returned as non-negative numbers.
+func GetAmountsFromLiquidity(tickCurrent int32, sqrtPriceCurrentX64 *big.Int, tickLower, tickUpper int32, liquidityDelta *big.Int) (*big.Int, *big.Int, error) {
+	if tickLower >= tickUpper {
+		return nil, nil, fmt.Errorf("%w: [%d, %d)", ErrInvalidTickRange, tickLower, tickUpper)
+	}
+	sqrtPriceLowerX64, err := GetSqrtPriceAtTick(tickLower)
+	if err != nil {
+		return nil, nil, err
+	}
+	sqrtPriceUpperX64, err := GetSqrtPriceAtTick(tickUpper)
+	if err != nil {
+		return nil, nil, err
+	}
+	roundUp := liquidityDelta.Sign() > 0
+	liquidity := new(big.Int).Abs(liquidityDelta)
+
+	amount0, amount1 := new(big.Int), new(big.Int)
+	ok0, ok1 := true, true
+	switch {
+	case tickCurrent < tickLower:
+		amount0, ok0 = getDeltaAmount0Unsigned(sqrtPriceLowerX64, sqrtPriceUpperX64, liquidity, roundUp)
+	case tickCurrent < tickUpper:
+		amount0, ok0 = getDeltaAmount0Unsigned(sqrtPriceCurrentX64, sqrtPriceUpperX64, liquidity, roundUp)
+		amount1, ok1 = getDeltaAmount1Unsigned(sqrtPriceLowerX64, sqrtPriceCurrentX64, liquidity, roundUp)
+	default:
+		amount1, ok1 = getDeltaAmount1Unsigned(sqrtPriceLowerX64, sqrtPriceUpperX64, liquidity, roundUp)
+	}
+	if !ok0 || !ok1 {
+		return nil, nil, fmt.Errorf("%w: liquidity %v", ErrAmountOverflow, liquidityDelta)
+	}
+	return amount0, amount1, nil
+}
@@ -0,0 +1,219 @@
+package raydium
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestTickMathRoundTrip(t *testing.T) {
+	for _, tick := range []int32{MIN_TICK, -443635, -100000, -1, 0, 1, 100, 12345, 443635} {
+		sqrtPriceX64, err := GetSqrtPriceAtTick(tick)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := GetTickAtSqrtPrice(sqrtPriceX64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tick {
+			t.Errorf("tick %d: round trip gave %d", tick, got)
+		}
+	}
+	if s, _ := GetSqrtPriceAtTick(MIN_TICK); s.Cmp(MIN_SQRT_PRICE_X64) != 0 {
+		t.Errorf("min sqrt price: got %v", s)
+	}
+	if s, _ := GetSqrtPriceAtTick(MAX_TICK); s.Cmp(MAX_SQRT_PRICE_X64) != 0 {
+		t.Errorf("max sqrt price: got %v", s)
+	}
+	if _, err := GetSqrtPriceAtTick(MAX_TICK + 1); err == nil {
+		t.Error("expected an error above MAX_TICK")
+	}
+	if _, err := GetTickAtSqrtPrice(MAX_SQRT_PRICE_X64); err == nil {
+		t.Error("expected an error at MAX_SQRT_PRICE_X64")
+	}
+}
+
+func TestPriceConversions(t *testing.T) {
+	price := SqrtPriceX64ToPrice(q64, 9, 6)
+	if !price.Equal(decimal.NewFromInt(1000)) {
+		t.Errorf("price at 2^64: got %v, want 1000", price)
+	}
+	sqrtPriceX64, err := PriceToSqrtPriceX64(decimal.NewFromInt(1000), 9, 6)
+	if err != nil || sqrtPriceX64.Cmp(q64) != 0 {
+		t.Errorf("sqrt price of 1000: got %v %v", sqrtPriceX64, err)
+	}
+	if _, err := PriceToSqrtPriceX64(decimal.Zero, 9, 6); err == nil {
+		t.Error("expected an error for a zero price")
+	}
+
+	cases := []struct {
+		tick    int32
+		spacing uint16
+		roundUp bool
+		want    int32
+	}{
+		{123, 10, false, 120},
+		{123, 10, true, 130},
+		{-123, 10, false, -130},
+		{-123, 10, true, -120},
+		{-120, 10, true, -120},
+		{MIN_TICK, 10, false, -443630},
+		{MAX_TICK - 1, 10, true, 443630},
+	}
+	for _, c := range cases {
+		sqrtPriceX64, err := GetSqrtPriceAtTick(c.tick)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tick, err := PriceToTick(SqrtPriceX64ToPrice(sqrtPriceX64, 6, 9), 6, 9, c.spacing, c.roundUp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tick != c.want {
+			t.Errorf("tick %d spacing %d round up %v: got %d, want %d", c.tick, c.spacing, c.roundUp, tick, c.want)
+		}
+	}
+}
+
+func TestLiquidityAmounts(t *testing.T) {
+	sqrtPriceCurrentX64, _ := GetSqrtPriceAtTick(0)
+
+	// Expected values come from the program's liquidity_math formulas.
+	cases := []struct {
+		lower, upper       int32
+		liquidity          int64
+		deposit0, deposit1 int64
+	}{
+		{-600, 600, 33_837_499_809, 1_000_000_000, 1_000_000_000},
+		{100, 1000, 22_840_997_268, 1_000_000_000, 0},
+		{-1000, -100, 45_681_994_537, 0, 2_000_000_000},
+	}
+	for _, c := range cases {
+		sqrtPriceLowerX64, _ := GetSqrtPriceAtTick(c.lower)
+		sqrtPriceUpperX64, _ := GetSqrtPriceAtTick(c.upper)
+		liquidity := GetLiquidityFromAmounts(sqrtPriceCurrentX64, sqrtPriceLowerX64, sqrtPriceUpperX64, 1_000_000_000, 2_000_000_000)
+		if liquidity.Int64() != c.liquidity {
+			t.Errorf("[%d, %d): liquidity %v, want %d", c.lower, c.upper, liquidity, c.liquidity)
+		}
+
+		amount0, amount1, err := GetAmountsFromLiquidity(0, sqrtPriceCurrentX64, c.lower, c.upper, liquidity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if amount0.Int64() != c.deposit0 || amount1.Int64() != c.deposit1 {
+			t.Errorf("[%d, %d): deposit %v %v, want %d %d", c.lower, c.upper, amount0, amount1, c.deposit0, c.deposit1)
+		}
+		amount0, amount1, err = GetAmountsFromLiquidity(0, sqrtPriceCurrentX64, c.lower, c.upper, new(big.Int).Neg(liquidity))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Withdrawals round down, one unit below the deposit here.
+		if amount0.Int64() != max(c.deposit0-1, 0) || amount1.Int64() != max(c.deposit1-1, 0) {
+			t.Errorf("[%d, %d): withdraw %v %v", c.lower, c.upper, amount0, amount1)
+		}
+	}
+
+	if _, _, err := GetAmountsFromLiquidity(0, sqrtPriceCurrentX64, 10, 10, big.NewInt(1)); err == nil {
+		t.Error("expected an error for an empty range")
+	}
+}
+
+// clampTick maps any int32 onto [MIN_TICK, MAX_TICK].
+func clampTick(tick int32) int32 {
+	return int32(int64(tick)%(MAX_TICK-MIN_TICK+1)+(MAX_TICK-MIN_TICK+1))%(MAX_TICK-MIN_TICK+1) + MIN_TICK
+}
+
+func FuzzSqrtPriceAtTick(f *testing.F) {
+	for _, tick := range []int32{MIN_TICK, MIN_TICK + 1, -1, 0, 1, MAX_TICK - 1, MAX_TICK} {
+		f.Add(tick)
+	}
+	f.Fuzz(func(t *testing.T, tick int32) {
+		tick = clampTick(tick)
+		sqrtPriceX64, err := GetSqrtPriceAtTick(tick)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := GetTickAtSqrtPrice(sqrtPriceX64); tick < MAX_TICK && (err != nil || got != tick) {
+			t.Fatalf("tick %d: round trip gave %d %v", tick, got, err)
+		}
+		if tick == MAX_TICK {
+			return
+		}
+		nextSqrtPriceX64, err := GetSqrtPriceAtTick(tick + 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nextSqrtPriceX64.Cmp(sqrtPriceX64) <= 0 {
+			t.Fatalf("tick %d: sqrt price %v not below %v", tick, sqrtPriceX64, nextSqrtPriceX64)
+		}
+		below := new(big.Int).Sub(nextSqrtPriceX64, big.NewInt(1))
+		if got, err := GetTickAtSqrtPrice(below); err != nil || got != tick {
+			t.Fatalf("sqrt price %v: got tick %d %v, want %d", below, got, err, tick)
+		}
+	})
+}
+
+func FuzzTickAtSqrtPrice(f *testing.F) {
+	f.Add(uint64(0), uint64(0))
+	f.Add(uint64(1), uint64(0))
+	f.Add(^uint64(0), ^uint64(0))
+	f.Fuzz(func(t *testing.T, hi, lo uint64) {
+		value := new(big.Int).Lsh(new(big.Int).SetUint64(hi), 64)
+		value.Or(value, new(big.Int).SetUint64(lo))
+		span := new(big.Int).Sub(MAX_SQRT_PRICE_X64, MIN_SQRT_PRICE_X64)
+		sqrtPriceX64 := value.Mod(value, span).Add(value, MIN_SQRT_PRICE_X64)
+
+		tick, err := GetTickAtSqrtPrice(sqrtPriceX64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		atTick, _ := GetSqrtPriceAtTick(tick)
+		if atTick.Cmp(sqrtPriceX64) > 0 {
+			t.Fatalf("sqrt price %v: tick %d starts above it", sqrtPriceX64, tick)
+		}
+		if tick < MAX_TICK {
+			atNext, _ := GetSqrtPriceAtTick(tick + 1)
+			if atNext.Cmp(sqrtPriceX64) <= 0 {
+				t.Fatalf("sqrt price %v: tick %d is not the greatest", sqrtPriceX64, tick)
+			}
+		}
+	})
+}
+
+func FuzzLiquidityAmounts(f *testing.F) {
+	f.Add(int32(-600), uint16(120), int32(0), uint64(1_000_000_000), uint64(2_000_000_000))
+	f.Add(int32(MIN_TICK), uint16(1), int32(MIN_TICK), uint64(1), uint64(1))
+	f.Add(int32(MAX_TICK-1), uint16(1), int32(MAX_TICK-1), ^uint64(0), ^uint64(0))
+	f.Fuzz(func(t *testing.T, lower int32, width uint16, current int32, amount0, amount1 uint64) {
+		lower = clampTick(lower)
+		upper := lower + int32(width) + 1
+		if upper > MAX_TICK {
+			lower, upper = MAX_TICK-int32(width)-1, MAX_TICK
+		}
+		current = clampTick(current)
+		sqrtPriceCurrentX64, _ := GetSqrtPriceAtTick(current)
+		sqrtPriceLowerX64, _ := GetSqrtPriceAtTick(lower)
+		sqrtPriceUpperX64, _ := GetSqrtPriceAtTick(upper)
+
+		liquidity := GetLiquidityFromAmounts(sqrtPriceCurrentX64, sqrtPriceLowerX64, sqrtPriceUpperX64, amount0, amount1)
+		if more := GetLiquidityFromAmounts(sqrtPriceCurrentX64, sqrtPriceLowerX64, sqrtPriceUpperX64, amount0|1<<63, amount1|1<<63); more.Cmp(liquidity) < 0 {
+			t.Fatalf("liquidity decreased from %v to %v with larger amounts", liquidity, more)
+		}
+		deposit0, deposit1, err := GetAmountsFromLiquidity(current, sqrtPriceCurrentX64, lower, upper, liquidity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deposit0.Cmp(new(big.Int).SetUint64(amount0)) > 0 || deposit1.Cmp(new(big.Int).SetUint64(amount1)) > 0 {
+			t.Fatalf("liquidity %v needs %v %v, more than %d %d", liquidity, deposit0, deposit1, amount0, amount1)
+		}
+		withdraw0, withdraw1, err := GetAmountsFromLiquidity(current, sqrtPriceCurrentX64, lower, upper, new(big.Int).Neg(liquidity))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if withdraw0.Cmp(deposit0) > 0 || withdraw1.Cmp(deposit1) > 0 {
+			t.Fatalf("withdraw %v %v exceeds deposit %v %v", withdraw0, withdraw1, deposit0, deposit1)
+		}
+	})
+}
@@ -0,0 +1,175 @@
+package raydium
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// ClmmPool is the on-chain state a CLMM swap reads: the pool, its fee config,
+// the optional bitmap extension and the tick arrays keyed by start index.
+// MintInfoA and MintInfoB carry the Token-2022 transfer fees; a nil mint
+// has none.
+type ClmmPool struct {
+	ProgramId  solana.PublicKey
+	Id         solana.PublicKey
+	State      *PoolInfoLayout
+	AmmConfig  *ApiClmmConfigItem
+	ExBitmap   *TickArrayBitmap
+	TickArrays map[int32]*TickArrayState
+	MintInfoA  *SplMint
+	MintInfoB  *SplMint
+}
+
+// LoadClmmPool fetches a pool with its config, bitmap extension and up to
+// tickArrayCount initialized tick arrays on each side of the current tick.
+func LoadClmmPool(ctx context.Context, fetcher AccountFetcher, poolId solana.PublicKey, tickArrayCount int) (*ClmmPool, error) {
+	poolAccount, err := fetcher.GetAccountInfo(ctx, poolId)
+	if err != nil {
+		return nil, err
+	}
+	programId := CLMM_PROGRAM_ID
+	if err := checkOwner(poolAccount.Owner, programId); err != nil {
+		return nil, fmt.Errorf("pool %v: %w", poolId, err)
+	}
+	state, err := NewPoolInfoLayoutFromBytes(poolAccount.Data.GetBinary())
+	if err != nil {
+		return nil, fmt.Errorf("decode pool %v: %w", poolId, err)
+	}
+
+	exBitmapAddress := getPdaExBitmapAccount(programId, poolId)
+	result, err := fetcher.GetMultipleAccounts(ctx, []solana.PublicKey{state.AmmConfig, exBitmapAddress, state.MintA, state.MintB})
+	if err != nil {
+		return nil, err
+	}
+	if result[0] == nil {
+		return nil, fmt.Errorf("amm config %v not found", state.AmmConfig)
+	}
+	ammConfig, err := NewApiClmmConfigItemFromBytes(state.AmmConfig, result[0].Data.GetBinary())
+	if err != nil {
+		return nil, fmt.Errorf("decode amm config %v: %w", state.AmmConfig, err)
+	}
+	var exBitmap *TickArrayBitmap
+	if result[1] != nil {
+		if exBitmap, err = NewTickArrayBitmapFromBytes(result[1].Data.GetBinary()); err != nil {
+			return nil, fmt.Errorf("decode tick array bitmap extension %v: %w", exBitmapAddress, err)
+		}
+	}
+
+	var mints [2]*SplMint
+	for i, mint := range []solana.PublicKey{state.MintA, state.MintB} {
+		account := result[2+i]
+		if account == nil {
+			return nil, fmt.Errorf("mint %v not found", mint)
+		}
+		if mints[i], err = NewSplMintFromBytes(account.Data.GetBinary()); err != nil {
+			return nil, fmt.Errorf("decode mint %v: %w", mint, err)
+		}
+	}
+
+	startIndexes, err := GetInitializedTickArrayStartIndexes(state, exBitmap, tickArrayCount)
+	if err != nil {
+		return nil, err
+	}
+	tickArrays, err := FetchTickArrays(ctx, fetcher, programId, poolId, startIndexes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ClmmPool{
+		ProgramId:  programId,
+		Id:         poolId,
+		State:      state,
+		AmmConfig:  ammConfig,
+		ExBitmap:   exBitmap,
+		TickArrays: tickArrays,
+		MintInfoA:  mints[0],
+		MintInfoB:  mints[1],
+	}, nil
+}
+
+// GetInitializedTickArrayStartIndexes locates, from the pool bitmap and the
+// extension, up to count initialized tick arrays on each side of the current
+// tick, plus the current one when it is initialized. Without an extension the
+// search stops at the edge of the pool bitmap.
+func GetInitializedTickArrayStartIndexes(pool *PoolInfoLayout, exBitmap *TickArrayBitmap, count int) ([]int32, error) {
+	currentStartIndex := getArrayStartIndex(pool.TickCurrent, pool.TickSpacing)
+	initialized, err := isTickArrayInitialized(pool, exBitmap, currentStartIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	var lower, upper []int32
+	for _, zeroForOne := range []bool{true, false} {
+		last := currentStartIndex
+		for i := 0; i < count; i++ {
+			next, found, err := nextInitializedTickArrayStartIndex(pool, exBitmap, last, zeroForOne)
+			if errors.Is(err, ErrMissingTickArrayBitmapExtension) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				break
+			}
+			if zeroForOne {
+				lower = append(lower, next)
+			} else {
+				upper = append(upper, next)
+			}
+			last = next
+		}
+	}
+
+	startIndexes := make([]int32, 0, len(lower)+len(upper)+1)
+	for i := len(lower) - 1; i >= 0; i-- {
+		startIndexes = append(startIndexes, lower[i])
+	}
+	if initialized {
+		startIndexes = append(startIndexes, currentStartIndex)
+	}
+	return append(startIndexes, upper...), nil
+}
+
+func isTickArrayInitialized(pool *PoolInfoLayout, exBitmap *TickArrayBitmap, startIndex int32) (bool, error) {
+	if !isOverflowDefaultTickArrayBitmap(startIndex, pool.TickSpacing) {
+		initialized, _, err := checkCurrentTickArrayIsInitialized(pool.TickArrayBitmap, startIndex, pool.TickSpacing)
+		return initialized, err
+	}
+	if exBitmap == nil {
+		return false, nil
+	}
+	return exBitmap.checkTickArrayIsInitialized(startIndex, pool.TickSpacing)
+}
+
+// FetchTickArrays batch-fetches and decodes the tick arrays of a pool, keyed
+// by start index.
+func FetchTickArrays(ctx context.Context, fetcher AccountFetcher, programId, poolId solana.PublicKey, startIndexes []int32) (map[int32]*TickArrayState, error) {
+	addresses := make([]solana.PublicKey, 0, len(startIndexes))
+	for _, startIndex := range startIndexes {
+		addresses = append(addresses, GetPdaTickArrayAddress(programId, poolId, startIndex))
+	}
+	accounts, err := getMultipleAccountsInfo(ctx, fetcher, addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	tickArrays := make(map[int32]*TickArrayState, len(accounts))
+	for i, account := range accounts {
+		if err := checkOwner(account.Owner, programId); err != nil {
+			return nil, fmt.Errorf("tick array %v: %w", addresses[i], err)
+		}
+		tickArray, err := NewTickArrayStateFromBytes(account.Data.GetBinary())
+		if err != nil {
+			return nil, fmt.Errorf("decode tick array %v: %w", addresses[i], err)
+		}
+		if !tickArray.PoolId.Equals(poolId) || tickArray.StartTickIndex != startIndexes[i] {
+			return nil, fmt.Errorf("tick array %v belongs to %v at %d", addresses[i], tickArray.PoolId, tickArray.StartTickIndex)
+		}
+		tickArrays[tickArray.StartTickIndex] = tickArray
+	}
+	return tickArrays, nil
+}
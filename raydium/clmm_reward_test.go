@@ -0,0 +1,159 @@
+package raydium
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/shopspring/decimal"
+)
+
+// rewardPoolFixture has one reward emitting 3 raw units a second between
+// times 100 and 1000, last updated at 200, over 1000 units of liquidity.
+func rewardPoolFixture() *PoolInfoLayout {
+	x64 := func(v int64) *big.Int { return new(big.Int).Lsh(big.NewInt(v), 64) }
+	return &PoolInfoLayout{
+		Liquidity: big.NewInt(1000),
+		RewardInfos: []*RewardInfo{
+			{
+				RewardState:           REWARD_STATE_OPENING,
+				OpenTime:              100,
+				EndTime:               1000,
+				LastUpdateTime:        200,
+				EmissionsPerSecondX64: x64(3),
+				RewardTotalEmissioned: 300,
+				RewardClaimed:         200,
+				TokenMint:             testPublicKey("reward mint"),
+				TokenVault:            testPublicKey("reward vault"),
+				RewardGrowthGlobalX64: x64(10),
+			},
+			{EmissionsPerSecondX64: new(big.Int), RewardGrowthGlobalX64: new(big.Int)},
+			{EmissionsPerSecondX64: new(big.Int), RewardGrowthGlobalX64: new(big.Int)},
+		},
+	}
+}
+
+func TestUpdateRewardInfos(t *testing.T) {
+	pool := rewardPoolFixture()
+
+	cases := []struct {
+		chainTime      uint64
+		growth         string
+		emissioned     uint64
+		lastUpdateTime uint64
+		state          uint8
+	}{
+		{50, "184467440737095516160", 300, 200, REWARD_STATE_OPENING},
+		{300, "190001463959208381644", 600, 300, REWARD_STATE_OPENING},
+		{2000, "228739626513998440038", 2700, 1000, REWARD_STATE_ENDED},
+	}
+	for _, c := range cases {
+		rewardInfo := UpdateRewardInfos(pool, c.chainTime)[0]
+		if rewardInfo.RewardGrowthGlobalX64.String() != c.growth {
+			t.Errorf("time %d: growth %v, want %s", c.chainTime, rewardInfo.RewardGrowthGlobalX64, c.growth)
+		}
+		if rewardInfo.RewardTotalEmissioned != c.emissioned || rewardInfo.LastUpdateTime != c.lastUpdateTime || rewardInfo.RewardState != c.state {
+			t.Errorf("time %d: got %+v", c.chainTime, rewardInfo)
+		}
+	}
+	if pool.RewardInfos[0].LastUpdateTime != 200 || pool.RewardInfos[0].RewardGrowthGlobalX64.String() != "184467440737095516160" {
+		t.Error("pool reward infos were modified")
+	}
+
+	pool.Liquidity = new(big.Int)
+	rewardInfo := UpdateRewardInfos(pool, 300)[0]
+	if rewardInfo.LastUpdateTime != 300 || rewardInfo.RewardTotalEmissioned != 300 {
+		t.Errorf("without liquidity: got %+v", rewardInfo)
+	}
+}
+
+func TestRewardAmounts(t *testing.T) {
+	rewardInfo := &RewardInfo{EmissionsPerSecondX64: new(big.Int).Lsh(big.NewInt(3), 63)}
+	if perSecond := RewardPerSecond(rewardInfo, 6); !perSecond.Equal(decimal.RequireFromString("0.0000015")) {
+		t.Errorf("per second: got %v", perSecond)
+	}
+
+	rewardInfo = &RewardInfo{RewardTotalEmissioned: 700, RewardClaimed: 200}
+	if remaining := RemainingRewards(rewardInfo, 1000); remaining.Int64() != 500 {
+		t.Errorf("remaining: got %v, want 500", remaining)
+	}
+	if remaining := RemainingRewards(rewardInfo, 400); remaining.Sign() != 0 {
+		t.Errorf("remaining of a short vault: got %v, want 0", remaining)
+	}
+}
+
+func TestComputePositionRewards(t *testing.T) {
+	x64 := func(v int64) *big.Int { return new(big.Int).Lsh(big.NewInt(v), 64) }
+	pool := rewardPoolFixture()
+	tickLower := &TickState{Tick: -600, LiquidityGross: big.NewInt(1000), RewardGrowthsOutsideX64: []*big.Int{x64(1), nil, nil}}
+	tickUpper := &TickState{Tick: 600, LiquidityGross: big.NewInt(1000), RewardGrowthsOutsideX64: []*big.Int{x64(2), nil, nil}}
+	position := &PersonalPositionState{
+		TickLowerIndex: -600,
+		TickUpperIndex: 600,
+		Liquidity:      big.NewInt(1000),
+		RewardInfos: []*PositionRewardInfo{
+			{GrowthInsideLastX64: x64(4), RewardAmountOwed: 5},
+			{GrowthInsideLastX64: new(big.Int), RewardAmountOwed: 9},
+			{GrowthInsideLastX64: new(big.Int)},
+		},
+	}
+
+	// Inside growth is 10-1-2 = 7 at time 200, 3 above the position's last.
+	rewards := ComputePositionRewards(pool, position, tickLower, tickUpper, 200)
+	if rewards[0].Int64() != 3005 || rewards[1].Int64() != 9 || rewards[2].Sign() != 0 {
+		t.Errorf("at 200: got %v", rewards)
+	}
+	// 100 more seconds emit 300 units, 299 after rounding down twice.
+	rewards = ComputePositionRewards(pool, position, tickLower, tickUpper, 300)
+	if rewards[0].Int64() != 3304 {
+		t.Errorf("at 300: got %v, want 3304", rewards[0])
+	}
+}
+
+func TestUpdatePoolRewardInfos(t *testing.T) {
+	pool := rewardPoolFixture()
+	rewardInfo := pool.RewardInfos[0]
+
+	accounts := map[solana.PublicKey]*rpc.Account{
+		rewardInfo.TokenMint: {Owner: TOKEN_2022_PROGRAM_ID, Data: rpc.DataBytesOrJSONFromBytes(mustMarshal(t, &SplMint{Decimals: 6}))},
+	}
+
+	// A missing vault used to be skipped silently.
+	if _, err := updatePoolRewardInfos(300, pool, accounts); !errors.Is(err, ErrAccountNotFound) {
+		t.Fatalf("got %v, want ErrAccountNotFound", err)
+	}
+
+	accounts[rewardInfo.TokenVault] = &rpc.Account{
+		Owner: TOKEN_2022_PROGRAM_ID,
+		Data:  rpc.DataBytesOrJSONFromBytes(mustMarshal(t, &SplAccount{Mint: rewardInfo.TokenMint, Amount: 10_000})),
+	}
+	rewardInfos, err := updatePoolRewardInfos(300, pool, accounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rewardInfos) != 1 {
+		t.Fatalf("got %d reward infos, want 1", len(rewardInfos))
+	}
+	got := rewardInfos[0]
+	if !got.TokenProgramId.Equals(TOKEN_2022_PROGRAM_ID) || got.RewardGrowthGlobalX64.String() != "190001463959208381644" {
+		t.Errorf("got %+v", got)
+	}
+	if !got.PerSecond.Equal(decimal.RequireFromString("0.000003")) {
+		t.Errorf("per second: got %v", got.PerSecond)
+	}
+	// 10000 in the vault, 600 emitted of which 200 claimed.
+	if got.RemainingRewards.Int64() != 9600 {
+		t.Errorf("remaining: got %v, want 9600", got.RemainingRewards)
+	}
+}
+
+func TestUpdatePoolRewardInfosWithoutRewards(t *testing.T) {
+	pool := rewardPoolFixture()
+	pool.RewardInfos = pool.RewardInfos[1:]
+	rewardInfos, err := updatePoolRewardInfos(300, pool, nil)
+	if err != nil || len(rewardInfos) != 0 {
+		t.Errorf("got %v %v", rewardInfos, err)
+	}
+}
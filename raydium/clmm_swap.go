@@ -0,0 +1,424 @@
+package raydium
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// Bit of PoolInfoLayout.Status that disables swaps.
+const CLMM_POOL_STATUS_SWAP_DISABLED = 1 << 4
+
+var (
+	ErrInsufficientLiquidity = errors.New("insufficient liquidity for swap")
+	ErrTickArrayNotFound     = errors.New("tick array account not provided")
+	ErrTooSmallAmount        = errors.New("swap amount too small")
+)
+
+// ClmmSwapResult amounts are what the user sends and receives. For
+// Token-2022 mints with a transfer fee they differ from what the pool takes
+// and pays out by TransferFeeIn and TransferFeeOut.
+type ClmmSwapResult struct {
+	AmountIn       *big.Int
+	AmountOut      *big.Int
+	MinAmountOut   *big.Int
+	MaxAmountIn    *big.Int
+	Fee            *big.Int
+	TransferFeeIn  *big.Int
+	TransferFeeOut *big.Int
+	SqrtPriceX64   *big.Int
+	TickCurrent    int32
+	Liquidity      *big.Int
+	// Tick array accounts in the order the swap visits them; the first one
+	// is the swap instruction's tick array, the rest its remaining accounts.
+	TickArrays []solana.PublicKey
+}
+
+// ComputeClmmAmountOut quotes an exact-input swap of amountIn of inputMint.
+// A nil sqrtPriceLimitX64 lets the swap run to the end of the price range.
+func ComputeClmmAmountOut(ctx context.Context, pool *ClmmPool, inputMint solana.PublicKey, amountIn *big.Int, slippage Slippage, sqrtPriceLimitX64 *big.Int, clock Clock) (*ClmmSwapResult, error) {
+	zeroForOne, err := pool.zeroForOne(inputMint)
+	if err != nil {
+		return nil, err
+	}
+	feeIn, feeOut, err := pool.transferFees(ctx, zeroForOne, clock)
+	if err != nil {
+		return nil, err
+	}
+	amountSpecified := amountIn
+	if feeIn != nil && amountIn != nil {
+		if amountSpecified = new(big.Int).Sub(amountIn, feeIn.Fee(amountIn)); amountSpecified.Sign() <= 0 {
+			return nil, fmt.Errorf("%w: %v is all transfer fee", ErrTooSmallAmount, amountIn)
+		}
+	}
+	result, err := simulateClmmSwap(ctx, pool, zeroForOne, amountSpecified, true, sqrtPriceLimitX64, clock)
+	if err != nil {
+		return nil, err
+	}
+	if err := result.applyTransferFees(feeIn, feeOut); err != nil {
+		return nil, err
+	}
+	result.MinAmountOut = slippage.MinAmountOut(result.AmountOut)
+	return result, nil
+}
+
+// ComputeClmmAmountIn quotes an exact-output swap that receives amountOut of
+// outputMint.
+func ComputeClmmAmountIn(ctx context.Context, pool *ClmmPool, outputMint solana.PublicKey, amountOut *big.Int, slippage Slippage, sqrtPriceLimitX64 *big.Int, clock Clock) (*ClmmSwapResult, error) {
+	var inputMint solana.PublicKey
+	switch {
+	case outputMint.Equals(pool.State.MintA):
+		inputMint = pool.State.MintB
+	case outputMint.Equals(pool.State.MintB):
+		inputMint = pool.State.MintA
+	default:
+		return nil, fmt.Errorf("%w: %v in pool %v", ErrTokenNotInPool, outputMint, pool.Id)
+	}
+	zeroForOne, err := pool.zeroForOne(inputMint)
+	if err != nil {
+		return nil, err
+	}
+	feeIn, feeOut, err := pool.transferFees(ctx, zeroForOne, clock)
+	if err != nil {
+		return nil, err
+	}
+	// The pool pays out enough for amountOut to arrive net of the fee.
+	amountSpecified := amountOut
+	if feeOut != nil && amountOut != nil {
+		amountSpecified = new(big.Int).Add(amountOut, feeOut.InverseFee(amountOut))
+	}
+	result, err := simulateClmmSwap(ctx, pool, zeroForOne, amountSpecified, false, sqrtPriceLimitX64, clock)
+	if err != nil {
+		return nil, err
+	}
+	if result.AmountOut.Cmp(amountSpecified) != 0 {
+		return nil, fmt.Errorf("%w: only %v of %v out available", ErrInsufficientLiquidity, result.AmountOut, amountSpecified)
+	}
+	if err := result.applyTransferFees(feeIn, feeOut); err != nil {
+		return nil, err
+	}
+	result.MaxAmountIn = slippage.MaxAmountIn(result.AmountIn)
+	if !result.MaxAmountIn.IsUint64() {
+		return nil, fmt.Errorf("%w: max amount in %v", ErrAmountOverflow, result.MaxAmountIn)
+	}
+	return result, nil
+}
+
+// transferFees returns the transfer fees in force on the input and output
+// mints, nil for a mint without one. The epoch is only read from clock when
+// a mint has a fee config.
+func (pool *ClmmPool) transferFees(ctx context.Context, zeroForOne bool, clock Clock) (in, out *TransferFee, err error) {
+	var extensionsIn, extensionsOut *MintExtensions
+	if pool.MintInfoA != nil {
+		extensionsIn = &pool.MintInfoA.Extensions
+	}
+	if pool.MintInfoB != nil {
+		extensionsOut = &pool.MintInfoB.Extensions
+	}
+	if !zeroForOne {
+		extensionsIn, extensionsOut = extensionsOut, extensionsIn
+	}
+	if extensionsIn.TransferFee(0) == nil && extensionsOut.TransferFee(0) == nil {
+		return nil, nil, nil
+	}
+	epoch, err := chainEpoch(ctx, clock)
+	if err != nil {
+		return nil, nil, err
+	}
+	return extensionsIn.TransferFee(epoch), extensionsOut.TransferFee(epoch), nil
+}
+
+// applyTransferFees turns the pool side amounts of a simulated swap into the
+// user side ones, as swap_v2 charges them: the input transfer carries the
+// inverse fee of what the pool takes, the output transfer withholds the fee
+// of what it pays out.
+func (result *ClmmSwapResult) applyTransferFees(feeIn, feeOut *TransferFee) error {
+	result.TransferFeeIn, result.TransferFeeOut = new(big.Int), new(big.Int)
+	if feeIn != nil {
+		result.TransferFeeIn = feeIn.InverseFee(result.AmountIn)
+		result.AmountIn = new(big.Int).Add(result.AmountIn, result.TransferFeeIn)
+		if !result.AmountIn.IsUint64() {
+			return fmt.Errorf("%w: amount in %v", ErrAmountOverflow, result.AmountIn)
+		}
+	}
+	if feeOut != nil {
+		result.TransferFeeOut = feeOut.Fee(result.AmountOut)
+		result.AmountOut = new(big.Int).Sub(result.AmountOut, result.TransferFeeOut)
+		if result.AmountOut.Sign() <= 0 {
+			return fmt.Errorf("%w: output is all transfer fee", ErrTooSmallAmount)
+		}
+	}
+	return nil
+}
+
+func (pool *ClmmPool) zeroForOne(inputMint solana.PublicKey) (bool, error) {
+	switch {
+	case inputMint.Equals(pool.State.MintA):
+		return true, nil
+	case inputMint.Equals(pool.State.MintB):
+		return false, nil
+	default:
+		return false, fmt.Errorf("%w: %v in pool %v", ErrTokenNotInPool, inputMint, pool.Id)
+	}
+}
+
+// simulateClmmSwap runs the program's swap loop without touching the pool:
+// step the sqrt price towards the next initialized tick, charge the trade fee
+// and apply liquidity_net whenever a tick is crossed.
+func simulateClmmSwap(ctx context.Context, pool *ClmmPool, zeroForOne bool, amountSpecified *big.Int, isBaseInput bool, sqrtPriceLimitX64 *big.Int, clock Clock) (*ClmmSwapResult, error) {
+	state := pool.State
+	if state.Status&CLMM_POOL_STATUS_SWAP_DISABLED != 0 {
+		return nil, fmt.Errorf("%w: status %d", ErrPoolNotOpen, state.Status)
+	}
+	now, err := chainTimestamp(ctx, clock)
+	if err != nil {
+		return nil, err
+	}
+	if now <= state.StartTime {
+		return nil, fmt.Errorf("%w: opens at %v", ErrPoolNotOpen, time.Unix(int64(state.StartTime), 0).UTC())
+	}
+	if amountSpecified == nil || amountSpecified.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid amount %v", amountSpecified)
+	}
+	if !amountSpecified.IsUint64() {
+		return nil, fmt.Errorf("%w: %v", ErrAmountOverflow, amountSpecified)
+	}
+	if pool.AmmConfig == nil || pool.AmmConfig.TradeFeeRate >= FEE_RATE_DENOMINATOR {
+		return nil, errors.New("invalid amm config")
+	}
+
+	if sqrtPriceLimitX64 == nil || sqrtPriceLimitX64.Sign() == 0 {
+		if zeroForOne {
+			sqrtPriceLimitX64 = new(big.Int).Add(MIN_SQRT_PRICE_X64, big.NewInt(1))
+		} else {
+			sqrtPriceLimitX64 = new(big.Int).Sub(MAX_SQRT_PRICE_X64, big.NewInt(1))
+		}
+	}
+	if zeroForOne {
+		if sqrtPriceLimitX64.Cmp(state.SqrtPriceX64) >= 0 || sqrtPriceLimitX64.Cmp(MIN_SQRT_PRICE_X64) <= 0 {
+			return nil, fmt.Errorf("%w: limit %v", ErrSqrtPriceOutOfRange, sqrtPriceLimitX64)
+		}
+	} else if sqrtPriceLimitX64.Cmp(state.SqrtPriceX64) <= 0 || sqrtPriceLimitX64.Cmp(MAX_SQRT_PRICE_X64) >= 0 {
+		return nil, fmt.Errorf("%w: limit %v", ErrSqrtPriceOutOfRange, sqrtPriceLimitX64)
+	}
+
+	isMatchPoolCurrentTickArray, currentValidTickArrayStartIndex, err := firstInitializedTickArray(state, pool.ExBitmap, zeroForOne)
+	if err != nil {
+		return nil, err
+	}
+	tickArrayCurrent, err := pool.tickArray(currentValidTickArrayStartIndex)
+	if err != nil {
+		return nil, err
+	}
+	tickArrays := []solana.PublicKey{pool.tickArrayAddress(currentValidTickArrayStartIndex)}
+
+	var (
+		amountRemaining  = new(big.Int).Set(amountSpecified)
+		amountCalculated = new(big.Int)
+		feeAmount        = new(big.Int)
+		sqrtPriceX64     = new(big.Int).Set(state.SqrtPriceX64)
+		tick             = state.TickCurrent
+		liquidity        = new(big.Int).Set(state.Liquidity)
+		tradeFeeRate     = pool.AmmConfig.TradeFeeRate
+	)
+	for amountRemaining.Sign() != 0 && sqrtPriceX64.Cmp(sqrtPriceLimitX64) != 0 && tick < MAX_TICK && tick > MIN_TICK {
+		sqrtPriceStartX64 := new(big.Int).Set(sqrtPriceX64)
+
+		nextInitializedTick := tickArrayCurrent.nextInitializedTick(tick, state.TickSpacing, zeroForOne)
+		if nextInitializedTick == nil && !isMatchPoolCurrentTickArray {
+			isMatchPoolCurrentTickArray = true
+			if nextInitializedTick, err = tickArrayCurrent.firstInitializedTick(zeroForOne); err != nil {
+				return nil, err
+			}
+		}
+		if !nextInitializedTick.isInitialized() {
+			next, found, err := nextInitializedTickArrayStartIndex(state, pool.ExBitmap, currentValidTickArrayStartIndex, zeroForOne)
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				return nil, ErrInsufficientLiquidity
+			}
+			if tickArrayCurrent, err = pool.tickArray(next); err != nil {
+				return nil, err
+			}
+			currentValidTickArrayStartIndex = next
+			tickArrays = append(tickArrays, pool.tickArrayAddress(next))
+			if nextInitializedTick, err = tickArrayCurrent.firstInitializedTick(zeroForOne); err != nil {
+				return nil, err
+			}
+		}
+
+		tickNext := min(max(nextInitializedTick.Tick, MIN_TICK), MAX_TICK)
+		sqrtPriceNextX64, err := GetSqrtPriceAtTick(tickNext)
+		if err != nil {
+			return nil, err
+		}
+		targetPrice := sqrtPriceNextX64
+		if (zeroForOne && sqrtPriceNextX64.Cmp(sqrtPriceLimitX64) < 0) || (!zeroForOne && sqrtPriceNextX64.Cmp(sqrtPriceLimitX64) > 0) {
+			targetPrice = sqrtPriceLimitX64
+		}
+
+		step, err := computeSwapStep(sqrtPriceX64, targetPrice, liquidity, amountRemaining, tradeFeeRate, isBaseInput, zeroForOne)
+		if err != nil {
+			return nil, err
+		}
+		sqrtPriceX64 = step.sqrtPriceNextX64
+		if isBaseInput {
+			amountRemaining.Sub(amountRemaining, step.amountIn).Sub(amountRemaining, step.feeAmount)
+			amountCalculated.Add(amountCalculated, step.amountOut)
+		} else {
+			amountRemaining.Sub(amountRemaining, step.amountOut)
+			amountCalculated.Add(amountCalculated, step.amountIn).Add(amountCalculated, step.feeAmount)
+		}
+		feeAmount.Add(feeAmount, step.feeAmount)
+
+		if sqrtPriceX64.Cmp(sqrtPriceNextX64) == 0 {
+			if nextInitializedTick.isInitialized() {
+				liquidityNet := new(big.Int).Set(nextInitializedTick.LiquidityNet)
+				if zeroForOne {
+					liquidityNet.Neg(liquidityNet)
+				}
+				if liquidity, err = addLiquidityDelta(liquidity, liquidityNet); err != nil {
+					return nil, err
+				}
+			}
+			tick = tickNext
+			if zeroForOne {
+				tick = tickNext - 1
+			}
+		} else if sqrtPriceX64.Cmp(sqrtPriceStartX64) != 0 {
+			if tick, err = GetTickAtSqrtPrice(sqrtPriceX64); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	amountSwapped := new(big.Int).Sub(amountSpecified, amountRemaining)
+	result := &ClmmSwapResult{
+		Fee:          feeAmount,
+		SqrtPriceX64: sqrtPriceX64,
+		TickCurrent:  tick,
+		Liquidity:    liquidity,
+		TickArrays:   tickArrays,
+	}
+	if isBaseInput {
+		result.AmountIn, result.AmountOut = amountSwapped, amountCalculated
+	} else {
+		result.AmountIn, result.AmountOut = amountCalculated, amountSwapped
+	}
+	if result.AmountIn.Sign() == 0 || result.AmountOut.Sign() == 0 {
+		return nil, ErrTooSmallAmount
+	}
+	if !result.AmountIn.IsUint64() {
+		return nil, fmt.Errorf("%w: amount in %v", ErrAmountOverflow, result.AmountIn)
+	}
+	return result, nil
+}
+
+func (pool *ClmmPool) tickArray(startIndex int32) (*TickArrayState, error) {
+	tickArray, ok := pool.TickArrays[startIndex]
+	if !ok || tickArray == nil {
+		return nil, fmt.Errorf("%w: start index %d", ErrTickArrayNotFound, startIndex)
+	}
+	return tickArray, nil
+}
+
+func (pool *ClmmPool) tickArrayAddress(startIndex int32) solana.PublicKey {
+	programId := pool.ProgramId
+	if programId.IsZero() {
+		programId = CLMM_PROGRAM_ID
+	}
+	return GetPdaTickArrayAddress(programId, pool.Id, startIndex)
+}
+
+type swapStep struct {
+	sqrtPriceNextX64 *big.Int
+	amountIn         *big.Int
+	amountOut        *big.Int
+	feeAmount        *big.Int
+}
+
+// computeSwapStep mirrors swap_math::compute_swap_step: swap as much of
+// amountRemaining as fits before the price reaches sqrtPriceTargetX64. An
+// amount that overflows a u64 only at the target price moves the price by
+// amountRemaining instead; one that overflows at the price reached fails the
+// step, as the program does.
+func computeSwapStep(sqrtPriceCurrentX64, sqrtPriceTargetX64, liquidity, amountRemaining *big.Int, feeRate uint32, isBaseInput, zeroForOne bool) (swapStep, error) {
+	step := swapStep{amountIn: new(big.Int), amountOut: new(big.Int)}
+	feeRateBig := big.NewInt(int64(feeRate))
+	feeComplement := big.NewInt(int64(FEE_RATE_DENOMINATOR - feeRate))
+
+	if isBaseInput {
+		amountRemainingLessFee := mulDivFloor(amountRemaining, feeComplement, big.NewInt(FEE_RATE_DENOMINATOR))
+		var amountIn *big.Int
+		var ok bool
+		if zeroForOne {
+			amountIn, ok = getDeltaAmount0Unsigned(sqrtPriceTargetX64, sqrtPriceCurrentX64, liquidity, true)
+		} else {
+			amountIn, ok = getDeltaAmount1Unsigned(sqrtPriceCurrentX64, sqrtPriceTargetX64, liquidity, true)
+		}
+		if ok {
+			step.amountIn = amountIn
+		}
+		if ok && amountRemainingLessFee.Cmp(step.amountIn) >= 0 {
+			step.sqrtPriceNextX64 = new(big.Int).Set(sqrtPriceTargetX64)
+		} else {
+			step.sqrtPriceNextX64 = getNextSqrtPriceFromInput(sqrtPriceCurrentX64, liquidity, amountRemainingLessFee, zeroForOne)
+		}
+	} else {
+		var amountOut *big.Int
+		var ok bool
+		if zeroForOne {
+			amountOut, ok = getDeltaAmount1Unsigned(sqrtPriceTargetX64, sqrtPriceCurrentX64, liquidity, false)
+		} else {
+			amountOut, ok = getDeltaAmount0Unsigned(sqrtPriceCurrentX64, sqrtPriceTargetX64, liquidity, false)
+		}
+		if ok {
+			step.amountOut = amountOut
+		}
+		if ok && amountRemaining.Cmp(step.amountOut) >= 0 {
+			step.sqrtPriceNextX64 = new(big.Int).Set(sqrtPriceTargetX64)
+		} else {
+			step.sqrtPriceNextX64 = getNextSqrtPriceFromOutput(sqrtPriceCurrentX64, liquidity, amountRemaining, zeroForOne)
+		}
+	}
+
+	reachedTarget := sqrtPriceTargetX64.Cmp(step.sqrtPriceNextX64) == 0
+	okIn, okOut := true, true
+	if zeroForOne {
+		if !(reachedTarget && isBaseInput) {
+			step.amountIn, okIn = getDeltaAmount0Unsigned(step.sqrtPriceNextX64, sqrtPriceCurrentX64, liquidity, true)
+		}
+		if !(reachedTarget && !isBaseInput) {
+			step.amountOut, okOut = getDeltaAmount1Unsigned(step.sqrtPriceNextX64, sqrtPriceCurrentX64, liquidity, false)
+		}
+	} else {
+		if !(reachedTarget && isBaseInput) {
+			step.amountIn, okIn = getDeltaAmount1Unsigned(sqrtPriceCurrentX64, step.sqrtPriceNextX64, liquidity, true)
+		}
+		if !(reachedTarget && !isBaseInput) {
+			step.amountOut, okOut = getDeltaAmount0Unsigned(sqrtPriceCurrentX64, step.sqrtPriceNextX64, liquidity, false)
+		}
+	}
+	if !okIn {
+		return step, fmt.Errorf("%w: swap step amount in %v", ErrAmountOverflow, step.amountIn)
+	}
+	if !okOut {
+		return step, fmt.Errorf("%w: swap step amount out %v", ErrAmountOverflow, step.amountOut)
+	}
+
+	if !isBaseInput && step.amountOut.Cmp(amountRemaining) > 0 {
+		step.amountOut = new(big.Int).Set(amountRemaining)
+	}
+	if isBaseInput && !reachedTarget {
+		step.feeAmount = new(big.Int).Sub(amountRemaining, step.amountIn)
+	} else {
+		step.feeAmount = mulDivCeil(step.amountIn, feeRateBig, feeComplement)
+	}
+	return step, nil
+}
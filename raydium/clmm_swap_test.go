@@ -0,0 +1,291 @@
+package raydium
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// clmmSwapFixture is a pool at tick 0 with two positions:
+// [-100, 100) holding 1e12 liquidity and [-1200, -100) holding 2e12.
+func clmmSwapFixture() *ClmmPool {
+	const tickSpacing = 10
+	liquidityA, liquidityB := big.NewInt(1_000_000_000_000), big.NewInt(2_000_000_000_000)
+	initialized := map[int32]*big.Int{
+		-1200: liquidityB,
+		-100:  new(big.Int).Sub(liquidityA, liquidityB),
+		100:   new(big.Int).Neg(liquidityA),
+	}
+
+	tickArrays := make(map[int32]*TickArrayState)
+	bitmap := make([]uint64, 16)
+	for tick, liquidityNet := range initialized {
+		startIndex := getArrayStartIndex(tick, tickSpacing)
+		tickArray, ok := tickArrays[startIndex]
+		if !ok {
+			tickArray = &TickArrayState{StartTickIndex: startIndex, Ticks: make([]*TickState, TICK_ARRAY_SIZE)}
+			for i := range tickArray.Ticks {
+				tickArray.Ticks[i] = &TickState{Tick: startIndex + int32(i)*tickSpacing, LiquidityNet: new(big.Int), LiquidityGross: new(big.Int)}
+			}
+			tickArrays[startIndex] = tickArray
+			bit := compressedTickArrayIndex(startIndex, tickSpacing)
+			bitmap[bit/64] |= 1 << (bit % 64)
+		}
+		tickState := tickArray.Ticks[(tick-startIndex)/tickSpacing]
+		tickState.LiquidityNet = liquidityNet
+		tickState.LiquidityGross = new(big.Int).Abs(liquidityNet)
+	}
+
+	return &ClmmPool{
+		ProgramId: CLMM_PROGRAM_ID,
+		Id:        testPublicKey("clmm pool"),
+		State: &PoolInfoLayout{
+			MintA:           testPublicKey("mint a"),
+			MintB:           testPublicKey("mint b"),
+			TickSpacing:     tickSpacing,
+			Liquidity:       liquidityA,
+			SqrtPriceX64:    new(big.Int).Lsh(big.NewInt(1), 64),
+			TickCurrent:     0,
+			TickArrayBitmap: bitmap,
+		},
+		AmmConfig:  &ApiClmmConfigItem{TradeFeeRate: 2500, TickSpacing: tickSpacing},
+		TickArrays: tickArrays,
+	}
+}
+
+func TestComputeClmmSwap(t *testing.T) {
+	pool := clmmSwapFixture()
+	mintA, mintB := pool.State.MintA, pool.State.MintB
+
+	// Expected values come from an independent big-integer model of the
+	// program's swap loop.
+	cases := []struct {
+		name                     string
+		input                    solana.PublicKey
+		amount                   int64
+		baseInput                bool
+		amountIn, amountOut, fee int64
+		sqrtPriceX64             string
+		tick                     int32
+		liquidity                int64
+		tickArrays               []int32
+	}{
+		{"a to b within range", mintA, 1_000_000, true, 1_000_000, 997_499, 2500, "18446725673100692699", -1, 1_000_000_000_000, []int32{0, -600}},
+		{"a to b crossing ticks", mintA, 8_000_000_000, true, 8_000_000_000, 7_921_142_746, 20_000_001, "18327684961434789036", -130, 2_000_000_000_000, []int32{0, -600, -1200}},
+		{"b to a within range", mintB, 1_000_000_000, true, 1_000_000_000, 996_505_985, 2_500_000, "18465144700923076893", 19, 1_000_000_000_000, []int32{0}},
+		{"exact out a to b", mintA, 5_000_000_000, false, 5_037_719_849, 5_000_000_000, 12_594_301, "18354627747760864157", -101, 2_000_000_000_000, []int32{0, -600, -1200}},
+		{"exact out b to a", mintB, 3_000_000_000, false, 3_016_568_504, 3_000_000_000, 7_541_422, "18502250826188115964", 60, 1_000_000_000_000, []int32{0}},
+	}
+	for _, c := range cases {
+		var (
+			result *ClmmSwapResult
+			err    error
+		)
+		if c.baseInput {
+			result, err = ComputeClmmAmountOut(context.Background(), pool, c.input, big.NewInt(c.amount), onePercent, nil, testClock)
+		} else {
+			output := mintA
+			if c.input.Equals(mintA) {
+				output = mintB
+			}
+			result, err = ComputeClmmAmountIn(context.Background(), pool, output, big.NewInt(c.amount), onePercent, nil, testClock)
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if result.AmountIn.Int64() != c.amountIn || result.AmountOut.Int64() != c.amountOut || result.Fee.Int64() != c.fee {
+			t.Errorf("%s: got in %v out %v fee %v, want %d %d %d", c.name, result.AmountIn, result.AmountOut, result.Fee, c.amountIn, c.amountOut, c.fee)
+		}
+		if result.SqrtPriceX64.String() != c.sqrtPriceX64 || result.TickCurrent != c.tick || result.Liquidity.Int64() != c.liquidity {
+			t.Errorf("%s: got sqrt price %v tick %d liquidity %v", c.name, result.SqrtPriceX64, result.TickCurrent, result.Liquidity)
+		}
+		if len(result.TickArrays) != len(c.tickArrays) {
+			t.Errorf("%s: got %d tick arrays, want %d", c.name, len(result.TickArrays), len(c.tickArrays))
+			continue
+		}
+		for i, startIndex := range c.tickArrays {
+			if !result.TickArrays[i].Equals(GetPdaTickArrayAddress(CLMM_PROGRAM_ID, pool.Id, startIndex)) {
+				t.Errorf("%s: tick array %d is not the array at %d", c.name, i, startIndex)
+			}
+		}
+	}
+}
+
+func TestComputeClmmSwapTransferFees(t *testing.T) {
+	plain := clmmSwapFixture()
+	pool := clmmSwapFixture()
+	feeA := TransferFee{MaximumFee: 1 << 40, TransferFeeBasisPoints: 100}
+	feeB := TransferFee{Epoch: 10, MaximumFee: 1 << 40, TransferFeeBasisPoints: 50}
+	pool.MintInfoA = &SplMint{Extensions: MintExtensions{TransferFeeConfig: &TransferFeeConfig{OlderTransferFee: feeA, NewerTransferFee: feeA}}}
+	pool.MintInfoB = &SplMint{Extensions: MintExtensions{TransferFeeConfig: &TransferFeeConfig{NewerTransferFee: feeB}}}
+	mintA, mintB := pool.State.MintA, pool.State.MintB
+	ctx := context.Background()
+	epochClock := NewFixedEpochClock(testTime, 10)
+
+	// Exact input: the pool swaps what is left after the input fee and the
+	// output fee comes out of what it pays.
+	result, err := ComputeClmmAmountOut(ctx, pool, mintA, big.NewInt(1_000_000), onePercent, nil, epochClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	swapped, err := ComputeClmmAmountOut(ctx, plain, mintA, big.NewInt(990_000), onePercent, nil, testClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantOut := new(big.Int).Sub(swapped.AmountOut, feeB.Fee(swapped.AmountOut))
+	if result.AmountIn.Int64() != 1_000_000 || result.TransferFeeIn.Int64() != 10_000 || result.AmountOut.Cmp(wantOut) != 0 {
+		t.Errorf("exact in: got in %v (fee %v) out %v, want 1000000 (fee 10000) out %v", result.AmountIn, result.TransferFeeIn, result.AmountOut, wantOut)
+	}
+	if want := onePercent.MinAmountOut(wantOut); result.MinAmountOut.Cmp(want) != 0 {
+		t.Errorf("exact in: got min amount out %v, want %v", result.MinAmountOut, want)
+	}
+
+	// The older fee of mint b is zero until epoch 10.
+	result, err = ComputeClmmAmountOut(ctx, pool, mintA, big.NewInt(1_000_000), onePercent, nil, NewFixedEpochClock(testTime, 9))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.AmountOut.Cmp(swapped.AmountOut) != 0 || result.TransferFeeOut.Sign() != 0 {
+		t.Errorf("epoch 9: got out %v (fee %v), want %v", result.AmountOut, result.TransferFeeOut, swapped.AmountOut)
+	}
+
+	// Exact output: the pool pays the amount plus its inverse fee and the
+	// input transfer carries the inverse fee of what the pool takes.
+	amountOut := big.NewInt(5_000_000_000)
+	gross := new(big.Int).Add(amountOut, feeB.InverseFee(amountOut))
+	result, err = ComputeClmmAmountIn(ctx, pool, mintB, amountOut, onePercent, nil, epochClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	swapped, err = ComputeClmmAmountIn(ctx, plain, mintB, gross, onePercent, nil, testClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantIn := new(big.Int).Add(swapped.AmountIn, feeA.InverseFee(swapped.AmountIn))
+	if result.AmountIn.Cmp(wantIn) != 0 || result.AmountOut.Cmp(amountOut) < 0 || result.AmountOut.Cmp(gross) >= 0 {
+		t.Errorf("exact out: got in %v out %v, want in %v and out in [%v, %v)", result.AmountIn, result.AmountOut, wantIn, amountOut, gross)
+	}
+	if want := onePercent.MaxAmountIn(wantIn); result.MaxAmountIn.Cmp(want) != 0 {
+		t.Errorf("exact out: got max amount in %v, want %v", result.MaxAmountIn, want)
+	}
+
+	// An input that is all fee cannot be swapped.
+	pool.MintInfoA.Extensions.TransferFeeConfig.NewerTransferFee.TransferFeeBasisPoints = MAX_FEE_BASIS_POINTS
+	if _, err := ComputeClmmAmountOut(ctx, pool, mintA, big.NewInt(1_000), onePercent, nil, epochClock); !errors.Is(err, ErrTooSmallAmount) {
+		t.Errorf("got %v, want ErrTooSmallAmount", err)
+	}
+
+	// Mints without a fee config leave the amounts alone.
+	result, err = ComputeClmmAmountOut(ctx, plain, mintB, big.NewInt(1_000_000), onePercent, nil, testClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.TransferFeeIn.Sign() != 0 || result.TransferFeeOut.Sign() != 0 {
+		t.Errorf("got transfer fees %v and %v without fee configs", result.TransferFeeIn, result.TransferFeeOut)
+	}
+}
+
+func TestComputeClmmSwapLimits(t *testing.T) {
+	pool := clmmSwapFixture()
+
+	// Running past the last position needs the extension to prove there is
+	// no more liquidity.
+	if _, err := ComputeClmmAmountOut(context.Background(), pool, pool.State.MintB, big.NewInt(1_000_000_000_000), onePercent, nil, testClock); !errors.Is(err, ErrMissingTickArrayBitmapExtension) {
+		t.Errorf("got %v, want ErrMissingTickArrayBitmapExtension", err)
+	}
+	pool.ExBitmap = &TickArrayBitmap{}
+	if _, err := ComputeClmmAmountOut(context.Background(), pool, pool.State.MintB, big.NewInt(1_000_000_000_000), onePercent, nil, testClock); !errors.Is(err, ErrInsufficientLiquidity) {
+		t.Errorf("got %v, want ErrInsufficientLiquidity", err)
+	}
+
+	// A price limit stops the swap early instead of failing.
+	limit, err := GetSqrtPriceAtTick(50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := ComputeClmmAmountOut(context.Background(), pool, pool.State.MintB, big.NewInt(1_000_000_000_000), onePercent, limit, testClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.SqrtPriceX64.Cmp(limit) != 0 || result.TickCurrent != 50 || result.AmountIn.Int64() >= 1_000_000_000_000 {
+		t.Errorf("limit not honored: %+v", result)
+	}
+
+	delete(pool.TickArrays, -600)
+	if _, err := ComputeClmmAmountOut(context.Background(), pool, pool.State.MintA, big.NewInt(1_000_000), onePercent, nil, testClock); !errors.Is(err, ErrTickArrayNotFound) {
+		t.Errorf("got %v, want ErrTickArrayNotFound", err)
+	}
+	if _, err := ComputeClmmAmountOut(context.Background(), pool, testPublicKey("other mint"), big.NewInt(1_000_000), onePercent, nil, testClock); !errors.Is(err, ErrTokenNotInPool) {
+		t.Errorf("got %v, want ErrTokenNotInPool", err)
+	}
+
+	pool.State.StartTime = uint64(testTime.Unix())
+	if _, err := ComputeClmmAmountOut(context.Background(), pool, pool.State.MintB, big.NewInt(1_000_000), onePercent, nil, testClock); !errors.Is(err, ErrPoolNotOpen) {
+		t.Errorf("before start time: got %v, want ErrPoolNotOpen", err)
+	}
+	pool.State.StartTime = 0
+	pool.State.Status = CLMM_POOL_STATUS_SWAP_DISABLED
+	if _, err := ComputeClmmAmountOut(context.Background(), pool, pool.State.MintB, big.NewInt(1_000_000), onePercent, nil, testClock); !errors.Is(err, ErrPoolNotOpen) {
+		t.Errorf("got %v, want ErrPoolNotOpen", err)
+	}
+}
+
+func TestComputeSwapStepOverflow(t *testing.T) {
+	// The input to reach the target overflows, so the price moves by the
+	// input instead, and the output at that price overflows too.
+	current, target := new(big.Int).Lsh(big.NewInt(1), 40), new(big.Int).Lsh(big.NewInt(1), 41)
+	liquidity := new(big.Int).Lsh(big.NewInt(1), 100)
+	amount := new(big.Int).Lsh(big.NewInt(1), 63)
+	if _, err := computeSwapStep(current, target, liquidity, amount, 500, true, false); !errors.Is(err, ErrAmountOverflow) {
+		t.Errorf("got %v, want ErrAmountOverflow", err)
+	}
+
+	step, err := computeSwapStep(current, target, big.NewInt(1_000_000_000_000), big.NewInt(1_000), 500, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if step.amountOut.Sign() <= 0 || step.sqrtPriceNextX64.Cmp(current) <= 0 {
+		t.Errorf("got %+v", step)
+	}
+}
+
+func TestNextInitializedTickArrayUsesExtension(t *testing.T) {
+	const tickSpacing = 1
+	boundary := maxTickInTickArrayBitmap(tickSpacing)
+	pool := &PoolInfoLayout{TickSpacing: tickSpacing, TickArrayBitmap: make([]uint64, 16)}
+	exBitmap := &TickArrayBitmap{
+		PositiveTickArrayBitmap: make([][]uint64, EXTENSION_TICK_ARRAY_BITMAP_SIZE),
+		NegativeTickArrayBitmap: make([][]uint64, EXTENSION_TICK_ARRAY_BITMAP_SIZE),
+	}
+	for i := 0; i < EXTENSION_TICK_ARRAY_BITMAP_SIZE; i++ {
+		exBitmap.PositiveTickArrayBitmap[i] = make([]uint64, 8)
+		exBitmap.NegativeTickArrayBitmap[i] = make([]uint64, 8)
+	}
+
+	// First array above the pool bitmap, and one three arrays below it.
+	upper := boundary
+	lower := -boundary - 3*tickCount(tickSpacing)
+	exBitmap.PositiveTickArrayBitmap[0][0] |= 1
+	offset := tickArrayOffsetInBitmap(lower, tickSpacing)
+	exBitmap.NegativeTickArrayBitmap[0][offset/64] |= 1 << (offset % 64)
+
+	if checked, err := exBitmap.checkTickArrayIsInitialized(lower, tickSpacing); err != nil || !checked {
+		t.Fatalf("lower array not marked: %v %v", checked, err)
+	}
+	next, found, err := nextInitializedTickArrayStartIndex(pool, exBitmap, 0, false)
+	if err != nil || !found || next != upper {
+		t.Errorf("upwards: got %d %v %v, want %d", next, found, err, upper)
+	}
+	next, found, err = nextInitializedTickArrayStartIndex(pool, exBitmap, 0, true)
+	if err != nil || !found || next != lower {
+		t.Errorf("downwards: got %d %v %v, want %d", next, found, err, lower)
+	}
+	next, found, err = nextInitializedTickArrayStartIndex(pool, exBitmap, lower, true)
+	if err != nil || found {
+		t.Errorf("below lowest: got %d %v %v", next, found, err)
+	}
+}
@@ -2,26 +2,212 @@ package raydium
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 
+	"github.com/gagliardetto/solana-go"
 	"github.com/gagliardetto/solana-go/rpc"
 )
 
 func BenchmarkFormatClmmKeys(b *testing.B) {
-	client := rpc.New("https://aged-morning-glade.solana-mainnet.quiknode.pro/b57bbb1a4c8bdd409e1ac53aaedead26da057f59/")
+	fetcher := NewBatchAccountFetcher(NewRpcAccountFetcher(liveRpcClient(b)), DefaultBatchOptions())
 
-	res, err := FormatClmmKeys(client)
+	res, err := FormatClmmKeys(context.Background(), fetcher, NewSysvarClock(fetcher))
 	b.Log(res, err)
 }
 
+// countingFetcher counts the requests that reach fetcher, the accounts they
+// return and how many times each key was fetched.
+type countingFetcher struct {
+	AccountFetcher
+	requests atomic.Int64
+	accounts atomic.Int64
+
+	mu      sync.Mutex
+	fetches map[solana.PublicKey]int
+}
+
+func (f *countingFetcher) count(keys ...solana.PublicKey) {
+	f.accounts.Add(int64(len(keys)))
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fetches == nil {
+		f.fetches = make(map[solana.PublicKey]int)
+	}
+	for _, key := range keys {
+		f.fetches[key]++
+	}
+}
+
+func (f *countingFetcher) GetAccountInfo(ctx context.Context, account solana.PublicKey) (*rpc.Account, error) {
+	f.requests.Add(1)
+	f.count(account)
+	return f.AccountFetcher.GetAccountInfo(ctx, account)
+}
+
+func (f *countingFetcher) GetMultipleAccounts(ctx context.Context, accounts []solana.PublicKey) ([]*rpc.Account, error) {
+	f.requests.Add(1)
+	f.count(accounts...)
+	return f.AccountFetcher.GetMultipleAccounts(ctx, accounts)
+}
+
+func (f *countingFetcher) GetProgramAccounts(ctx context.Context, programId solana.PublicKey, filters []rpc.RPCFilter) (rpc.GetProgramAccountsResult, error) {
+	f.requests.Add(1)
+	result, err := f.AccountFetcher.GetProgramAccounts(ctx, programId, filters)
+	for _, keyedAccount := range result {
+		f.count(keyedAccount.Pubkey)
+	}
+	return result, err
+}
+
+// clmmPoolsFixture serves n copies of the synthetic testdata/clmm pool spread
+// over 20 mints, each with two rewards paid in one of 3 reward mints.
+func clmmPoolsFixture(tb testing.TB, n int) *FakeAccountFetcher {
+	fetcher, err := LoadFakeAccountFetcher("testdata/clmm")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	template, err := fetcher.GetAccountInfo(context.Background(), testPublicKey("clmm pool"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	mint := func(name string, i int) solana.PublicKey {
+		key := testPublicKey(fmt.Sprint(name, i))
+		fetcher.SetAccount(key, TOKEN_PROGRAM_ID, mustMarshal(tb, &SplMint{Decimals: 6, IsInitialized: 1}))
+		return key
+	}
+
+	for i := 0; i < n; i++ {
+		pool, err := NewPoolInfoLayoutFromBytes(template.Data.GetBinary())
+		if err != nil {
+			tb.Fatal(err)
+		}
+		poolId := testPublicKey(fmt.Sprint("pool ", i))
+		pool.MintA, pool.MintB = mint("mint ", i%20), mint("mint ", (i+1)%20)
+		second := *pool.RewardInfos[0]
+		pool.RewardInfos[1] = &second
+		for j := 0; j < 2; j++ {
+			pool.RewardInfos[j].TokenMint = mint("reward mint ", (i+j)%3)
+			pool.RewardInfos[j].TokenVault = testPublicKey(fmt.Sprint("reward vault ", i, j))
+			fetcher.SetAccount(pool.RewardInfos[j].TokenVault, TOKEN_PROGRAM_ID, mustMarshal(tb, &SplAccount{Mint: pool.RewardInfos[j].TokenMint, Amount: 10_000}))
+		}
+		fetcher.SetAccount(poolId, CLMM_PROGRAM_ID, mustMarshal(tb, pool))
+		fetcher.SetAccount(getPdaExBitmapAccount(CLMM_PROGRAM_ID, poolId), CLMM_PROGRAM_ID, mustMarshal(tb, &TickArrayBitmap{PoolId: poolId}))
+	}
+	fetcher.DeleteAccount(testPublicKey("clmm pool"))
+	return fetcher
+}
+
+// BenchmarkFormatClmmKeysRequests reports the RPC requests and accounts
+// FormatClmmKeys needs for 500 pools.
+func BenchmarkFormatClmmKeysRequests(b *testing.B) {
+	fetcher := &countingFetcher{AccountFetcher: clmmPoolsFixture(b, 500)}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		poolsInfo, err := FormatClmmKeys(context.Background(), fetcher, testClock)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(poolsInfo) != 500 {
+			b.Fatalf("got %d pools", len(poolsInfo))
+		}
+	}
+	b.ReportMetric(float64(fetcher.requests.Load())/float64(b.N), "requests/op")
+	b.ReportMetric(float64(fetcher.accounts.Load())/float64(b.N), "accounts/op")
+}
+
+func TestFormatClmmKeysFetchesEachAccountOnce(t *testing.T) {
+	fetcher := &countingFetcher{AccountFetcher: clmmPoolsFixture(t, 50)}
+	poolsInfo, err := FormatClmmKeys(context.Background(), fetcher, testClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(poolsInfo) != 50 {
+		t.Fatalf("got %d pools", len(poolsInfo))
+	}
+	// Pools share their mints and reward mints.
+	for key, n := range fetcher.fetches {
+		if n != 1 {
+			t.Errorf("%v fetched %d times", key, n)
+		}
+	}
+	if want := 50*4 + 20 + 3; len(fetcher.fetches) < want {
+		t.Errorf("fetched %d accounts, want at least %d", len(fetcher.fetches), want)
+	}
+}
+
+func TestFormatClmmKeysSkipsBrokenPools(t *testing.T) {
+	fetcher := clmmPoolsFixture(t, 3)
+	pools, err := fetcher.GetProgramAccounts(context.Background(), CLMM_PROGRAM_ID, []rpc.RPCFilter{{DataSize: POOL_STATE_SIZE}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	broken, err := NewPoolInfoLayoutFromBytes(pools[0].Account.Data.GetBinary())
+	if err != nil {
+		t.Fatal(err)
+	}
+	broken.MintA = testPublicKey("gone")
+	fetcher.SetAccount(pools[0].Pubkey, CLMM_PROGRAM_ID, mustMarshal(t, broken))
+
+	poolsInfo, err := FormatClmmKeys(context.Background(), fetcher, testClock)
+	if !errors.Is(err, ErrAccountNotFound) || !strings.Contains(err.Error(), pools[0].Pubkey.String()) {
+		t.Errorf("got %v, want the broken pool reported", err)
+	}
+	if len(poolsInfo) != 2 || poolsInfo[pools[0].Pubkey.String()] != nil {
+		t.Errorf("got %d pools", len(poolsInfo))
+	}
+}
+
+func TestFormatClmmKeysFromFixtures(t *testing.T) {
+	fetcher, err := LoadFakeAccountFetcher("testdata/clmm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	poolsInfo, err := FormatClmmKeys(context.Background(), fetcher, testClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	poolInfo := poolsInfo[testPublicKey("clmm pool").String()]
+	if len(poolsInfo) != 1 || poolInfo == nil {
+		t.Fatalf("got %d pools", len(poolsInfo))
+	}
+	if !poolInfo.MintA.ProgramId.Equals(TOKEN_PROGRAM_ID) || !poolInfo.MintB.ProgramId.Equals(TOKEN_2022_PROGRAM_ID) {
+		t.Errorf("mint programs: got %v and %v", poolInfo.MintA.ProgramId, poolInfo.MintB.ProgramId)
+	}
+	if poolInfo.AmmConfig == nil || poolInfo.AmmConfig.TradeFeeRate != 500 || poolInfo.AmmConfig.TickSpacing != 10 {
+		t.Errorf("amm config: got %+v", poolInfo.AmmConfig)
+	}
+	if poolInfo.CurrentPrice.String() != "0.001" {
+		t.Errorf("price: got %v, want 0.001", poolInfo.CurrentPrice)
+	}
+	if poolInfo.ExBitmapInfo == nil {
+		t.Error("missing bitmap extension")
+	}
+	if len(poolInfo.RewardInfos) != 1 {
+		t.Fatalf("got %d reward infos, want 1", len(poolInfo.RewardInfos))
+	}
+	rewardInfo := poolInfo.RewardInfos[0]
+	if rewardInfo.RewardState != REWARD_STATE_ENDED || rewardInfo.RewardGrowthGlobalX64.String() != "228739626513998440038" {
+		t.Errorf("reward: got %+v", rewardInfo)
+	}
+	if rewardInfo.RemainingRewards.Int64() != 7_500 {
+		t.Errorf("remaining rewards: got %v, want 7500", rewardInfo.RemainingRewards)
+	}
+}
+
 func TestGenerateClmmTransaction(t *testing.T) {
-	client := rpc.New("https://aged-morning-glade.solana-mainnet.quiknode.pro/b57bbb1a4c8bdd409e1ac53aaedead26da057f59/")
+	fetcher := NewRpcAccountFetcher(liveRpcClient(t))
 
-	poolsInfo, err := FormatClmmKeys(client)
+	poolsInfo, err := FormatClmmKeys(context.Background(), fetcher, NewSysvarClock(fetcher))
 	if err != nil {
 		t.Error(err)
 		return
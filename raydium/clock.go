@@ -0,0 +1,148 @@
+package raydium
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// Clock is the source of chain time for reward accrual and pool open checks.
+type Clock interface {
+	Now(ctx context.Context) (time.Time, error)
+}
+
+// EpochClock is a Clock that also knows the epoch, which selects the
+// transfer fee in force.
+type EpochClock interface {
+	Clock
+	Epoch(ctx context.Context) (uint64, error)
+}
+
+// chainEpoch is the epoch of clock. Clocks that do not know it get the
+// maximum epoch, and so the newer transfer fee, which is in force but for
+// the epoch after a fee change.
+func chainEpoch(ctx context.Context, clock Clock) (uint64, error) {
+	epochClock, ok := clock.(EpochClock)
+	if !ok {
+		return math.MaxUint64, nil
+	}
+	return epochClock.Epoch(ctx)
+}
+
+// SysvarClock reads unix_timestamp from the Clock sysvar, the time programs
+// see in the current slot.
+type SysvarClock struct {
+	fetcher AccountFetcher
+}
+
+func NewSysvarClock(fetcher AccountFetcher) *SysvarClock {
+	return &SysvarClock{fetcher: fetcher}
+}
+
+func (clock *SysvarClock) Now(ctx context.Context) (time.Time, error) {
+	data, err := clock.sysvar(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(int64(binary.LittleEndian.Uint64(data[32:])), 0), nil
+}
+
+func (clock *SysvarClock) Epoch(ctx context.Context) (uint64, error) {
+	data, err := clock.sysvar(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(data[16:]), nil
+}
+
+// sysvar holds slot, epoch_start_timestamp, epoch, leader_schedule_epoch and
+// unix_timestamp.
+func (clock *SysvarClock) sysvar(ctx context.Context) ([]byte, error) {
+	account, err := clock.fetcher.GetAccountInfo(ctx, solana.SysVarClockPubkey)
+	if err != nil {
+		return nil, fmt.Errorf("fetch clock sysvar: %w", err)
+	}
+	data := account.Data.GetBinary()
+	if err := checkSize(data, 40); err != nil {
+		return nil, fmt.Errorf("decode clock sysvar: %w", err)
+	}
+	return data, nil
+}
+
+// BlockTimeClock is the estimated production time of a given slot, so
+// computations can be replayed against a past block.
+type BlockTimeClock struct {
+	client *rpc.Client
+	slot   uint64
+}
+
+func NewBlockTimeClock(client *rpc.Client, slot uint64) *BlockTimeClock {
+	return &BlockTimeClock{client: client, slot: slot}
+}
+
+func (clock *BlockTimeClock) Now(ctx context.Context) (time.Time, error) {
+	blockTime, err := clock.client.GetBlockTime(ctx, clock.slot)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("fetch block time of slot %d: %w", clock.slot, err)
+	}
+	if blockTime == nil {
+		return time.Time{}, fmt.Errorf("no block time for slot %d", clock.slot)
+	}
+	return blockTime.Time(), nil
+}
+
+// FixedClock always returns the same time, for fixtures and tests.
+type FixedClock struct {
+	now time.Time
+}
+
+func NewFixedClock(now time.Time) *FixedClock {
+	return &FixedClock{now: now}
+}
+
+func (clock *FixedClock) Now(ctx context.Context) (time.Time, error) {
+	return clock.now, nil
+}
+
+// FixedEpochClock is a FixedClock that also reports a fixed epoch.
+type FixedEpochClock struct {
+	FixedClock
+	epoch uint64
+}
+
+func NewFixedEpochClock(now time.Time, epoch uint64) *FixedEpochClock {
+	return &FixedEpochClock{FixedClock: FixedClock{now: now}, epoch: epoch}
+}
+
+func (clock *FixedEpochClock) Epoch(ctx context.Context) (uint64, error) {
+	return clock.epoch, nil
+}
+
+// SystemClock is the local wall clock. Prefer SysvarClock where the result
+// must agree with the cluster.
+type SystemClock struct{}
+
+func (SystemClock) Now(ctx context.Context) (time.Time, error) {
+	return time.Now(), nil
+}
+
+// chainTimestamp is the unix time of clock as the u64 programs compare
+// against.
+func chainTimestamp(ctx context.Context, clock Clock) (uint64, error) {
+	if clock == nil {
+		return 0, fmt.Errorf("no clock")
+	}
+	now, err := clock.Now(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if now.Unix() < 0 {
+		return 0, fmt.Errorf("clock before unix epoch: %v", now)
+	}
+	return uint64(now.Unix()), nil
+}
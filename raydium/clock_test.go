@@ -0,0 +1,68 @@
+package raydium
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+func TestClocks(t *testing.T) {
+	sysvar := make([]byte, 40)
+	binary.LittleEndian.PutUint64(sysvar[0:], 250_000_000)
+	binary.LittleEndian.PutUint64(sysvar[16:], 612)
+	binary.LittleEndian.PutUint64(sysvar[32:], 1_700_000_123)
+	accounts := map[solana.PublicKey]stubAccount{
+		solana.SysVarClockPubkey: {solana.MustPublicKeyFromBase58("Sysvar1111111111111111111111111111111111111"), sysvar},
+	}
+	fetcher := newTestFetcher(accounts, nil)
+	client := rpc.New(newStubRpcServer(t, fetcher).URL)
+
+	cases := []struct {
+		name  string
+		clock Clock
+		want  int64
+	}{
+		{"sysvar", NewSysvarClock(fetcher), 1_700_000_123},
+		{"block time", NewBlockTimeClock(client, 42), stubBlockTime(42)},
+		{"fixed", NewFixedClock(time.Unix(1_234, 0)), 1_234},
+	}
+	for _, c := range cases {
+		now, err := chainTimestamp(context.Background(), c.clock)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if int64(now) != c.want {
+			t.Errorf("%s: got %d, want %d", c.name, now, c.want)
+		}
+	}
+
+	if _, err := chainTimestamp(context.Background(), nil); err == nil {
+		t.Error("expected an error without a clock")
+	}
+
+	epochs := []struct {
+		name  string
+		clock Clock
+		want  uint64
+	}{
+		{"sysvar", NewSysvarClock(fetcher), 612},
+		{"fixed epoch", NewFixedEpochClock(time.Unix(1_234, 0), 7), 7},
+		{"fixed", NewFixedClock(time.Unix(1_234, 0)), math.MaxUint64},
+	}
+	for _, c := range epochs {
+		epoch, err := chainEpoch(context.Background(), c.clock)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if epoch != c.want {
+			t.Errorf("%s: got epoch %d, want %d", c.name, epoch, c.want)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package raydium
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+var ErrNoSimulation = errors.New("no simulation result for transaction")
+
+// FakeAccountFetcher is an in-memory AccountFetcher for running without a
+// node. Program accounts are the stored accounts owned by the program that
+// pass every filter. Simulations are answered by Simulate when it is set,
+// otherwise from the recorded results of the same message.
+type FakeAccountFetcher struct {
+	Simulate func(tx *solana.Transaction) (*rpc.SimulateTransactionResult, error)
+
+	mu          sync.RWMutex
+	slot        uint64
+	accounts    map[solana.PublicKey]*rpc.Account
+	simulations map[string]*rpc.SimulateTransactionResult
+}
+
+func NewFakeAccountFetcher() *FakeAccountFetcher {
+	return &FakeAccountFetcher{
+		accounts:    make(map[solana.PublicKey]*rpc.Account),
+		simulations: make(map[string]*rpc.SimulateTransactionResult),
+	}
+}
+
+// LoadFakeAccountFetcher serves the accounts of every fixture file in dir.
+func LoadFakeAccountFetcher(dir string) (*FakeAccountFetcher, error) {
+	f := NewFakeAccountFetcher()
+	if err := f.LoadFixtures(dir); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// LoadFixtures adds the accounts of every .json file in dir. A file holds
+// either one keyed account, as printed by `solana account --output json`, or
+// an array of them, as returned by getProgramAccounts with base64 encoding.
+// The manifest and simulations of a recorded directory are loaded as well.
+func (f *FakeAccountFetcher) LoadFixtures(dir string) error {
+	if err := f.loadFixtureMetadata(dir); err != nil {
+		return err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if name := filepath.Base(path); name == FIXTURE_MANIFEST_FILE || name == FIXTURE_SIMULATIONS_FILE {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var keyedAccounts []*rpc.KeyedAccount
+		if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '[' {
+			err = json.Unmarshal(data, &keyedAccounts)
+		} else {
+			keyedAccount := new(rpc.KeyedAccount)
+			err = json.Unmarshal(data, keyedAccount)
+			keyedAccounts = append(keyedAccounts, keyedAccount)
+		}
+		if err != nil {
+			return fmt.Errorf("fixture %s: %w", path, err)
+		}
+		for _, keyedAccount := range keyedAccounts {
+			if keyedAccount.Account == nil || keyedAccount.Account.Data == nil {
+				return fmt.Errorf("fixture %s: account %v has no data", path, keyedAccount.Pubkey)
+			}
+			f.StoreAccount(keyedAccount.Pubkey, keyedAccount.Account)
+		}
+	}
+	return nil
+}
+
+func (f *FakeAccountFetcher) loadFixtureMetadata(dir string) error {
+	var manifest FixtureManifest
+	if err := readFixtureFile(filepath.Join(dir, FIXTURE_MANIFEST_FILE), &manifest); errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if manifest.Version > FIXTURE_VERSION {
+		return fmt.Errorf("fixture %s: version %d is newer than %d", dir, manifest.Version, FIXTURE_VERSION)
+	}
+
+	var simulations []*recordedSimulation
+	if err := readFixtureFile(filepath.Join(dir, FIXTURE_SIMULATIONS_FILE), &simulations); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.slot = max(f.slot, manifest.Slot)
+	for _, simulation := range simulations {
+		f.simulations[simulation.Message] = simulation.Result
+	}
+	return nil
+}
+
+// Slot is the slot of the loaded recordings, or 0 when there are none.
+func (f *FakeAccountFetcher) Slot() uint64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.slot
+}
+
+// SetAccount stores data owned by owner at key, replacing any previous account.
+func (f *FakeAccountFetcher) SetAccount(key, owner solana.PublicKey, data []byte) {
+	f.StoreAccount(key, &rpc.Account{
+		Lamports: 1,
+		Owner:    owner,
+		Data:     rpc.DataBytesOrJSONFromBytes(data),
+	})
+}
+
+func (f *FakeAccountFetcher) StoreAccount(key solana.PublicKey, account *rpc.Account) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.accounts[key] = copyAccount(account)
+}
+
+func (f *FakeAccountFetcher) DeleteAccount(key solana.PublicKey) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.accounts, key)
+}
+
+func (f *FakeAccountFetcher) GetAccountInfo(ctx context.Context, account solana.PublicKey) (*rpc.Account, error) {
+	accounts, err := f.GetMultipleAccounts(ctx, []solana.PublicKey{account})
+	if err != nil {
+		return nil, err
+	}
+	if accounts[0] == nil {
+		return nil, ErrAccountNotFound
+	}
+	return accounts[0], nil
+}
+
+func (f *FakeAccountFetcher) GetMultipleAccounts(ctx context.Context, accounts []solana.PublicKey) ([]*rpc.Account, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	result := make([]*rpc.Account, 0, len(accounts))
+	for _, key := range accounts {
+		if account, ok := f.accounts[key]; ok {
+			result = append(result, copyAccount(account))
+		} else {
+			result = append(result, nil)
+		}
+	}
+	return result, nil
+}
+
+// GetProgramAccounts returns the matching accounts ordered by address.
+func (f *FakeAccountFetcher) GetProgramAccounts(ctx context.Context, programId solana.PublicKey, filters []rpc.RPCFilter) (rpc.GetProgramAccountsResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	result := rpc.GetProgramAccountsResult{}
+	for key, account := range f.accounts {
+		if !account.Owner.Equals(programId) || !matchFilters(account.Data.GetBinary(), filters) {
+			continue
+		}
+		result = append(result, &rpc.KeyedAccount{Pubkey: key, Account: copyAccount(account)})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return bytes.Compare(result[i].Pubkey[:], result[j].Pubkey[:]) < 0
+	})
+	return result, nil
+}
+
+// GetTokenAccountsByOwner returns the token accounts of programId held by
+// owner, ordered by address.
+func (f *FakeAccountFetcher) GetTokenAccountsByOwner(ctx context.Context, owner, programId solana.PublicKey) (rpc.GetProgramAccountsResult, error) {
+	result, err := f.GetProgramAccounts(ctx, programId, []rpc.RPCFilter{{Memcmp: &rpc.RPCFilterMemcmp{Offset: 32, Bytes: owner.Bytes()}}})
+	if err != nil {
+		return nil, err
+	}
+	tokenAccounts := result[:0]
+	for _, keyedAccount := range result {
+		if isTokenAccountData(keyedAccount.Account.Data.GetBinary()) {
+			tokenAccounts = append(tokenAccounts, keyedAccount)
+		}
+	}
+	return tokenAccounts, nil
+}
+
+func (f *FakeAccountFetcher) SimulateTransaction(ctx context.Context, tx *solana.Transaction) (*rpc.SimulateTransactionResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if f.Simulate != nil {
+		return f.Simulate(tx)
+	}
+	key, err := simulationKey(tx)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	result, ok := f.simulations[key]
+	if !ok {
+		return nil, ErrNoSimulation
+	}
+	return result, nil
+}
+
+func matchFilters(data []byte, filters []rpc.RPCFilter) bool {
+	for _, filter := range filters {
+		if filter.DataSize != 0 && uint64(len(data)) != filter.DataSize {
+			return false
+		}
+		if memcmp := filter.Memcmp; memcmp != nil {
+			if memcmp.Offset > uint64(len(data)) || !bytes.HasPrefix(data[memcmp.Offset:], memcmp.Bytes) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func copyAccount(account *rpc.Account) *rpc.Account {
+	copied := *account
+	copied.Data = rpc.DataBytesOrJSONFromBytes(bytes.Clone(account.Data.GetBinary()))
+	return &copied
+}
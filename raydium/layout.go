@@ -0,0 +1,189 @@
+package raydium
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+var (
+	ErrShortAccount       = errors.New("account data too short")
+	ErrWrongDiscriminator = errors.New("account discriminator mismatch")
+	ErrWrongOwner         = errors.New("account owner mismatch")
+)
+
+const (
+	LIQUIDITY_STATE_V4_SIZE          = 752
+	MARKET_STATE_V3_SIZE             = 388
+	SPL_MINT_SIZE                    = 82
+	POOL_STATE_SIZE                  = 1544
+	REWARD_INFO_SIZE                 = 169
+	AMM_CONFIG_SIZE                  = 117
+	TICK_ARRAY_BITMAP_EXTENSION_SIZE = 1832
+	OPEN_ORDERS_V3_SIZE              = 3228
+	TICK_ARRAY_STATE_SIZE            = 10240
+	TICK_STATE_SIZE                  = 168
+	PERSONAL_POSITION_STATE_SIZE     = 281
+	PROTOCOL_POSITION_STATE_SIZE     = 225
+)
+
+// Anchor account discriminators, sha256("account:<Name>")[:8].
+var (
+	POOL_STATE_DISCRIMINATOR                  = [8]byte{247, 237, 227, 245, 215, 195, 222, 70}
+	AMM_CONFIG_DISCRIMINATOR                  = [8]byte{218, 244, 33, 104, 203, 203, 43, 111}
+	TICK_ARRAY_BITMAP_EXTENSION_DISCRIMINATOR = [8]byte{60, 150, 36, 219, 97, 128, 139, 153}
+	TICK_ARRAY_STATE_DISCRIMINATOR            = [8]byte{192, 155, 85, 205, 49, 249, 129, 42}
+	PERSONAL_POSITION_STATE_DISCRIMINATOR     = [8]byte{70, 111, 150, 126, 230, 15, 25, 117}
+	PROTOCOL_POSITION_STATE_DISCRIMINATOR     = [8]byte{100, 226, 145, 99, 146, 218, 160, 106}
+)
+
+// Serum/OpenBook accounts are framed by these paddings instead of a discriminator.
+var (
+	SERUM_HEAD_PADDING = []byte("serum")
+	SERUM_TAIL_PADDING = []byte("padding")
+)
+
+func checkSize(data []byte, size int) error {
+	if len(data) < size {
+		return fmt.Errorf("%w: got %d bytes, want %d", ErrShortAccount, len(data), size)
+	}
+	return nil
+}
+
+func checkDiscriminator(data []byte, discriminator [8]byte) error {
+	if err := checkSize(data, len(discriminator)); err != nil {
+		return err
+	}
+	if !bytes.Equal(data[:len(discriminator)], discriminator[:]) {
+		return fmt.Errorf("%w: got %v, want %v", ErrWrongDiscriminator, data[:len(discriminator)], discriminator)
+	}
+	return nil
+}
+
+func checkAnchorAccount(data []byte, discriminator [8]byte, size int) error {
+	if err := checkSize(data, size); err != nil {
+		return err
+	}
+	return checkDiscriminator(data, discriminator)
+}
+
+func checkOwner(owner, expected solana.PublicKey) error {
+	if !owner.Equals(expected) {
+		return fmt.Errorf("%w: got %v, want %v", ErrWrongOwner, owner, expected)
+	}
+	return nil
+}
+
+// layoutReader walks a little-endian account buffer whose length has already
+// been checked against the layout size.
+type layoutReader struct {
+	data   []byte
+	offset int
+}
+
+func newLayoutReader(data []byte, offset int) *layoutReader {
+	return &layoutReader{data: data, offset: offset}
+}
+
+func (r *layoutReader) bytes(n int) []byte {
+	b := r.data[r.offset : r.offset+n]
+	r.offset += n
+	return b
+}
+
+func (r *layoutReader) skip(n int) {
+	r.offset += n
+}
+
+func (r *layoutReader) u8() uint8 {
+	return r.bytes(1)[0]
+}
+
+func (r *layoutReader) u16() uint16 {
+	return binary.LittleEndian.Uint16(r.bytes(2))
+}
+
+func (r *layoutReader) u32() uint32 {
+	return binary.LittleEndian.Uint32(r.bytes(4))
+}
+
+func (r *layoutReader) u64() uint64 {
+	return binary.LittleEndian.Uint64(r.bytes(8))
+}
+
+func (r *layoutReader) publicKey() solana.PublicKey {
+	return solana.PublicKeyFromBytes(r.bytes(32))
+}
+
+func (r *layoutReader) read32(dst *[32]byte) {
+	copy(dst[:], r.bytes(32))
+}
+
+func (r *layoutReader) read16(dst *[16]byte) {
+	copy(dst[:], r.bytes(16))
+}
+
+// layoutWriter is the encoding counterpart of layoutReader.
+type layoutWriter struct {
+	data   []byte
+	offset int
+}
+
+func newLayoutWriter(size int, offset int) *layoutWriter {
+	return &layoutWriter{data: make([]byte, size), offset: offset}
+}
+
+func (w *layoutWriter) bytes(b []byte) {
+	copy(w.data[w.offset:], b)
+	w.offset += len(b)
+}
+
+func (w *layoutWriter) u64(v uint64) {
+	binary.LittleEndian.PutUint64(w.data[w.offset:], v)
+	w.offset += 8
+}
+
+func (w *layoutWriter) u8(v uint8) {
+	w.data[w.offset] = v
+	w.offset++
+}
+
+func (w *layoutWriter) u16(v uint16) {
+	binary.LittleEndian.PutUint16(w.data[w.offset:], v)
+	w.offset += 2
+}
+
+func (w *layoutWriter) u32(v uint32) {
+	binary.LittleEndian.PutUint32(w.data[w.offset:], v)
+	w.offset += 4
+}
+
+func (w *layoutWriter) u128(v *big.Int) error {
+	if err := PutU128(w.data[w.offset:], v); err != nil {
+		return err
+	}
+	w.offset += 16
+	return nil
+}
+
+func (w *layoutWriter) bool(v bool) {
+	if v {
+		w.u8(1)
+	} else {
+		w.u8(0)
+	}
+}
+
+// optionBool writes a Borsh Option<bool>, one byte for None and two for Some.
+func (w *layoutWriter) optionBool(v *bool) {
+	if v == nil {
+		w.u8(0)
+		return
+	}
+	w.u8(1)
+	w.bool(*v)
+}
@@ -57,6 +57,143 @@ type LiquidityStateV4 struct {
 	Padding                [24]byte
 }
 
+func NewLiquidityStateV4FromBytes(data []byte) (*LiquidityStateV4, error) {
+	if err := checkSize(data, LIQUIDITY_STATE_V4_SIZE); err != nil {
+		return nil, err
+	}
+
+	r := newLayoutReader(data, 0)
+	state := &LiquidityStateV4{
+		Status:                 r.u64(),
+		Nonce:                  r.u64(),
+		MaxOrder:               r.u64(),
+		Depth:                  r.u64(),
+		BaseDecimal:            r.u64(),
+		QuoteDecimal:           r.u64(),
+		State:                  r.u64(),
+		ResetFlag:              r.u64(),
+		MinSize:                r.u64(),
+		VolMaxCutRatio:         r.u64(),
+		AmountWaveRatio:        r.u64(),
+		BaseLotSize:            r.u64(),
+		QuoteLotSize:           r.u64(),
+		MinPriceMultiplier:     r.u64(),
+		MaxPriceMultiplier:     r.u64(),
+		SystemDecimalValue:     r.u64(),
+		MinSeparateNumerator:   r.u64(),
+		MinSeparateDenominator: r.u64(),
+		TradeFeeNumerator:      r.u64(),
+		TradeFeeDenominator:    r.u64(),
+		PnlNumerator:           r.u64(),
+		PnlDenominator:         r.u64(),
+		SwapFeeNumerator:       r.u64(),
+		SwapFeeDenominator:     r.u64(),
+		BaseNeedTakePnl:        r.u64(),
+		QuoteNeedTakePnl:       r.u64(),
+		QuoteTotalPnl:          r.u64(),
+		BaseTotalPnl:           r.u64(),
+		PoolOpenTime:           r.u64(),
+		PunishPcAmount:         r.u64(),
+		PunishCoinAmount:       r.u64(),
+		OrderbookToInitTime:    r.u64(),
+	}
+	r.read16(&state.SwapBaseInAmount)
+	r.read16(&state.SwapQuoteOutAmount)
+	state.SwapBase2QuoteFee = r.u64()
+	r.read16(&state.SwapQuoteInAmount)
+	r.read16(&state.SwapBaseOutAmount)
+	state.SwapQuote2BaseFee = r.u64()
+	r.read32(&state.BaseVault)
+	r.read32(&state.QuoteVault)
+	r.read32(&state.BaseMint)
+	r.read32(&state.QuoteMint)
+	r.read32(&state.LpMint)
+	r.read32(&state.OpenOrders)
+	r.read32(&state.MarketId)
+	r.read32(&state.MarketProgramId)
+	r.read32(&state.TargetOrders)
+	r.read32(&state.WithdrawQueue)
+	r.read32(&state.LpVault)
+	r.read32(&state.Owner)
+	state.LpReserve = r.u64()
+	copy(state.Padding[:], r.bytes(24))
+	return state, nil
+}
+
+func (state *LiquidityStateV4) UnmarshalBinary(data []byte) error {
+	decoded, err := NewLiquidityStateV4FromBytes(data)
+	if err != nil {
+		return err
+	}
+	*state = *decoded
+	return nil
+}
+
+func (state *LiquidityStateV4) MarshalBinary() ([]byte, error) {
+	w := newLayoutWriter(LIQUIDITY_STATE_V4_SIZE, 0)
+	for _, v := range []uint64{
+		state.Status,
+		state.Nonce,
+		state.MaxOrder,
+		state.Depth,
+		state.BaseDecimal,
+		state.QuoteDecimal,
+		state.State,
+		state.ResetFlag,
+		state.MinSize,
+		state.VolMaxCutRatio,
+		state.AmountWaveRatio,
+		state.BaseLotSize,
+		state.QuoteLotSize,
+		state.MinPriceMultiplier,
+		state.MaxPriceMultiplier,
+		state.SystemDecimalValue,
+		state.MinSeparateNumerator,
+		state.MinSeparateDenominator,
+		state.TradeFeeNumerator,
+		state.TradeFeeDenominator,
+		state.PnlNumerator,
+		state.PnlDenominator,
+		state.SwapFeeNumerator,
+		state.SwapFeeDenominator,
+		state.BaseNeedTakePnl,
+		state.QuoteNeedTakePnl,
+		state.QuoteTotalPnl,
+		state.BaseTotalPnl,
+		state.PoolOpenTime,
+		state.PunishPcAmount,
+		state.PunishCoinAmount,
+		state.OrderbookToInitTime,
+	} {
+		w.u64(v)
+	}
+	w.bytes(state.SwapBaseInAmount[:])
+	w.bytes(state.SwapQuoteOutAmount[:])
+	w.u64(state.SwapBase2QuoteFee)
+	w.bytes(state.SwapQuoteInAmount[:])
+	w.bytes(state.SwapBaseOutAmount[:])
+	w.u64(state.SwapQuote2BaseFee)
+	for _, key := range [][32]byte{
+		state.BaseVault,
+		state.QuoteVault,
+		state.BaseMint,
+		state.QuoteMint,
+		state.LpMint,
+		state.OpenOrders,
+		state.MarketId,
+		state.MarketProgramId,
+		state.TargetOrders,
+		state.WithdrawQueue,
+		state.LpVault,
+		state.Owner,
+	} {
+		w.bytes(key[:])
+	}
+	w.u64(state.LpReserve)
+	w.bytes(state.Padding[:])
+	return w.data, nil
+}
+
 func (state *LiquidityStateV4) GetMarketId() solana.PublicKey {
 	return solana.PublicKeyFromBytes(state.MarketId[:])
 }
@@ -0,0 +1,356 @@
+package raydium
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+var (
+	ADDRESS_LOOKUP_TABLE_PROGRAM_ID = solana.MustPublicKeyFromBase58("AddressLookupTab1e1111111111111111111111111")
+	// RAYDIUM_LOOKUP_TABLE_AUTHORITY owns the lookup tables Raydium keeps for
+	// its pools.
+	RAYDIUM_LOOKUP_TABLE_AUTHORITY = solana.MustPublicKeyFromBase58("RayZuc5vEK174xfgNFdD9YADqbbwbFjVjY4NM8itSF9")
+)
+
+const (
+	// TRANSACTION_SIZE_LIMIT is the largest serialized transaction, signatures
+	// included, a validator accepts.
+	TRANSACTION_SIZE_LIMIT = 1232
+	LOOKUP_TABLE_META_SIZE = 56
+	// The authority follows the type, deactivation slot, last extended slot,
+	// start index and authority option.
+	LOOKUP_TABLE_AUTHORITY_OFFSET = 22
+)
+
+var ErrTransactionTooLarge = errors.New("transaction too large")
+
+type AddressLookupTableState struct {
+	DeactivationSlot           *big.Int
+	LastExtendedSlot           uint64
+	LastExtendedSlotStartIndex uint64
+	Authority                  solana.PublicKey
+	Addresses                  []solana.PublicKey
+}
+
+func NewAddressLookupTableStateFromBytes(data []byte) (*AddressLookupTableState, error) {
+	if err := checkSize(data, LOOKUP_TABLE_META_SIZE); err != nil {
+		return nil, err
+	}
+	if (len(data)-LOOKUP_TABLE_META_SIZE)%32 != 0 {
+		return nil, fmt.Errorf("lookup table addresses take %d bytes, not a multiple of 32", len(data)-LOOKUP_TABLE_META_SIZE)
+	}
+
+	r := newLayoutReader(data, 4)
+	state := &AddressLookupTableState{
+		DeactivationSlot:           new(big.Int).SetUint64(r.u64()),
+		LastExtendedSlot:           r.u64(),
+		LastExtendedSlotStartIndex: uint64(r.u8()),
+	}
+	if r.u8() == 1 {
+		state.Authority = r.publicKey()
+	}
+	state.Addresses = make([]solana.PublicKey, 0, (len(data)-LOOKUP_TABLE_META_SIZE)/32)
+	for i := LOOKUP_TABLE_META_SIZE; i < len(data); i += 32 {
+		state.Addresses = append(state.Addresses, solana.PublicKeyFromBytes(data[i:i+32]))
+	}
+	return state, nil
+}
+
+// IsActive reports whether the table has not been deactivated.
+func (state *AddressLookupTableState) IsActive() bool {
+	return state.DeactivationSlot == nil || state.DeactivationSlot.IsUint64() && state.DeactivationSlot.Uint64() == math.MaxUint64
+}
+
+// MarshalBinary encodes an active table when DeactivationSlot is nil.
+func (state *AddressLookupTableState) MarshalBinary() ([]byte, error) {
+	deactivationSlot := uint64(math.MaxUint64)
+	if state.DeactivationSlot != nil {
+		if !state.DeactivationSlot.IsUint64() {
+			return nil, fmt.Errorf("%w: deactivation slot %v", ErrAmountOverflow, state.DeactivationSlot)
+		}
+		deactivationSlot = state.DeactivationSlot.Uint64()
+	}
+	if state.LastExtendedSlotStartIndex > math.MaxUint8 {
+		return nil, fmt.Errorf("lookup table start index %d does not fit a u8", state.LastExtendedSlotStartIndex)
+	}
+
+	w := newLayoutWriter(LOOKUP_TABLE_META_SIZE+32*len(state.Addresses), 0)
+	// ProgramState::LookupTable
+	w.bytes([]byte{1, 0, 0, 0})
+	w.u64(deactivationSlot)
+	w.u64(state.LastExtendedSlot)
+	w.bytes([]byte{uint8(state.LastExtendedSlotStartIndex)})
+	if !state.Authority.IsZero() {
+		w.bytes([]byte{1})
+		w.bytes(state.Authority.Bytes())
+	}
+	w.offset = LOOKUP_TABLE_META_SIZE
+	for _, address := range state.Addresses {
+		w.bytes(address.Bytes())
+	}
+	return w.data, nil
+}
+
+type AddressLookupTableAccount struct {
+	Key   solana.PublicKey
+	State *AddressLookupTableState
+}
+
+// GetAddressLookupTables fetches and decodes the lookup tables at keys.
+func GetAddressLookupTables(ctx context.Context, fetcher AccountFetcher, keys ...solana.PublicKey) ([]*AddressLookupTableAccount, error) {
+	accounts, err := getMultipleAccountsInfo(ctx, fetcher, keys)
+	if err != nil {
+		return nil, err
+	}
+	tables := make([]*AddressLookupTableAccount, len(keys))
+	for i, account := range accounts {
+		if err := checkOwner(account.Owner, ADDRESS_LOOKUP_TABLE_PROGRAM_ID); err != nil {
+			return nil, fmt.Errorf("lookup table %v: %w", keys[i], err)
+		}
+		state, err := NewAddressLookupTableStateFromBytes(account.Data.GetBinary())
+		if err != nil {
+			return nil, fmt.Errorf("decode lookup table %v: %w", keys[i], err)
+		}
+		tables[i] = &AddressLookupTableAccount{Key: keys[i], State: state}
+	}
+	return tables, nil
+}
+
+// GetLookupTablesByAuthority loads every lookup table owned by authority, such
+// as RAYDIUM_LOOKUP_TABLE_AUTHORITY.
+func GetLookupTablesByAuthority(ctx context.Context, fetcher AccountFetcher, authority solana.PublicKey) ([]*AddressLookupTableAccount, error) {
+	accounts, err := fetcher.GetProgramAccounts(ctx, ADDRESS_LOOKUP_TABLE_PROGRAM_ID, []rpc.RPCFilter{
+		{
+			Memcmp: &rpc.RPCFilterMemcmp{
+				Offset: LOOKUP_TABLE_AUTHORITY_OFFSET,
+				Bytes:  authority.Bytes(),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	tables := make([]*AddressLookupTableAccount, 0, len(accounts))
+	for _, account := range accounts {
+		state, err := NewAddressLookupTableStateFromBytes(account.Account.Data.GetBinary())
+		if err != nil {
+			return nil, fmt.Errorf("decode lookup table %v: %w", account.Pubkey, err)
+		}
+		tables = append(tables, &AddressLookupTableAccount{Key: account.Pubkey, State: state})
+	}
+	return tables, nil
+}
+
+// LookupTableIndex records which active lookup tables hold which addresses.
+// It is not safe for concurrent use while tables are being added.
+type LookupTableIndex struct {
+	tables map[solana.PublicKey]*AddressLookupTableAccount
+	// The tables holding each address, ordered by key.
+	addresses map[solana.PublicKey][]solana.PublicKey
+}
+
+func NewLookupTableIndex(tables ...*AddressLookupTableAccount) *LookupTableIndex {
+	index := &LookupTableIndex{
+		tables:    make(map[solana.PublicKey]*AddressLookupTableAccount),
+		addresses: make(map[solana.PublicKey][]solana.PublicKey),
+	}
+	index.Add(tables...)
+	return index
+}
+
+// Add indexes tables, replacing those already indexed under the same key.
+// Deactivated tables are left out.
+func (index *LookupTableIndex) Add(tables ...*AddressLookupTableAccount) {
+	for _, table := range tables {
+		if old, ok := index.tables[table.Key]; ok {
+			index.remove(old)
+		}
+		if !table.State.IsActive() {
+			continue
+		}
+		index.tables[table.Key] = table
+		seen := make(map[solana.PublicKey]bool, len(table.State.Addresses))
+		for _, address := range table.State.Addresses {
+			if seen[address] {
+				continue
+			}
+			seen[address] = true
+			keys := index.addresses[address]
+			i := sort.Search(len(keys), func(i int) bool { return bytes.Compare(keys[i][:], table.Key[:]) >= 0 })
+			index.addresses[address] = append(keys[:i], append([]solana.PublicKey{table.Key}, keys[i:]...)...)
+		}
+	}
+}
+
+func (index *LookupTableIndex) remove(table *AddressLookupTableAccount) {
+	delete(index.tables, table.Key)
+	for _, address := range table.State.Addresses {
+		keys := index.addresses[address]
+		for i, key := range keys {
+			if key.Equals(table.Key) {
+				keys = append(keys[:i], keys[i+1:]...)
+				break
+			}
+		}
+		if len(keys) == 0 {
+			delete(index.addresses, address)
+		} else {
+			index.addresses[address] = keys
+		}
+	}
+}
+
+func (index *LookupTableIndex) Table(key solana.PublicKey) (*AddressLookupTableAccount, bool) {
+	table, ok := index.tables[key]
+	return table, ok
+}
+
+// TablesContaining returns the keys of the tables holding address.
+func (index *LookupTableIndex) TablesContaining(address solana.PublicKey) []solana.PublicKey {
+	return append([]solana.PublicKey(nil), index.addresses[address]...)
+}
+
+// BestTable returns the table holding the most of addresses, the lowest key
+// among equals. It returns false when no table holds any of them.
+func (index *LookupTableIndex) BestTable(addresses ...solana.PublicKey) (solana.PublicKey, bool) {
+	counts := make(map[solana.PublicKey]int)
+	seen := make(map[solana.PublicKey]bool, len(addresses))
+	for _, address := range addresses {
+		if seen[address] {
+			continue
+		}
+		seen[address] = true
+		for _, key := range index.addresses[address] {
+			counts[key]++
+		}
+	}
+	var best solana.PublicKey
+	bestCount := 0
+	for key, count := range counts {
+		if count > bestCount || count == bestCount && bytes.Compare(key[:], best[:]) < 0 {
+			best, bestCount = key, count
+		}
+	}
+	return best, bestCount > 0
+}
+
+// SetAmmLookupTable points ammInfo.LookupTableAccount at the table holding
+// the most of the pool id and vaults, and reports whether there is one.
+func (index *LookupTableIndex) SetAmmLookupTable(ammInfo *AmmInfo) bool {
+	key, ok := index.BestTable(ammInfo.Id, ammInfo.BaseVault, ammInfo.QuoteVault)
+	if ok {
+		ammInfo.LookupTableAccount = key
+	}
+	return ok
+}
+
+// SetClmmLookupTable points pool.LookupTableAccount at the table holding the
+// most of the pool id and vaults, and reports whether there is one.
+func (index *LookupTableIndex) SetClmmLookupTable(pool *ClmmPoolInfo) bool {
+	key, ok := index.BestTable(pool.Id, pool.MintA.Vault, pool.MintB.Vault)
+	if ok {
+		pool.LookupTableAccount = key
+	}
+	return ok
+}
+
+// SelectTables picks the tables worth referencing from a transaction of
+// instructions paid by payer. Only accounts that neither sign nor are invoked
+// as programs can be looked up; tables are taken greedily by how many of the
+// remaining ones they hold, as long as each saves more bytes than it costs.
+func (index *LookupTableIndex) SelectTables(instructions []solana.Instruction, payer solana.PublicKey) []*AddressLookupTableAccount {
+	excluded := map[solana.PublicKey]bool{payer: true}
+	for _, instruction := range instructions {
+		excluded[instruction.ProgramID()] = true
+		for _, account := range instruction.Accounts() {
+			if account.IsSigner {
+				excluded[account.PublicKey] = true
+			}
+		}
+	}
+	remaining := make(map[solana.PublicKey]bool)
+	for _, instruction := range instructions {
+		for _, account := range instruction.Accounts() {
+			if !excluded[account.PublicKey] {
+				if _, ok := index.addresses[account.PublicKey]; ok {
+					remaining[account.PublicKey] = true
+				}
+			}
+		}
+	}
+
+	var selected []*AddressLookupTableAccount
+	for len(remaining) > 0 {
+		counts := make(map[solana.PublicKey]int)
+		for address := range remaining {
+			for _, key := range index.addresses[address] {
+				counts[key]++
+			}
+		}
+		var best solana.PublicKey
+		bestCount := 0
+		for key, count := range counts {
+			if count > bestCount || count == bestCount && bytes.Compare(key[:], best[:]) < 0 {
+				best, bestCount = key, count
+			}
+		}
+		// A table reference takes its 32 byte key and two length bytes; each
+		// address it holds saves 31 bytes.
+		if bestCount < 2 {
+			break
+		}
+		table := index.tables[best]
+		selected = append(selected, table)
+		for _, address := range table.State.Addresses {
+			delete(remaining, address)
+		}
+	}
+	return selected
+}
+
+// NewTransactionV0 compiles instructions into a v0 transaction paid by payer,
+// looking accounts up in the tables SelectTables picks. It returns
+// ErrTransactionTooLarge when the signed transaction would not fit in
+// TRANSACTION_SIZE_LIMIT.
+func (index *LookupTableIndex) NewTransactionV0(instructions []solana.Instruction, recentBlockhash solana.Hash, payer solana.PublicKey) (*solana.Transaction, error) {
+	tables := make(map[solana.PublicKey]solana.PublicKeySlice)
+	for _, table := range index.SelectTables(instructions, payer) {
+		tables[table.Key] = table.State.Addresses
+	}
+	tx, err := solana.NewTransaction(instructions, recentBlockhash, solana.TransactionPayer(payer), solana.TransactionAddressTables(tables))
+	if err != nil {
+		return nil, err
+	}
+	// Without lookups NewTransaction compiles a legacy message.
+	tx.Message.SetVersion(solana.MessageVersionV0)
+
+	size, err := signedTransactionSize(tx)
+	if err != nil {
+		return nil, err
+	}
+	if size > TRANSACTION_SIZE_LIMIT {
+		return nil, fmt.Errorf("%w: %d bytes, limit %d", ErrTransactionTooLarge, size, TRANSACTION_SIZE_LIMIT)
+	}
+	return tx, nil
+}
+
+// signedTransactionSize is the serialized size of tx once every required
+// signature is present.
+func signedTransactionSize(tx *solana.Transaction) (int, error) {
+	message, err := tx.Message.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+	var signatureCount []byte
+	bin.EncodeCompactU16Length(&signatureCount, int(tx.Message.Header.NumRequiredSignatures))
+	return len(signatureCount) + 64*int(tx.Message.Header.NumRequiredSignatures) + len(message), nil
+}
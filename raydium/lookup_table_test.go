@@ -0,0 +1,213 @@
+package raydium
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	addresslookuptable "github.com/gagliardetto/solana-go/programs/address-lookup-table"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// lookupTableFixture is mainnet lookup table 2immgwYNHBbyVQKVGCEkgWpi53bLwWNRMB5G2nbgYV17.
+const lookupTableFixture = "AQAAAP//////////d49+DAAAAAAAAQZMWvw7GUNJdaccNBVnb57OKakxL2BHLYvhRwVILRsgAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAMGRm/lIRcy/+ytunLDm+e8jOW7xfcSayxDmzpAAAAABt324ddloZPZy+FGzut5rBy0he1fWzeROoz1hX7/AKkG3fbh7nWP3hhCXbzkbM3athr8TYO5DSf+vfko2KGL/AVKU1D4XciC1hSlVnJ4iilt3x6rq9CmBniISTL07vagBqfVFxksXFEhjMlMPUrxf1ja7gibof1E49vZigAAAAAGp9UXGMd0yShWY5hpHV62i164o5tLbVxzVVshAAAAAIyXJY9OJInxuz0QKRSODYMLWhOZ2v8QhASOe9jb6fhZC3BlsePRfEU4nVJ/awTDzVi4bHMaoP21SbbRvAP4KUbIScv+6Yw2LHF/6K0ZjUPibbSWXCirYPGuuVl7zT789IUPLW4CpHr4JNCatp3ELXDLKMv6JJ+37le50lbBJ2LvDQdRqCgtphMF/imcN7mY5YRx2xE1A3MQ+L4QRaYK9u4GRfZP3LsAd00a+IkCpA22UNQMKdq5BFbJuwuOLqc8zxCTDlqxBG8J0HcxtfogQHDK06ukzfaXiNDKAob1MqBHS9lJxDYCwz8gd5DtFqNSTKG5l1zxIaKpDP/sffi2is1H9aKveyXSu5StXElYRl9SD5As0DHE4N0GLnf84/siiKXVyp4Ez121kLcUui/jLLFZEz/BwZK3Ilf9B9OcsEAeDMKAy2vjGSxQODgBz0QwGA+eP4ZjIjrIAQaXENv31QfLlOdXSRCkaybRniDHF4C8YcwhcvsqrOVuTP4B2Na+9wLdtrB31uz2rtlFI5kahdsnp/d1SrASDInYCtTYtdoke4kX+hoKWcEWM4Tle8pTUkUVv4BxS6fje/EzKBE4Qu9N9LMnrw/JNO0hqMVB4rk/2ou4AB1loQ7FZoPwut2o4KZB+0p9xnbrQKw038qjpHar+PyDwvxBRcu5hpHw3dguezeWv+IwvgW5icu8EGkhGa9AkFPPJT7VMSFb8xowveU="
+
+func TestAddressLookupTableStateFromBytes(t *testing.T) {
+	data, err := base64.StdEncoding.DecodeString(lookupTableFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := NewAddressLookupTableStateFromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := addresslookuptable.DecodeAddressLookupTableState(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.IsActive() || state.LastExtendedSlot != want.LastExtendedSlot || state.Authority != *want.Authority || len(state.Addresses) != len(want.Addresses) {
+		t.Errorf("got %+v, want %+v", state, want)
+	}
+	for i, address := range want.Addresses {
+		if !state.Addresses[i].Equals(address) {
+			t.Errorf("address %d: got %v, want %v", i, state.Addresses[i], address)
+		}
+	}
+
+	encoded, err := state.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(encoded) != string(data) {
+		t.Error("re-encoded table differs")
+	}
+}
+
+// testLookupTable is an active table holding addresses.
+func testLookupTable(name string, addresses ...solana.PublicKey) *AddressLookupTableAccount {
+	return &AddressLookupTableAccount{
+		Key:   testPublicKey(name),
+		State: &AddressLookupTableState{Authority: RAYDIUM_LOOKUP_TABLE_AUTHORITY, Addresses: addresses},
+	}
+}
+
+func testAccounts(prefix string, n int) []solana.PublicKey {
+	keys := make([]solana.PublicKey, n)
+	for i := range keys {
+		keys[i] = testPublicKey(fmt.Sprint(prefix, i))
+	}
+	return keys
+}
+
+func TestLookupTableIndex(t *testing.T) {
+	pool := &ClmmPoolInfo{
+		Id:    testPublicKey("pool"),
+		MintA: Mint{Vault: testPublicKey("vault a")},
+		MintB: Mint{Vault: testPublicKey("vault b")},
+	}
+	idOnly := testLookupTable("id only", pool.Id)
+	vaults := testLookupTable("vaults", pool.MintA.Vault, pool.MintB.Vault)
+	deactivated := testLookupTable("deactivated", pool.Id, pool.MintA.Vault, pool.MintB.Vault)
+	deactivated.State.DeactivationSlot = new(big.Int).SetUint64(100)
+	index := NewLookupTableIndex(idOnly, vaults, deactivated)
+
+	if _, ok := index.Table(deactivated.Key); ok {
+		t.Error("deactivated table indexed")
+	}
+	if got := index.TablesContaining(pool.Id); len(got) != 1 || !got[0].Equals(idOnly.Key) {
+		t.Errorf("got tables %v holding the pool id", got)
+	}
+	if !index.SetClmmLookupTable(pool) || !pool.LookupTableAccount.Equals(vaults.Key) {
+		t.Errorf("got lookup table %v, want %v", pool.LookupTableAccount, vaults.Key)
+	}
+
+	// A table replaced by a newer state is indexed by its new addresses.
+	index.Add(testLookupTable("vaults"))
+	ammInfo := &AmmInfo{Id: pool.Id, BaseVault: pool.MintA.Vault, QuoteVault: pool.MintB.Vault}
+	if !index.SetAmmLookupTable(ammInfo) || !ammInfo.LookupTableAccount.Equals(idOnly.Key) {
+		t.Errorf("got lookup table %v, want %v", ammInfo.LookupTableAccount, idOnly.Key)
+	}
+	if index.SetAmmLookupTable(&AmmInfo{Id: testPublicKey("unknown")}) {
+		t.Error("found a table for an unknown pool")
+	}
+}
+
+func TestNewTransactionV0(t *testing.T) {
+	payer, program := testPublicKey("payer"), testPublicKey("program")
+	accounts := testAccounts("account", 40)
+	metas := solana.AccountMetaSlice{solana.Meta(payer).WRITE().SIGNER()}
+	for i, account := range accounts {
+		meta := solana.Meta(account)
+		if i%2 == 0 {
+			meta.WRITE()
+		}
+		metas = append(metas, meta)
+	}
+	instructions := []solana.Instruction{solana.NewInstruction(program, metas, []byte{1, 2, 3})}
+
+	if _, err := NewLookupTableIndex().NewTransactionV0(instructions, solana.Hash{}, payer); !errors.Is(err, ErrTransactionTooLarge) {
+		t.Fatalf("got %v, want ErrTransactionTooLarge", err)
+	}
+
+	// Signers and programs are never looked up, and a table holding one
+	// account costs more than it saves.
+	main := testLookupTable("main", append([]solana.PublicKey{payer, program}, accounts[:30]...)...)
+	rest := testLookupTable("rest", accounts[30:]...)
+	single := testLookupTable("single", accounts[0], testPublicKey("unrelated"))
+	lonely := testLookupTable("lonely", accounts[39])
+	index := NewLookupTableIndex(main, rest, single, lonely)
+	selected := index.SelectTables(instructions, payer)
+	if len(selected) != 2 || selected[0] != main || selected[1] != rest {
+		t.Fatalf("selected %v", selected)
+	}
+
+	tx, err := index.NewTransactionV0(instructions, solana.Hash{}, payer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tx.Message.IsVersioned() || len(tx.Message.AddressTableLookups) != 2 {
+		t.Fatalf("got %d lookups", len(tx.Message.AddressTableLookups))
+	}
+	if keys := tx.Message.AccountKeys; len(keys) != 2 || !keys[0].Equals(payer) || !keys[1].Equals(program) {
+		t.Errorf("got static keys %v", keys)
+	}
+
+	// The serialized transaction resolves to the original accounts.
+	tx.Signatures = make([]solana.Signature, tx.Message.Header.NumRequiredSignatures)
+	data, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size, err := signedTransactionSize(tx); err != nil || size != len(data) {
+		t.Errorf("got size %d, %v, want %d", size, err, len(data))
+	}
+	decoded, err := solana.TransactionFromDecoder(bin.NewBinDecoder(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.Message.SetAddressTables(map[solana.PublicKey]solana.PublicKeySlice{main.Key: main.State.Addresses, rest.Key: rest.State.Addresses}); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.Message.ResolveLookups(); err != nil {
+		t.Fatal(err)
+	}
+	compiled := decoded.Message.Instructions[0]
+	for i, meta := range metas {
+		key, err := decoded.Message.Account(compiled.Accounts[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !key.Equals(meta.PublicKey) {
+			t.Errorf("account %d: got %v, want %v", i, key, meta.PublicKey)
+		}
+		writable, err := decoded.Message.IsWritable(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if writable != meta.IsWritable {
+			t.Errorf("account %d: got writable %v", i, writable)
+		}
+	}
+}
+
+func TestFormatClmmKeysLookupTable(t *testing.T) {
+	fetcher, err := LoadFakeAccountFetcher("testdata/clmm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clmmPools, err := fetcher.GetProgramAccounts(context.Background(), CLMM_PROGRAM_ID, []rpc.RPCFilter{{DataSize: POOL_STATE_SIZE}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pools, err := FormatClmmKeys(context.Background(), fetcher, NewFixedClock(testTime))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := pools[clmmPools[0].Pubkey.String()]
+	if !pool.LookupTableAccount.Equals(solana.SystemProgramID) {
+		t.Errorf("got lookup table %v without any table", pool.LookupTableAccount)
+	}
+
+	table := testLookupTable("raydium", pool.Id, pool.MintA.Vault)
+	foreign := testLookupTable("foreign", pool.Id, pool.MintA.Vault, pool.MintB.Vault)
+	foreign.State.Authority = testPublicKey("someone else")
+	for _, table := range []*AddressLookupTableAccount{table, foreign} {
+		data, err := table.State.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fetcher.SetAccount(table.Key, ADDRESS_LOOKUP_TABLE_PROGRAM_ID, data)
+	}
+	pools, err = FormatClmmKeys(context.Background(), fetcher, NewFixedClock(testTime))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pools[pool.Id.String()].LookupTableAccount; !got.Equals(table.Key) {
+		t.Errorf("got lookup table %v, want %v", got, table.Key)
+	}
+}
@@ -1,14 +1,15 @@
 package raydium
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 
 	"github.com/gagliardetto/solana-go"
 )
 
 type MarketStateV3 struct {
-	// Unknown1               [5]byte
-	// Unknown2               [8]byte
+	AccountFlags           uint64
 	OwnAddress             [32]byte
 	VaultSignerNonce       uint64
 	BaseMint               [32]byte
@@ -28,7 +29,74 @@ type MarketStateV3 struct {
 	QuoteLotSize           uint64
 	FeeRateBps             uint64
 	ReferrerRebatesAccrued uint64
-	// Unknown3               [7]byte
+}
+
+func NewMarketStateV3FromBytes(data []byte) (*MarketStateV3, error) {
+	if err := checkSize(data, MARKET_STATE_V3_SIZE); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(data[:5], SERUM_HEAD_PADDING) {
+		return nil, fmt.Errorf("%w: market account does not start with %q", ErrWrongDiscriminator, SERUM_HEAD_PADDING)
+	}
+
+	r := newLayoutReader(data, 5)
+	state := &MarketStateV3{AccountFlags: r.u64()}
+	r.read32(&state.OwnAddress)
+	state.VaultSignerNonce = r.u64()
+	r.read32(&state.BaseMint)
+	r.read32(&state.QuoteMint)
+	r.read32(&state.BaseVault)
+	state.BaseDepositsTotal = r.u64()
+	state.BaseFeesAccrued = r.u64()
+	r.read32(&state.QuoteVault)
+	state.QuoteDepositsTotal = r.u64()
+	state.QuoteFeesAccrued = r.u64()
+	state.QuoteDustThreshold = r.u64()
+	r.read32(&state.RequestQueue)
+	r.read32(&state.EventQueue)
+	r.read32(&state.Bids)
+	r.read32(&state.Asks)
+	state.BaseLotSize = r.u64()
+	state.QuoteLotSize = r.u64()
+	state.FeeRateBps = r.u64()
+	state.ReferrerRebatesAccrued = r.u64()
+	return state, nil
+}
+
+func (state *MarketStateV3) UnmarshalBinary(data []byte) error {
+	decoded, err := NewMarketStateV3FromBytes(data)
+	if err != nil {
+		return err
+	}
+	*state = *decoded
+	return nil
+}
+
+func (state *MarketStateV3) MarshalBinary() ([]byte, error) {
+	w := newLayoutWriter(MARKET_STATE_V3_SIZE, 0)
+	w.bytes(SERUM_HEAD_PADDING)
+	w.u64(state.AccountFlags)
+	w.bytes(state.OwnAddress[:])
+	w.u64(state.VaultSignerNonce)
+	w.bytes(state.BaseMint[:])
+	w.bytes(state.QuoteMint[:])
+	w.bytes(state.BaseVault[:])
+	w.u64(state.BaseDepositsTotal)
+	w.u64(state.BaseFeesAccrued)
+	w.bytes(state.QuoteVault[:])
+	w.u64(state.QuoteDepositsTotal)
+	w.u64(state.QuoteFeesAccrued)
+	w.u64(state.QuoteDustThreshold)
+	w.bytes(state.RequestQueue[:])
+	w.bytes(state.EventQueue[:])
+	w.bytes(state.Bids[:])
+	w.bytes(state.Asks[:])
+	w.u64(state.BaseLotSize)
+	w.u64(state.QuoteLotSize)
+	w.u64(state.FeeRateBps)
+	w.u64(state.ReferrerRebatesAccrued)
+	w.bytes(SERUM_TAIL_PADDING)
+	return w.data, nil
 }
 
 func GetAssociatedAuthority(programId, marketId []byte) (solana.PublicKey, error) {
@@ -0,0 +1,83 @@
+package raydium
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// OpenOrdersV3 is the Serum/OpenBook open orders account an AMM v4 pool
+// trades through.
+type OpenOrdersV3 struct {
+	AccountFlags           uint64
+	Market                 [32]byte
+	Owner                  [32]byte
+	BaseTokenFree          uint64
+	BaseTokenTotal         uint64
+	QuoteTokenFree         uint64
+	QuoteTokenTotal        uint64
+	FreeSlotBits           [16]byte
+	IsBidBits              [16]byte
+	Orders                 [128][16]byte
+	ClientIds              [128]uint64
+	ReferrerRebatesAccrued uint64
+}
+
+func NewOpenOrdersV3FromBytes(data []byte) (*OpenOrdersV3, error) {
+	if err := checkSize(data, OPEN_ORDERS_V3_SIZE); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(data[:5], SERUM_HEAD_PADDING) {
+		return nil, fmt.Errorf("%w: open orders account does not start with %q", ErrWrongDiscriminator, SERUM_HEAD_PADDING)
+	}
+
+	r := newLayoutReader(data, 5)
+	openOrders := &OpenOrdersV3{AccountFlags: r.u64()}
+	r.read32(&openOrders.Market)
+	r.read32(&openOrders.Owner)
+	openOrders.BaseTokenFree = r.u64()
+	openOrders.BaseTokenTotal = r.u64()
+	openOrders.QuoteTokenFree = r.u64()
+	openOrders.QuoteTokenTotal = r.u64()
+	r.read16(&openOrders.FreeSlotBits)
+	r.read16(&openOrders.IsBidBits)
+	for i := range openOrders.Orders {
+		r.read16(&openOrders.Orders[i])
+	}
+	for i := range openOrders.ClientIds {
+		openOrders.ClientIds[i] = r.u64()
+	}
+	openOrders.ReferrerRebatesAccrued = r.u64()
+	return openOrders, nil
+}
+
+func (openOrders *OpenOrdersV3) UnmarshalBinary(data []byte) error {
+	decoded, err := NewOpenOrdersV3FromBytes(data)
+	if err != nil {
+		return err
+	}
+	*openOrders = *decoded
+	return nil
+}
+
+func (openOrders *OpenOrdersV3) MarshalBinary() ([]byte, error) {
+	w := newLayoutWriter(OPEN_ORDERS_V3_SIZE, 0)
+	w.bytes(SERUM_HEAD_PADDING)
+	w.u64(openOrders.AccountFlags)
+	w.bytes(openOrders.Market[:])
+	w.bytes(openOrders.Owner[:])
+	w.u64(openOrders.BaseTokenFree)
+	w.u64(openOrders.BaseTokenTotal)
+	w.u64(openOrders.QuoteTokenFree)
+	w.u64(openOrders.QuoteTokenTotal)
+	w.bytes(openOrders.FreeSlotBits[:])
+	w.bytes(openOrders.IsBidBits[:])
+	for i := range openOrders.Orders {
+		w.bytes(openOrders.Orders[i][:])
+	}
+	for _, clientId := range openOrders.ClientIds {
+		w.u64(clientId)
+	}
+	w.u64(openOrders.ReferrerRebatesAccrued)
+	w.bytes(SERUM_TAIL_PADDING)
+	return w.data, nil
+}
@@ -1,12 +1,12 @@
 package raydium
 
 import (
+	"context"
+	"encoding/binary"
 	"fmt"
 	"math/big"
-	"unsafe"
 
 	"github.com/gagliardetto/solana-go"
-	"github.com/shopspring/decimal"
 )
 
 type PoolInfo struct {
@@ -20,23 +20,52 @@ type PoolInfo struct {
 	StartTime     int      `json:"pool_open_time"`
 }
 
-func ComputeAmountOut(ammInfo *AmmInfo, poolInfo *PoolInfo, inputToken *Token, outputToken *Token, inputAmount *big.Int, slippage int64) (*big.Int, *big.Int) {
-	if !includesToken(ammInfo, inputToken) || !includesToken(ammInfo, outputToken) {
-		fmt.Println("token not match with pool")
+// ComputeAmountOut quotes a swap_base_in from GetPoolData reserves using the
+// default pool fee. Use QuoteAmountOut when the pool state is at hand.
+func ComputeAmountOut(ctx context.Context, ammInfo *AmmInfo, poolInfo *PoolInfo, inputToken *Token, outputToken *Token, inputAmount *big.Int, slippage Slippage, clock Clock) (*big.Int, *big.Int, error) {
+	reserveIn, reserveOut, err := poolInfo.reserves(ctx, ammInfo, inputToken, outputToken, inputAmount, clock)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	reserveIn, reserveOut := poolInfo.BaseReserve, poolInfo.QuoteReserve
-	if inputToken.Mint.Equals(ammInfo.QuoteMint) {
-		reserveIn, reserveOut = reserveOut, reserveIn
+	fee := ammSwapFee(inputAmount, big.NewInt(LIQUIDITY_FEES_NUMERATOR), big.NewInt(LIQUIDITY_FEES_DENOMINATOR))
+	amountOutRaw := swapTokenAmountBaseIn(new(big.Int).Sub(inputAmount, fee), reserveIn, reserveOut)
+
+	return amountOutRaw, slippage.MinAmountOut(amountOutRaw), nil
+}
+
+// ComputeAmountIn is the swap_base_out counterpart of ComputeAmountOut.
+func ComputeAmountIn(ctx context.Context, ammInfo *AmmInfo, poolInfo *PoolInfo, inputToken *Token, outputToken *Token, outputAmount *big.Int, slippage Slippage, clock Clock) (*big.Int, *big.Int, error) {
+	reserveIn, reserveOut, err := poolInfo.reserves(ctx, ammInfo, inputToken, outputToken, outputAmount, clock)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	feeRaw := decimal.NewFromBigInt(inputAmount, 0).Mul(decimal.NewFromInt(25)).Div(decimal.NewFromInt(10000)).IntPart()
-	amountInWithFee := new(big.Int).Sub(inputAmount, big.NewInt(feeRaw))
-	denominator := new(big.Int).Add(reserveIn, amountInWithFee)
-	amountOutRaw := new(big.Int).Div(new(big.Int).Mul(reserveOut, amountInWithFee), denominator)
+	amountInWithoutFee, err := swapTokenAmountBaseOut(outputAmount, reserveIn, reserveOut)
+	if err != nil {
+		return nil, nil, err
+	}
+	amountInRaw := ammAddFee(amountInWithoutFee, big.NewInt(LIQUIDITY_FEES_NUMERATOR), big.NewInt(LIQUIDITY_FEES_DENOMINATOR))
+
+	maxAmountInRaw := slippage.MaxAmountIn(amountInRaw)
+	if !maxAmountInRaw.IsUint64() {
+		return nil, nil, fmt.Errorf("%w: max amount in %v", ErrAmountOverflow, maxAmountInRaw)
+	}
+	return amountInRaw, maxAmountInRaw, nil
+}
 
-	minAmountOutRaw := new(big.Int).Div(new(big.Int).Mul(amountOutRaw, big.NewInt(100)), big.NewInt(100+slippage))
-	return amountOutRaw, minAmountOutRaw
+func (poolInfo *PoolInfo) reserves(ctx context.Context, ammInfo *AmmInfo, inputToken *Token, outputToken *Token, amount *big.Int, clock Clock) (*big.Int, *big.Int, error) {
+	if poolInfo.Status == nil || !poolInfo.Status.IsUint64() || poolInfo.StartTime < 0 {
+		return nil, nil, fmt.Errorf("%w: status %v", ErrPoolNotOpen, poolInfo.Status)
+	}
+	now, err := chainTimestamp(ctx, clock)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkAmmSwapOpen(poolInfo.Status.Uint64(), uint64(poolInfo.StartTime), now); err != nil {
+		return nil, nil, err
+	}
+	return ammOrientReserves(ammInfo, poolInfo.BaseReserve, poolInfo.QuoteReserve, inputToken, outputToken, amount)
 }
 
 func includesToken(ammInfo *AmmInfo, token *Token) bool {
@@ -57,20 +86,53 @@ type RewardInfo struct {
 	RewardGrowthGlobalX64 *big.Int
 }
 
-func NewRewardInfoFromBytes(data []byte) *RewardInfo {
+func NewRewardInfoFromBytes(data []byte) (*RewardInfo, error) {
+	if err := checkSize(data, REWARD_INFO_SIZE); err != nil {
+		return nil, err
+	}
+
 	return &RewardInfo{
 		RewardState:           data[0],
-		OpenTime:              *(*uint64)(unsafe.Pointer(&data[1])),
-		EndTime:               *(*uint64)(unsafe.Pointer(&data[9])),
-		LastUpdateTime:        *(*uint64)(unsafe.Pointer(&data[17])),
-		EmissionsPerSecondX64: new(big.Int).SetBytes(reverseByteSlice(data[25:41])),
-		RewardTotalEmissioned: *(*uint64)(unsafe.Pointer(&data[41])),
-		RewardClaimed:         *(*uint64)(unsafe.Pointer(&data[49])),
+		OpenTime:              binary.LittleEndian.Uint64(data[1:]),
+		EndTime:               binary.LittleEndian.Uint64(data[9:]),
+		LastUpdateTime:        binary.LittleEndian.Uint64(data[17:]),
+		EmissionsPerSecondX64: U128FromBytes([16]byte(data[25:41])),
+		RewardTotalEmissioned: binary.LittleEndian.Uint64(data[41:]),
+		RewardClaimed:         binary.LittleEndian.Uint64(data[49:]),
 		TokenMint:             solana.PublicKeyFromBytes(data[57:89]),
 		TokenVault:            solana.PublicKeyFromBytes(data[89:121]),
 		Creator:               solana.PublicKeyFromBytes(data[121:153]),
-		RewardGrowthGlobalX64: new(big.Int).SetBytes(reverseByteSlice(data[153:169])),
+		RewardGrowthGlobalX64: U128FromBytes([16]byte(data[153:169])),
+	}, nil
+}
+
+func (rewardInfo *RewardInfo) MarshalBinary() ([]byte, error) {
+	data := make([]byte, REWARD_INFO_SIZE)
+	data[0] = rewardInfo.RewardState
+	binary.LittleEndian.PutUint64(data[1:], rewardInfo.OpenTime)
+	binary.LittleEndian.PutUint64(data[9:], rewardInfo.EndTime)
+	binary.LittleEndian.PutUint64(data[17:], rewardInfo.LastUpdateTime)
+	if err := PutU128(data[25:41], rewardInfo.EmissionsPerSecondX64); err != nil {
+		return nil, err
 	}
+	binary.LittleEndian.PutUint64(data[41:], rewardInfo.RewardTotalEmissioned)
+	binary.LittleEndian.PutUint64(data[49:], rewardInfo.RewardClaimed)
+	copy(data[57:89], rewardInfo.TokenMint[:])
+	copy(data[89:121], rewardInfo.TokenVault[:])
+	copy(data[121:153], rewardInfo.Creator[:])
+	if err := PutU128(data[153:169], rewardInfo.RewardGrowthGlobalX64); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (rewardInfo *RewardInfo) UnmarshalBinary(data []byte) error {
+	decoded, err := NewRewardInfoFromBytes(data)
+	if err != nil {
+		return err
+	}
+	*rewardInfo = *decoded
+	return nil
 }
 
 type PoolInfoLayout struct {
@@ -108,17 +170,26 @@ type PoolInfoLayout struct {
 	FundFeesTokenA            uint64
 	FundFeesTokenB            uint64
 	StartTime                 uint64
+	RecentEpoch               uint64
 }
 
-func NewPoolInfoLayoutFromBytes(data []byte) *PoolInfoLayout {
+func NewPoolInfoLayoutFromBytes(data []byte) (*PoolInfoLayout, error) {
+	if err := checkAnchorAccount(data, POOL_STATE_DISCRIMINATOR, POOL_STATE_SIZE); err != nil {
+		return nil, err
+	}
+
 	var rewardInfos []*RewardInfo
 	for i := 0; i < 3; i++ {
-		rewardInfos = append(rewardInfos, NewRewardInfoFromBytes(data[397+(i*169):397+((i+1)*169)]))
+		rewardInfo, err := NewRewardInfoFromBytes(data[397+(i*169) : 397+((i+1)*169)])
+		if err != nil {
+			return nil, err
+		}
+		rewardInfos = append(rewardInfos, rewardInfo)
 	}
 
 	var tickArrayBitmap []uint64
 	for i := 0; i < 16; i++ {
-		tickArrayBitmap = append(tickArrayBitmap, *(*uint64)(unsafe.Pointer(&data[904+(i*8)])))
+		tickArrayBitmap = append(tickArrayBitmap, binary.LittleEndian.Uint64(data[904+(i*8):]))
 	}
 
 	return &PoolInfoLayout{
@@ -132,36 +203,104 @@ func NewPoolInfoLayoutFromBytes(data []byte) *PoolInfoLayout {
 		ObservationId:             solana.PublicKeyFromBytes(data[201:233]),
 		MintDecimalsA:             data[233],
 		MintDicimalsB:             data[234],
-		TickSpacing:               *(*uint16)(unsafe.Pointer(&data[235])),
-		Liquidity:                 new(big.Int).SetBytes(reverseByteSlice(data[237:253])),
-		SqrtPriceX64:              new(big.Int).SetBytes(reverseByteSlice(data[253:269])),
-		TickCurrent:               *(*int32)(unsafe.Pointer(&data[269])),
-		ObservationIndex:          *(*uint16)(unsafe.Pointer(&data[273])),
-		ObservationUpdateDuration: *(*uint16)(unsafe.Pointer(&data[275])),
-		FeeGrowthGlobalX64A:       new(big.Int).SetBytes(reverseByteSlice(data[277:293])),
-		FeeGrowthGlobalX64B:       new(big.Int).SetBytes(reverseByteSlice(data[293:309])),
-		ProtocolFeesTokenA:        *(*uint64)(unsafe.Pointer(&data[309])),
-		ProtocolFeesTokenB:        *(*uint64)(unsafe.Pointer(&data[317])),
-		SwapInAmountTokenA:        new(big.Int).SetBytes(reverseByteSlice(data[325:341])),
-		SwapOutAmountTokenB:       new(big.Int).SetBytes(reverseByteSlice(data[341:357])),
-		SwapInAmountTokenB:        new(big.Int).SetBytes(reverseByteSlice(data[357:373])),
-		SwapOutAmountTokenA:       new(big.Int).SetBytes(reverseByteSlice(data[373:389])),
+		TickSpacing:               binary.LittleEndian.Uint16(data[235:]),
+		Liquidity:                 U128FromBytes([16]byte(data[237:253])),
+		SqrtPriceX64:              U128FromBytes([16]byte(data[253:269])),
+		TickCurrent:               int32(binary.LittleEndian.Uint32(data[269:])),
+		ObservationIndex:          binary.LittleEndian.Uint16(data[273:]),
+		ObservationUpdateDuration: binary.LittleEndian.Uint16(data[275:]),
+		FeeGrowthGlobalX64A:       U128FromBytes([16]byte(data[277:293])),
+		FeeGrowthGlobalX64B:       U128FromBytes([16]byte(data[293:309])),
+		ProtocolFeesTokenA:        binary.LittleEndian.Uint64(data[309:]),
+		ProtocolFeesTokenB:        binary.LittleEndian.Uint64(data[317:]),
+		SwapInAmountTokenA:        U128FromBytes([16]byte(data[325:341])),
+		SwapOutAmountTokenB:       U128FromBytes([16]byte(data[341:357])),
+		SwapInAmountTokenB:        U128FromBytes([16]byte(data[357:373])),
+		SwapOutAmountTokenA:       U128FromBytes([16]byte(data[373:389])),
 		Status:                    data[389],
 		RewardInfos:               rewardInfos,
 		TickArrayBitmap:           tickArrayBitmap,
-		TotalFeesTokenA:           *(*uint64)(unsafe.Pointer(&data[1032])),
-		TotalFeesClaimedTokenA:    *(*uint64)(unsafe.Pointer(&data[1040])),
-		TotalFeesTokenB:           *(*uint64)(unsafe.Pointer(&data[1048])),
-		TotalFeesClaimedTokenB:    *(*uint64)(unsafe.Pointer(&data[1056])),
-		FundFeesTokenA:            *(*uint64)(unsafe.Pointer(&data[1064])),
-		FundFeesTokenB:            *(*uint64)(unsafe.Pointer(&data[1072])),
-		StartTime:                 *(*uint64)(unsafe.Pointer(&data[1080])),
+		TotalFeesTokenA:           binary.LittleEndian.Uint64(data[1032:]),
+		TotalFeesClaimedTokenA:    binary.LittleEndian.Uint64(data[1040:]),
+		TotalFeesTokenB:           binary.LittleEndian.Uint64(data[1048:]),
+		TotalFeesClaimedTokenB:    binary.LittleEndian.Uint64(data[1056:]),
+		FundFeesTokenA:            binary.LittleEndian.Uint64(data[1064:]),
+		FundFeesTokenB:            binary.LittleEndian.Uint64(data[1072:]),
+		StartTime:                 binary.LittleEndian.Uint64(data[1080:]),
+		RecentEpoch:               binary.LittleEndian.Uint64(data[1088:]),
+	}, nil
+}
+
+func (layout *PoolInfoLayout) UnmarshalBinary(data []byte) error {
+	decoded, err := NewPoolInfoLayoutFromBytes(data)
+	if err != nil {
+		return err
 	}
+	*layout = *decoded
+	return nil
 }
 
-func reverseByteSlice(data []byte) []byte {
-	for i := 0; i < len(data)/2; i++ {
-		data[i], data[len(data)-1-i] = data[len(data)-1-i], data[i]
+func (layout *PoolInfoLayout) MarshalBinary() ([]byte, error) {
+	if len(layout.RewardInfos) > 3 {
+		return nil, fmt.Errorf("pool has %d reward infos, at most 3 fit", len(layout.RewardInfos))
+	}
+	if len(layout.TickArrayBitmap) > 16 {
+		return nil, fmt.Errorf("pool tick array bitmap has %d words, at most 16 fit", len(layout.TickArrayBitmap))
+	}
+
+	data := make([]byte, POOL_STATE_SIZE)
+	copy(data[0:8], POOL_STATE_DISCRIMINATOR[:])
+	data[8] = layout.Bump
+	copy(data[9:41], layout.AmmConfig[:])
+	copy(data[41:73], layout.Creator[:])
+	copy(data[73:105], layout.MintA[:])
+	copy(data[105:137], layout.MintB[:])
+	copy(data[137:169], layout.VaultA[:])
+	copy(data[169:201], layout.VaultB[:])
+	copy(data[201:233], layout.ObservationId[:])
+	data[233] = layout.MintDecimalsA
+	data[234] = layout.MintDicimalsB
+	binary.LittleEndian.PutUint16(data[235:], layout.TickSpacing)
+	binary.LittleEndian.PutUint32(data[269:], uint32(layout.TickCurrent))
+	binary.LittleEndian.PutUint16(data[273:], layout.ObservationIndex)
+	binary.LittleEndian.PutUint16(data[275:], layout.ObservationUpdateDuration)
+	binary.LittleEndian.PutUint64(data[309:], layout.ProtocolFeesTokenA)
+	binary.LittleEndian.PutUint64(data[317:], layout.ProtocolFeesTokenB)
+	data[389] = layout.Status
+	for _, field := range []struct {
+		offset int
+		value  *big.Int
+	}{
+		{237, layout.Liquidity},
+		{253, layout.SqrtPriceX64},
+		{277, layout.FeeGrowthGlobalX64A},
+		{293, layout.FeeGrowthGlobalX64B},
+		{325, layout.SwapInAmountTokenA},
+		{341, layout.SwapOutAmountTokenB},
+		{357, layout.SwapInAmountTokenB},
+		{373, layout.SwapOutAmountTokenA},
+	} {
+		if err := PutU128(data[field.offset:], field.value); err != nil {
+			return nil, err
+		}
+	}
+	for i, rewardInfo := range layout.RewardInfos {
+		encoded, err := rewardInfo.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		copy(data[397+(i*169):], encoded)
+	}
+	for i, word := range layout.TickArrayBitmap {
+		binary.LittleEndian.PutUint64(data[904+(i*8):], word)
 	}
-	return data
+	binary.LittleEndian.PutUint64(data[1032:], layout.TotalFeesTokenA)
+	binary.LittleEndian.PutUint64(data[1040:], layout.TotalFeesClaimedTokenA)
+	binary.LittleEndian.PutUint64(data[1048:], layout.TotalFeesTokenB)
+	binary.LittleEndian.PutUint64(data[1056:], layout.TotalFeesClaimedTokenB)
+	binary.LittleEndian.PutUint64(data[1064:], layout.FundFeesTokenA)
+	binary.LittleEndian.PutUint64(data[1072:], layout.FundFeesTokenB)
+	binary.LittleEndian.PutUint64(data[1080:], layout.StartTime)
+	binary.LittleEndian.PutUint64(data[1088:], layout.RecentEpoch)
+	return data, nil
 }
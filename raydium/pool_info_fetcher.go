@@ -0,0 +1,279 @@
+package raydium
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// GetPoolData instructions per simulated transaction; each pool adds seven
+// accounts and a legacy transaction must stay under 1232 bytes.
+const AMM_SIMULATE_BATCH_SIZE = 4
+
+var AMM_SIMULATE_PAYER = solana.MustPublicKeyFromBase58("RaydiumSimuLateTransaction11111111111111111")
+
+var ErrPoolAccountMismatch = errors.New("account does not belong to pool")
+
+// PoolInfoFetcher returns the GetPoolData view of AMM v4 pools, in the same
+// order as ammInfos.
+type PoolInfoFetcher interface {
+	FetchPoolInfos(ctx context.Context, ammInfos []*AmmInfo) ([]*PoolInfo, error)
+}
+
+// AccountPoolInfoFetcher computes PoolInfo from the pool, vault and OpenOrders
+// accounts, fetched with getMultipleAccounts.
+type AccountPoolInfoFetcher struct {
+	fetcher AccountFetcher
+}
+
+func NewAccountPoolInfoFetcher(fetcher AccountFetcher) *AccountPoolInfoFetcher {
+	return &AccountPoolInfoFetcher{fetcher: fetcher}
+}
+
+func (f *AccountPoolInfoFetcher) FetchPoolInfos(ctx context.Context, ammInfos []*AmmInfo) ([]*PoolInfo, error) {
+	keys := make([]solana.PublicKey, 0, 4*len(ammInfos))
+	for _, ammInfo := range ammInfos {
+		keys = append(keys, ammAccountKeys(ammInfo)...)
+	}
+	accounts, err := getMultipleAccountsInfo(ctx, f.fetcher, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	poolInfos := make([]*PoolInfo, 0, len(ammInfos))
+	for i, ammInfo := range ammInfos {
+		pool, err := newAmmPoolFromAccounts(ammInfo, accounts[4*i:4*i+4])
+		if err != nil {
+			return nil, fmt.Errorf("pool %v: %w", ammInfo.Id, err)
+		}
+		poolInfos = append(poolInfos, pool.PoolInfo)
+	}
+	return poolInfos, nil
+}
+
+// AmmPool is the state of an AMM v4 pool with the GetPoolData view computed
+// from it.
+type AmmPool struct {
+	AmmInfo  *AmmInfo
+	State    *LiquidityStateV4
+	PoolInfo *PoolInfo
+}
+
+// ammAccountKeys lists the accounts newAmmPoolFromAccounts reads, in order.
+func ammAccountKeys(ammInfo *AmmInfo) []solana.PublicKey {
+	return []solana.PublicKey{ammInfo.Id, ammInfo.BaseVault, ammInfo.QuoteVault, ammInfo.OpenOrders}
+}
+
+// newAmmPoolFromAccounts decodes the pool, base vault, quote vault and
+// OpenOrders accounts, in that order, checking that each belongs to the pool.
+func newAmmPoolFromAccounts(ammInfo *AmmInfo, accounts []*rpc.Account) (*AmmPool, error) {
+	if err := checkOwner(accounts[0].Owner, ammInfo.ProgramId); err != nil {
+		return nil, err
+	}
+	state, err := NewLiquidityStateV4FromBytes(accounts[0].Data.GetBinary())
+	if err != nil {
+		return nil, err
+	}
+	baseVault, err := newAmmVaultFromAccount(accounts[1], ammInfo.BaseMint)
+	if err != nil {
+		return nil, fmt.Errorf("base vault: %w", err)
+	}
+	quoteVault, err := newAmmVaultFromAccount(accounts[2], ammInfo.QuoteMint)
+	if err != nil {
+		return nil, fmt.Errorf("quote vault: %w", err)
+	}
+	if err := checkOwner(accounts[3].Owner, ammInfo.MarketProgramId); err != nil {
+		return nil, fmt.Errorf("open orders: %w", err)
+	}
+	openOrders, err := NewOpenOrdersV3FromBytes(accounts[3].Data.GetBinary())
+	if err != nil {
+		return nil, err
+	}
+	if market := solana.PublicKeyFromBytes(openOrders.Market[:]); !market.Equals(ammInfo.MarketId) {
+		return nil, fmt.Errorf("%w: open orders of market %v, want %v", ErrPoolAccountMismatch, market, ammInfo.MarketId)
+	}
+	if owner := solana.PublicKeyFromBytes(openOrders.Owner[:]); !owner.Equals(ammInfo.Authority) {
+		return nil, fmt.Errorf("%w: open orders owned by %v, want %v", ErrPoolAccountMismatch, owner, ammInfo.Authority)
+	}
+	poolInfo, err := ComputePoolInfo(ammInfo, state, baseVault, quoteVault, openOrders)
+	if err != nil {
+		return nil, err
+	}
+	return &AmmPool{AmmInfo: ammInfo, State: state, PoolInfo: poolInfo}, nil
+}
+
+// newAmmVaultFromAccount decodes a pool vault, which must be a token account
+// of mint.
+func newAmmVaultFromAccount(account *rpc.Account, mint solana.PublicKey) (*SplAccount, error) {
+	if err := checkTokenProgram(account.Owner); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWrongOwner, err)
+	}
+	vault, err := NewSplAccountFromBytes(account.Data.GetBinary())
+	if err != nil {
+		return nil, err
+	}
+	if vaultMint := solana.PublicKeyFromBytes(vault.Mint[:]); !vaultMint.Equals(mint) {
+		return nil, fmt.Errorf("%w: vault of mint %v, want %v", ErrPoolAccountMismatch, vaultMint, mint)
+	}
+	return vault, nil
+}
+
+// ComputePoolInfo reproduces what GetPoolData reports: vault balances, plus
+// the OpenOrders totals while the pool still uses the order book, minus the
+// pnl owed to the protocol. Fills still sitting in the market's event queue
+// are not included.
+func ComputePoolInfo(ammInfo *AmmInfo, state *LiquidityStateV4, baseVault, quoteVault *SplAccount, openOrders *OpenOrdersV3) (*PoolInfo, error) {
+	baseTotal := new(big.Int).SetUint64(baseVault.Amount)
+	quoteTotal := new(big.Int).SetUint64(quoteVault.Amount)
+	if state.Status == AMM_STATUS_INITIALIZED || state.Status == AMM_STATUS_ORDER_BOOK_ONLY {
+		baseTotal.Add(baseTotal, new(big.Int).SetUint64(openOrders.BaseTokenTotal))
+		quoteTotal.Add(quoteTotal, new(big.Int).SetUint64(openOrders.QuoteTokenTotal))
+	}
+	if !baseTotal.IsUint64() || !quoteTotal.IsUint64() {
+		return nil, fmt.Errorf("%w: pool totals %v/%v", ErrAmountOverflow, baseTotal, quoteTotal)
+	}
+	baseReserve, quoteReserve, err := state.ReservesWithoutTakePnl(baseTotal.Uint64(), quoteTotal.Uint64())
+	if err != nil {
+		return nil, err
+	}
+
+	return &PoolInfo{
+		Status:        new(big.Int).SetUint64(state.Status),
+		BaseDecimals:  int(state.BaseDecimal),
+		QuoteDecimals: int(state.QuoteDecimal),
+		LpDecimals:    int(ammInfo.LpDecimals),
+		BaseReserve:   baseReserve,
+		QuoteReserve:  quoteReserve,
+		LpSupply:      new(big.Int).SetUint64(state.LpReserve),
+		StartTime:     int(state.PoolOpenTime),
+	}, nil
+}
+
+// SimulatePoolInfoFetcher simulates the program's GetPoolData instruction and
+// reads PoolInfo from the transaction logs.
+type SimulatePoolInfoFetcher struct {
+	fetcher AccountFetcher
+}
+
+func NewSimulatePoolInfoFetcher(fetcher AccountFetcher) *SimulatePoolInfoFetcher {
+	return &SimulatePoolInfoFetcher{fetcher: fetcher}
+}
+
+// FetchPoolInfos simulates the pools in batches of AMM_SIMULATE_BATCH_SIZE.
+// A pool whose GetPoolData instruction cannot be built, for instance because
+// one of its accounts is unset, is left out of the simulation: its entry is
+// nil and its error is joined into the one returned with the other pools.
+func (f *SimulatePoolInfoFetcher) FetchPoolInfos(ctx context.Context, ammInfos []*AmmInfo) ([]*PoolInfo, error) {
+	poolInfos := make([]*PoolInfo, 0, len(ammInfos))
+	var poolErrs []error
+	for i := 0; i < len(ammInfos); i += AMM_SIMULATE_BATCH_SIZE {
+		end := min(i+AMM_SIMULATE_BATCH_SIZE, len(ammInfos))
+		batch, errs, err := f.simulate(ctx, ammInfos[i:end])
+		if err != nil {
+			return nil, err
+		}
+		poolInfos = append(poolInfos, batch...)
+		poolErrs = append(poolErrs, errs...)
+	}
+	return poolInfos, errors.Join(poolErrs...)
+}
+
+// simulate returns the pool infos of ammInfos, nil for the pools reported in
+// poolErrs, or err if the simulation itself fails.
+func (f *SimulatePoolInfoFetcher) simulate(ctx context.Context, ammInfos []*AmmInfo) (poolInfos []*PoolInfo, poolErrs []error, err error) {
+	poolInfos = make([]*PoolInfo, len(ammInfos))
+	simulated := make([]int, 0, len(ammInfos))
+	instructions := make([]solana.Instruction, 0, len(ammInfos))
+	for i, ammInfo := range ammInfos {
+		instruction, err := NewAmmGetPoolDataInstruction(ammInfo)
+		if err != nil {
+			poolErrs = append(poolErrs, fmt.Errorf("pool %v: %w", ammInfo.Id, err))
+			continue
+		}
+		simulated = append(simulated, i)
+		instructions = append(instructions, instruction)
+	}
+	if len(instructions) == 0 {
+		return poolInfos, poolErrs, nil
+	}
+	// The blockhash is replaced by the node, so any value will do.
+	tx, err := solana.NewTransaction(instructions, solana.Hash{}, solana.TransactionPayer(AMM_SIMULATE_PAYER))
+	if err != nil {
+		return nil, nil, err
+	}
+	tx.Signatures = append(tx.Signatures, solana.Signature{})
+
+	result, err := f.fetcher.SimulateTransaction(ctx, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if result.Err != nil {
+		return nil, nil, fmt.Errorf("simulate GetPoolData: %v", result.Err)
+	}
+
+	logged, err := parseGetPoolDataLogs(result.Logs)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(logged) != len(simulated) {
+		return nil, nil, fmt.Errorf("simulate GetPoolData: got %d pool infos, want %d", len(logged), len(simulated))
+	}
+	for j, i := range simulated {
+		poolInfos[i] = logged[j]
+	}
+	return poolInfos, poolErrs, nil
+}
+
+func parseGetPoolDataLogs(logs []string) ([]*PoolInfo, error) {
+	var poolInfos []*PoolInfo
+	for _, log := range logs {
+		if !strings.Contains(log, "GetPoolData") {
+			continue
+		}
+		start, end := strings.Index(log, "{"), strings.LastIndex(log, "}")
+		if start < 0 || end < start {
+			return nil, fmt.Errorf("malformed GetPoolData log %q", log)
+		}
+		var poolInfo PoolInfo
+		if err := json.Unmarshal([]byte(log[start:end+1]), &poolInfo); err != nil {
+			return nil, fmt.Errorf("GetPoolData log: %w", err)
+		}
+		poolInfos = append(poolInfos, &poolInfo)
+	}
+	return poolInfos, nil
+}
+
+// FallbackPoolInfoFetcher tries each fetcher in turn and returns the first
+// successful result.
+type FallbackPoolInfoFetcher struct {
+	fetchers []PoolInfoFetcher
+}
+
+func NewFallbackPoolInfoFetcher(fetchers ...PoolInfoFetcher) *FallbackPoolInfoFetcher {
+	return &FallbackPoolInfoFetcher{fetchers: fetchers}
+}
+
+func (f *FallbackPoolInfoFetcher) FetchPoolInfos(ctx context.Context, ammInfos []*AmmInfo) ([]*PoolInfo, error) {
+	var errs []error
+	for _, fetcher := range f.fetchers {
+		poolInfos, err := fetcher.FetchPoolInfos(ctx, ammInfos)
+		if err == nil {
+			return poolInfos, nil
+		}
+		errs = append(errs, err)
+		// No point in trying the next fetcher once the caller gave up.
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if len(errs) == 0 {
+		return nil, errors.New("no pool info fetcher configured")
+	}
+	return nil, errors.Join(errs...)
+}
@@ -0,0 +1,725 @@
+package raydium
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math/big"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+)
+
+// REGISTRY_UPDATE_BATCH_SIZE is the most account notifications applied
+// together in one snapshot.
+const REGISTRY_UPDATE_BATCH_SIZE = 256
+
+var ErrRegistryRunning = errors.New("pool registry is already running")
+
+type PoolEventKind uint8
+
+const (
+	POOL_EVENT_CREATED PoolEventKind = iota + 1
+	POOL_EVENT_PRICE_CHANGED
+	POOL_EVENT_LIQUIDITY_CHANGED
+	// POOL_EVENT_FAILED reports a pool left out of the snapshot because it
+	// could not be built.
+	POOL_EVENT_FAILED
+)
+
+// PoolEvent reports a pool change published in the snapshot at Slot. Either
+// Clmm or Amm is set, to the pool as that snapshot holds it, except for
+// POOL_EVENT_FAILED, which sets Err instead.
+type PoolEvent struct {
+	Kind   PoolEventKind
+	PoolId solana.PublicKey
+	Slot   uint64
+	Clmm   *ClmmPoolInfo
+	Amm    *AmmPool
+	Err    error
+}
+
+// PoolSnapshot is the state of a PoolRegistry as of Slot. Snapshots and the
+// pools in them are shared by every reader and never modified.
+type PoolSnapshot struct {
+	Slot      uint64
+	clmmPools map[solana.PublicKey]*ClmmPoolInfo
+	ammPools  map[solana.PublicKey]*AmmPool
+}
+
+func (s *PoolSnapshot) ClmmPool(id solana.PublicKey) (*ClmmPoolInfo, bool) {
+	pool, ok := s.clmmPools[id]
+	return pool, ok
+}
+
+func (s *PoolSnapshot) AmmPool(id solana.PublicKey) (*AmmPool, bool) {
+	pool, ok := s.ammPools[id]
+	return pool, ok
+}
+
+// ClmmPools returns the CLMM pools ordered by id.
+func (s *PoolSnapshot) ClmmPools() []*ClmmPoolInfo {
+	pools := make([]*ClmmPoolInfo, 0, len(s.clmmPools))
+	for _, pool := range s.clmmPools {
+		pools = append(pools, pool)
+	}
+	sort.Slice(pools, func(i, j int) bool {
+		return bytes.Compare(pools[i].Id[:], pools[j].Id[:]) < 0
+	})
+	return pools
+}
+
+// AmmPools returns the AMM v4 pools ordered by id.
+func (s *PoolSnapshot) AmmPools() []*AmmPool {
+	pools := make([]*AmmPool, 0, len(s.ammPools))
+	for _, pool := range s.ammPools {
+		pools = append(pools, pool)
+	}
+	sort.Slice(pools, func(i, j int) bool {
+		return bytes.Compare(pools[i].AmmInfo.Id[:], pools[j].AmmInfo.Id[:]) < 0
+	})
+	return pools
+}
+
+func (s *PoolSnapshot) clone() *PoolSnapshot {
+	return &PoolSnapshot{
+		Slot:      s.Slot,
+		clmmPools: maps.Clone(s.clmmPools),
+		ammPools:  maps.Clone(s.ammPools),
+	}
+}
+
+// PoolRegistry keeps every CLMM pool, and the AMM v4 pools given to TrackAmm,
+// current from websocket notifications. Bootstrap loads the pools, Run applies
+// changes until the connection drops, and Snapshot may be called from any
+// goroutine.
+//
+// Changes made between Bootstrap and the subscriptions of Run are only seen
+// once the account changes again, so call Bootstrap before each Run that
+// follows a dropped connection. Run also subscribes to the mints, reward mints
+// and reward vaults of the CLMM pools, so transfer fees and remaining rewards
+// follow them.
+//
+// A pool that cannot be built, for instance because one of its accounts is
+// gone or does not decode, is left out of the snapshot until it can be built
+// again and reported by a POOL_EVENT_FAILED event; Bootstrap and TrackAmm
+// also return these errors. The other pools are published as usual, and Run
+// only stops for its context or its subscriptions.
+type PoolRegistry struct {
+	fetcher AccountFetcher
+	clock   Clock
+	events  chan<- PoolEvent
+
+	snapshot atomic.Pointer[PoolSnapshot]
+
+	// mu serializes the writers: Bootstrap, TrackAmm and the updates of Run.
+	mu        sync.Mutex
+	clmmPools map[solana.PublicKey]*clmmPoolAccount
+	ammInfos  map[solana.PublicKey]*AmmInfo
+	configs   map[string]*ApiClmmConfigItem
+	// The Raydium lookup tables as of the last Bootstrap.
+	lookupTables *LookupTableIndex
+	// Accounts the pools read, nil for those that do not exist, with the
+	// slot they were read at and the pools reading them.
+	accounts   map[solana.PublicKey]*rpc.Account
+	slots      map[solana.PublicKey]uint64
+	dependents map[solana.PublicKey]map[solana.PublicKey]struct{}
+	run        *registryRun
+}
+
+// NewPoolRegistry returns an empty registry reading accounts through fetcher
+// and reward time from clock. Events are sent to events unless it is nil,
+// once their snapshot is published and without holding up the other writers.
+// The call that publishes them waits on every send, so the channel must be
+// drained, and not from a goroutine calling Bootstrap or TrackAmm. Events of
+// concurrent calls may interleave; Slot tells them apart.
+func NewPoolRegistry(fetcher AccountFetcher, clock Clock, events chan<- PoolEvent) *PoolRegistry {
+	r := &PoolRegistry{
+		fetcher:      fetcher,
+		clock:        clock,
+		events:       events,
+		clmmPools:    make(map[solana.PublicKey]*clmmPoolAccount),
+		ammInfos:     make(map[solana.PublicKey]*AmmInfo),
+		configs:      make(map[string]*ApiClmmConfigItem),
+		lookupTables: NewLookupTableIndex(),
+		accounts:     make(map[solana.PublicKey]*rpc.Account),
+		slots:        make(map[solana.PublicKey]uint64),
+		dependents:   make(map[solana.PublicKey]map[solana.PublicKey]struct{}),
+	}
+	r.snapshot.Store(&PoolSnapshot{
+		clmmPools: make(map[solana.PublicKey]*ClmmPoolInfo),
+		ammPools:  make(map[solana.PublicKey]*AmmPool),
+	})
+	return r
+}
+
+// Snapshot returns the latest published state.
+func (r *PoolRegistry) Snapshot() *PoolSnapshot {
+	return r.snapshot.Load()
+}
+
+// Bootstrap loads every CLMM pool and refetches the tracked AMM pools. Pools
+// seen for the first time are reported as created, and pools left out are
+// reported in the returned error.
+func (r *PoolRegistry) Bootstrap(ctx context.Context) error {
+	state, err := fetchClmmAccounts(ctx, r.fetcher)
+	if err != nil {
+		return err
+	}
+	events, err := r.bootstrap(ctx, state)
+	if err != nil {
+		return err
+	}
+	if err := r.send(ctx, events); err != nil {
+		return err
+	}
+	return poolEventErrors(events)
+}
+
+func (r *PoolRegistry) bootstrap(ctx context.Context, state *clmmAccounts) ([]PoolEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ammKeys := make([]solana.PublicKey, 0, 4*len(r.ammInfos))
+	for _, ammInfo := range r.ammInfos {
+		ammKeys = append(ammKeys, ammAccountKeys(ammInfo)...)
+	}
+	ammAccounts, err := fetchAccounts(ctx, r.fetcher, ammKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	slot := fetcherSlot(r.fetcher)
+	ids := make([]solana.PublicKey, 0, len(state.pools)+len(r.ammInfos))
+	for _, pool := range state.pools {
+		r.clmmPools[pool.id] = pool
+		r.slots[pool.id] = slot
+		ids = append(ids, pool.id)
+	}
+	for key, account := range state.accounts {
+		r.setAccount(key, account, slot)
+	}
+	maps.Copy(r.configs, state.configs)
+	r.lookupTables = state.lookupTables
+	for i, key := range ammKeys {
+		r.setAccount(key, ammAccounts.Accounts[i], slot)
+	}
+	for id := range r.ammInfos {
+		ids = append(ids, id)
+	}
+	return r.publish(ctx, slot, ids, nil), nil
+}
+
+// TrackAmm adds AMM v4 pools to the registry, subscribing to their accounts
+// before reading them if Run is running. Pools already tracked are left as
+// they are; if a subscription or the read fails, none of ammInfos is added.
+// A pool with missing accounts is tracked but only published once they
+// appear.
+func (r *PoolRegistry) TrackAmm(ctx context.Context, ammInfos ...*AmmInfo) error {
+	events, err := r.trackAmm(ctx, ammInfos)
+	if err != nil {
+		return err
+	}
+	if err := r.send(ctx, events); err != nil {
+		return err
+	}
+	return poolEventErrors(events)
+}
+
+func (r *PoolRegistry) trackAmm(ctx context.Context, ammInfos []*AmmInfo) ([]PoolEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var added []*AmmInfo
+	var keys []solana.PublicKey
+	for _, ammInfo := range ammInfos {
+		if _, ok := r.ammInfos[ammInfo.Id]; ok {
+			continue
+		}
+		added = append(added, ammInfo)
+		keys = append(keys, ammAccountKeys(ammInfo)...)
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+	if r.run != nil {
+		if err := r.run.subscribeAccounts(keys); err != nil {
+			return nil, err
+		}
+	}
+	accounts, err := fetchAccounts(ctx, r.fetcher, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	slot := fetcherSlot(r.fetcher)
+	ids := make([]solana.PublicKey, 0, len(added))
+	for i, ammInfo := range added {
+		r.ammInfos[ammInfo.Id] = ammInfo
+		for j, key := range ammAccountKeys(ammInfo) {
+			r.setAccount(key, accounts.Accounts[4*i+j], slot)
+			r.addDependent(key, ammInfo.Id)
+		}
+		ids = append(ids, ammInfo.Id)
+	}
+	return r.publish(ctx, slot, ids, nil), nil
+}
+
+// Run subscribes to the CLMM pools and bitmap extensions, to the other
+// accounts the CLMM pools read and to the accounts of the tracked AMM pools,
+// then applies notifications until ctx is done or a subscription fails. It
+// does not close client.
+func (r *PoolRegistry) Run(ctx context.Context, client *ws.Client) error {
+	ctx, cancel := context.WithCancel(ctx)
+	run := &registryRun{
+		ctx:        ctx,
+		client:     client,
+		updates:    make(chan accountUpdate, REGISTRY_UPDATE_BATCH_SIZE),
+		errs:       make(chan error, 1),
+		subscribed: make(map[solana.PublicKey]bool),
+	}
+	defer func() {
+		r.mu.Lock()
+		if r.run == run {
+			r.run = nil
+		}
+		r.mu.Unlock()
+		cancel()
+		run.close()
+	}()
+	if err := r.subscribe(run); err != nil {
+		return err
+	}
+
+	batch := make([]accountUpdate, 0, REGISTRY_UPDATE_BATCH_SIZE)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-run.errs:
+			return fmt.Errorf("pool registry subscription: %w", err)
+		case update := <-run.updates:
+			batch = append(batch[:0], update)
+		drain:
+			for len(batch) < REGISTRY_UPDATE_BATCH_SIZE {
+				select {
+				case update := <-run.updates:
+					batch = append(batch, update)
+				default:
+					break drain
+				}
+			}
+			if err := r.apply(ctx, batch); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (r *PoolRegistry) subscribe(run *registryRun) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.run != nil {
+		return ErrRegistryRunning
+	}
+	if err := run.subscribeProgram(CLMM_PROGRAM_ID, POOL_STATE_SIZE); err != nil {
+		return err
+	}
+	if err := run.subscribeProgram(CLMM_PROGRAM_ID, TICK_ARRAY_BITMAP_EXTENSION_SIZE); err != nil {
+		return err
+	}
+	// Bitmap extensions come with the program subscription above.
+	exBitmaps := make(map[solana.PublicKey]bool, len(r.clmmPools))
+	for id, pool := range r.clmmPools {
+		exBitmaps[getPdaExBitmapAccount(pool.programId, id)] = true
+	}
+	for key := range r.dependents {
+		if exBitmaps[key] {
+			continue
+		}
+		if err := run.subscribeAccount(key); err != nil {
+			return err
+		}
+	}
+	r.run = run
+	return nil
+}
+
+// apply stores the accounts of updates newer than what the registry holds,
+// publishes the pools reading them and sends the events. Accounts no pool
+// reads are dropped. It only fails once ctx is done.
+func (r *PoolRegistry) apply(ctx context.Context, updates []accountUpdate) error {
+	return r.send(ctx, r.update(ctx, updates))
+}
+
+func (r *PoolRegistry) update(ctx context.Context, updates []accountUpdate) []PoolEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var slot uint64
+	var ids []solana.PublicKey
+	failed := make(map[solana.PublicKey]error)
+	for _, update := range updates {
+		if update.slot < r.slots[update.key] {
+			continue
+		}
+		if isClmmPoolAccount(update.account) {
+			r.slots[update.key] = update.slot
+			ids = append(ids, update.key)
+			pool, err := NewPoolInfoLayoutFromBytes(update.account.Data.GetBinary())
+			if err != nil {
+				delete(r.clmmPools, update.key)
+				failed[update.key] = fmt.Errorf("decode pool: %w", err)
+			} else {
+				r.clmmPools[update.key] = &clmmPoolAccount{id: update.key, programId: update.account.Owner, layout: pool}
+				delete(failed, update.key)
+			}
+		} else if dependents, ok := r.dependents[update.key]; ok {
+			r.setAccount(update.key, update.account, update.slot)
+			for id := range dependents {
+				ids = append(ids, id)
+			}
+		} else {
+			continue
+		}
+		slot = max(slot, update.slot)
+	}
+	return r.publish(ctx, slot, ids, failed)
+}
+
+// publish rebuilds the pools in ids into a new snapshot at slot and returns
+// the events of what changed, to be sent once r.mu is released. Pools in
+// failed, and pools that cannot be built, are dropped from the snapshot and
+// reported by POOL_EVENT_FAILED events. Callers hold r.mu.
+func (r *PoolRegistry) publish(ctx context.Context, slot uint64, ids []solana.PublicKey, failed map[solana.PublicKey]error) []PoolEvent {
+	if len(ids) == 0 {
+		return nil
+	}
+	// Pools missing accounts or their config because of loadErr fail with it.
+	loadErr := r.loadClmmDependencies(ctx, ids)
+	chainTime, clockErr := chainTimestamp(ctx, r.clock)
+
+	current := r.snapshot.Load()
+	next := current.clone()
+	next.Slot = max(current.Slot, slot)
+	var events []PoolEvent
+	fail := func(id solana.PublicKey, err error) {
+		delete(next.clmmPools, id)
+		delete(next.ammPools, id)
+		events = append(events, PoolEvent{Kind: POOL_EVENT_FAILED, PoolId: id, Err: fmt.Errorf("pool %v: %w", id, err)})
+	}
+	built := make(map[solana.PublicKey]bool, len(ids))
+	for _, id := range ids {
+		if built[id] {
+			continue
+		}
+		built[id] = true
+		if err, ok := failed[id]; ok {
+			fail(id, err)
+		} else if pool, ok := r.clmmPools[id]; ok {
+			if clockErr != nil {
+				fail(id, clockErr)
+				continue
+			}
+			config, ok := r.configs[pool.layout.AmmConfig.String()]
+			if !ok && loadErr != nil {
+				fail(id, loadErr)
+				continue
+			}
+			poolInfo, err := newClmmPoolInfo(id, pool.programId, pool.layout, config, r.accounts, chainTime)
+			if err != nil {
+				if loadErr != nil {
+					err = errors.Join(err, loadErr)
+				}
+				fail(id, err)
+				continue
+			}
+			r.lookupTables.SetClmmLookupTable(poolInfo)
+			next.clmmPools[id] = poolInfo
+			events = append(events, clmmPoolEvents(current.clmmPools[id], poolInfo)...)
+		} else if ammInfo, ok := r.ammInfos[id]; ok {
+			pool, err := r.ammPool(ammInfo)
+			if err != nil {
+				fail(id, err)
+				continue
+			}
+			next.ammPools[id] = pool
+			events = append(events, ammPoolEvents(current.ammPools[id], pool)...)
+		}
+	}
+	r.snapshot.Store(next)
+	for i := range events {
+		events[i].Slot = next.Slot
+	}
+	return events
+}
+
+// send sends events unless the registry has no channel, giving up once ctx
+// is done. Callers do not hold r.mu.
+func (r *PoolRegistry) send(ctx context.Context, events []PoolEvent) error {
+	if r.events == nil {
+		return nil
+	}
+	for _, event := range events {
+		select {
+		case r.events <- event:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// poolEventErrors joins the errors of the POOL_EVENT_FAILED events.
+func poolEventErrors(events []PoolEvent) error {
+	var errs []error
+	for _, event := range events {
+		if event.Kind == POOL_EVENT_FAILED {
+			errs = append(errs, event.Err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *PoolRegistry) ammPool(ammInfo *AmmInfo) (*AmmPool, error) {
+	keys := ammAccountKeys(ammInfo)
+	accounts := make([]*rpc.Account, len(keys))
+	for i, key := range keys {
+		if accounts[i] = r.accounts[key]; accounts[i] == nil {
+			return nil, fmt.Errorf("%w: %v", ErrAccountNotFound, key)
+		}
+	}
+	return newAmmPoolFromAccounts(ammInfo, accounts)
+}
+
+// loadClmmDependencies fetches, in one batch, the accounts and configs of the
+// CLMM pools in ids that the registry has not read yet. While Run is running,
+// accounts new to the registry are subscribed to before they are read, and a
+// failed subscription stops Run. Configs that do not decode are left out.
+func (r *PoolRegistry) loadClmmDependencies(ctx context.Context, ids []solana.PublicKey) error {
+	var keys []solana.PublicKey
+	wanted := make(map[solana.PublicKey]bool)
+	for _, id := range ids {
+		pool, ok := r.clmmPools[id]
+		if !ok {
+			continue
+		}
+		for _, key := range clmmPoolDependencies(pool.programId, id, pool.layout) {
+			if r.addDependent(key, id) && r.run != nil && !key.Equals(getPdaExBitmapAccount(pool.programId, id)) {
+				if err := r.run.subscribeAccount(key); err != nil {
+					r.run.fail(err)
+					return err
+				}
+			}
+			if _, ok := r.accounts[key]; !ok && !wanted[key] {
+				wanted[key] = true
+				keys = append(keys, key)
+			}
+		}
+		if _, ok := r.configs[pool.layout.AmmConfig.String()]; !ok && !wanted[pool.layout.AmmConfig] {
+			wanted[pool.layout.AmmConfig] = true
+			keys = append(keys, pool.layout.AmmConfig)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	fetched, err := fetchAccounts(ctx, r.fetcher, keys)
+	if err != nil {
+		return err
+	}
+
+	slot := fetcherSlot(r.fetcher)
+	var errs []error
+	for i, key := range keys {
+		account := fetched.Accounts[i]
+		if _, ok := r.dependents[key]; ok {
+			r.setAccount(key, account, slot)
+			continue
+		}
+		// Pools without their config keep a nil AmmConfig, as in FormatClmmKeys.
+		if account == nil {
+			continue
+		}
+		config, err := NewApiClmmConfigItemFromBytes(key, account.Data.GetBinary())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("decode amm config %v: %w", key, err))
+			continue
+		}
+		r.configs[key.String()] = config
+	}
+	return errors.Join(errs...)
+}
+
+func (r *PoolRegistry) setAccount(key solana.PublicKey, account *rpc.Account, slot uint64) {
+	r.accounts[key] = account
+	r.slots[key] = slot
+}
+
+// addDependent records that poolId reads key and reports whether key is new
+// to the registry.
+func (r *PoolRegistry) addDependent(key, poolId solana.PublicKey) bool {
+	dependents, ok := r.dependents[key]
+	if !ok {
+		dependents = make(map[solana.PublicKey]struct{})
+		r.dependents[key] = dependents
+	}
+	dependents[poolId] = struct{}{}
+	return !ok
+}
+
+func clmmPoolEvents(previous, pool *ClmmPoolInfo) []PoolEvent {
+	event := func(kind PoolEventKind) PoolEvent {
+		return PoolEvent{Kind: kind, PoolId: pool.Id, Clmm: pool}
+	}
+	if previous == nil {
+		return []PoolEvent{event(POOL_EVENT_CREATED)}
+	}
+	var events []PoolEvent
+	if previous.SqrtPriceX64 != pool.SqrtPriceX64 {
+		events = append(events, event(POOL_EVENT_PRICE_CHANGED))
+	}
+	if previous.Liquidity != pool.Liquidity {
+		events = append(events, event(POOL_EVENT_LIQUIDITY_CHANGED))
+	}
+	return events
+}
+
+// ammPoolEvents reports a price change when the reserve ratio moves and a
+// liquidity change when the LP supply does.
+func ammPoolEvents(previous, pool *AmmPool) []PoolEvent {
+	event := func(kind PoolEventKind) PoolEvent {
+		return PoolEvent{Kind: kind, PoolId: pool.AmmInfo.Id, Amm: pool}
+	}
+	if previous == nil {
+		return []PoolEvent{event(POOL_EVENT_CREATED)}
+	}
+	var events []PoolEvent
+	before := new(big.Int).Mul(previous.PoolInfo.BaseReserve, pool.PoolInfo.QuoteReserve)
+	after := new(big.Int).Mul(pool.PoolInfo.BaseReserve, previous.PoolInfo.QuoteReserve)
+	if before.Cmp(after) != 0 {
+		events = append(events, event(POOL_EVENT_PRICE_CHANGED))
+	}
+	if previous.PoolInfo.LpSupply.Cmp(pool.PoolInfo.LpSupply) != 0 {
+		events = append(events, event(POOL_EVENT_LIQUIDITY_CHANGED))
+	}
+	return events
+}
+
+func isClmmPoolAccount(account *rpc.Account) bool {
+	return account != nil && account.Owner.Equals(CLMM_PROGRAM_ID) && len(account.Data.GetBinary()) == POOL_STATE_SIZE
+}
+
+func fetcherSlot(fetcher AccountFetcher) uint64 {
+	if reporter, ok := fetcher.(slotReporter); ok {
+		return reporter.Slot()
+	}
+	return 0
+}
+
+type accountUpdate struct {
+	key     solana.PublicKey
+	slot    uint64
+	account *rpc.Account
+}
+
+// registryRun holds the subscriptions of one Run, each received by its own
+// goroutine into updates. Subscriptions are added under PoolRegistry.mu.
+type registryRun struct {
+	ctx          context.Context
+	client       *ws.Client
+	updates      chan accountUpdate
+	errs         chan error
+	wg           sync.WaitGroup
+	unsubscribes []func()
+	subscribed   map[solana.PublicKey]bool
+}
+
+func (run *registryRun) subscribeProgram(programId solana.PublicKey, dataSize uint64) error {
+	sub, err := run.client.ProgramSubscribeWithOpts(programId, rpc.CommitmentConfirmed, solana.EncodingBase64, []rpc.RPCFilter{{DataSize: dataSize}})
+	if err != nil {
+		return err
+	}
+	run.receive(sub.Unsubscribe, func() (*accountUpdate, error) {
+		result, err := sub.Recv()
+		if result == nil {
+			return nil, err
+		}
+		return &accountUpdate{key: result.Value.Pubkey, slot: result.Context.Slot, account: result.Value.Account}, nil
+	})
+	return nil
+}
+
+func (run *registryRun) subscribeAccounts(keys []solana.PublicKey) error {
+	for _, key := range keys {
+		if err := run.subscribeAccount(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subscribeAccount subscribes to key unless the run already has.
+func (run *registryRun) subscribeAccount(key solana.PublicKey) error {
+	if run.subscribed[key] {
+		return nil
+	}
+	sub, err := run.client.AccountSubscribeWithOpts(key, rpc.CommitmentConfirmed, solana.EncodingBase64)
+	if err != nil {
+		return err
+	}
+	run.subscribed[key] = true
+	run.receive(sub.Unsubscribe, func() (*accountUpdate, error) {
+		result, err := sub.Recv()
+		if result == nil {
+			return nil, err
+		}
+		return &accountUpdate{key: key, slot: result.Context.Slot, account: &result.Value.Account}, nil
+	})
+	return nil
+}
+
+// receive forwards updates from recv until it fails or, returning neither an
+// update nor an error, reports the subscription closed.
+func (run *registryRun) receive(unsubscribe func(), recv func() (*accountUpdate, error)) {
+	run.unsubscribes = append(run.unsubscribes, unsubscribe)
+	run.wg.Add(1)
+	go func() {
+		defer run.wg.Done()
+		for {
+			update, err := recv()
+			if err != nil {
+				run.fail(err)
+				return
+			}
+			if update == nil {
+				return
+			}
+			select {
+			case run.updates <- *update:
+			case <-run.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// fail stops Run with err, unless it is already stopping for another error.
+func (run *registryRun) fail(err error) {
+	select {
+	case run.errs <- err:
+	default:
+	}
+}
+
+func (run *registryRun) close() {
+	for _, unsubscribe := range run.unsubscribes {
+		unsubscribe()
+	}
+	run.wg.Wait()
+}
@@ -0,0 +1,480 @@
+package raydium
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+	"github.com/gorilla/websocket"
+)
+
+// stubWsServer answers accountSubscribe and programSubscribe, the latter
+// keyed by its dataSize filter, and sends the notifications a test asks for.
+type stubWsServer struct {
+	*httptest.Server
+	subscribed chan string
+
+	mu            sync.Mutex
+	conn          *websocket.Conn
+	subscriptions map[string]uint64
+}
+
+func newStubWsServer(t *testing.T) *stubWsServer {
+	s := &stubWsServer{subscribed: make(chan string, 100), subscriptions: make(map[string]uint64)}
+	upgrader := websocket.Upgrader{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		s.mu.Lock()
+		s.conn = conn
+		s.mu.Unlock()
+		for {
+			var request struct {
+				Id     uint64            `json:"id"`
+				Method string            `json:"method"`
+				Params []json.RawMessage `json:"params"`
+			}
+			if err := conn.ReadJSON(&request); err != nil {
+				return
+			}
+			var name string
+			switch request.Method {
+			case "accountSubscribe":
+				var key solana.PublicKey
+				json.Unmarshal(request.Params[0], &key)
+				name = "account " + key.String()
+			case "programSubscribe":
+				var opts struct {
+					Filters []rpc.RPCFilter `json:"filters"`
+				}
+				json.Unmarshal(request.Params[1], &opts)
+				name = fmt.Sprint("program ", opts.Filters[0].DataSize)
+			default:
+				continue
+			}
+			s.mu.Lock()
+			s.subscriptions[name] = request.Id + 1000
+			conn.WriteJSON(map[string]any{"jsonrpc": "2.0", "id": request.Id, "result": request.Id + 1000})
+			s.mu.Unlock()
+			s.subscribed <- name
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *stubWsServer) connect(t *testing.T) *ws.Client {
+	client, err := ws.Connect(context.Background(), "ws"+strings.TrimPrefix(s.URL, "http"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
+
+func (s *stubWsServer) waitSubscriptions(t *testing.T, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-s.subscribed:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %d subscriptions, want %d", i, n)
+		}
+	}
+}
+
+func (s *stubWsServer) notify(t *testing.T, name, method string, slot uint64, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.subscriptions[name]
+	if !ok {
+		t.Fatalf("no subscription %s", name)
+	}
+	err := s.conn.WriteJSON(map[string]any{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params": map[string]any{
+			"subscription": id,
+			"result":       map[string]any{"context": map[string]any{"slot": slot}, "value": value},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (s *stubWsServer) notifyProgram(t *testing.T, dataSize, slot uint64, key solana.PublicKey, account *rpc.Account) {
+	s.notify(t, fmt.Sprint("program ", dataSize), "programNotification", slot, &rpc.KeyedAccount{Pubkey: key, Account: account})
+}
+
+func (s *stubWsServer) notifyAccount(t *testing.T, key solana.PublicKey, slot uint64, account *rpc.Account) {
+	s.notify(t, "account "+key.String(), "accountNotification", slot, account)
+}
+
+func (s *stubWsServer) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conn.Close()
+}
+
+func nextPoolEvent(t *testing.T, events <-chan PoolEvent) PoolEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("no pool event")
+		return PoolEvent{}
+	}
+}
+
+func TestPoolRegistry(t *testing.T) {
+	ctx := context.Background()
+	fetcher, err := LoadFakeAccountFetcher("testdata/clmm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ammInfo, ammAccounts, _ := poolInfoFixture(t)
+	for key, account := range ammAccounts {
+		fetcher.SetAccount(key, account.owner, account.data)
+	}
+	clmmPools, err := fetcher.GetProgramAccounts(ctx, CLMM_PROGRAM_ID, []rpc.RPCFilter{{DataSize: POOL_STATE_SIZE}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	poolId, poolAccount := clmmPools[0].Pubkey, clmmPools[0].Account
+	clock := NewFixedClock(testTime)
+
+	events := make(chan PoolEvent, 16)
+	registry := NewPoolRegistry(fetcher, clock, events)
+	if err := registry.Bootstrap(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.TrackAmm(ctx, ammInfo); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []solana.PublicKey{poolId, ammInfo.Id} {
+		if event := nextPoolEvent(t, events); event.Kind != POOL_EVENT_CREATED || !event.PoolId.Equals(want) {
+			t.Errorf("got event %+v, want %v created", event, want)
+		}
+	}
+	want, err := FormatClmmKeys(ctx, fetcher, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantJson, _ := json.Marshal(want[poolId.String()])
+	pool, _ := registry.Snapshot().ClmmPool(poolId)
+	if gotJson, _ := json.Marshal(pool); string(gotJson) != string(wantJson) {
+		t.Errorf("bootstrapped pool differs:\n got %s\nwant %s", gotJson, wantJson)
+	}
+
+	server := newStubWsServer(t)
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() { done <- registry.Run(runCtx, server.connect(t)) }()
+	// Two program subscriptions, the two mints, reward mint and reward vault
+	// of the CLMM pool and the four AMM accounts.
+	server.waitSubscriptions(t, 10)
+
+	// Readers never see a pool half updated.
+	var readers sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				snapshot := registry.Snapshot()
+				if pool, ok := snapshot.ClmmPool(poolId); !ok || pool.Liquidity == "" || len(snapshot.ClmmPools()) == 0 {
+					t.Error("inconsistent snapshot")
+					return
+				}
+			}
+		}()
+	}
+
+	layout, err := NewPoolInfoLayoutFromBytes(poolAccount.Data.GetBinary())
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout.SqrtPriceX64 = new(big.Int).Lsh(big.NewInt(2), 64)
+	layout.Liquidity = big.NewInt(123456)
+	data, err := layout.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.notifyProgram(t, POOL_STATE_SIZE, 10, poolId, &rpc.Account{Owner: CLMM_PROGRAM_ID, Data: rpc.DataBytesOrJSONFromBytes(data)})
+	for _, kind := range []PoolEventKind{POOL_EVENT_PRICE_CHANGED, POOL_EVENT_LIQUIDITY_CHANGED} {
+		if event := nextPoolEvent(t, events); event.Kind != kind || !event.PoolId.Equals(poolId) || event.Slot != 10 {
+			t.Errorf("got event %+v, want kind %d at slot 10", event, kind)
+		}
+	}
+	pool, _ = registry.Snapshot().ClmmPool(poolId)
+	if pool.CurrentPrice.String() != "0.004" || pool.Liquidity != "123456" {
+		t.Errorf("got price %v liquidity %v", pool.CurrentPrice, pool.Liquidity)
+	}
+
+	// An older notification is ignored; a pool never seen is created, with
+	// its missing bitmap extension fetched once.
+	server.notifyProgram(t, POOL_STATE_SIZE, 5, poolId, poolAccount)
+	newPoolId := testPublicKey("new clmm pool")
+	server.notifyProgram(t, POOL_STATE_SIZE, 11, newPoolId, poolAccount)
+	if event := nextPoolEvent(t, events); event.Kind != POOL_EVENT_CREATED || !event.PoolId.Equals(newPoolId) || event.Clmm.ExBitmapInfo != nil {
+		t.Errorf("got event %+v, want %v created", event, newPoolId)
+	}
+	if pool, _ := registry.Snapshot().ClmmPool(poolId); pool.Liquidity != "123456" {
+		t.Error("stale notification was applied")
+	}
+
+	baseVault := &SplAccount{Mint: ammInfo.BaseMint, Owner: ammInfo.Authority, Amount: 10_000_000_000}
+	data, err = baseVault.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.notifyAccount(t, ammInfo.BaseVault, 12, &rpc.Account{Owner: TOKEN_PROGRAM_ID, Data: rpc.DataBytesOrJSONFromBytes(data)})
+	event := nextPoolEvent(t, events)
+	if event.Kind != POOL_EVENT_PRICE_CHANGED || !event.PoolId.Equals(ammInfo.Id) || event.Slot != 12 {
+		t.Errorf("got event %+v, want AMM price change at slot 12", event)
+	}
+	if ammPool, _ := registry.Snapshot().AmmPool(ammInfo.Id); ammPool != event.Amm {
+		t.Error("event pool is not the snapshot pool")
+	}
+
+	// Reward vaults are followed too, though they raise no event.
+	rewardVault := pool.RewardInfos[0].TokenVault
+	accounts, err := getMultipleAccountsInfo(ctx, fetcher, []solana.PublicKey{rewardVault})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vault, err := NewSplAccountFromBytes(accounts[0].Data.GetBinary())
+	if err != nil {
+		t.Fatal(err)
+	}
+	vault.Amount += 1000
+	server.notifyAccount(t, rewardVault, 13, &rpc.Account{Owner: accounts[0].Owner, Data: rpc.DataBytesOrJSONFromBytes(mustMarshal(t, vault))})
+	for deadline := time.Now().Add(5 * time.Second); registry.Snapshot().Slot != 13; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("reward vault notification was not applied")
+		}
+	}
+	if pool, _ := registry.Snapshot().ClmmPool(poolId); pool.RewardInfos[0].RemainingRewards.Int64() != 8_500 {
+		t.Errorf("remaining rewards: got %v, want 8500", pool.RewardInfos[0].RemainingRewards)
+	}
+
+	close(stop)
+	readers.Wait()
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+	if snapshot := registry.Snapshot(); snapshot.Slot != 13 || len(snapshot.ClmmPools()) != 2 || len(snapshot.AmmPools()) != 1 {
+		t.Errorf("got snapshot at slot %d with %d CLMM pools", snapshot.Slot, len(snapshot.ClmmPools()))
+	}
+}
+
+func TestPoolRegistryConnectionDropped(t *testing.T) {
+	fetcher, err := LoadFakeAccountFetcher("testdata/clmm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := NewPoolRegistry(fetcher, NewFixedClock(testTime), nil)
+	if err := registry.Bootstrap(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	server := newStubWsServer(t)
+	client := server.connect(t)
+	done := make(chan error, 1)
+	go func() { done <- registry.Run(context.Background(), client) }()
+	server.waitSubscriptions(t, 6)
+	if err := registry.Run(context.Background(), client); !errors.Is(err, ErrRegistryRunning) {
+		t.Errorf("second Run: got %v, want ErrRegistryRunning", err)
+	}
+
+	server.drop()
+	select {
+	case err := <-done:
+		if err == nil || errors.Is(err, context.Canceled) {
+			t.Errorf("got %v, want the connection error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after the connection dropped")
+	}
+}
+
+func TestPoolRegistrySkipsBrokenAmmPools(t *testing.T) {
+	ctx := context.Background()
+	fetcher, err := LoadFakeAccountFetcher("testdata/clmm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ammInfo, ammAccounts, _ := poolInfoFixture(t)
+	for key, account := range ammAccounts {
+		fetcher.SetAccount(key, account.owner, account.data)
+	}
+	registry := NewPoolRegistry(fetcher, NewFixedClock(testTime), nil)
+	if err := registry.TrackAmm(ctx, ammInfo); err != nil {
+		t.Fatal(err)
+	}
+
+	fetcher.DeleteAccount(ammInfo.QuoteVault)
+	err = registry.Bootstrap(ctx)
+	if !errors.Is(err, ErrAccountNotFound) || !strings.Contains(err.Error(), ammInfo.Id.String()) {
+		t.Errorf("got %v, want ErrAccountNotFound for %v", err, ammInfo.Id)
+	}
+	snapshot := registry.Snapshot()
+	if len(snapshot.ClmmPools()) != 1 {
+		t.Errorf("got %d CLMM pools, want 1", len(snapshot.ClmmPools()))
+	}
+	if _, ok := snapshot.AmmPool(ammInfo.Id); ok {
+		t.Error("AMM pool without its quote vault is still published")
+	}
+}
+
+func TestPoolRegistryTrackAmmSubscribesFirst(t *testing.T) {
+	ctx := context.Background()
+	fetcher := NewFakeAccountFetcher()
+	ammInfo, ammAccounts, _ := poolInfoFixture(t)
+	for key, account := range ammAccounts {
+		fetcher.SetAccount(key, account.owner, account.data)
+	}
+	registry := NewPoolRegistry(fetcher, NewFixedClock(testTime), nil)
+
+	// A run whose connection is gone cannot subscribe.
+	client := newStubWsServer(t).connect(t)
+	client.Close()
+	registry.run = &registryRun{ctx: ctx, client: client, subscribed: make(map[solana.PublicKey]bool)}
+	if err := registry.TrackAmm(ctx, ammInfo); err == nil {
+		t.Fatal("TrackAmm succeeded without its subscriptions")
+	}
+	if _, ok := registry.Snapshot().AmmPool(ammInfo.Id); ok || len(registry.ammInfos) != 0 {
+		t.Error("pool was tracked without its subscriptions")
+	}
+}
+
+func TestPoolRegistryRunSkipsBrokenPools(t *testing.T) {
+	ctx := context.Background()
+	fetcher, err := LoadFakeAccountFetcher("testdata/clmm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clmmPools, err := fetcher.GetProgramAccounts(ctx, CLMM_PROGRAM_ID, []rpc.RPCFilter{{DataSize: POOL_STATE_SIZE}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	poolId, poolAccount := clmmPools[0].Pubkey, clmmPools[0].Account
+	events := make(chan PoolEvent, 16)
+	registry := NewPoolRegistry(fetcher, NewFixedClock(testTime), events)
+	if err := registry.Bootstrap(ctx); err != nil {
+		t.Fatal(err)
+	}
+	nextPoolEvent(t, events)
+
+	server := newStubWsServer(t)
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() { done <- registry.Run(runCtx, server.connect(t)) }()
+	server.waitSubscriptions(t, 6)
+
+	// A pool that no longer decodes leaves the snapshot.
+	garbage := &rpc.Account{Owner: CLMM_PROGRAM_ID, Data: rpc.DataBytesOrJSONFromBytes(make([]byte, POOL_STATE_SIZE))}
+	server.notifyProgram(t, POOL_STATE_SIZE, 10, poolId, garbage)
+	if event := nextPoolEvent(t, events); event.Kind != POOL_EVENT_FAILED || !event.PoolId.Equals(poolId) || event.Slot != 10 || event.Err == nil {
+		t.Errorf("got event %+v, want %v failed at slot 10", event, poolId)
+	}
+	if _, ok := registry.Snapshot().ClmmPool(poolId); ok {
+		t.Error("pool that does not decode is still published")
+	}
+
+	// A new pool whose mints do not exist is not published.
+	layout, err := NewPoolInfoLayoutFromBytes(poolAccount.Data.GetBinary())
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout.MintA = testPublicKey("missing mint")
+	newPoolId := testPublicKey("new clmm pool")
+	server.notifyProgram(t, POOL_STATE_SIZE, 11, newPoolId, &rpc.Account{Owner: CLMM_PROGRAM_ID, Data: rpc.DataBytesOrJSONFromBytes(mustMarshal(t, layout))})
+	if event := nextPoolEvent(t, events); event.Kind != POOL_EVENT_FAILED || !event.PoolId.Equals(newPoolId) || !errors.Is(event.Err, ErrAccountNotFound) {
+		t.Errorf("got event %+v, want %v failed with ErrAccountNotFound", event, newPoolId)
+	}
+
+	// Run is still applying notifications.
+	server.notifyProgram(t, POOL_STATE_SIZE, 12, poolId, poolAccount)
+	if event := nextPoolEvent(t, events); event.Kind != POOL_EVENT_CREATED || !event.PoolId.Equals(poolId) || event.Slot != 12 {
+		t.Errorf("got event %+v, want %v created at slot 12", event, poolId)
+	}
+	snapshot := registry.Snapshot()
+	if _, ok := snapshot.ClmmPool(newPoolId); ok || len(snapshot.ClmmPools()) != 1 {
+		t.Errorf("got %d CLMM pools, want only %v", len(snapshot.ClmmPools()), poolId)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestPoolRegistrySendsEventsUnlocked(t *testing.T) {
+	ctx := context.Background()
+	fetcher, err := LoadFakeAccountFetcher("testdata/clmm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ammInfo, ammAccounts, _ := poolInfoFixture(t)
+	for key, account := range ammAccounts {
+		fetcher.SetAccount(key, account.owner, account.data)
+	}
+	events := make(chan PoolEvent)
+	registry := NewPoolRegistry(fetcher, NewFixedClock(testTime), events)
+	done := make(chan error, 1)
+	go func() { done <- registry.Bootstrap(ctx) }()
+
+	// Bootstrap waits on its event while the registry takes other writers.
+	for deadline := time.Now().Add(5 * time.Second); len(registry.Snapshot().ClmmPools()) == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Bootstrap did not publish its snapshot")
+		}
+	}
+	tracked := make(chan error, 1)
+	go func() { tracked <- registry.TrackAmm(ctx, ammInfo) }()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		if _, ok := registry.Snapshot().AmmPool(ammInfo.Id); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("TrackAmm waited on the event Bootstrap is sending")
+		}
+	}
+	created := map[solana.PublicKey]bool{}
+	for i := 0; i < 2; i++ {
+		event := nextPoolEvent(t, events)
+		created[event.PoolId] = event.Kind == POOL_EVENT_CREATED
+	}
+	if !created[ammInfo.Id] || len(created) != 2 {
+		t.Errorf("got created events %v, want the CLMM pool and %v", created, ammInfo.Id)
+	}
+	for _, errs := range []chan error{done, tracked} {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+package raydium
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+type PositionRewardInfo struct {
+	GrowthInsideLastX64 *big.Int
+	RewardAmountOwed    uint64
+}
+
+// PersonalPositionState is the position owned by whoever holds NftMint.
+type PersonalPositionState struct {
+	Bump                    uint8
+	NftMint                 solana.PublicKey
+	PoolId                  solana.PublicKey
+	TickLowerIndex          int32
+	TickUpperIndex          int32
+	Liquidity               *big.Int
+	FeeGrowthInside0LastX64 *big.Int
+	FeeGrowthInside1LastX64 *big.Int
+	TokenFeesOwed0          uint64
+	TokenFeesOwed1          uint64
+	RewardInfos             []*PositionRewardInfo
+	RecentEpoch             uint64
+}
+
+// ProtocolPositionState aggregates every personal position of a pool over
+// the same tick range.
+type ProtocolPositionState struct {
+	Bump                    uint8
+	PoolId                  solana.PublicKey
+	TickLowerIndex          int32
+	TickUpperIndex          int32
+	Liquidity               *big.Int
+	FeeGrowthInside0LastX64 *big.Int
+	FeeGrowthInside1LastX64 *big.Int
+	TokenFeesOwed0          uint64
+	TokenFeesOwed1          uint64
+	RewardGrowthInsideX64   []*big.Int
+	RecentEpoch             uint64
+}
+
+func NewPersonalPositionStateFromBytes(data []byte) (*PersonalPositionState, error) {
+	if err := checkAnchorAccount(data, PERSONAL_POSITION_STATE_DISCRIMINATOR, PERSONAL_POSITION_STATE_SIZE); err != nil {
+		return nil, err
+	}
+
+	rewardInfos := make([]*PositionRewardInfo, 0, 3)
+	for i := 0; i < 3; i++ {
+		offset := 145 + i*24
+		rewardInfos = append(rewardInfos, &PositionRewardInfo{
+			GrowthInsideLastX64: U128FromBytes([16]byte(data[offset : offset+16])),
+			RewardAmountOwed:    binary.LittleEndian.Uint64(data[offset+16:]),
+		})
+	}
+	return &PersonalPositionState{
+		Bump:                    data[8],
+		NftMint:                 solana.PublicKeyFromBytes(data[9:41]),
+		PoolId:                  solana.PublicKeyFromBytes(data[41:73]),
+		TickLowerIndex:          int32(binary.LittleEndian.Uint32(data[73:])),
+		TickUpperIndex:          int32(binary.LittleEndian.Uint32(data[77:])),
+		Liquidity:               U128FromBytes([16]byte(data[81:97])),
+		FeeGrowthInside0LastX64: U128FromBytes([16]byte(data[97:113])),
+		FeeGrowthInside1LastX64: U128FromBytes([16]byte(data[113:129])),
+		TokenFeesOwed0:          binary.LittleEndian.Uint64(data[129:]),
+		TokenFeesOwed1:          binary.LittleEndian.Uint64(data[137:]),
+		RewardInfos:             rewardInfos,
+		RecentEpoch:             binary.LittleEndian.Uint64(data[217:]),
+	}, nil
+}
+
+func (position *PersonalPositionState) UnmarshalBinary(data []byte) error {
+	decoded, err := NewPersonalPositionStateFromBytes(data)
+	if err != nil {
+		return err
+	}
+	*position = *decoded
+	return nil
+}
+
+func (position *PersonalPositionState) MarshalBinary() ([]byte, error) {
+	if len(position.RewardInfos) > 3 {
+		return nil, fmt.Errorf("position has %d reward infos, at most 3 fit", len(position.RewardInfos))
+	}
+
+	data := make([]byte, PERSONAL_POSITION_STATE_SIZE)
+	copy(data[0:8], PERSONAL_POSITION_STATE_DISCRIMINATOR[:])
+	data[8] = position.Bump
+	copy(data[9:41], position.NftMint[:])
+	copy(data[41:73], position.PoolId[:])
+	binary.LittleEndian.PutUint32(data[73:], uint32(position.TickLowerIndex))
+	binary.LittleEndian.PutUint32(data[77:], uint32(position.TickUpperIndex))
+	for _, field := range []struct {
+		offset int
+		value  *big.Int
+	}{
+		{81, position.Liquidity},
+		{97, position.FeeGrowthInside0LastX64},
+		{113, position.FeeGrowthInside1LastX64},
+	} {
+		if err := PutU128(data[field.offset:], field.value); err != nil {
+			return nil, err
+		}
+	}
+	binary.LittleEndian.PutUint64(data[129:], position.TokenFeesOwed0)
+	binary.LittleEndian.PutUint64(data[137:], position.TokenFeesOwed1)
+	for i, rewardInfo := range position.RewardInfos {
+		if rewardInfo == nil {
+			continue
+		}
+		offset := 145 + i*24
+		if err := PutU128(data[offset:], rewardInfo.GrowthInsideLastX64); err != nil {
+			return nil, err
+		}
+		binary.LittleEndian.PutUint64(data[offset+16:], rewardInfo.RewardAmountOwed)
+	}
+	binary.LittleEndian.PutUint64(data[217:], position.RecentEpoch)
+	return data, nil
+}
+
+func NewProtocolPositionStateFromBytes(data []byte) (*ProtocolPositionState, error) {
+	if err := checkAnchorAccount(data, PROTOCOL_POSITION_STATE_DISCRIMINATOR, PROTOCOL_POSITION_STATE_SIZE); err != nil {
+		return nil, err
+	}
+
+	rewardGrowthInside := make([]*big.Int, 0, 3)
+	for i := 0; i < 3; i++ {
+		rewardGrowthInside = append(rewardGrowthInside, U128FromBytes([16]byte(data[113+i*16:129+i*16])))
+	}
+	return &ProtocolPositionState{
+		Bump:                    data[8],
+		PoolId:                  solana.PublicKeyFromBytes(data[9:41]),
+		TickLowerIndex:          int32(binary.LittleEndian.Uint32(data[41:])),
+		TickUpperIndex:          int32(binary.LittleEndian.Uint32(data[45:])),
+		Liquidity:               U128FromBytes([16]byte(data[49:65])),
+		FeeGrowthInside0LastX64: U128FromBytes([16]byte(data[65:81])),
+		FeeGrowthInside1LastX64: U128FromBytes([16]byte(data[81:97])),
+		TokenFeesOwed0:          binary.LittleEndian.Uint64(data[97:]),
+		TokenFeesOwed1:          binary.LittleEndian.Uint64(data[105:]),
+		RewardGrowthInsideX64:   rewardGrowthInside,
+		RecentEpoch:             binary.LittleEndian.Uint64(data[161:]),
+	}, nil
+}
+
+func (position *ProtocolPositionState) UnmarshalBinary(data []byte) error {
+	decoded, err := NewProtocolPositionStateFromBytes(data)
+	if err != nil {
+		return err
+	}
+	*position = *decoded
+	return nil
+}
+
+func (position *ProtocolPositionState) MarshalBinary() ([]byte, error) {
+	if len(position.RewardGrowthInsideX64) > 3 {
+		return nil, fmt.Errorf("position has %d reward growths, at most 3 fit", len(position.RewardGrowthInsideX64))
+	}
+
+	data := make([]byte, PROTOCOL_POSITION_STATE_SIZE)
+	copy(data[0:8], PROTOCOL_POSITION_STATE_DISCRIMINATOR[:])
+	data[8] = position.Bump
+	copy(data[9:41], position.PoolId[:])
+	binary.LittleEndian.PutUint32(data[41:], uint32(position.TickLowerIndex))
+	binary.LittleEndian.PutUint32(data[45:], uint32(position.TickUpperIndex))
+	for _, field := range []struct {
+		offset int
+		value  *big.Int
+	}{
+		{49, position.Liquidity},
+		{65, position.FeeGrowthInside0LastX64},
+		{81, position.FeeGrowthInside1LastX64},
+	} {
+		if err := PutU128(data[field.offset:], field.value); err != nil {
+			return nil, err
+		}
+	}
+	binary.LittleEndian.PutUint64(data[97:], position.TokenFeesOwed0)
+	binary.LittleEndian.PutUint64(data[105:], position.TokenFeesOwed1)
+	for i, growth := range position.RewardGrowthInsideX64 {
+		if err := PutU128(data[113+i*16:], growth); err != nil {
+			return nil, err
+		}
+	}
+	binary.LittleEndian.PutUint64(data[161:], position.RecentEpoch)
+	return data, nil
+}
+
+func GetPdaPersonalPositionAddress(programId, nftMint solana.PublicKey) solana.PublicKey {
+	publicKey, _, _ := solana.FindProgramAddress(
+		[][]byte{
+			[]byte("position"),
+			nftMint.Bytes(),
+		},
+		programId,
+	)
+	return publicKey
+}
+
+func GetPdaProtocolPositionAddress(programId, poolId solana.PublicKey, tickLower, tickUpper int32) solana.PublicKey {
+	var lower, upper [4]byte
+	binary.BigEndian.PutUint32(lower[:], uint32(tickLower))
+	binary.BigEndian.PutUint32(upper[:], uint32(tickUpper))
+	publicKey, _, _ := solana.FindProgramAddress(
+		[][]byte{
+			[]byte("position"),
+			poolId.Bytes(),
+			lower[:],
+			upper[:],
+		},
+		programId,
+	)
+	return publicKey
+}
+
+// FetchWalletPositions finds the CLMM positions of owner through the
+// position NFTs it holds in Token and Token-2022 accounts.
+func FetchWalletPositions(ctx context.Context, fetcher AccountFetcher, programId, owner solana.PublicKey) ([]*PersonalPositionState, error) {
+	tokenAccounts, err := FetchTokenAccounts(ctx, fetcher, owner)
+	if err != nil {
+		return nil, err
+	}
+	var positionAddresses []solana.PublicKey
+	for _, tokenAccount := range tokenAccounts {
+		if tokenAccount.AccountInfo.Amount != 1 {
+			continue
+		}
+		positionAddresses = append(positionAddresses, GetPdaPersonalPositionAddress(programId, tokenAccount.AccountInfo.Mint))
+	}
+
+	result, err := fetchAccounts(ctx, fetcher, positionAddresses)
+	if err != nil {
+		return nil, err
+	}
+	var positions []*PersonalPositionState
+	// Most NFTs are not positions, so missing accounts are expected.
+	for i, account := range result.Accounts {
+		if result.Missing(i) || !account.Owner.Equals(programId) {
+			continue
+		}
+		position, err := NewPersonalPositionStateFromBytes(account.Data.GetBinary())
+		if err != nil {
+			return nil, fmt.Errorf("decode position %v: %w", positionAddresses[i], err)
+		}
+		positions = append(positions, position)
+	}
+	return positions, nil
+}
+
+// PositionValue is what a position would return if it were closed now.
+type PositionValue struct {
+	NftMint   solana.PublicKey
+	PoolId    solana.PublicKey
+	AmountA   *big.Int
+	AmountB   *big.Int
+	InRange   bool
+	FeesOwedA *big.Int
+	FeesOwedB *big.Int
+	// RewardsOwed has one entry per pool reward slot.
+	RewardsOwed []*big.Int
+}
+
+// ComputePositionValue values position against the current pool state, with
+// rewards accrued up to chainTime. tickLower and tickUpper are the pool's tick
+// states at the position bounds.
+func ComputePositionValue(pool *PoolInfoLayout, position *PersonalPositionState, tickLower, tickUpper *TickState, chainTime uint64) (*PositionValue, error) {
+	amountA, amountB, err := GetAmountsFromLiquidity(pool.TickCurrent, pool.SqrtPriceX64, position.TickLowerIndex, position.TickUpperIndex, new(big.Int).Neg(position.Liquidity))
+	if err != nil {
+		return nil, err
+	}
+
+	feeGrowthInsideA := getGrowthInside(pool.TickCurrent, position.TickLowerIndex, position.TickUpperIndex, pool.FeeGrowthGlobalX64A, tickLower.FeeGrowthOutsideX64A, tickUpper.FeeGrowthOutsideX64A)
+	feeGrowthInsideB := getGrowthInside(pool.TickCurrent, position.TickLowerIndex, position.TickUpperIndex, pool.FeeGrowthGlobalX64B, tickLower.FeeGrowthOutsideX64B, tickUpper.FeeGrowthOutsideX64B)
+	return &PositionValue{
+		NftMint:     position.NftMint,
+		PoolId:      position.PoolId,
+		AmountA:     amountA,
+		AmountB:     amountB,
+		InRange:     position.TickLowerIndex <= pool.TickCurrent && pool.TickCurrent < position.TickUpperIndex,
+		FeesOwedA:   pendingGrowthAmount(position.TokenFeesOwed0, feeGrowthInsideA, position.FeeGrowthInside0LastX64, position.Liquidity),
+		FeesOwedB:   pendingGrowthAmount(position.TokenFeesOwed1, feeGrowthInsideB, position.FeeGrowthInside1LastX64, position.Liquidity),
+		RewardsOwed: ComputePositionRewards(pool, position, tickLower, tickUpper, chainTime),
+	}, nil
+}
+
+// getGrowthInside is the growth accumulated inside [tickLower, tickUpper)
+// from the global growth and the growth outside each bound, with the
+// program's wrapping u128 arithmetic.
+func getGrowthInside(tickCurrent, tickLower, tickUpper int32, global, lowerOutside, upperOutside *big.Int) *big.Int {
+	below := lowerOutside
+	if tickCurrent < tickLower {
+		below = wrappingSubU128(global, lowerOutside)
+	}
+	above := upperOutside
+	if tickCurrent >= tickUpper {
+		above = wrappingSubU128(global, upperOutside)
+	}
+	return wrappingSubU128(wrappingSubU128(global, below), above)
+}
+
+// pendingGrowthAmount is owed plus liquidity times the growth since last.
+func pendingGrowthAmount(owed uint64, growthInside, growthInsideLast, liquidity *big.Int) *big.Int {
+	pending := mulDivFloor(wrappingSubU128(growthInside, growthInsideLast), liquidity, q64)
+	return pending.Add(pending, new(big.Int).SetUint64(owed))
+}
+
+// FetchPositionValues loads the pools and boundary ticks of positions and
+// values each of them, with rewards accrued up to the time of clock.
+func FetchPositionValues(ctx context.Context, fetcher AccountFetcher, positions []*PersonalPositionState, clock Clock) ([]*PositionValue, error) {
+	if len(positions) == 0 {
+		return nil, nil
+	}
+	chainTime, err := chainTimestamp(ctx, clock)
+	if err != nil {
+		return nil, err
+	}
+
+	var poolIds []solana.PublicKey
+	startIndexes := make(map[solana.PublicKey]map[int32]bool)
+	for _, position := range positions {
+		if _, ok := startIndexes[position.PoolId]; !ok {
+			poolIds = append(poolIds, position.PoolId)
+			startIndexes[position.PoolId] = make(map[int32]bool)
+		}
+	}
+	poolAccounts, err := getMultipleAccountsInfo(ctx, fetcher, poolIds)
+	if err != nil {
+		return nil, err
+	}
+	pools := make(map[solana.PublicKey]*PoolInfoLayout, len(poolIds))
+	for i, account := range poolAccounts {
+		pool, err := NewPoolInfoLayoutFromBytes(account.Data.GetBinary())
+		if err != nil {
+			return nil, fmt.Errorf("decode pool %v: %w", poolIds[i], err)
+		}
+		pools[poolIds[i]] = pool
+	}
+
+	for _, position := range positions {
+		tickSpacing := pools[position.PoolId].TickSpacing
+		startIndexes[position.PoolId][getArrayStartIndex(position.TickLowerIndex, tickSpacing)] = true
+		startIndexes[position.PoolId][getArrayStartIndex(position.TickUpperIndex, tickSpacing)] = true
+	}
+	tickArrays := make(map[solana.PublicKey]map[int32]*TickArrayState, len(poolIds))
+	for i, poolId := range poolIds {
+		indexes := make([]int32, 0, len(startIndexes[poolId]))
+		for startIndex := range startIndexes[poolId] {
+			indexes = append(indexes, startIndex)
+		}
+		if tickArrays[poolId], err = FetchTickArrays(ctx, fetcher, poolAccounts[i].Owner, poolId, indexes); err != nil {
+			return nil, err
+		}
+	}
+
+	values := make([]*PositionValue, 0, len(positions))
+	for _, position := range positions {
+		pool := pools[position.PoolId]
+		tickLower, err := findTickState(tickArrays[position.PoolId], position.TickLowerIndex, pool.TickSpacing)
+		if err != nil {
+			return nil, err
+		}
+		tickUpper, err := findTickState(tickArrays[position.PoolId], position.TickUpperIndex, pool.TickSpacing)
+		if err != nil {
+			return nil, err
+		}
+		value, err := ComputePositionValue(pool, position, tickLower, tickUpper, chainTime)
+		if err != nil {
+			return nil, fmt.Errorf("position %v: %w", position.NftMint, err)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func findTickState(tickArrays map[int32]*TickArrayState, tick int32, tickSpacing uint16) (*TickState, error) {
+	startIndex := getArrayStartIndex(tick, tickSpacing)
+	tickArray, ok := tickArrays[startIndex]
+	if !ok {
+		return nil, fmt.Errorf("%w: start index %d", ErrTickArrayNotFound, startIndex)
+	}
+	tickState := tickArray.tick(int((tick - startIndex) / int32(tickSpacing)))
+	if tickState == nil {
+		return nil, fmt.Errorf("%w: tick %d", ErrTickArrayNotFound, tick)
+	}
+	return tickState, nil
+}
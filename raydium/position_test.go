@@ -0,0 +1,129 @@
+package raydium
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// positionFixture is a [-600, 600) position over a pool at tick 0. Fee
+// growth of token B has wrapped around since the position was last updated.
+func positionFixture() (*PoolInfoLayout, *PersonalPositionState, *TickState, *TickState) {
+	x64 := func(v int64) *big.Int { return new(big.Int).Lsh(big.NewInt(v), 64) }
+	sqrtPriceX64, _ := GetSqrtPriceAtTick(0)
+
+	pool := &PoolInfoLayout{
+		MintA:               testPublicKey("mint a"),
+		MintB:               testPublicKey("mint b"),
+		TickSpacing:         10,
+		Liquidity:           big.NewInt(33_837_499_809),
+		SqrtPriceX64:        sqrtPriceX64,
+		FeeGrowthGlobalX64A: x64(5),
+		FeeGrowthGlobalX64B: x64(1),
+	}
+	tickLower := &TickState{
+		Tick:                 -600,
+		LiquidityNet:         big.NewInt(33_837_499_809),
+		LiquidityGross:       big.NewInt(33_837_499_809),
+		FeeGrowthOutsideX64A: x64(1),
+		FeeGrowthOutsideX64B: x64(3),
+	}
+	tickUpper := &TickState{
+		Tick:                 600,
+		LiquidityNet:         big.NewInt(-33_837_499_809),
+		LiquidityGross:       big.NewInt(33_837_499_809),
+		FeeGrowthOutsideX64A: x64(1),
+		FeeGrowthOutsideX64B: new(big.Int),
+	}
+	position := &PersonalPositionState{
+		NftMint:                 testPublicKey("position nft"),
+		PoolId:                  testPublicKey("clmm pool"),
+		TickLowerIndex:          -600,
+		TickUpperIndex:          600,
+		Liquidity:               big.NewInt(33_837_499_809),
+		FeeGrowthInside0LastX64: x64(1),
+		FeeGrowthInside1LastX64: new(big.Int).Sub(two128, x64(3)),
+		TokenFeesOwed0:          7,
+	}
+	return pool, position, tickLower, tickUpper
+}
+
+func TestComputePositionValue(t *testing.T) {
+	pool, position, tickLower, tickUpper := positionFixture()
+
+	value, err := ComputePositionValue(pool, position, tickLower, tickUpper, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !value.InRange {
+		t.Error("position should be in range")
+	}
+	if value.AmountA.Int64() != 999_999_999 || value.AmountB.Int64() != 999_999_999 {
+		t.Errorf("amounts: got %v %v", value.AmountA, value.AmountB)
+	}
+	// Inside growth is 5-1-1 = 3 for A and 1-3-0 = -2 for B, so each
+	// position earned 2 and 1 units per liquidity since its last update.
+	if value.FeesOwedA.Int64() != 2*33_837_499_809+7 {
+		t.Errorf("fees A: got %v", value.FeesOwedA)
+	}
+	if value.FeesOwedB.Int64() != 33_837_499_809 {
+		t.Errorf("fees B: got %v", value.FeesOwedB)
+	}
+
+	// Above the range, inside growth is the difference of the outside growths.
+	tickUpper.FeeGrowthOutsideX64A = new(big.Int).Lsh(big.NewInt(2), 64)
+	pool.TickCurrent = 700
+	pool.SqrtPriceX64, _ = GetSqrtPriceAtTick(700)
+	value, err = ComputePositionValue(pool, position, tickLower, tickUpper, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value.InRange || value.AmountA.Sign() != 0 || value.AmountB.Int64() != 2_030_452_988 {
+		t.Errorf("above range: got in range %v, amounts %v %v", value.InRange, value.AmountA, value.AmountB)
+	}
+	if value.FeesOwedA.Int64() != 7 {
+		t.Errorf("above range fees A: got %v", value.FeesOwedA)
+	}
+}
+
+func TestFetchWalletPositions(t *testing.T) {
+	pool, position, tickLower, tickUpper := positionFixture()
+	wallet := testPublicKey("wallet")
+
+	tokenAccount := func(mint solana.PublicKey, amount uint64) []byte {
+		return mustMarshal(t, &SplAccount{Mint: mint, Owner: wallet, Amount: amount})
+	}
+	tickArray := func(tick *TickState) []byte {
+		tickArray := &TickArrayState{PoolId: position.PoolId, StartTickIndex: tick.Tick, Ticks: []*TickState{tick}}
+		return mustMarshal(t, tickArray)
+	}
+
+	accounts := map[solana.PublicKey]stubAccount{
+		testPublicKey("nft account"):                                     {TOKEN_2022_PROGRAM_ID, tokenAccount(position.NftMint, 1)},
+		testPublicKey("other nft account"):                               {TOKEN_PROGRAM_ID, tokenAccount(testPublicKey("other nft"), 1)},
+		testPublicKey("usdc account"):                                    {TOKEN_PROGRAM_ID, tokenAccount(testPublicKey("usdc"), 1_000_000)},
+		GetPdaPersonalPositionAddress(CLMM_PROGRAM_ID, position.NftMint): {CLMM_PROGRAM_ID, mustMarshal(t, position)},
+		position.PoolId:                                                  {CLMM_PROGRAM_ID, mustMarshal(t, pool)},
+		GetPdaTickArrayAddress(CLMM_PROGRAM_ID, position.PoolId, -600):   {CLMM_PROGRAM_ID, tickArray(tickLower)},
+		GetPdaTickArrayAddress(CLMM_PROGRAM_ID, position.PoolId, 600):    {CLMM_PROGRAM_ID, tickArray(tickUpper)},
+	}
+	fetcher := newTestFetcher(accounts, nil)
+
+	positions, err := FetchWalletPositions(context.Background(), fetcher, CLMM_PROGRAM_ID, wallet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positions) != 1 || !positions[0].NftMint.Equals(position.NftMint) {
+		t.Fatalf("got %d positions", len(positions))
+	}
+
+	values, err := FetchPositionValues(context.Background(), fetcher, positions, testClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 1 || values[0].FeesOwedA.Int64() != 2*33_837_499_809+7 || values[0].FeesOwedB.Int64() != 33_837_499_809 {
+		t.Errorf("got %+v", values[0])
+	}
+}
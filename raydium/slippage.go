@@ -0,0 +1,54 @@
+package raydium
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/shopspring/decimal"
+)
+
+var ErrInvalidSlippage = errors.New("invalid slippage")
+
+// Slippage is a non-negative tolerance such as 0.005 (0.5%, 50 bps). It is
+// kept as a fraction so min/max amounts round exactly like integer math.
+type Slippage struct {
+	rate *big.Rat
+}
+
+func NewSlippageFromBps(bps int64) (Slippage, error) {
+	if bps < 0 {
+		return Slippage{}, fmt.Errorf("%w: %d bps", ErrInvalidSlippage, bps)
+	}
+	return Slippage{rate: big.NewRat(bps, 10000)}, nil
+}
+
+func NewSlippageFromDecimal(d decimal.Decimal) (Slippage, error) {
+	if d.IsNegative() {
+		return Slippage{}, fmt.Errorf("%w: %v", ErrInvalidSlippage, d)
+	}
+	rate, ok := new(big.Rat).SetString(d.String())
+	if !ok {
+		return Slippage{}, fmt.Errorf("%w: %v", ErrInvalidSlippage, d)
+	}
+	return Slippage{rate: rate}, nil
+}
+
+// MinAmountOut is amount / (1 + s), rounded down.
+func (s Slippage) MinAmountOut(amount *big.Int) *big.Int {
+	num, den := s.fraction()
+	return new(big.Int).Div(new(big.Int).Mul(amount, den), new(big.Int).Add(den, num))
+}
+
+// MaxAmountIn is amount * (1 + s), rounded down.
+func (s Slippage) MaxAmountIn(amount *big.Int) *big.Int {
+	num, den := s.fraction()
+	return new(big.Int).Div(new(big.Int).Mul(amount, new(big.Int).Add(den, num)), den)
+}
+
+func (s Slippage) fraction() (*big.Int, *big.Int) {
+	if s.rate == nil {
+		return big.NewInt(0), big.NewInt(1)
+	}
+	return s.rate.Num(), s.rate.Denom()
+}
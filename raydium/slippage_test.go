@@ -0,0 +1,42 @@
+package raydium
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestSlippage(t *testing.T) {
+	fromBps, err := NewSlippageFromBps(50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromDecimal, err := NewSlippageFromDecimal(decimal.RequireFromString("0.005"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	amount := big.NewInt(1_000_000)
+	for _, s := range []Slippage{fromBps, fromDecimal} {
+		if got := s.MinAmountOut(amount); got.Int64() != 995_024 {
+			t.Errorf("min amount out: got %v", got)
+		}
+		if got := s.MaxAmountIn(amount); got.Int64() != 1_005_000 {
+			t.Errorf("max amount in: got %v", got)
+		}
+	}
+
+	var zero Slippage
+	if zero.MinAmountOut(amount).Cmp(amount) != 0 || zero.MaxAmountIn(amount).Cmp(amount) != 0 {
+		t.Error("zero slippage should not change amounts")
+	}
+
+	if _, err := NewSlippageFromBps(-1); !errors.Is(err, ErrInvalidSlippage) {
+		t.Errorf("got %v, want ErrInvalidSlippage", err)
+	}
+	if _, err := NewSlippageFromDecimal(decimal.NewFromFloat(-0.01)); !errors.Is(err, ErrInvalidSlippage) {
+		t.Errorf("got %v, want ErrInvalidSlippage", err)
+	}
+}
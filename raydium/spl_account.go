@@ -1,6 +1,6 @@
 package raydium
 
-import "unsafe"
+import "encoding/binary"
 
 var (
 	SPL_ACCOUNT_SIZE = 165
@@ -18,20 +18,56 @@ type SplAccount struct {
 	DelegatedAmount      uint64
 	CloseAuthorityOption uint32
 	CloseAuthority       [32]byte
+	// Extensions of a Token-2022 account.
+	Extensions AccountExtensions
 }
 
-func NewSplAccountFromBytes(b []byte) *SplAccount {
+func NewSplAccountFromBytes(b []byte) (*SplAccount, error) {
+	if err := checkSize(b, SPL_ACCOUNT_SIZE); err != nil {
+		return nil, err
+	}
+
+	extensions, err := decodeAccountExtensions(b)
+	if err != nil {
+		return nil, err
+	}
 	return &SplAccount{
 		Mint:                 *(*[32]byte)(b[0:32]),
 		Owner:                *(*[32]byte)(b[32:64]),
-		Amount:               *(*uint64)(unsafe.Pointer(&b[64])),
-		DelegateOption:       *(*uint32)(unsafe.Pointer(&b[72])),
+		Amount:               binary.LittleEndian.Uint64(b[64:72]),
+		DelegateOption:       binary.LittleEndian.Uint32(b[72:76]),
 		Delegate:             *(*[32]byte)(b[76:108]),
-		State:                *(*uint8)(unsafe.Pointer(&b[108])),
-		IsNativeOption:       *(*uint32)(unsafe.Pointer(&b[109])),
-		IsNative:             (*(*uint64)(unsafe.Pointer(&b[113]))),
-		DelegatedAmount:      *(*uint64)(unsafe.Pointer(&b[121])),
-		CloseAuthorityOption: *(*uint32)(unsafe.Pointer(&b[129])),
+		State:                b[108],
+		IsNativeOption:       binary.LittleEndian.Uint32(b[109:113]),
+		IsNative:             binary.LittleEndian.Uint64(b[113:121]),
+		DelegatedAmount:      binary.LittleEndian.Uint64(b[121:129]),
+		CloseAuthorityOption: binary.LittleEndian.Uint32(b[129:133]),
 		CloseAuthority:       *(*[32]byte)(b[133:165]),
+		Extensions:           extensions,
+	}, nil
+}
+
+func (account *SplAccount) UnmarshalBinary(data []byte) error {
+	decoded, err := NewSplAccountFromBytes(data)
+	if err != nil {
+		return err
 	}
+	*account = *decoded
+	return nil
+}
+
+func (account *SplAccount) MarshalBinary() ([]byte, error) {
+	b := make([]byte, SPL_ACCOUNT_SIZE)
+	copy(b[0:32], account.Mint[:])
+	copy(b[32:64], account.Owner[:])
+	binary.LittleEndian.PutUint64(b[64:72], account.Amount)
+	binary.LittleEndian.PutUint32(b[72:76], account.DelegateOption)
+	copy(b[76:108], account.Delegate[:])
+	b[108] = account.State
+	binary.LittleEndian.PutUint32(b[109:113], account.IsNativeOption)
+	binary.LittleEndian.PutUint64(b[113:121], account.IsNative)
+	binary.LittleEndian.PutUint64(b[121:129], account.DelegatedAmount)
+	binary.LittleEndian.PutUint32(b[129:133], account.CloseAuthorityOption)
+	copy(b[133:165], account.CloseAuthority[:])
+	return writeExtensions(b, TOKEN_2022_ACCOUNT_TYPE_ACCOUNT, encodeAccountExtensions(&account.Extensions)), nil
 }
@@ -1,11 +1,58 @@
 package raydium
 
+import "encoding/binary"
+
 type SplMint struct {
-	// MintAuthorityOption   uint32
+	MintAuthorityOption   uint32
 	MintAuthority         [32]byte
 	Supply                uint64
 	Decimals              uint8
 	IsInitialized         uint8
 	FreezeAuthorityOption uint32
-	// FreezeAuthority       [32]byte
+	FreezeAuthority       [32]byte
+	// Extensions of a Token-2022 mint.
+	Extensions MintExtensions
+}
+
+func NewSplMintFromBytes(data []byte) (*SplMint, error) {
+	if err := checkSize(data, SPL_MINT_SIZE); err != nil {
+		return nil, err
+	}
+
+	mint := &SplMint{
+		MintAuthorityOption:   binary.LittleEndian.Uint32(data[0:4]),
+		Supply:                binary.LittleEndian.Uint64(data[36:44]),
+		Decimals:              data[44],
+		IsInitialized:         data[45],
+		FreezeAuthorityOption: binary.LittleEndian.Uint32(data[46:50]),
+	}
+	copy(mint.MintAuthority[:], data[4:36])
+	copy(mint.FreezeAuthority[:], data[50:82])
+	extensions, err := decodeMintExtensions(data)
+	if err != nil {
+		return nil, err
+	}
+	mint.Extensions = extensions
+	return mint, nil
+}
+
+func (mint *SplMint) UnmarshalBinary(data []byte) error {
+	decoded, err := NewSplMintFromBytes(data)
+	if err != nil {
+		return err
+	}
+	*mint = *decoded
+	return nil
+}
+
+func (mint *SplMint) MarshalBinary() ([]byte, error) {
+	data := make([]byte, SPL_MINT_SIZE)
+	binary.LittleEndian.PutUint32(data[0:4], mint.MintAuthorityOption)
+	copy(data[4:36], mint.MintAuthority[:])
+	binary.LittleEndian.PutUint64(data[36:44], mint.Supply)
+	data[44] = mint.Decimals
+	data[45] = mint.IsInitialized
+	binary.LittleEndian.PutUint32(data[46:50], mint.FreezeAuthorityOption)
+	copy(data[50:82], mint.FreezeAuthority[:])
+	return writeExtensions(data, TOKEN_2022_ACCOUNT_TYPE_MINT, encodeMintExtensions(&mint.Extensions)), nil
 }
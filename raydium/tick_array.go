@@ -0,0 +1,218 @@
+package raydium
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+const TICK_ARRAY_SIZE = 60
+
+var ErrTickArrayNotInitialized = errors.New("tick array has no initialized tick")
+
+type TickState struct {
+	Tick                    int32
+	LiquidityNet            *big.Int
+	LiquidityGross          *big.Int
+	FeeGrowthOutsideX64A    *big.Int
+	FeeGrowthOutsideX64B    *big.Int
+	RewardGrowthsOutsideX64 []*big.Int
+}
+
+func (tick *TickState) isInitialized() bool {
+	return tick != nil && tick.LiquidityGross != nil && tick.LiquidityGross.Sign() != 0
+}
+
+type TickArrayState struct {
+	PoolId               solana.PublicKey
+	StartTickIndex       int32
+	Ticks                []*TickState
+	InitializedTickCount uint8
+	RecentEpoch          uint64
+}
+
+func NewTickStateFromBytes(data []byte) (*TickState, error) {
+	if err := checkSize(data, TICK_STATE_SIZE); err != nil {
+		return nil, err
+	}
+
+	rewardGrowthsOutside := make([]*big.Int, 0, 3)
+	for i := 0; i < 3; i++ {
+		rewardGrowthsOutside = append(rewardGrowthsOutside, U128FromBytes([16]byte(data[68+i*16:84+i*16])))
+	}
+	return &TickState{
+		Tick:                    int32(binary.LittleEndian.Uint32(data[0:])),
+		LiquidityNet:            I128FromBytes([16]byte(data[4:20])),
+		LiquidityGross:          U128FromBytes([16]byte(data[20:36])),
+		FeeGrowthOutsideX64A:    U128FromBytes([16]byte(data[36:52])),
+		FeeGrowthOutsideX64B:    U128FromBytes([16]byte(data[52:68])),
+		RewardGrowthsOutsideX64: rewardGrowthsOutside,
+	}, nil
+}
+
+func (tick *TickState) MarshalBinary() ([]byte, error) {
+	if len(tick.RewardGrowthsOutsideX64) > 3 {
+		return nil, fmt.Errorf("tick has %d reward growths, at most 3 fit", len(tick.RewardGrowthsOutsideX64))
+	}
+
+	data := make([]byte, TICK_STATE_SIZE)
+	binary.LittleEndian.PutUint32(data[0:], uint32(tick.Tick))
+	if err := PutI128(data[4:], tick.LiquidityNet); err != nil {
+		return nil, fmt.Errorf("liquidity net: %w", err)
+	}
+	for _, field := range []struct {
+		offset int
+		value  *big.Int
+	}{
+		{20, tick.LiquidityGross},
+		{36, tick.FeeGrowthOutsideX64A},
+		{52, tick.FeeGrowthOutsideX64B},
+	} {
+		if err := PutU128(data[field.offset:], field.value); err != nil {
+			return nil, fmt.Errorf("tick field at offset %d: %w", field.offset, err)
+		}
+	}
+	for i, growth := range tick.RewardGrowthsOutsideX64 {
+		if err := PutU128(data[68+i*16:], growth); err != nil {
+			return nil, fmt.Errorf("reward growth outside %d: %w", i, err)
+		}
+	}
+	return data, nil
+}
+
+func NewTickArrayStateFromBytes(data []byte) (*TickArrayState, error) {
+	if err := checkAnchorAccount(data, TICK_ARRAY_STATE_DISCRIMINATOR, TICK_ARRAY_STATE_SIZE); err != nil {
+		return nil, err
+	}
+
+	ticks := make([]*TickState, 0, TICK_ARRAY_SIZE)
+	for i := 0; i < TICK_ARRAY_SIZE; i++ {
+		tick, err := NewTickStateFromBytes(data[44+i*TICK_STATE_SIZE : 44+(i+1)*TICK_STATE_SIZE])
+		if err != nil {
+			return nil, err
+		}
+		ticks = append(ticks, tick)
+	}
+	return &TickArrayState{
+		PoolId:               solana.PublicKeyFromBytes(data[8:40]),
+		StartTickIndex:       int32(binary.LittleEndian.Uint32(data[40:])),
+		Ticks:                ticks,
+		InitializedTickCount: data[10124],
+		RecentEpoch:          binary.LittleEndian.Uint64(data[10125:]),
+	}, nil
+}
+
+func (tickArray *TickArrayState) UnmarshalBinary(data []byte) error {
+	decoded, err := NewTickArrayStateFromBytes(data)
+	if err != nil {
+		return err
+	}
+	*tickArray = *decoded
+	return nil
+}
+
+func (tickArray *TickArrayState) MarshalBinary() ([]byte, error) {
+	if len(tickArray.Ticks) > TICK_ARRAY_SIZE {
+		return nil, fmt.Errorf("tick array has %d ticks, at most %d fit", len(tickArray.Ticks), TICK_ARRAY_SIZE)
+	}
+
+	data := make([]byte, TICK_ARRAY_STATE_SIZE)
+	copy(data[0:8], TICK_ARRAY_STATE_DISCRIMINATOR[:])
+	copy(data[8:40], tickArray.PoolId[:])
+	binary.LittleEndian.PutUint32(data[40:], uint32(tickArray.StartTickIndex))
+	for i, tick := range tickArray.Ticks {
+		if tick == nil {
+			continue
+		}
+		encoded, err := tick.MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("tick %d: %w", i, err)
+		}
+		copy(data[44+i*TICK_STATE_SIZE:], encoded)
+	}
+	data[10124] = tickArray.InitializedTickCount
+	binary.LittleEndian.PutUint64(data[10125:], tickArray.RecentEpoch)
+	return data, nil
+}
+
+func tickCount(tickSpacing uint16) int32 {
+	return TICK_ARRAY_SIZE * int32(tickSpacing)
+}
+
+// getArrayStartIndex returns the start tick of the array containing tickIndex.
+func getArrayStartIndex(tickIndex int32, tickSpacing uint16) int32 {
+	ticksInArray := tickCount(tickSpacing)
+	start := tickIndex / ticksInArray
+	if tickIndex < 0 && tickIndex%ticksInArray != 0 {
+		start--
+	}
+	return start * ticksInArray
+}
+
+// nextInitializedTick searches this array from currentTick in the swap
+// direction. It returns nil when currentTick is not in the array or no
+// initialized tick is left.
+func (tickArray *TickArrayState) nextInitializedTick(currentTick int32, tickSpacing uint16, zeroForOne bool) *TickState {
+	if getArrayStartIndex(currentTick, tickSpacing) != tickArray.StartTickIndex {
+		return nil
+	}
+	offset := int((currentTick - tickArray.StartTickIndex) / int32(tickSpacing))
+	if zeroForOne {
+		for ; offset >= 0; offset-- {
+			if tickArray.tick(offset).isInitialized() {
+				return tickArray.Ticks[offset]
+			}
+		}
+		return nil
+	}
+	for offset++; offset < TICK_ARRAY_SIZE; offset++ {
+		if tickArray.tick(offset).isInitialized() {
+			return tickArray.Ticks[offset]
+		}
+	}
+	return nil
+}
+
+// firstInitializedTick is the first initialized tick met when entering the
+// array in the swap direction.
+func (tickArray *TickArrayState) firstInitializedTick(zeroForOne bool) (*TickState, error) {
+	if zeroForOne {
+		for i := TICK_ARRAY_SIZE - 1; i >= 0; i-- {
+			if tickArray.tick(i).isInitialized() {
+				return tickArray.Ticks[i], nil
+			}
+		}
+	} else {
+		for i := 0; i < TICK_ARRAY_SIZE; i++ {
+			if tickArray.tick(i).isInitialized() {
+				return tickArray.Ticks[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: start index %d", ErrTickArrayNotInitialized, tickArray.StartTickIndex)
+}
+
+func (tickArray *TickArrayState) tick(offset int) *TickState {
+	if offset >= len(tickArray.Ticks) {
+		return nil
+	}
+	return tickArray.Ticks[offset]
+}
+
+// GetPdaTickArrayAddress derives the tick array account starting at startIndex.
+func GetPdaTickArrayAddress(programId, poolId solana.PublicKey, startIndex int32) solana.PublicKey {
+	index := make([]byte, 4)
+	binary.BigEndian.PutUint32(index, uint32(startIndex))
+	publicKey, _, _ := solana.FindProgramAddress(
+		[][]byte{
+			[]byte("tick_array"),
+			poolId.Bytes(),
+			index,
+		},
+		programId,
+	)
+	return publicKey
+}
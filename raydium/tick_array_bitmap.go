@@ -1,23 +1,39 @@
 package raydium
 
 import (
-	"unsafe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
 
 	"github.com/gagliardetto/solana-go"
 )
 
+// Tick arrays tracked by one 512-bit bitmap; the pool holds a 1024-bit bitmap
+// centred on tick 0 and the extension account 14 more per side.
+const (
+	TICK_ARRAY_BITMAP_SIZE           = 512
+	EXTENSION_TICK_ARRAY_BITMAP_SIZE = 14
+)
+
+var ErrMissingTickArrayBitmapExtension = errors.New("tick array bitmap extension required")
+
 type TickArrayBitmap struct {
 	PoolId                  solana.PublicKey `json:"poolId"`
 	PositiveTickArrayBitmap [][]uint64       `json:"positiveTickArrayBitmap"`
 	NegativeTickArrayBitmap [][]uint64       `json:"negativeTickArrayBitmap"`
 }
 
-func NewTickArrayBitmapFromBytes(data []byte) *TickArrayBitmap {
+func NewTickArrayBitmapFromBytes(data []byte) (*TickArrayBitmap, error) {
+	if err := checkAnchorAccount(data, TICK_ARRAY_BITMAP_EXTENSION_DISCRIMINATOR, TICK_ARRAY_BITMAP_EXTENSION_SIZE); err != nil {
+		return nil, err
+	}
+
 	positiveTickArrayBitmap := make([][]uint64, 0, 14)
 	for i := 0; i < 14; i++ {
 		row := make([]uint64, 0, 8)
 		for j := 0; j < 8; j++ {
-			row = append(row, *(*uint64)(unsafe.Pointer(&data[40+i*64+j*8])))
+			row = append(row, binary.LittleEndian.Uint64(data[40+i*64+j*8:]))
 		}
 		positiveTickArrayBitmap = append(positiveTickArrayBitmap, row)
 	}
@@ -25,7 +41,7 @@ func NewTickArrayBitmapFromBytes(data []byte) *TickArrayBitmap {
 	for i := 0; i < 14; i++ {
 		row := make([]uint64, 0, 8)
 		for j := 0; j < 8; j++ {
-			row = append(row, *(*uint64)(unsafe.Pointer(&data[936+i*64+j*8])))
+			row = append(row, binary.LittleEndian.Uint64(data[936+i*64+j*8:]))
 		}
 		negativeTickArrayBitmap = append(negativeTickArrayBitmap, row)
 	}
@@ -34,5 +50,296 @@ func NewTickArrayBitmapFromBytes(data []byte) *TickArrayBitmap {
 		PoolId:                  solana.PublicKeyFromBytes(data[8:40]),
 		PositiveTickArrayBitmap: positiveTickArrayBitmap,
 		NegativeTickArrayBitmap: negativeTickArrayBitmap,
+	}, nil
+}
+
+func (bitmap *TickArrayBitmap) UnmarshalBinary(data []byte) error {
+	decoded, err := NewTickArrayBitmapFromBytes(data)
+	if err != nil {
+		return err
+	}
+	*bitmap = *decoded
+	return nil
+}
+
+func (bitmap *TickArrayBitmap) MarshalBinary() ([]byte, error) {
+	if len(bitmap.PositiveTickArrayBitmap) > 14 || len(bitmap.NegativeTickArrayBitmap) > 14 {
+		return nil, fmt.Errorf("tick array bitmap has more than 14 rows")
+	}
+
+	data := make([]byte, TICK_ARRAY_BITMAP_EXTENSION_SIZE)
+	copy(data[0:8], TICK_ARRAY_BITMAP_EXTENSION_DISCRIMINATOR[:])
+	copy(data[8:40], bitmap.PoolId[:])
+	for i, row := range bitmap.PositiveTickArrayBitmap {
+		if len(row) > 8 {
+			return nil, fmt.Errorf("tick array bitmap row %d has more than 8 words", i)
+		}
+		for j, word := range row {
+			binary.LittleEndian.PutUint64(data[40+i*64+j*8:], word)
+		}
+	}
+	for i, row := range bitmap.NegativeTickArrayBitmap {
+		if len(row) > 8 {
+			return nil, fmt.Errorf("tick array bitmap row %d has more than 8 words", i)
+		}
+		for j, word := range row {
+			binary.LittleEndian.PutUint64(data[936+i*64+j*8:], word)
+		}
+	}
+	return data, nil
+}
+
+func maxTickInTickArrayBitmap(tickSpacing uint16) int32 {
+	return int32(tickSpacing) * TICK_ARRAY_SIZE * TICK_ARRAY_BITMAP_SIZE
+}
+
+// getBitmapTickBoundary returns the tick range covered by the 512-bit bitmap
+// that contains tickArrayStartIndex.
+func getBitmapTickBoundary(tickArrayStartIndex int32, tickSpacing uint16) (int32, int32) {
+	ticksInOneBitmap := maxTickInTickArrayBitmap(tickSpacing)
+	m := abs32(tickArrayStartIndex) / ticksInOneBitmap
+	if tickArrayStartIndex < 0 && abs32(tickArrayStartIndex)%ticksInOneBitmap != 0 {
+		m++
+	}
+	minValue := ticksInOneBitmap * m
+	if tickArrayStartIndex < 0 {
+		return -minValue, -minValue + ticksInOneBitmap
+	}
+	return minValue, minValue + ticksInOneBitmap
+}
+
+// tickArrayStartIndexRange is the range of start indexes tracked by the
+// pool's own bitmap.
+func tickArrayStartIndexRange(tickSpacing uint16) (int32, int32) {
+	maxTickBoundary := maxTickInTickArrayBitmap(tickSpacing)
+	minTickBoundary := -maxTickBoundary
+	if maxTickBoundary > MAX_TICK {
+		maxTickBoundary = getArrayStartIndex(MAX_TICK, tickSpacing) + tickCount(tickSpacing)
+	}
+	if minTickBoundary < MIN_TICK {
+		minTickBoundary = getArrayStartIndex(MIN_TICK, tickSpacing)
+	}
+	return minTickBoundary, maxTickBoundary
+}
+
+func isOverflowDefaultTickArrayBitmap(tickIndex int32, tickSpacing uint16) bool {
+	minBoundary, maxBoundary := tickArrayStartIndexRange(tickSpacing)
+	startIndex := getArrayStartIndex(tickIndex, tickSpacing)
+	return startIndex >= maxBoundary || startIndex < minBoundary
+}
+
+func abs32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// wordsToBitmap joins little-endian u64 words into one integer, bit i of the
+// result being bit i%64 of words[i/64].
+func wordsToBitmap(words []uint64) *big.Int {
+	bitmap := new(big.Int)
+	for i := len(words) - 1; i >= 0; i-- {
+		bitmap.Lsh(bitmap, 64)
+		bitmap.Or(bitmap, new(big.Int).SetUint64(words[i]))
+	}
+	return bitmap
+}
+
+// compressedTickArrayIndex is the bit of the pool bitmap for the tick array
+// containing tickIndex.
+func compressedTickArrayIndex(tickIndex int32, tickSpacing uint16) int {
+	multiplier := tickCount(tickSpacing)
+	compressed := tickIndex/multiplier + 512
+	if tickIndex < 0 && tickIndex%multiplier != 0 {
+		compressed--
+	}
+	return int(abs32(compressed))
+}
+
+func checkCurrentTickArrayIsInitialized(bitmap []uint64, tickCurrent int32, tickSpacing uint16) (bool, int32, error) {
+	if tickCurrent < MIN_TICK || tickCurrent > MAX_TICK {
+		return false, 0, fmt.Errorf("%w: %d", ErrTickOutOfRange, tickCurrent)
+	}
+	bitPos := compressedTickArrayIndex(tickCurrent, tickSpacing)
+	startIndex := int32(bitPos-512) * tickCount(tickSpacing)
+	return wordsToBitmap(bitmap).Bit(bitPos) == 1, startIndex, nil
+}
+
+// nextInitializedTickArrayStartIndexInBitmap searches the pool bitmap for the
+// next initialized array after lastTickArrayStartIndex. When none is found it
+// returns the boundary from which the extension search continues.
+func nextInitializedTickArrayStartIndexInBitmap(bitmap []uint64, lastTickArrayStartIndex int32, tickSpacing uint16, zeroForOne bool) (bool, int32) {
+	tickBoundary := maxTickInTickArrayBitmap(tickSpacing)
+	next := lastTickArrayStartIndex + tickCount(tickSpacing)
+	if zeroForOne {
+		next = lastTickArrayStartIndex - tickCount(tickSpacing)
+	}
+	if next < -tickBoundary || next >= tickBoundary {
+		return false, lastTickArrayStartIndex
+	}
+
+	multiplier := tickCount(tickSpacing)
+	bitPos := compressedTickArrayIndex(next, tickSpacing)
+	words := wordsToBitmap(bitmap)
+	if zeroForOne {
+		masked := new(big.Int).And(words, lowBitsMask(bitPos+1))
+		if masked.Sign() == 0 {
+			return false, -tickBoundary
+		}
+		return true, int32(masked.BitLen()-1-512) * multiplier
+	}
+	shifted := new(big.Int).Rsh(words, uint(bitPos))
+	if shifted.Sign() == 0 {
+		return false, tickBoundary - tickCount(tickSpacing)
+	}
+	return true, int32(bitPos+int(shifted.TrailingZeroBits())-512) * multiplier
+}
+
+func lowBitsMask(n int) *big.Int {
+	mask := new(big.Int).Lsh(big.NewInt(1), uint(n))
+	return mask.Sub(mask, big.NewInt(1))
+}
+
+func checkExtensionBoundary(tickIndex int32, tickSpacing uint16) error {
+	positiveTickBoundary := maxTickInTickArrayBitmap(tickSpacing)
+	if tickIndex >= -positiveTickBoundary && tickIndex < positiveTickBoundary {
+		return fmt.Errorf("tick %d is tracked by the pool bitmap, not the extension", tickIndex)
+	}
+	return nil
+}
+
+func (bitmap *TickArrayBitmap) row(tickArrayStartIndex int32, tickSpacing uint16) ([]uint64, error) {
+	if err := checkExtensionBoundary(tickArrayStartIndex, tickSpacing); err != nil {
+		return nil, err
+	}
+	ticksInOneBitmap := maxTickInTickArrayBitmap(tickSpacing)
+	offset := abs32(tickArrayStartIndex)/ticksInOneBitmap - 1
+	if tickArrayStartIndex < 0 && abs32(tickArrayStartIndex)%ticksInOneBitmap == 0 {
+		offset--
+	}
+
+	rows := bitmap.PositiveTickArrayBitmap
+	if tickArrayStartIndex < 0 {
+		rows = bitmap.NegativeTickArrayBitmap
+	}
+	if offset < 0 || offset >= EXTENSION_TICK_ARRAY_BITMAP_SIZE {
+		return nil, fmt.Errorf("%w: start index %d outside the extension bitmap", ErrTickOutOfRange, tickArrayStartIndex)
+	}
+	if int(offset) >= len(rows) {
+		return nil, nil
+	}
+	return rows[offset], nil
+}
+
+// tickArrayOffsetInBitmap is the bit for tickArrayStartIndex in its extension
+// row. Negative rows are stored so that higher bits are closer to tick 0.
+func tickArrayOffsetInBitmap(tickArrayStartIndex int32, tickSpacing uint16) int {
+	m := abs32(tickArrayStartIndex) % maxTickInTickArrayBitmap(tickSpacing)
+	offset := m / tickCount(tickSpacing)
+	if tickArrayStartIndex < 0 && m != 0 {
+		offset = TICK_ARRAY_BITMAP_SIZE - offset
+	}
+	return int(offset)
+}
+
+func (bitmap *TickArrayBitmap) checkTickArrayIsInitialized(tickArrayStartIndex int32, tickSpacing uint16) (bool, error) {
+	row, err := bitmap.row(tickArrayStartIndex, tickSpacing)
+	if err != nil {
+		return false, err
+	}
+	return wordsToBitmap(row).Bit(tickArrayOffsetInBitmap(tickArrayStartIndex, tickSpacing)) == 1, nil
+}
+
+func (bitmap *TickArrayBitmap) nextInitializedTickArrayFromOneBitmap(lastTickArrayStartIndex int32, tickSpacing uint16, zeroForOne bool) (bool, int32, error) {
+	multiplier := tickCount(tickSpacing)
+	next := lastTickArrayStartIndex + multiplier
+	if zeroForOne {
+		next = lastTickArrayStartIndex - multiplier
+	}
+	if next < getArrayStartIndex(MIN_TICK, tickSpacing) || next > getArrayStartIndex(MAX_TICK, tickSpacing) {
+		return false, next, nil
+	}
+
+	row, err := bitmap.row(next, tickSpacing)
+	if err != nil {
+		return false, 0, err
+	}
+	minBoundary, maxBoundary := getBitmapTickBoundary(next, tickSpacing)
+	offset := tickArrayOffsetInBitmap(next, tickSpacing)
+	words := wordsToBitmap(row)
+	if zeroForOne {
+		masked := new(big.Int).And(words, lowBitsMask(offset+1))
+		if masked.Sign() == 0 {
+			return false, minBoundary, nil
+		}
+		return true, next - int32(offset-(masked.BitLen()-1))*multiplier, nil
+	}
+	shifted := new(big.Int).Rsh(words, uint(offset))
+	if shifted.Sign() == 0 {
+		return false, maxBoundary - multiplier, nil
+	}
+	return true, next + int32(shifted.TrailingZeroBits())*multiplier, nil
+}
+
+// firstInitializedTickArray returns the start index of the tick array a swap
+// begins in, and whether it is the array holding the pool's current tick.
+func firstInitializedTickArray(pool *PoolInfoLayout, exBitmap *TickArrayBitmap, zeroForOne bool) (bool, int32, error) {
+	var (
+		initialized bool
+		startIndex  int32
+		err         error
+	)
+	if isOverflowDefaultTickArrayBitmap(pool.TickCurrent, pool.TickSpacing) {
+		if exBitmap == nil {
+			return false, 0, ErrMissingTickArrayBitmapExtension
+		}
+		startIndex = getArrayStartIndex(pool.TickCurrent, pool.TickSpacing)
+		initialized, err = exBitmap.checkTickArrayIsInitialized(startIndex, pool.TickSpacing)
+	} else {
+		initialized, startIndex, err = checkCurrentTickArrayIsInitialized(pool.TickArrayBitmap, pool.TickCurrent, pool.TickSpacing)
+	}
+	if err != nil {
+		return false, 0, err
+	}
+	if initialized {
+		return true, startIndex, nil
+	}
+
+	next, found, err := nextInitializedTickArrayStartIndex(pool, exBitmap, getArrayStartIndex(pool.TickCurrent, pool.TickSpacing), zeroForOne)
+	if err != nil {
+		return false, 0, err
+	}
+	if !found {
+		return false, 0, ErrInsufficientLiquidity
+	}
+	return false, next, nil
+}
+
+// nextInitializedTickArrayStartIndex walks the pool bitmap and then the
+// extension until it finds the next initialized tick array.
+func nextInitializedTickArrayStartIndex(pool *PoolInfoLayout, exBitmap *TickArrayBitmap, lastTickArrayStartIndex int32, zeroForOne bool) (int32, bool, error) {
+	last := getArrayStartIndex(lastTickArrayStartIndex, pool.TickSpacing)
+	for {
+		found, startIndex := nextInitializedTickArrayStartIndexInBitmap(pool.TickArrayBitmap, last, pool.TickSpacing, zeroForOne)
+		if found {
+			return startIndex, true, nil
+		}
+		last = startIndex
+		if exBitmap == nil {
+			return 0, false, ErrMissingTickArrayBitmapExtension
+		}
+
+		found, startIndex, err := exBitmap.nextInitializedTickArrayFromOneBitmap(last, pool.TickSpacing, zeroForOne)
+		if err != nil {
+			return 0, false, err
+		}
+		if found {
+			return startIndex, true, nil
+		}
+		last = startIndex
+		if last < MIN_TICK || last > MAX_TICK {
+			return 0, false, nil
+		}
 	}
 }
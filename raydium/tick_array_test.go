@@ -0,0 +1,141 @@
+package raydium
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+func TestTickArrayStateRoundTrip(t *testing.T) {
+	data := randomAccountData(9, TICK_ARRAY_STATE_SIZE)
+	copy(data, TICK_ARRAY_STATE_DISCRIMINATOR[:])
+
+	tickArray, err := NewTickArrayStateFromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := tickArray.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Tick padding is not kept, so compare everything else.
+	for i := 0; i < TICK_ARRAY_SIZE; i++ {
+		clear(data[44+i*TICK_STATE_SIZE+116 : 44+(i+1)*TICK_STATE_SIZE])
+	}
+	clear(data[10133:])
+	if string(encoded) != string(data) {
+		t.Error("round trip differs")
+	}
+}
+
+func TestNewTickStateFromBytes(t *testing.T) {
+	tick := &TickState{
+		Tick:                    -887,
+		LiquidityNet:            big.NewInt(-5_000_000),
+		LiquidityGross:          big.NewInt(5_000_000),
+		FeeGrowthOutsideX64A:    new(big.Int).Lsh(big.NewInt(3), 100),
+		FeeGrowthOutsideX64B:    big.NewInt(1),
+		RewardGrowthsOutsideX64: []*big.Int{big.NewInt(7), nil, big.NewInt(9)},
+	}
+	data, err := tick.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int32(binary.LittleEndian.Uint32(data)) != -887 {
+		t.Errorf("tick index not little endian: %v", data[:4])
+	}
+
+	decoded, err := NewTickStateFromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Tick != tick.Tick || decoded.LiquidityNet.Cmp(tick.LiquidityNet) != 0 || decoded.FeeGrowthOutsideX64A.Cmp(tick.FeeGrowthOutsideX64A) != 0 {
+		t.Errorf("got %+v", decoded)
+	}
+	if decoded.RewardGrowthsOutsideX64[1].Sign() != 0 || decoded.RewardGrowthsOutsideX64[2].Int64() != 9 {
+		t.Errorf("reward growths: got %v", decoded.RewardGrowthsOutsideX64)
+	}
+}
+
+func TestGetInitializedTickArrayStartIndexes(t *testing.T) {
+	pool := clmmSwapFixture()
+
+	cases := []struct {
+		tickCurrent int32
+		count       int
+		want        []int32
+	}{
+		{0, 1, []int32{-600, 0}},
+		{0, 5, []int32{-1200, -600, 0}},
+		{-700, 1, []int32{-1200, -600}},
+		{-1300, 1, []int32{-1200}},
+	}
+	for _, c := range cases {
+		pool.State.TickCurrent = c.tickCurrent
+		got, err := GetInitializedTickArrayStartIndexes(pool.State, pool.ExBitmap, c.count)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(c.want) {
+			t.Errorf("tick %d count %d: got %v, want %v", c.tickCurrent, c.count, got, c.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("tick %d count %d: got %v, want %v", c.tickCurrent, c.count, got, c.want)
+				break
+			}
+		}
+	}
+}
+
+func TestLoadClmmPool(t *testing.T) {
+	fixture := clmmSwapFixture()
+	fixture.State.AmmConfig = testPublicKey("amm config")
+
+	ammConfig := make([]byte, AMM_CONFIG_SIZE)
+	copy(ammConfig, AMM_CONFIG_DISCRIMINATOR[:])
+	binary.LittleEndian.PutUint32(ammConfig[47:], fixture.AmmConfig.TradeFeeRate)
+	binary.LittleEndian.PutUint16(ammConfig[51:], fixture.State.TickSpacing)
+
+	accounts := map[solana.PublicKey]stubAccount{
+		fixture.Id:              {CLMM_PROGRAM_ID, mustMarshal(t, fixture.State)},
+		fixture.State.AmmConfig: {CLMM_PROGRAM_ID, ammConfig},
+		fixture.State.MintA:     {TOKEN_PROGRAM_ID, mustMarshal(t, &SplMint{Decimals: 9, IsInitialized: 1})},
+		fixture.State.MintB:     {TOKEN_PROGRAM_ID, mustMarshal(t, &SplMint{Decimals: 6, IsInitialized: 1})},
+	}
+	for startIndex, tickArray := range fixture.TickArrays {
+		tickArray.PoolId = fixture.Id
+		accounts[GetPdaTickArrayAddress(CLMM_PROGRAM_ID, fixture.Id, startIndex)] = stubAccount{CLMM_PROGRAM_ID, mustMarshal(t, tickArray)}
+	}
+	pool, err := LoadClmmPool(context.Background(), newTestFetcher(accounts, nil), fixture.Id, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.ExBitmap != nil {
+		t.Error("expected no bitmap extension")
+	}
+	if pool.MintInfoA == nil || pool.MintInfoA.Decimals != 9 || pool.MintInfoB == nil || pool.MintInfoB.Decimals != 6 {
+		t.Errorf("got mints %+v and %+v", pool.MintInfoA, pool.MintInfoB)
+	}
+	if len(pool.TickArrays) != 3 {
+		t.Errorf("got %d tick arrays, want 3", len(pool.TickArrays))
+	}
+
+	accounts[fixture.Id] = stubAccount{testPublicKey("other program"), accounts[fixture.Id].data}
+	if _, err := LoadClmmPool(context.Background(), newTestFetcher(accounts, nil), fixture.Id, 2); !errors.Is(err, ErrWrongOwner) {
+		t.Errorf("got %v, want ErrWrongOwner", err)
+	}
+
+	result, err := ComputeClmmAmountOut(context.Background(), pool, pool.State.MintA, big.NewInt(8_000_000_000), onePercent, nil, testClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.AmountOut.Int64() != 7_921_142_746 {
+		t.Errorf("amount out: got %v, want 7921142746", result.AmountOut)
+	}
+}
@@ -1,11 +1,31 @@
 package raydium
 
-import "github.com/gagliardetto/solana-go"
+import (
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+)
 
 var (
-	TOKEN_PROGRAM_ID = solana.MustPublicKeyFromBase58("TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA")
+	TOKEN_PROGRAM_ID            = solana.MustPublicKeyFromBase58("TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA")
+	TOKEN_2022_PROGRAM_ID       = solana.MustPublicKeyFromBase58("TokenzQdBNbLqP5VEhdkAS6EHFLC1PHnBqCXEpPxuEb")
+	ASSOCIATED_TOKEN_PROGRAM_ID = solana.MustPublicKeyFromBase58("ATokenGPvbdGVxr1b2hvZbsiqW5xWH25efTNsLJA8knL")
+	SYSVAR_RENT_PUBKEY          = solana.MustPublicKeyFromBase58("SysvarRent111111111111111111111111111111111")
+	// WSOL_MINT wraps SOL under Token and WSOL_2022_MINT under Token-2022.
+	WSOL_MINT      = solana.MustPublicKeyFromBase58("So11111111111111111111111111111111111111112")
+	WSOL_2022_MINT = solana.MustPublicKeyFromBase58("9pan9bMn5HatX4EJdBwg9VgCa7Uz5HL8N1m5D3NdXejP")
 )
 
+// Token program instruction tags, shared by Token-2022.
+const (
+	TOKEN_INSTRUCTION_CLOSE_ACCOUNT       = 9
+	TOKEN_INSTRUCTION_SYNC_NATIVE         = 17
+	TOKEN_INSTRUCTION_INITIALIZE_ACCOUNT3 = 18
+)
+
+// Associated token program instruction tags.
+const ASSOCIATED_TOKEN_INSTRUCTION_CREATE_IDEMPOTENT = 1
+
 type Token struct {
 	ProgramId solana.PublicKey
 	Mint      solana.PublicKey
@@ -13,3 +33,77 @@ type Token struct {
 	Symbol    string
 	Name      string
 }
+
+// GetAssociatedTokenAddress derives owner's associated account for mint
+// under tokenProgramId, either Token or Token-2022.
+func GetAssociatedTokenAddress(owner, mint, tokenProgramId solana.PublicKey) (solana.PublicKey, error) {
+	address, _, err := solana.FindProgramAddress([][]byte{
+		owner.Bytes(),
+		tokenProgramId.Bytes(),
+		mint.Bytes(),
+	}, ASSOCIATED_TOKEN_PROGRAM_ID)
+	return address, err
+}
+
+// IsWrappedSol reports whether mint is the native mint of tokenProgramId.
+func IsWrappedSol(mint, tokenProgramId solana.PublicKey) bool {
+	return mint.Equals(WSOL_MINT) && tokenProgramId.Equals(TOKEN_PROGRAM_ID) ||
+		mint.Equals(WSOL_2022_MINT) && tokenProgramId.Equals(TOKEN_2022_PROGRAM_ID)
+}
+
+func checkTokenProgram(tokenProgramId solana.PublicKey) error {
+	if !tokenProgramId.Equals(TOKEN_PROGRAM_ID) && !tokenProgramId.Equals(TOKEN_2022_PROGRAM_ID) {
+		return fmt.Errorf("%v is not a token program", tokenProgramId)
+	}
+	return nil
+}
+
+// NewCreateAssociatedTokenAccountIdempotentInstruction creates owner's
+// associated account for mint unless it already exists.
+func NewCreateAssociatedTokenAccountIdempotentInstruction(payer, owner, mint, tokenProgramId solana.PublicKey) (solana.Instruction, error) {
+	if err := checkTokenProgram(tokenProgramId); err != nil {
+		return nil, err
+	}
+	account, err := GetAssociatedTokenAddress(owner, mint, tokenProgramId)
+	if err != nil {
+		return nil, err
+	}
+	return solana.NewInstruction(ASSOCIATED_TOKEN_PROGRAM_ID, solana.AccountMetaSlice{
+		solana.Meta(payer).WRITE().SIGNER(),
+		solana.Meta(account).WRITE(),
+		solana.Meta(owner),
+		solana.Meta(mint),
+		solana.Meta(solana.SystemProgramID),
+		solana.Meta(tokenProgramId),
+	}, []byte{ASSOCIATED_TOKEN_INSTRUCTION_CREATE_IDEMPOTENT}), nil
+}
+
+// NewInitializeAccount3Instruction initializes account, already allocated
+// and owned by tokenProgramId, as owner's account for mint.
+func NewInitializeAccount3Instruction(account, mint, owner, tokenProgramId solana.PublicKey) solana.Instruction {
+	w := newLayoutWriter(33, 0)
+	w.u8(TOKEN_INSTRUCTION_INITIALIZE_ACCOUNT3)
+	w.bytes(owner.Bytes())
+	return solana.NewInstruction(tokenProgramId, solana.AccountMetaSlice{
+		solana.Meta(account).WRITE(),
+		solana.Meta(mint),
+	}, w.data)
+}
+
+// NewSyncNativeInstruction updates the token amount of a wrapped SOL
+// account to its lamports above rent exemption.
+func NewSyncNativeInstruction(account, tokenProgramId solana.PublicKey) solana.Instruction {
+	return solana.NewInstruction(tokenProgramId, solana.AccountMetaSlice{
+		solana.Meta(account).WRITE(),
+	}, []byte{TOKEN_INSTRUCTION_SYNC_NATIVE})
+}
+
+// NewCloseAccountInstruction closes account, sending its lamports, and so
+// any wrapped SOL, to destination.
+func NewCloseAccountInstruction(account, destination, owner, tokenProgramId solana.PublicKey) solana.Instruction {
+	return solana.NewInstruction(tokenProgramId, solana.AccountMetaSlice{
+		solana.Meta(account).WRITE(),
+		solana.Meta(destination).WRITE(),
+		solana.Meta(owner).SIGNER(),
+	}, []byte{TOKEN_INSTRUCTION_CLOSE_ACCOUNT})
+}
@@ -0,0 +1,321 @@
+package raydium
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// Token-2022 accounts with extensions store their AccountType right after
+// the base layout, SPL_ACCOUNT_SIZE bytes in for both kinds, followed by
+// type-length-value extensions.
+const (
+	TOKEN_2022_ACCOUNT_TYPE_MINT    = 1
+	TOKEN_2022_ACCOUNT_TYPE_ACCOUNT = 2
+)
+
+// Token-2022 extension types this package decodes.
+const (
+	EXTENSION_TYPE_UNINITIALIZED            = 0
+	EXTENSION_TYPE_TRANSFER_FEE_CONFIG      = 1
+	EXTENSION_TYPE_TRANSFER_FEE_AMOUNT      = 2
+	EXTENSION_TYPE_NON_TRANSFERABLE         = 9
+	EXTENSION_TYPE_INTEREST_BEARING_CONFIG  = 10
+	EXTENSION_TYPE_NON_TRANSFERABLE_ACCOUNT = 13
+	EXTENSION_TYPE_TRANSFER_HOOK            = 14
+	EXTENSION_TYPE_TRANSFER_HOOK_ACCOUNT    = 15
+)
+
+const (
+	TRANSFER_FEE_CONFIG_SIZE     = 108
+	INTEREST_BEARING_CONFIG_SIZE = 52
+	TRANSFER_HOOK_SIZE           = 64
+	MAX_FEE_BASIS_POINTS         = 10_000
+)
+
+var (
+	ErrInvalidTokenExtension = errors.New("invalid token extension")
+	ErrUnsupportedMint       = errors.New("mint extensions not supported by the pool program")
+)
+
+type TransferFee struct {
+	Epoch                  uint64 `json:"epoch"`
+	MaximumFee             uint64 `json:"maximumFee"`
+	TransferFeeBasisPoints uint16 `json:"transferFeeBasisPoints"`
+}
+
+// Fee is the amount withheld from a transfer of preFeeAmount.
+func (fee *TransferFee) Fee(preFeeAmount *big.Int) *big.Int {
+	if fee.TransferFeeBasisPoints == 0 || preFeeAmount.Sign() == 0 {
+		return new(big.Int)
+	}
+	amount := new(big.Int).Mul(preFeeAmount, big.NewInt(int64(fee.TransferFeeBasisPoints)))
+	amount = divRoundingUp(amount, big.NewInt(MAX_FEE_BASIS_POINTS))
+	if maximumFee := new(big.Int).SetUint64(fee.MaximumFee); amount.Cmp(maximumFee) > 0 {
+		return maximumFee
+	}
+	return amount
+}
+
+// InverseFee is the amount withheld from the transfer that delivers
+// postFeeAmount, so that sending postFeeAmount plus it nets postFeeAmount.
+func (fee *TransferFee) InverseFee(postFeeAmount *big.Int) *big.Int {
+	maximumFee := new(big.Int).SetUint64(fee.MaximumFee)
+	switch {
+	case fee.TransferFeeBasisPoints == 0 || postFeeAmount.Sign() == 0:
+		return new(big.Int)
+	case fee.TransferFeeBasisPoints >= MAX_FEE_BASIS_POINTS:
+		return maximumFee
+	}
+	preFeeAmount := new(big.Int).Mul(postFeeAmount, big.NewInt(MAX_FEE_BASIS_POINTS))
+	preFeeAmount = divRoundingUp(preFeeAmount, big.NewInt(int64(MAX_FEE_BASIS_POINTS-fee.TransferFeeBasisPoints)))
+	if new(big.Int).Sub(preFeeAmount, postFeeAmount).Cmp(maximumFee) >= 0 {
+		return maximumFee
+	}
+	return fee.Fee(preFeeAmount)
+}
+
+type TransferFeeConfig struct {
+	TransferFeeConfigAuthority solana.PublicKey `json:"transferFeeConfigAuthority"`
+	WithdrawWithheldAuthority  solana.PublicKey `json:"withdrawWithheldAuthority"`
+	WithheldAmount             uint64           `json:"withheldAmount"`
+	OlderTransferFee           TransferFee      `json:"olderTransferFee"`
+	NewerTransferFee           TransferFee      `json:"newerTransferFee"`
+}
+
+// EpochFee is the transfer fee in force during epoch.
+func (config *TransferFeeConfig) EpochFee(epoch uint64) *TransferFee {
+	if epoch >= config.NewerTransferFee.Epoch {
+		return &config.NewerTransferFee
+	}
+	return &config.OlderTransferFee
+}
+
+// InterestBearingConfig makes the UI amount of a mint accrue interest at
+// CurrentRate basis points a year; raw amounts are unaffected.
+type InterestBearingConfig struct {
+	RateAuthority           solana.PublicKey `json:"rateAuthority"`
+	InitializationTimestamp int64            `json:"initializationTimestamp"`
+	PreUpdateAverageRate    int16            `json:"preUpdateAverageRate"`
+	LastUpdateTimestamp     int64            `json:"lastUpdateTimestamp"`
+	CurrentRate             int16            `json:"currentRate"`
+}
+
+// TransferHook makes every transfer of a mint invoke ProgramId.
+type TransferHook struct {
+	Authority solana.PublicKey `json:"authority"`
+	ProgramId solana.PublicKey `json:"programId"`
+}
+
+// MintExtensions are the Token-2022 mint extensions that change how a mint
+// transfers; nil and false when absent.
+type MintExtensions struct {
+	TransferFeeConfig     *TransferFeeConfig     `json:"transferFeeConfig,omitempty"`
+	InterestBearingConfig *InterestBearingConfig `json:"interestBearingConfig,omitempty"`
+	TransferHook          *TransferHook          `json:"transferHook,omitempty"`
+	NonTransferable       bool                   `json:"nonTransferable,omitempty"`
+}
+
+// TransferFee is the fee of a transfer during epoch, nil if the mint has
+// none.
+func (extensions *MintExtensions) TransferFee(epoch uint64) *TransferFee {
+	if extensions == nil || extensions.TransferFeeConfig == nil {
+		return nil
+	}
+	return extensions.TransferFeeConfig.EpochFee(epoch)
+}
+
+// AccountExtensions are the account counterparts of MintExtensions.
+type AccountExtensions struct {
+	// WithheldAmount is set for accounts of transfer fee mints.
+	WithheldAmount  *uint64
+	NonTransferable bool
+	// TransferHookTransferring is set for accounts of transfer hook mints.
+	TransferHookTransferring *bool
+}
+
+func decodeMintExtensions(data []byte) (MintExtensions, error) {
+	var extensions MintExtensions
+	entries, err := readExtensions(data, SPL_MINT_SIZE, TOKEN_2022_ACCOUNT_TYPE_MINT)
+	if err != nil {
+		return extensions, err
+	}
+	for _, entry := range entries {
+		r := newLayoutReader(entry.value, 0)
+		switch entry.kind {
+		case EXTENSION_TYPE_TRANSFER_FEE_CONFIG:
+			if err := checkExtensionSize(entry, TRANSFER_FEE_CONFIG_SIZE); err != nil {
+				return extensions, err
+			}
+			config := &TransferFeeConfig{
+				TransferFeeConfigAuthority: r.publicKey(),
+				WithdrawWithheldAuthority:  r.publicKey(),
+				WithheldAmount:             r.u64(),
+			}
+			for _, fee := range []*TransferFee{&config.OlderTransferFee, &config.NewerTransferFee} {
+				fee.Epoch, fee.MaximumFee, fee.TransferFeeBasisPoints = r.u64(), r.u64(), r.u16()
+			}
+			extensions.TransferFeeConfig = config
+		case EXTENSION_TYPE_INTEREST_BEARING_CONFIG:
+			if err := checkExtensionSize(entry, INTEREST_BEARING_CONFIG_SIZE); err != nil {
+				return extensions, err
+			}
+			extensions.InterestBearingConfig = &InterestBearingConfig{
+				RateAuthority:           r.publicKey(),
+				InitializationTimestamp: int64(r.u64()),
+				PreUpdateAverageRate:    int16(r.u16()),
+				LastUpdateTimestamp:     int64(r.u64()),
+				CurrentRate:             int16(r.u16()),
+			}
+		case EXTENSION_TYPE_TRANSFER_HOOK:
+			if err := checkExtensionSize(entry, TRANSFER_HOOK_SIZE); err != nil {
+				return extensions, err
+			}
+			extensions.TransferHook = &TransferHook{Authority: r.publicKey(), ProgramId: r.publicKey()}
+		case EXTENSION_TYPE_NON_TRANSFERABLE:
+			extensions.NonTransferable = true
+		}
+	}
+	return extensions, nil
+}
+
+func decodeAccountExtensions(data []byte) (AccountExtensions, error) {
+	var extensions AccountExtensions
+	entries, err := readExtensions(data, SPL_ACCOUNT_SIZE, TOKEN_2022_ACCOUNT_TYPE_ACCOUNT)
+	if err != nil {
+		return extensions, err
+	}
+	for _, entry := range entries {
+		switch entry.kind {
+		case EXTENSION_TYPE_TRANSFER_FEE_AMOUNT:
+			if err := checkExtensionSize(entry, 8); err != nil {
+				return extensions, err
+			}
+			withheld := binary.LittleEndian.Uint64(entry.value)
+			extensions.WithheldAmount = &withheld
+		case EXTENSION_TYPE_TRANSFER_HOOK_ACCOUNT:
+			if err := checkExtensionSize(entry, 1); err != nil {
+				return extensions, err
+			}
+			transferring := entry.value[0] != 0
+			extensions.TransferHookTransferring = &transferring
+		case EXTENSION_TYPE_NON_TRANSFERABLE_ACCOUNT:
+			extensions.NonTransferable = true
+		}
+	}
+	return extensions, nil
+}
+
+func encodeMintExtensions(extensions *MintExtensions) []extensionEntry {
+	var entries []extensionEntry
+	if config := extensions.TransferFeeConfig; config != nil {
+		w := newLayoutWriter(TRANSFER_FEE_CONFIG_SIZE, 0)
+		w.bytes(config.TransferFeeConfigAuthority.Bytes())
+		w.bytes(config.WithdrawWithheldAuthority.Bytes())
+		w.u64(config.WithheldAmount)
+		for _, fee := range []TransferFee{config.OlderTransferFee, config.NewerTransferFee} {
+			w.u64(fee.Epoch)
+			w.u64(fee.MaximumFee)
+			w.u16(fee.TransferFeeBasisPoints)
+		}
+		entries = append(entries, extensionEntry{EXTENSION_TYPE_TRANSFER_FEE_CONFIG, w.data})
+	}
+	if extensions.NonTransferable {
+		entries = append(entries, extensionEntry{EXTENSION_TYPE_NON_TRANSFERABLE, nil})
+	}
+	if config := extensions.InterestBearingConfig; config != nil {
+		w := newLayoutWriter(INTEREST_BEARING_CONFIG_SIZE, 0)
+		w.bytes(config.RateAuthority.Bytes())
+		w.u64(uint64(config.InitializationTimestamp))
+		w.u16(uint16(config.PreUpdateAverageRate))
+		w.u64(uint64(config.LastUpdateTimestamp))
+		w.u16(uint16(config.CurrentRate))
+		entries = append(entries, extensionEntry{EXTENSION_TYPE_INTEREST_BEARING_CONFIG, w.data})
+	}
+	if hook := extensions.TransferHook; hook != nil {
+		w := newLayoutWriter(TRANSFER_HOOK_SIZE, 0)
+		w.bytes(hook.Authority.Bytes())
+		w.bytes(hook.ProgramId.Bytes())
+		entries = append(entries, extensionEntry{EXTENSION_TYPE_TRANSFER_HOOK, w.data})
+	}
+	return entries
+}
+
+func encodeAccountExtensions(extensions *AccountExtensions) []extensionEntry {
+	var entries []extensionEntry
+	if extensions.WithheldAmount != nil {
+		entries = append(entries, extensionEntry{EXTENSION_TYPE_TRANSFER_FEE_AMOUNT, binary.LittleEndian.AppendUint64(nil, *extensions.WithheldAmount)})
+	}
+	if extensions.NonTransferable {
+		entries = append(entries, extensionEntry{EXTENSION_TYPE_NON_TRANSFERABLE_ACCOUNT, nil})
+	}
+	if extensions.TransferHookTransferring != nil {
+		transferring := []byte{0}
+		if *extensions.TransferHookTransferring {
+			transferring[0] = 1
+		}
+		entries = append(entries, extensionEntry{EXTENSION_TYPE_TRANSFER_HOOK_ACCOUNT, transferring})
+	}
+	return entries
+}
+
+type extensionEntry struct {
+	kind  uint16
+	value []byte
+}
+
+// readExtensions returns the extensions after a base layout of baseSize
+// bytes, none for a plain Token account or mint.
+func readExtensions(data []byte, baseSize int, accountType uint8) ([]extensionEntry, error) {
+	if len(data) <= baseSize {
+		return nil, nil
+	}
+	if len(data) <= SPL_ACCOUNT_SIZE {
+		return nil, fmt.Errorf("%w: %d bytes is neither a base nor an extended account", ErrInvalidTokenExtension, len(data))
+	}
+	if data[SPL_ACCOUNT_SIZE] != accountType {
+		return nil, fmt.Errorf("%w: account type %d, want %d", ErrInvalidTokenExtension, data[SPL_ACCOUNT_SIZE], accountType)
+	}
+	var entries []extensionEntry
+	for offset := SPL_ACCOUNT_SIZE + 1; offset+4 <= len(data); {
+		kind := binary.LittleEndian.Uint16(data[offset:])
+		length := int(binary.LittleEndian.Uint16(data[offset+2:]))
+		if kind == EXTENSION_TYPE_UNINITIALIZED {
+			break
+		}
+		offset += 4
+		if offset+length > len(data) {
+			return nil, fmt.Errorf("%w: extension %d overruns the account", ErrInvalidTokenExtension, kind)
+		}
+		entries = append(entries, extensionEntry{kind, data[offset : offset+length]})
+		offset += length
+	}
+	return entries, nil
+}
+
+// writeExtensions appends entries to base, padded to SPL_ACCOUNT_SIZE and
+// tagged with accountType; base is returned as is without entries.
+func writeExtensions(base []byte, accountType uint8, entries []extensionEntry) []byte {
+	if len(entries) == 0 {
+		return base
+	}
+	data := make([]byte, SPL_ACCOUNT_SIZE+1, SPL_ACCOUNT_SIZE+1+len(entries)*4)
+	copy(data, base)
+	data[SPL_ACCOUNT_SIZE] = accountType
+	for _, entry := range entries {
+		data = binary.LittleEndian.AppendUint16(data, entry.kind)
+		data = binary.LittleEndian.AppendUint16(data, uint16(len(entry.value)))
+		data = append(data, entry.value...)
+	}
+	return data
+}
+
+func checkExtensionSize(entry extensionEntry, size int) error {
+	if len(entry.value) != size {
+		return fmt.Errorf("%w: extension %d has %d bytes, want %d", ErrInvalidTokenExtension, entry.kind, len(entry.value), size)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package raydium
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeMintExtensions(t *testing.T) {
+	// A mint as Token-2022 lays it out: the base mint padded to the account
+	// size, the account type, then a transfer fee config and a non-transferable
+	// marker.
+	data := make([]byte, SPL_ACCOUNT_SIZE+1)
+	data[44] = 6
+	data[SPL_ACCOUNT_SIZE] = TOKEN_2022_ACCOUNT_TYPE_MINT
+	data = binary.LittleEndian.AppendUint16(data, EXTENSION_TYPE_TRANSFER_FEE_CONFIG)
+	data = binary.LittleEndian.AppendUint16(data, TRANSFER_FEE_CONFIG_SIZE)
+	config := make([]byte, TRANSFER_FEE_CONFIG_SIZE)
+	copy(config, testPublicKey("fee authority").Bytes())
+	binary.LittleEndian.PutUint64(config[64:], 77)
+	binary.LittleEndian.PutUint64(config[72:], 500)
+	binary.LittleEndian.PutUint64(config[80:], 1_000)
+	binary.LittleEndian.PutUint16(config[88:], 10)
+	binary.LittleEndian.PutUint64(config[90:], 600)
+	binary.LittleEndian.PutUint64(config[98:], 5_000)
+	binary.LittleEndian.PutUint16(config[106:], 150)
+	data = append(data, config...)
+	data = binary.LittleEndian.AppendUint16(data, EXTENSION_TYPE_NON_TRANSFERABLE)
+	data = binary.LittleEndian.AppendUint16(data, 0)
+
+	mint, err := NewSplMintFromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &TransferFeeConfig{
+		TransferFeeConfigAuthority: testPublicKey("fee authority"),
+		WithheldAmount:             77,
+		OlderTransferFee:           TransferFee{Epoch: 500, MaximumFee: 1_000, TransferFeeBasisPoints: 10},
+		NewerTransferFee:           TransferFee{Epoch: 600, MaximumFee: 5_000, TransferFeeBasisPoints: 150},
+	}
+	if mint.Decimals != 6 || !reflect.DeepEqual(mint.Extensions.TransferFeeConfig, want) || !mint.Extensions.NonTransferable {
+		t.Errorf("got %+v with extensions %+v", mint, mint.Extensions)
+	}
+	for epoch, bps := range map[uint64]uint16{0: 10, 599: 10, 600: 150, 700: 150} {
+		if got := mint.Extensions.TransferFee(epoch).TransferFeeBasisPoints; got != bps {
+			t.Errorf("epoch %d: got %d basis points, want %d", epoch, got, bps)
+		}
+	}
+	if (*MintExtensions)(nil).TransferFee(0) != nil || (&MintExtensions{}).TransferFee(0) != nil {
+		t.Error("expected no transfer fee without a config")
+	}
+}
+
+func TestTokenExtensionsRoundTrip(t *testing.T) {
+	withheld, transferring := uint64(42), true
+	cases := map[string]interface {
+		MarshalBinary() ([]byte, error)
+	}{
+		"mint": &SplMint{
+			Decimals:      9,
+			IsInitialized: 1,
+			Extensions: MintExtensions{
+				TransferFeeConfig: &TransferFeeConfig{
+					WithdrawWithheldAuthority: testPublicKey("withdraw"),
+					NewerTransferFee:          TransferFee{Epoch: 3, MaximumFee: 9, TransferFeeBasisPoints: 25},
+				},
+				InterestBearingConfig: &InterestBearingConfig{
+					RateAuthority:           testPublicKey("rate"),
+					InitializationTimestamp: 1_700_000_000,
+					PreUpdateAverageRate:    -20,
+					LastUpdateTimestamp:     1_700_000_500,
+					CurrentRate:             35,
+				},
+				TransferHook:    &TransferHook{Authority: testPublicKey("hook authority"), ProgramId: testPublicKey("hook")},
+				NonTransferable: true,
+			},
+		},
+		"account": &SplAccount{
+			Mint:       testPublicKey("mint"),
+			Amount:     1_000,
+			State:      TOKEN_ACCOUNT_STATE_INITIALIZED,
+			Extensions: AccountExtensions{WithheldAmount: &withheld, NonTransferable: true, TransferHookTransferring: &transferring},
+		},
+		"plain mint":    &SplMint{Decimals: 6, IsInitialized: 1},
+		"plain account": &SplAccount{Mint: testPublicKey("mint"), Amount: 7},
+	}
+	for name, layout := range cases {
+		data, err := layout.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var decoded interface{ MarshalBinary() ([]byte, error) }
+		switch layout.(type) {
+		case *SplMint:
+			decoded, err = NewSplMintFromBytes(data)
+			if want := SPL_MINT_SIZE; name == "plain mint" && len(data) != want {
+				t.Errorf("%s: got %d bytes, want %d", name, len(data), want)
+			}
+		case *SplAccount:
+			decoded, err = NewSplAccountFromBytes(data)
+			if want := SPL_ACCOUNT_SIZE; name == "plain account" && len(data) != want {
+				t.Errorf("%s: got %d bytes, want %d", name, len(data), want)
+			}
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(decoded, layout) {
+			t.Errorf("%s: got %+v, want %+v", name, decoded, layout)
+		}
+	}
+}
+
+func TestDecodeInvalidTokenExtensions(t *testing.T) {
+	mint := func(edit func([]byte) []byte) []byte {
+		data := make([]byte, SPL_ACCOUNT_SIZE+1)
+		data[SPL_ACCOUNT_SIZE] = TOKEN_2022_ACCOUNT_TYPE_MINT
+		return edit(data)
+	}
+	cases := map[string][]byte{
+		"between layouts": make([]byte, SPL_MINT_SIZE+10),
+		"account type": mint(func(data []byte) []byte {
+			data[SPL_ACCOUNT_SIZE] = TOKEN_2022_ACCOUNT_TYPE_ACCOUNT
+			return data
+		}),
+		"overrun": mint(func(data []byte) []byte {
+			data = binary.LittleEndian.AppendUint16(data, EXTENSION_TYPE_TRANSFER_HOOK)
+			data = binary.LittleEndian.AppendUint16(data, TRANSFER_HOOK_SIZE)
+			return append(data, make([]byte, 10)...)
+		}),
+		"size": mint(func(data []byte) []byte {
+			data = binary.LittleEndian.AppendUint16(data, EXTENSION_TYPE_TRANSFER_HOOK)
+			data = binary.LittleEndian.AppendUint16(data, 32)
+			return append(data, make([]byte, 32)...)
+		}),
+	}
+	for name, data := range cases {
+		if _, err := NewSplMintFromBytes(data); !errors.Is(err, ErrInvalidTokenExtension) {
+			t.Errorf("%s: got %v, want ErrInvalidTokenExtension", name, err)
+		}
+	}
+
+	// Unknown extensions are skipped and zeroed space ends the list.
+	data := mint(func(data []byte) []byte {
+		data = binary.LittleEndian.AppendUint16(data, 18)
+		data = binary.LittleEndian.AppendUint16(data, 3)
+		return append(data, make([]byte, 3+20)...)
+	})
+	if decoded, err := NewSplMintFromBytes(data); err != nil || !reflect.DeepEqual(decoded.Extensions, MintExtensions{}) {
+		t.Errorf("got %+v, %v", decoded, err)
+	}
+}
+
+func TestTransferFee(t *testing.T) {
+	cases := []struct {
+		fee            TransferFee
+		pre, fee0, inv int64
+	}{
+		{TransferFee{MaximumFee: 5_000, TransferFeeBasisPoints: 100}, 10_000, 100, 102},
+		{TransferFee{MaximumFee: 5_000, TransferFeeBasisPoints: 100}, 1, 1, 1},
+		{TransferFee{MaximumFee: 5_000, TransferFeeBasisPoints: 100}, 1_000_000, 5_000, 5_000},
+		{TransferFee{MaximumFee: 5_000, TransferFeeBasisPoints: 0}, 1_000_000, 0, 0},
+		{TransferFee{MaximumFee: 5_000, TransferFeeBasisPoints: MAX_FEE_BASIS_POINTS}, 300, 300, 5_000},
+		{TransferFee{MaximumFee: 0, TransferFeeBasisPoints: 250}, 1_000_000, 0, 0},
+	}
+	for _, c := range cases {
+		amount := big.NewInt(c.pre)
+		if got := c.fee.Fee(amount); got.Int64() != c.fee0 {
+			t.Errorf("%+v: fee of %d: got %v, want %d", c.fee, c.pre, got, c.fee0)
+		}
+		if got := c.fee.InverseFee(amount); got.Int64() != c.inv {
+			t.Errorf("%+v: inverse fee of %d: got %v, want %d", c.fee, c.pre, got, c.inv)
+		}
+	}
+
+	// Sending an amount plus its inverse fee nets at least that amount.
+	fee := TransferFee{MaximumFee: 1 << 40, TransferFeeBasisPoints: 37}
+	for _, post := range []int64{1, 99, 12_345, 987_654_321} {
+		amount := big.NewInt(post)
+		pre := new(big.Int).Add(amount, fee.InverseFee(amount))
+		if net := new(big.Int).Sub(pre, fee.Fee(pre)); net.Cmp(amount) < 0 {
+			t.Errorf("%d: sending %v nets %v", post, pre, net)
+		}
+	}
+}
@@ -1,9 +1,44 @@
 package raydium
 
-import "github.com/gagliardetto/solana-go"
+import (
+	"context"
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+)
 
 type TokenAccount struct {
 	PublicKey   solana.PublicKey
 	ProgramId   solana.PublicKey
 	AccountInfo *SplAccount
 }
+
+// FetchTokenAccounts returns the Token and Token-2022 accounts owned by owner.
+func FetchTokenAccounts(ctx context.Context, fetcher AccountFetcher, owner solana.PublicKey) ([]*TokenAccount, error) {
+	var tokenAccounts []*TokenAccount
+	for _, programId := range []solana.PublicKey{TOKEN_PROGRAM_ID, TOKEN_2022_PROGRAM_ID} {
+		result, err := fetcher.GetTokenAccountsByOwner(ctx, owner, programId)
+		if err != nil {
+			return nil, err
+		}
+		for _, keyedAccount := range result {
+			account, err := NewSplAccountFromBytes(keyedAccount.Account.Data.GetBinary())
+			if err != nil {
+				return nil, fmt.Errorf("decode token account %v: %w", keyedAccount.Pubkey, err)
+			}
+			tokenAccounts = append(tokenAccounts, &TokenAccount{
+				PublicKey:   keyedAccount.Pubkey,
+				ProgramId:   programId,
+				AccountInfo: account,
+			})
+		}
+	}
+	return tokenAccounts, nil
+}
+
+// isTokenAccountData reports whether data is laid out as a token account
+// rather than a mint; Token-2022 accounts past the base size carry their
+// account type.
+func isTokenAccountData(data []byte) bool {
+	return len(data) == SPL_ACCOUNT_SIZE || len(data) > SPL_ACCOUNT_SIZE && data[SPL_ACCOUNT_SIZE] == TOKEN_2022_ACCOUNT_TYPE_ACCOUNT
+}
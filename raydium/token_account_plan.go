@@ -0,0 +1,199 @@
+package raydium
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/system"
+)
+
+// SplAccount.State of an account that is neither uninitialized nor frozen.
+const TOKEN_ACCOUNT_STATE_INITIALIZED = 1
+
+// WrapSolMode chooses the account PlanTokenAccount wraps SOL into.
+type WrapSolMode int
+
+const (
+	// WRAP_SOL_ASSOCIATED funds the owner's associated account and syncs it.
+	WRAP_SOL_ASSOCIATED WrapSolMode = iota
+	// WRAP_SOL_SEEDED creates a throwaway account derived from the owner and
+	// a seed, closed once the transaction is done with it.
+	WRAP_SOL_SEEDED
+)
+
+var ErrInsufficientTokenBalance = errors.New("no token account holds the amount")
+
+// TokenAccountRequest asks for an account of Mint that Owner can use in a
+// transaction.
+type TokenAccountRequest struct {
+	Owner solana.PublicKey
+	// Payer funds the accounts created; Owner when left zero.
+	Payer          solana.PublicKey
+	Mint           solana.PublicKey
+	TokenProgramId solana.PublicKey
+	// Amount is what the transaction spends from the account, zero for an
+	// account that only receives.
+	Amount uint64
+	// AssociatedOnly ignores every account but the owner's associated one.
+	AssociatedOnly bool
+	WrapSol        WrapSolMode
+	// Seed and RentExemptLamports, the rent of an SPL_ACCOUNT_SIZE account,
+	// are required by WRAP_SOL_SEEDED.
+	Seed               string
+	RentExemptLamports uint64
+}
+
+// TokenAccountPlan is the account to use and the instructions to run before
+// and after the instructions using it.
+type TokenAccountPlan struct {
+	Account solana.PublicKey
+	Setup   []solana.Instruction
+	Cleanup []solana.Instruction
+}
+
+// PlanTokenAccount picks the account of tokenAccounts, the owner's accounts
+// as returned by FetchTokenAccounts, that satisfies request, or plans the
+// creation of the owner's associated account.
+//
+// An account spending Amount must already hold it, and the associated one
+// is preferred over the largest. A receiving account is the associated one
+// if it exists or AssociatedOnly is set, otherwise the largest.
+//
+// Wrapped SOL is funded from the owner's lamports instead. A seeded account
+// or an associated account the plan creates is closed in Cleanup, unwrapping
+// what is left; an existing associated account is topped up and kept.
+func PlanTokenAccount(tokenAccounts []*TokenAccount, request *TokenAccountRequest) (*TokenAccountPlan, error) {
+	if err := checkTokenProgram(request.TokenProgramId); err != nil {
+		return nil, err
+	}
+	if err := checkInstructionAccounts(map[string]solana.PublicKey{
+		"owner": request.Owner,
+		"mint":  request.Mint,
+	}); err != nil {
+		return nil, err
+	}
+	payer := request.Payer
+	if payer.IsZero() {
+		payer = request.Owner
+	}
+	associated, err := GetAssociatedTokenAddress(request.Owner, request.Mint, request.TokenProgramId)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []*TokenAccount
+	var existing *TokenAccount
+	for _, account := range tokenAccounts {
+		info := account.AccountInfo
+		if !account.ProgramId.Equals(request.TokenProgramId) || info.State != TOKEN_ACCOUNT_STATE_INITIALIZED ||
+			!bytes.Equal(info.Mint[:], request.Mint[:]) || !bytes.Equal(info.Owner[:], request.Owner[:]) {
+			continue
+		}
+		if account.PublicKey.Equals(associated) {
+			existing = account
+		} else if !request.AssociatedOnly {
+			candidates = append(candidates, account)
+		}
+	}
+
+	if IsWrappedSol(request.Mint, request.TokenProgramId) {
+		if request.WrapSol == WRAP_SOL_SEEDED {
+			return planSeededWrappedSol(request, payer)
+		}
+		return planAssociatedWrappedSol(request, payer, associated, existing)
+	}
+
+	if existing != nil && existing.AccountInfo.Amount >= request.Amount {
+		return &TokenAccountPlan{Account: associated}, nil
+	}
+	var best *TokenAccount
+	for _, account := range candidates {
+		if account.AccountInfo.Amount < request.Amount {
+			continue
+		}
+		if best == nil || account.AccountInfo.Amount > best.AccountInfo.Amount ||
+			account.AccountInfo.Amount == best.AccountInfo.Amount && bytes.Compare(account.PublicKey[:], best.PublicKey[:]) < 0 {
+			best = account
+		}
+	}
+	switch {
+	case best != nil:
+		return &TokenAccountPlan{Account: best.PublicKey}, nil
+	case request.Amount > 0:
+		return nil, fmt.Errorf("%w: %d of %v", ErrInsufficientTokenBalance, request.Amount, request.Mint)
+	}
+	create, err := NewCreateAssociatedTokenAccountIdempotentInstruction(payer, request.Owner, request.Mint, request.TokenProgramId)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenAccountPlan{Account: associated, Setup: []solana.Instruction{create}}, nil
+}
+
+func planAssociatedWrappedSol(request *TokenAccountRequest, payer, associated solana.PublicKey, existing *TokenAccount) (*TokenAccountPlan, error) {
+	plan := &TokenAccountPlan{Account: associated}
+	lamports := request.Amount
+	if existing == nil {
+		create, err := NewCreateAssociatedTokenAccountIdempotentInstruction(payer, request.Owner, request.Mint, request.TokenProgramId)
+		if err != nil {
+			return nil, err
+		}
+		plan.Setup = append(plan.Setup, create)
+		plan.Cleanup = append(plan.Cleanup, NewCloseAccountInstruction(associated, request.Owner, request.Owner, request.TokenProgramId))
+	} else if existing.AccountInfo.Amount >= lamports {
+		lamports = 0
+	} else {
+		lamports -= existing.AccountInfo.Amount
+	}
+	if lamports > 0 {
+		plan.Setup = append(plan.Setup,
+			system.NewTransferInstruction(lamports, request.Owner, associated).Build(),
+			NewSyncNativeInstruction(associated, request.TokenProgramId),
+		)
+	}
+	return plan, nil
+}
+
+func planSeededWrappedSol(request *TokenAccountRequest, payer solana.PublicKey) (*TokenAccountPlan, error) {
+	if request.Seed == "" || request.RentExemptLamports == 0 {
+		return nil, errors.New("seeded wrapped SOL needs a seed and the account rent")
+	}
+	account, err := solana.CreateWithSeed(request.Owner, request.Seed, request.TokenProgramId)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenAccountPlan{
+		Account: account,
+		Setup: []solana.Instruction{
+			system.NewCreateAccountWithSeedInstruction(
+				request.Owner,
+				request.Seed,
+				request.RentExemptLamports+request.Amount,
+				uint64(SPL_ACCOUNT_SIZE),
+				request.TokenProgramId,
+				payer,
+				account,
+				request.Owner,
+			).Build(),
+			NewInitializeAccount3Instruction(account, request.Mint, request.Owner, request.TokenProgramId),
+		},
+		Cleanup: []solana.Instruction{
+			NewCloseAccountInstruction(account, request.Owner, request.Owner, request.TokenProgramId),
+		},
+	}, nil
+}
+
+// WithTokenAccounts surrounds instructions with the setup and cleanup of
+// plans, in order.
+func WithTokenAccounts(instructions []solana.Instruction, plans ...*TokenAccountPlan) []solana.Instruction {
+	var all []solana.Instruction
+	for _, plan := range plans {
+		all = append(all, plan.Setup...)
+	}
+	all = append(all, instructions...)
+	for _, plan := range plans {
+		all = append(all, plan.Cleanup...)
+	}
+	return all
+}
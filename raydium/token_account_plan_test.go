@@ -0,0 +1,185 @@
+package raydium
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+func TestPlanTokenAccount(t *testing.T) {
+	owner, payer := testPublicKey("owner"), testPublicKey("payer")
+	usdc, pyusd := testPublicKey("usdc"), testPublicKey("pyusd")
+	// Spelled out so that a wrong WSOL_2022_MINT fails the test.
+	wsol2022 := solana.MustPublicKeyFromBase58("9pan9bMn5HatX4EJdBwg9VgCa7Uz5HL8N1m5D3NdXejP")
+	associated := func(mint, programId solana.PublicKey) solana.PublicKey {
+		t.Helper()
+		account, err := GetAssociatedTokenAddress(owner, mint, programId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return account
+	}
+	tokenAccount := func(key, programId, mint solana.PublicKey, amount uint64, state uint8) *TokenAccount {
+		return &TokenAccount{
+			PublicKey:   key,
+			ProgramId:   programId,
+			AccountInfo: &SplAccount{Mint: mint, Owner: owner, Amount: amount, State: state},
+		}
+	}
+	usdcAssociated := associated(usdc, TOKEN_PROGRAM_ID)
+	tokenAccounts := []*TokenAccount{
+		tokenAccount(usdcAssociated, TOKEN_PROGRAM_ID, usdc, 100, TOKEN_ACCOUNT_STATE_INITIALIZED),
+		tokenAccount(testPublicKey("usdc 1"), TOKEN_PROGRAM_ID, usdc, 500, TOKEN_ACCOUNT_STATE_INITIALIZED),
+		tokenAccount(testPublicKey("usdc 2"), TOKEN_PROGRAM_ID, usdc, 300, TOKEN_ACCOUNT_STATE_INITIALIZED),
+		tokenAccount(testPublicKey("frozen usdc"), TOKEN_PROGRAM_ID, usdc, 1_000, 2),
+		tokenAccount(testPublicKey("pyusd"), TOKEN_2022_PROGRAM_ID, pyusd, 50, TOKEN_ACCOUNT_STATE_INITIALIZED),
+	}
+
+	for _, test := range []struct {
+		name    string
+		request TokenAccountRequest
+		want    solana.PublicKey
+		setup   int
+		err     error
+	}{
+		{"associated holds the amount", TokenAccountRequest{Mint: usdc, Amount: 100}, usdcAssociated, 0, nil},
+		{"largest holding the amount", TokenAccountRequest{Mint: usdc, Amount: 200}, testPublicKey("usdc 1"), 0, nil},
+		{"frozen account skipped", TokenAccountRequest{Mint: usdc, Amount: 600}, solana.PublicKey{}, 0, ErrInsufficientTokenBalance},
+		{"associated only", TokenAccountRequest{Mint: usdc, Amount: 200, AssociatedOnly: true}, solana.PublicKey{}, 0, ErrInsufficientTokenBalance},
+		{"receive into associated", TokenAccountRequest{Mint: usdc}, usdcAssociated, 0, nil},
+		{"receive into Token-2022 account", TokenAccountRequest{Mint: pyusd, TokenProgramId: TOKEN_2022_PROGRAM_ID}, testPublicKey("pyusd"), 0, nil},
+		{"create Token-2022 associated", TokenAccountRequest{Mint: pyusd, TokenProgramId: TOKEN_2022_PROGRAM_ID, AssociatedOnly: true}, associated(pyusd, TOKEN_2022_PROGRAM_ID), 1, nil},
+		{"program mismatch", TokenAccountRequest{Mint: pyusd, Amount: 10}, solana.PublicKey{}, 0, ErrInsufficientTokenBalance},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			request := test.request
+			request.Owner = owner
+			if request.TokenProgramId.IsZero() {
+				request.TokenProgramId = TOKEN_PROGRAM_ID
+			}
+			plan, err := PlanTokenAccount(tokenAccounts, &request)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+			if err != nil {
+				return
+			}
+			if !plan.Account.Equals(test.want) || len(plan.Setup) != test.setup || len(plan.Cleanup) != 0 {
+				t.Errorf("got account %v with %d setup and %d cleanup instructions, want %v with %d setup", plan.Account, len(plan.Setup), len(plan.Cleanup), test.want, test.setup)
+			}
+		})
+	}
+
+	t.Run("create instruction", func(t *testing.T) {
+		plan, err := PlanTokenAccount(nil, &TokenAccountRequest{Owner: owner, Payer: payer, Mint: pyusd, TokenProgramId: TOKEN_2022_PROGRAM_ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(plan.Setup) != 1 {
+			t.Fatalf("got %d setup instructions, want 1", len(plan.Setup))
+		}
+		checkInstruction(t, plan.Setup[0], []byte{ASSOCIATED_TOKEN_INSTRUCTION_CREATE_IDEMPOTENT}, solana.AccountMetaSlice{
+			solana.Meta(payer).WRITE().SIGNER(),
+			solana.Meta(associated(pyusd, TOKEN_2022_PROGRAM_ID)).WRITE(),
+			solana.Meta(owner),
+			solana.Meta(pyusd),
+			solana.Meta(solana.SystemProgramID),
+			solana.Meta(TOKEN_2022_PROGRAM_ID),
+		})
+	})
+
+	t.Run("wrap into new associated account", func(t *testing.T) {
+		plan, err := PlanTokenAccount(tokenAccounts, &TokenAccountRequest{Owner: owner, Mint: WSOL_MINT, TokenProgramId: TOKEN_PROGRAM_ID, Amount: 1_000})
+		if err != nil {
+			t.Fatal(err)
+		}
+		account := associated(WSOL_MINT, TOKEN_PROGRAM_ID)
+		if !plan.Account.Equals(account) || len(plan.Setup) != 3 || len(plan.Cleanup) != 1 {
+			t.Fatalf("got %v with %d setup and %d cleanup instructions", plan.Account, len(plan.Setup), len(plan.Cleanup))
+		}
+		checkInstruction(t, plan.Setup[1], binary.LittleEndian.AppendUint64([]byte{2, 0, 0, 0}, 1_000), solana.AccountMetaSlice{
+			solana.Meta(owner).WRITE().SIGNER(),
+			solana.Meta(account).WRITE(),
+		})
+		checkInstruction(t, plan.Setup[2], []byte{TOKEN_INSTRUCTION_SYNC_NATIVE}, solana.AccountMetaSlice{
+			solana.Meta(account).WRITE(),
+		})
+		checkInstruction(t, plan.Cleanup[0], []byte{TOKEN_INSTRUCTION_CLOSE_ACCOUNT}, solana.AccountMetaSlice{
+			solana.Meta(account).WRITE(),
+			solana.Meta(owner).WRITE(),
+			solana.Meta(owner).SIGNER(),
+		})
+	})
+
+	t.Run("top up existing associated account", func(t *testing.T) {
+		account := associated(wsol2022, TOKEN_2022_PROGRAM_ID)
+		existing := append(tokenAccounts, tokenAccount(account, TOKEN_2022_PROGRAM_ID, wsol2022, 400, TOKEN_ACCOUNT_STATE_INITIALIZED))
+		plan, err := PlanTokenAccount(existing, &TokenAccountRequest{Owner: owner, Mint: wsol2022, TokenProgramId: TOKEN_2022_PROGRAM_ID, Amount: 1_000})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !plan.Account.Equals(account) || len(plan.Setup) != 2 || len(plan.Cleanup) != 0 {
+			t.Fatalf("got %v with %d setup and %d cleanup instructions", plan.Account, len(plan.Setup), len(plan.Cleanup))
+		}
+		if data, _ := plan.Setup[0].Data(); binary.LittleEndian.Uint64(data[4:]) != 600 {
+			t.Errorf("got transfer %v, want 600 lamports", data)
+		}
+		if !plan.Setup[1].ProgramID().Equals(TOKEN_2022_PROGRAM_ID) {
+			t.Errorf("sync native program: got %v", plan.Setup[1].ProgramID())
+		}
+	})
+
+	t.Run("wrap into seeded account", func(t *testing.T) {
+		request := &TokenAccountRequest{Owner: owner, Payer: payer, Mint: WSOL_MINT, TokenProgramId: TOKEN_PROGRAM_ID, Amount: 1_000, WrapSol: WRAP_SOL_SEEDED, Seed: "seed"}
+		if _, err := PlanTokenAccount(nil, request); err == nil {
+			t.Error("planned a seeded account without its rent")
+		}
+		request.RentExemptLamports = 2_039_280
+		plan, err := PlanTokenAccount(nil, request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		account, err := solana.CreateWithSeed(owner, "seed", TOKEN_PROGRAM_ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !plan.Account.Equals(account) || len(plan.Setup) != 2 || len(plan.Cleanup) != 1 {
+			t.Fatalf("got %v with %d setup and %d cleanup instructions", plan.Account, len(plan.Setup), len(plan.Cleanup))
+		}
+		create := plan.Setup[0].Accounts()
+		if !create[0].PublicKey.Equals(payer) || !create[1].PublicKey.Equals(account) {
+			t.Errorf("create accounts: got %v", create)
+		}
+		checkInstruction(t, plan.Setup[1], append([]byte{TOKEN_INSTRUCTION_INITIALIZE_ACCOUNT3}, owner.Bytes()...), solana.AccountMetaSlice{
+			solana.Meta(account).WRITE(),
+			solana.Meta(WSOL_MINT),
+		})
+	})
+
+	t.Run("unknown token program", func(t *testing.T) {
+		if _, err := PlanTokenAccount(nil, &TokenAccountRequest{Owner: owner, Mint: usdc, TokenProgramId: testPublicKey("program")}); err == nil {
+			t.Error("accepted an unknown token program")
+		}
+	})
+}
+
+func TestWithTokenAccounts(t *testing.T) {
+	instruction := func(name string) solana.Instruction {
+		return solana.NewInstruction(testPublicKey(name), nil, nil)
+	}
+	got := WithTokenAccounts([]solana.Instruction{instruction("swap")},
+		&TokenAccountPlan{Setup: []solana.Instruction{instruction("create in")}, Cleanup: []solana.Instruction{instruction("close in")}},
+		&TokenAccountPlan{Setup: []solana.Instruction{instruction("create out")}},
+	)
+	want := []string{"create in", "create out", "swap", "close in"}
+	if len(got) != len(want) {
+		t.Fatalf("got %d instructions, want %d", len(got), len(want))
+	}
+	for i, name := range want {
+		if !got[i].ProgramID().Equals(testPublicKey(name)) {
+			t.Errorf("instruction %d: got %v, want %s", i, got[i].ProgramID(), name)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package raydium
+
+import (
+	"errors"
+	"math/big"
+)
+
+var (
+	ErrU128Overflow = errors.New("value does not fit in u128")
+	ErrI128Overflow = errors.New("value does not fit in i128")
+)
+
+var (
+	two128   = new(big.Int).Lsh(big.NewInt(1), 128)
+	MAX_U128 = new(big.Int).Sub(two128, big.NewInt(1))
+	MAX_I128 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 127), big.NewInt(1))
+	MIN_I128 = new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), 127))
+)
+
+// U128FromBytes decodes a little-endian unsigned integer. Taking an array
+// keeps a short slice of account data from reaching it.
+func U128FromBytes(b [16]byte) *big.Int {
+	var be [16]byte
+	for i := 0; i < 16; i++ {
+		be[15-i] = b[i]
+	}
+	return new(big.Int).SetBytes(be[:])
+}
+
+// I128FromBytes decodes a little-endian two's complement integer.
+func I128FromBytes(b [16]byte) *big.Int {
+	v := U128FromBytes(b)
+	if b[15]&0x80 != 0 {
+		v.Sub(v, two128)
+	}
+	return v
+}
+
+// PutU128 writes v into dst[:16] as a little-endian unsigned integer.
+func PutU128(dst []byte, v *big.Int) error {
+	if v == nil {
+		v = new(big.Int)
+	}
+	if v.Sign() < 0 || v.Cmp(MAX_U128) > 0 {
+		return ErrU128Overflow
+	}
+	putLittleEndian128(dst, v)
+	return nil
+}
+
+// PutI128 writes v into dst[:16] as a little-endian two's complement integer.
+func PutI128(dst []byte, v *big.Int) error {
+	if v == nil {
+		v = new(big.Int)
+	}
+	if v.Cmp(MIN_I128) < 0 || v.Cmp(MAX_I128) > 0 {
+		return ErrI128Overflow
+	}
+	if v.Sign() < 0 {
+		v = new(big.Int).Add(v, two128)
+	}
+	putLittleEndian128(dst, v)
+	return nil
+}
+
+func putLittleEndian128(dst []byte, v *big.Int) {
+	var be [16]byte
+	v.FillBytes(be[:])
+	for i := 0; i < 16; i++ {
+		dst[i] = be[15-i]
+	}
+}
+
+func U128ToBytes(v *big.Int) ([]byte, error) {
+	b := make([]byte, 16)
+	if err := PutU128(b, v); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func I128ToBytes(v *big.Int) ([]byte, error) {
+	b := make([]byte, 16)
+	if err := PutI128(b, v); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// wrappingSubU128 is a - b modulo 2^128, like u128::wrapping_sub.
+func wrappingSubU128(a, b *big.Int) *big.Int {
+	return new(big.Int).Mod(new(big.Int).Sub(a, b), two128)
+}
@@ -0,0 +1,90 @@
+package raydium
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestU128FromBytesDoesNotMutate(t *testing.T) {
+	data := [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	original := data
+
+	first := U128FromBytes(data)
+	second := U128FromBytes(data)
+	if data != original {
+		t.Fatalf("input mutated: %v", data)
+	}
+	if first.Cmp(second) != 0 {
+		t.Fatalf("decoding twice differs: %v != %v", first, second)
+	}
+	want, _ := new(big.Int).SetString("100f0e0d0c0b0a090807060504030201", 16)
+	if first.Cmp(want) != 0 {
+		t.Errorf("got %x, want %x", first, want)
+	}
+}
+
+func TestU128RoundTrip(t *testing.T) {
+	for _, v := range []*big.Int{big.NewInt(0), big.NewInt(1), new(big.Int).Lsh(big.NewInt(1), 64), MAX_U128} {
+		b, err := U128ToBytes(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := U128FromBytes([16]byte(b)); got.Cmp(v) != 0 {
+			t.Errorf("round trip %v: got %v", v, got)
+		}
+	}
+	if _, err := U128ToBytes(new(big.Int).Add(MAX_U128, big.NewInt(1))); !errors.Is(err, ErrU128Overflow) {
+		t.Errorf("got %v, want ErrU128Overflow", err)
+	}
+	if _, err := U128ToBytes(big.NewInt(-1)); !errors.Is(err, ErrU128Overflow) {
+		t.Errorf("got %v, want ErrU128Overflow", err)
+	}
+}
+
+func TestI128RoundTrip(t *testing.T) {
+	for _, v := range []*big.Int{big.NewInt(0), big.NewInt(-1), big.NewInt(-123456789), MIN_I128, MAX_I128} {
+		b, err := I128ToBytes(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := I128FromBytes([16]byte(b)); got.Cmp(v) != 0 {
+			t.Errorf("round trip %v: got %v", v, got)
+		}
+	}
+
+	minusOne := [16]byte(bytes.Repeat([]byte{0xff}, 16))
+	if got := I128FromBytes(minusOne); got.Cmp(big.NewInt(-1)) != 0 {
+		t.Errorf("got %v, want -1", got)
+	}
+	if _, err := I128ToBytes(new(big.Int).Add(MAX_I128, big.NewInt(1))); !errors.Is(err, ErrI128Overflow) {
+		t.Errorf("got %v, want ErrI128Overflow", err)
+	}
+}
+
+func TestNewPoolInfoLayoutFromBytesDoesNotMutate(t *testing.T) {
+	data := make([]byte, POOL_STATE_SIZE)
+	copy(data, POOL_STATE_DISCRIMINATOR[:])
+	data[237] = 0x2a // liquidity
+	data[253+8] = 1  // sqrt price = 2^64
+	original := append([]byte(nil), data...)
+
+	first, err := NewPoolInfoLayoutFromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewPoolInfoLayoutFromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, original) {
+		t.Fatal("input mutated")
+	}
+	if first.Liquidity.Int64() != 42 || second.Liquidity.Int64() != 42 {
+		t.Errorf("liquidity: got %v and %v, want 42", first.Liquidity, second.Liquidity)
+	}
+	if first.SqrtPriceX64.Cmp(new(big.Int).Lsh(big.NewInt(1), 64)) != 0 || first.SqrtPriceX64.Cmp(second.SqrtPriceX64) != 0 {
+		t.Errorf("sqrt price: got %v and %v", first.SqrtPriceX64, second.SqrtPriceX64)
+	}
+}